@@ -0,0 +1,131 @@
+// Command migrate applies the schema migrations embedded from the migrations
+// directory.
+//
+//	DATABASE_URL=postgres://... migrate up
+//	DATABASE_URL=postgres://... migrate down [steps]
+//	DATABASE_URL=postgres://... migrate status
+//	DATABASE_URL=postgres://... migrate baseline
+//	DATABASE_URL=sqlite:orders.db migrate up
+//
+// up applies every pending migration, down reverts the last steps applied
+// ones, one by default. A sqlite: url gets the schema translated for SQLite.
+// The database is the one of the service configuration, see the config
+// package, so -config and -database-url go before the command.
+//
+// up refuses a database that has tables but no applied migration, such as
+// one created from the former init.sql. The first migration is that schema,
+// baseline records it as applied without running it, once it checked the
+// database has the same tables. Such a database still holds card numbers in
+// payment_methods, which 0013_drop_card_number refuses to drop, so it is
+// moved over with:
+//
+//	DATABASE_URL=postgres://... migrate baseline
+//	DATABASE_URL=postgres://... migrate up              # stops at 0013_drop_card_number
+//	DATABASE_URL=postgres://... CARD_VAULT_KEY=... tokenize-cards
+//	DATABASE_URL=postgres://... migrate up
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/migrate"
+	"github.com/mathesukkj/goecommerce/order-service/migrations"
+)
+
+func main() {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	cfg, err := config.LoadSettings(fs, os.Args[1:], os.Getenv, "database.url")
+	if err != nil {
+		log.Fatalf("migrate: %s", err)
+	}
+
+	args := fs.Args()
+	if len(args) < 1 {
+		log.Fatal("migrate: usage: migrate [-config file] [-database-url url] up | down [steps] | status | baseline")
+	}
+
+	db, err := database.Open(cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("migrate: connecting to database: %s", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.For(database.DialectOf(db)))
+	if err != nil {
+		log.Fatalf("migrate: %s", err)
+	}
+
+	// an interrupt cancels the migration in flight, which is rolled back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("migrate: applied %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate: %s", err)
+		}
+		log.Printf("migrate: %d migrations applied", len(applied))
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				log.Fatalf("migrate: invalid steps %q", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			log.Printf("migrate: reverted %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate: %s", err)
+		}
+		log.Printf("migrate: %d migrations reverted", len(reverted))
+
+	case "baseline":
+		baselined, err := migrator.Baseline(ctx)
+		if err != nil {
+			log.Fatalf("migrate: %s", err)
+		}
+		log.Printf("migrate: recorded %d_%s as applied", baselined.Version, baselined.Name)
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("migrate: %s", err)
+		}
+
+		applied := 0
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				applied++
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state += " (modified since)"
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+		if applied == 0 {
+			log.Print("migrate: no migrations applied")
+		}
+
+	default:
+		log.Fatalf("migrate: unknown command %q", args[0])
+	}
+}
@@ -0,0 +1,144 @@
+// Command order-service serves the order api.
+//
+//	order-service -config /etc/goecommerce/order-service.yaml
+//	DATABASE_URL=sqlite:orders.db JWT_SECRET=... order-service -addr :8080
+//
+// See the config package for every setting. The service refuses to start
+// while any of them is missing or invalid, and stops gracefully on an
+// interrupt: /readyz fails for the drain delay so load balancers stop sending
+// requests, then the requests in flight are let finish. Logs go to the
+// standard error in the format and from the level set by LOG_FORMAT and
+// LOG_LEVEL.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/email"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/health"
+	"github.com/mathesukkj/goecommerce/order-service/internal/jwtauth"
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/server"
+	"github.com/mathesukkj/goecommerce/order-service/internal/tracing"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+func main() {
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("order-service: %s", err)
+	}
+
+	// validated along with the configuration
+	logger, _ := cfg.Log.Logger(os.Stderr)
+	slog.SetDefault(logger)
+
+	jwtauth.SetSecret([]byte(cfg.Auth.JWTSecret))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Options())
+	if err != nil {
+		fatal("setting up tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("flushing spans", "error", err)
+		}
+	}()
+
+	keyring, err := fieldcrypt.LoadKeyfile(cfg.PII.Keyfile)
+	if err != nil {
+		fatal("loading PII keyfile", err)
+	}
+	fieldcrypt.SetKeyring(keyring)
+
+	db, err := database.Open(cfg.Database.URL)
+	if err != nil {
+		fatal("connecting to database", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	if err := metrics.RegisterDBStats(db.DB, "orders"); err != nil {
+		fatal("registering database metrics", err)
+	}
+
+	// validated along with the configuration
+	vaultKey, _ := vault.ParseKey(cfg.Payments.CardVaultKey)
+	cardVault, err := vault.NewLocalVault(db, vaultKey)
+	if err != nil {
+		fatal("opening card vault", err)
+	}
+
+	gateway, err := payment.New(cfg.Payments.Gateway)
+	if err != nil {
+		fatal("creating payment gateway", err)
+	}
+	if gateway.Provider() == payment.ProviderFake {
+		slog.Warn("payments go through the fake gateway, no card is charged")
+	}
+
+	var mail email.Sender
+	switch cfg.Mail.Sender {
+	case email.SenderLog:
+		slog.Warn("mail is logged instead of sent, password reset tokens included")
+		mail = email.NewLogSender(logger)
+	default:
+		mail = email.NewSMTPSender(cfg.Mail.SMTPAddr, cfg.Mail.From, cfg.Mail.Username, cfg.Mail.Password)
+	}
+
+	readiness := health.NewChecker(cfg.Server.HealthCheckTimeout)
+	srv := &http.Server{
+		Addr:    cfg.Server.Addr,
+		Handler: server.New(cfg, db, cardVault, gateway, mail, readiness),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// ListenAndServe returns as soon as Shutdown starts, main waits for the
+	// requests in flight to finish
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		// a second interrupt stops the service right away
+		stop()
+
+		readiness.Drain()
+		slog.Info("draining", "delay", cfg.Server.DrainDelay.String())
+		time.Sleep(cfg.Server.DrainDelay)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutting down", "error", err)
+		}
+	}()
+
+	slog.Info("listening", "addr", cfg.Server.Addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fatal("serving", err)
+	}
+	<-shutdown
+}
+
+// fatal logs err and exits, like log.Fatal through the configured logger.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
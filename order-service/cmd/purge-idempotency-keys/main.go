@@ -0,0 +1,47 @@
+// Command purge-idempotency-keys deletes the stored Idempotency-Key
+// responses past their 24 hour expiry, meant to run periodically.
+//
+//	DATABASE_URL=postgres://... purge-idempotency-keys
+//
+// Expired keys are already ignored by the api, purging only reclaims space.
+// The database is the one of the service configuration, see the config
+// package.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+)
+
+func main() {
+	fs := flag.NewFlagSet("purge-idempotency-keys", flag.ContinueOnError)
+	cfg, err := config.LoadSettings(fs, os.Args[1:], os.Getenv, "database.url")
+	if err != nil {
+		log.Fatalf("purge-idempotency-keys: %s", err)
+	}
+
+	db, err := database.Open(cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("purge-idempotency-keys: connecting to database: %s", err)
+	}
+	defer db.Close()
+
+	// an interrupt cancels the queries in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	purged, err := service.NewIdempotencyService(db).PurgeExpired(ctx)
+	if err != nil {
+		log.Fatalf("purge-idempotency-keys: %s", err)
+	}
+
+	log.Printf("purge-idempotency-keys: %d expired keys purged", purged)
+}
@@ -0,0 +1,66 @@
+// Command reencrypt rotates the PII columns to the current master key of the
+// keyfile, in small batches so the service can keep running.
+//
+// To rotate, add a new key version to the keyfile and make it the
+// current_version, roll the service out with it, then run:
+//
+//	DATABASE_URL=postgres://... reencrypt -pii-keyfile /etc/goecommerce/pii.json
+//
+// The database and keyfile are the ones of the service configuration, see
+// the config package.
+//
+// Once it reports no rows left, the previous key can be removed from the
+// keyfile. The same command encrypts rows written before encryption was
+// enabled.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+)
+
+func main() {
+	fs := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	batchSize := fs.Int("batch-size", 500, "rows re-encrypted per transaction")
+	pause := fs.Duration("pause", 100*time.Millisecond, "pause between batches")
+	cfg, err := config.LoadSettings(fs, os.Args[1:], os.Getenv, "database.url", "pii.keyfile")
+	if err != nil {
+		log.Fatalf("reencrypt: %s", err)
+	}
+	if *batchSize < 1 {
+		log.Fatal("reencrypt: -batch-size must be positive")
+	}
+
+	keyring, err := fieldcrypt.LoadKeyfile(cfg.PII.Keyfile)
+	if err != nil {
+		log.Fatalf("reencrypt: %s", err)
+	}
+	fieldcrypt.SetKeyring(keyring)
+
+	db, err := database.Open(cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("reencrypt: connecting to database: %s", err)
+	}
+	defer db.Close()
+
+	// an interrupt cancels the queries in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rotated, err := service.NewKeyRotationService(db).Rotate(ctx, *batchSize, *pause)
+	if err != nil {
+		log.Fatalf("reencrypt: %s after %d rows", err, rotated)
+	}
+
+	log.Printf("reencrypt: %d rows now on key version %d", rotated, keyring.CurrentVersion())
+}
@@ -0,0 +1,51 @@
+// Command replay-payment-events applies stored payment provider webhooks
+// again, after a bug fix or an outage left some of them unapplied.
+//
+//	DATABASE_URL=postgres://... replay-payment-events -provider fake -since 24h
+//
+// By default only events that failed to apply are replayed, -all replays
+// every event in the window. Applying an event twice has no effect. The
+// database is the one of the service configuration, see the config package.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+)
+
+func main() {
+	fs := flag.NewFlagSet("replay-payment-events", flag.ContinueOnError)
+	provider := fs.String("provider", "", "only replay events of this provider")
+	since := fs.Duration("since", 24*time.Hour, "replay events received within this window")
+	all := fs.Bool("all", false, "also replay events already applied")
+	cfg, err := config.LoadSettings(fs, os.Args[1:], os.Getenv, "database.url")
+	if err != nil {
+		log.Fatalf("replay-payment-events: %s", err)
+	}
+
+	db, err := database.Open(cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("replay-payment-events: connecting to database: %s", err)
+	}
+	defer db.Close()
+
+	// an interrupt cancels the queries in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	replayed, err := service.NewPaymentEventService(db).ReplayEvents(ctx, *provider, time.Now().Add(-*since), *all)
+	if err != nil {
+		log.Fatalf("replay-payment-events: %d events replayed, failures:\n%s", replayed, err)
+	}
+
+	log.Printf("replay-payment-events: %d events replayed", replayed)
+}
@@ -0,0 +1,62 @@
+// Command tokenize-cards moves the card numbers payment methods stored before
+// the card vault into it, in small batches so the service can keep running.
+//
+//	DATABASE_URL=postgres://... CARD_VAULT_KEY=... tokenize-cards
+//
+// It runs on a database migrated up to 0012_search_indexes, before
+// 0013_drop_card_number drops the column they are read from, see cmd/migrate.
+// The database and card vault key are the ones of the service configuration,
+// see the config package.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+func main() {
+	fs := flag.NewFlagSet("tokenize-cards", flag.ContinueOnError)
+	batchSize := fs.Int("batch-size", 500, "payment methods tokenized per transaction")
+	pause := fs.Duration("pause", 100*time.Millisecond, "pause between batches")
+	cfg, err := config.LoadSettings(fs, os.Args[1:], os.Getenv, "database.url", "payments.card_vault_key")
+	if err != nil {
+		log.Fatalf("tokenize-cards: %s", err)
+	}
+	if *batchSize < 1 {
+		log.Fatal("tokenize-cards: -batch-size must be positive")
+	}
+
+	db, err := database.Open(cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("tokenize-cards: connecting to database: %s", err)
+	}
+	defer db.Close()
+
+	// validated along with the configuration
+	key, _ := vault.ParseKey(cfg.Payments.CardVaultKey)
+	cardVault, err := vault.NewLocalVault(db, key)
+	if err != nil {
+		log.Fatalf("tokenize-cards: %s", err)
+	}
+
+	// an interrupt cancels the queries in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tokenized, err := service.NewCardTokenizationService(db, cardVault).Tokenize(ctx, *batchSize, *pause)
+	if err != nil {
+		log.Fatalf("tokenize-cards: %s after %d payment methods", err, tokenized)
+	}
+
+	log.Printf("tokenize-cards: %d payment methods moved to the card vault", tokenized)
+}
@@ -0,0 +1,122 @@
+// Package card holds the payment card rules shared by payload validation and
+// the payment method service.
+package card
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Brand string
+
+const (
+	BrandVisa       Brand = "visa"
+	BrandMastercard Brand = "mastercard"
+	BrandAmex       Brand = "amex"
+	BrandDiscover   Brand = "discover"
+	BrandDiners     Brand = "diners"
+	BrandJCB        Brand = "jcb"
+	BrandUnknown    Brand = ""
+)
+
+var ErrInvalidExpiry = errors.New("expiry must be in the MM/YY format")
+
+// Normalize strips the spaces and dashes clients commonly use to group the
+// digits of a card number.
+func Normalize(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+// Valid reports whether number is made of 12 to 19 digits and passes the
+// Luhn checksum.
+func Valid(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// DetectBrand identifies the card network from the number prefix (IIN).
+func DetectBrand(number string) Brand {
+	switch {
+	case hasPrefixInRange(number, 1, 4, 4):
+		return BrandVisa
+	case hasPrefixInRange(number, 2, 51, 55), hasPrefixInRange(number, 4, 2221, 2720):
+		return BrandMastercard
+	case hasPrefixInRange(number, 2, 34, 34), hasPrefixInRange(number, 2, 37, 37):
+		return BrandAmex
+	case hasPrefixInRange(number, 4, 6011, 6011), hasPrefixInRange(number, 3, 644, 649), hasPrefixInRange(number, 2, 65, 65):
+		return BrandDiscover
+	case hasPrefixInRange(number, 3, 300, 305), hasPrefixInRange(number, 2, 36, 36), hasPrefixInRange(number, 2, 38, 39):
+		return BrandDiners
+	case hasPrefixInRange(number, 4, 3528, 3589):
+		return BrandJCB
+	}
+
+	return BrandUnknown
+}
+
+func hasPrefixInRange(number string, length, low, high int) bool {
+	if len(number) < length {
+		return false
+	}
+
+	prefix, err := strconv.Atoi(number[:length])
+	if err != nil {
+		return false
+	}
+
+	return prefix >= low && prefix <= high
+}
+
+// ParseExpiry parses a MM/YY expiry, returning the last day of that month,
+// the last day the card can be charged.
+func ParseExpiry(expiry string) (time.Time, error) {
+	month, year, ok := strings.Cut(expiry, "/")
+	if !ok || len(month) != 2 || len(year) != 2 {
+		return time.Time{}, ErrInvalidExpiry
+	}
+
+	m, err := strconv.Atoi(month)
+	if err != nil || m < 1 || m > 12 {
+		return time.Time{}, ErrInvalidExpiry
+	}
+
+	y, err := strconv.Atoi(year)
+	if err != nil || y < 0 {
+		return time.Time{}, ErrInvalidExpiry
+	}
+
+	// day 0 of the next month is the last day of this one
+	return time.Date(2000+y, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC), nil
+}
+
+// Expired reports whether a card expiring at expiry can no longer be used at
+// now.
+func Expired(expiry, now time.Time) bool {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return expiry.Before(today)
+}
@@ -0,0 +1,83 @@
+package card
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+		want   bool
+	}{
+		{name: "visa", number: "4242424242424242", want: true},
+		{name: "amex", number: "378282246310005", want: true},
+		{name: "wrong check digit", number: "4242424242424241", want: false},
+		{name: "too short", number: "42424242424", want: false},
+		{name: "non digits", number: "4242a24242424242", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Valid(tt.number))
+		})
+	}
+}
+
+func TestDetectBrand(t *testing.T) {
+	tests := []struct {
+		number string
+		want   Brand
+	}{
+		{number: "4242424242424242", want: BrandVisa},
+		{number: "5555555555554444", want: BrandMastercard},
+		{number: "2223003122003222", want: BrandMastercard},
+		{number: "378282246310005", want: BrandAmex},
+		{number: "6011111111111117", want: BrandDiscover},
+		{number: "30569309025904", want: BrandDiners},
+		{number: "3566002020360505", want: BrandJCB},
+		{number: "9999999999999995", want: BrandUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectBrand(tt.number))
+		})
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		expiry  string
+		want    time.Time
+		wantErr bool
+	}{
+		{expiry: "12/30", want: time.Date(2030, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{expiry: "02/28", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expiry: "13/30", wantErr: true},
+		{expiry: "1/30", wantErr: true},
+		{expiry: "12-30", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expiry, func(t *testing.T) {
+			got, err := ParseExpiry(tt.expiry)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidExpiry)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	expiry := time.Date(2030, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	assert.False(t, Expired(expiry, time.Date(2030, 12, 31, 23, 59, 0, 0, time.UTC)))
+	assert.True(t, Expired(expiry, time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
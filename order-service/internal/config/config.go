@@ -0,0 +1,534 @@
+// Package config loads the settings of the order service and validates them
+// once at startup, so a missing or invalid setting stops the service right
+// away instead of failing the first request that needs it.
+//
+// Each setting comes from, by increasing precedence, its default, the YAML
+// file named by -config or CONFIG_FILE, an environment variable and a command
+// line flag:
+//
+//	database:
+//	  url: sqlite:orders.db # DATABASE_URL, -database-url
+//	  max_open_conns: 25    # DATABASE_MAX_OPEN_CONNS, -database-max-open-conns
+//
+// Durations are written as in Go, such as 15m or 24h. Lists and maps are comma
+// separated in the environment and flags: CORS_ALLOWED_ORIGINS=https://a.com,https://b.com
+// and WEBHOOK_SECRETS=fake=secret.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/email"
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/tracing"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+// minJWTSecretSize is the shortest secret accepted to sign tokens, the size
+// of the HS256 hash.
+const minJWTSecretSize = 32
+
+type Config struct {
+	Database Database `yaml:"database"`
+	Server   Server   `yaml:"server"`
+	Auth     Auth     `yaml:"auth"`
+	PII      PII      `yaml:"pii"`
+	Payments Payments `yaml:"payments"`
+	Mail     Mail     `yaml:"mail"`
+	Orders   Orders   `yaml:"orders"`
+	CORS     CORS     `yaml:"cors"`
+	Log      Log      `yaml:"log"`
+	Tracing  Tracing  `yaml:"tracing"`
+	Features Features `yaml:"features"`
+}
+
+type Database struct {
+	// URL is a postgres connection string or sqlite: followed by a file
+	// path, see database.Open.
+	URL             string        `yaml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type Server struct {
+	Addr string `yaml:"addr"`
+	// RequestTimeout bounds every request, zero leaves them unbounded.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// RouteTimeouts replaces RequestTimeout for the routes it holds, keyed by
+	// the pattern they are registered with, such as
+	// "POST /orders/{order_id}/refunds". Zero leaves a route unbounded.
+	RouteTimeouts map[string]time.Duration `yaml:"route_timeouts"`
+	// ShutdownTimeout is how long the requests in flight have to finish once
+	// the service is asked to stop.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// DrainDelay is how long /readyz fails before the service stops taking
+	// connections, for the load balancers to notice.
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	// HealthCheckTimeout bounds each check of /readyz.
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+}
+
+type Auth struct {
+	JWTSecret             string        `yaml:"jwt_secret"`
+	TokenTTL              time.Duration `yaml:"token_ttl"`
+	ImpersonationTokenTTL time.Duration `yaml:"impersonation_token_ttl"`
+	PasswordResetTokenTTL time.Duration `yaml:"password_reset_token_ttl"`
+}
+
+type PII struct {
+	// Keyfile is the path of the master keyfile, see fieldcrypt.LoadKeyfile.
+	Keyfile string `yaml:"keyfile"`
+}
+
+type Payments struct {
+	// Gateway is the provider charging the cards, one of payment.Providers.
+	Gateway string `yaml:"gateway"`
+	// AllowFakeGateway lets Gateway be payment.ProviderFake, which approves
+	// every valid card without charging it. It is for local development only.
+	AllowFakeGateway bool `yaml:"allow_fake_gateway"`
+	// CardVaultKey is the base64 encoded key of the card vault.
+	CardVaultKey string `yaml:"card_vault_key"`
+	// WebhookSecrets holds the secret signing the webhooks of each provider,
+	// keyed by the provider name used in the webhook url.
+	WebhookSecrets map[string]string `yaml:"webhook_secrets"`
+}
+
+type Mail struct {
+	// Sender is how mail is delivered, one of email.Senders. The log sender
+	// only logs it, password reset tokens included, for local runs without a
+	// relay.
+	Sender string `yaml:"sender"`
+	// SMTPAddr is the host:port of the relay the smtp sender goes through.
+	SMTPAddr string `yaml:"smtp_addr"`
+	// From is the address the mail is sent as.
+	From string `yaml:"from"`
+	// Username and Password authenticate with the relay, which is used
+	// unauthenticated without a username.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type Orders struct {
+	// CancellationWindow is how long after being placed an order can still
+	// be cancelled by its owner.
+	CancellationWindow time.Duration `yaml:"cancellation_window"`
+	// ReturnWindow is how long after being delivered an order can still be
+	// returned. Orders delivered before their delivery was recorded cannot
+	// be returned.
+	ReturnWindow time.Duration `yaml:"return_window"`
+}
+
+type CORS struct {
+	// AllowedOrigins are the origins browsers may call the api from, * for
+	// any. None allows no cross origin calls.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+type Log struct {
+	// Level is the lowest level logged: debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is how records are written, one of logging.Formats.
+	Format string `yaml:"format"`
+}
+
+// Logger returns the logger writing to w the log settings describe.
+func (l Log) Logger(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return nil, err
+	}
+	return logging.New(w, l.Format, level)
+}
+
+type Tracing struct {
+	// Exporter is where spans go, one of tracing.Exporters.
+	Exporter string `yaml:"exporter"`
+	// File is the file the file exporter appends spans to.
+	File string `yaml:"file"`
+	// OTLPEndpoint is the url of the collector the otlp exporter sends spans
+	// to, such as http://localhost:4318.
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+}
+
+// Options returns the tracing settings as tracing.Setup takes them.
+func (t Tracing) Options() tracing.Options {
+	return tracing.Options{Exporter: t.Exporter, File: t.File, OTLPEndpoint: t.OTLPEndpoint}
+}
+
+// Features turn whole groups of routes on or off.
+type Features struct {
+	Signup        bool `yaml:"signup"`
+	Impersonation bool `yaml:"impersonation"`
+	Returns       bool `yaml:"returns"`
+	Webhooks      bool `yaml:"webhooks"`
+}
+
+// Default is the configuration before any file, environment variable or flag
+// is applied. It lacks the secrets, so it does not validate on its own.
+func Default() Config {
+	return Config{
+		Database: Database{
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Server: Server{
+			Addr:           ":8080",
+			RequestTimeout: 5 * time.Second,
+			// these wait on the payment gateway
+			RouteTimeouts: map[string]time.Duration{
+				"POST /orders/{order_id}/payments":  30 * time.Second,
+				"POST /orders/{order_id}/cancel":    30 * time.Second,
+				"POST /orders/{order_id}/refunds":   30 * time.Second,
+				"POST /returns/{return_id}/receive": 30 * time.Second,
+			},
+			ShutdownTimeout:    15 * time.Second,
+			DrainDelay:         5 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Auth: Auth{
+			TokenTTL:              24 * time.Hour,
+			ImpersonationTokenTTL: 15 * time.Minute,
+			PasswordResetTokenTTL: 24 * time.Hour,
+		},
+		Mail: Mail{
+			Sender: email.SenderSMTP,
+		},
+		Orders: Orders{
+			CancellationWindow: 30 * time.Minute,
+			ReturnWindow:       30 * 24 * time.Hour,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: logging.FormatJSON,
+		},
+		Tracing: Tracing{
+			Exporter: tracing.ExporterNone,
+		},
+		Features: Features{
+			Signup:        true,
+			Impersonation: true,
+			Returns:       true,
+		},
+	}
+}
+
+// setting is where one field of Config is read from besides the file.
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	value flag.Value
+}
+
+func settings(c *Config) []setting {
+	return []setting{
+		{"database.url", "DATABASE_URL", "database-url", "database connection string, sqlite:path for a SQLite file", (*stringValue)(&c.Database.URL)},
+		{"database.max_open_conns", "DATABASE_MAX_OPEN_CONNS", "database-max-open-conns", "maximum open database connections, 0 for no limit", (*intValue)(&c.Database.MaxOpenConns)},
+		{"database.max_idle_conns", "DATABASE_MAX_IDLE_CONNS", "database-max-idle-conns", "maximum idle database connections", (*intValue)(&c.Database.MaxIdleConns)},
+		{"database.conn_max_lifetime", "DATABASE_CONN_MAX_LIFETIME", "database-conn-max-lifetime", "how long a database connection is reused, 0 forever", (*durationValue)(&c.Database.ConnMaxLifetime)},
+		{"server.addr", "LISTEN_ADDR", "addr", "address the api listens on", (*stringValue)(&c.Server.Addr)},
+		{"server.request_timeout", "REQUEST_TIMEOUT", "request-timeout", "how long a request may run, 0 for no limit", (*durationValue)(&c.Server.RequestTimeout)},
+		{"server.route_timeouts", "ROUTE_TIMEOUTS", "route-timeouts", "timeouts of single routes as pattern=duration,..., replacing the defaults", (*durationMapValue)(&c.Server.RouteTimeouts)},
+		{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long requests in flight have to finish on shutdown", (*durationValue)(&c.Server.ShutdownTimeout)},
+		{"server.drain_delay", "DRAIN_DELAY", "drain-delay", "how long readiness fails on shutdown before connections are refused", (*durationValue)(&c.Server.DrainDelay)},
+		{"server.health_check_timeout", "HEALTH_CHECK_TIMEOUT", "health-check-timeout", "how long each readiness check may run", (*durationValue)(&c.Server.HealthCheckTimeout)},
+		{"auth.jwt_secret", "JWT_SECRET", "jwt-secret", "secret signing the tokens, at least 32 bytes", (*stringValue)(&c.Auth.JWTSecret)},
+		{"auth.token_ttl", "TOKEN_TTL", "token-ttl", "how long a login token is valid", (*durationValue)(&c.Auth.TokenTTL)},
+		{"auth.impersonation_token_ttl", "IMPERSONATION_TOKEN_TTL", "impersonation-token-ttl", "how long an impersonation token is valid", (*durationValue)(&c.Auth.ImpersonationTokenTTL)},
+		{"auth.password_reset_token_ttl", "PASSWORD_RESET_TOKEN_TTL", "password-reset-token-ttl", "how long a password reset token is valid", (*durationValue)(&c.Auth.PasswordResetTokenTTL)},
+		{"pii.keyfile", "PII_KEYFILE", "pii-keyfile", "path of the PII master keyfile", (*stringValue)(&c.PII.Keyfile)},
+		{"payments.gateway", "PAYMENT_GATEWAY", "payment-gateway", "provider charging the cards: " + strings.Join(payment.Providers, ", "), (*stringValue)(&c.Payments.Gateway)},
+		{"payments.allow_fake_gateway", "ALLOW_FAKE_GATEWAY", "allow-fake-gateway", "let the fake gateway approve payments without charging them, for local development only", (*boolValue)(&c.Payments.AllowFakeGateway)},
+		{"payments.card_vault_key", "CARD_VAULT_KEY", "card-vault-key", "base64 encoded 256 bit key of the card vault", (*stringValue)(&c.Payments.CardVaultKey)},
+		{"payments.webhook_secrets", "WEBHOOK_SECRETS", "webhook-secrets", "webhook signing secrets as provider=secret,...", (*mapValue)(&c.Payments.WebhookSecrets)},
+		{"mail.sender", "MAIL_SENDER", "mail-sender", "how mail is delivered: " + strings.Join(email.Senders, ", "), (*stringValue)(&c.Mail.Sender)},
+		{"mail.smtp_addr", "MAIL_SMTP_ADDR", "mail-smtp-addr", "host:port of the SMTP relay mail is sent through", (*stringValue)(&c.Mail.SMTPAddr)},
+		{"mail.from", "MAIL_FROM", "mail-from", "address mail is sent as", (*stringValue)(&c.Mail.From)},
+		{"mail.username", "MAIL_USERNAME", "mail-username", "username of the SMTP relay, none for an unauthenticated relay", (*stringValue)(&c.Mail.Username)},
+		{"mail.password", "MAIL_PASSWORD", "mail-password", "password of the SMTP relay", (*stringValue)(&c.Mail.Password)},
+		{"orders.cancellation_window", "CANCELLATION_WINDOW", "cancellation-window", "how long after being placed an order can be cancelled", (*durationValue)(&c.Orders.CancellationWindow)},
+		{"orders.return_window", "RETURN_WINDOW", "return-window", "how long after being delivered an order can be returned", (*durationValue)(&c.Orders.ReturnWindow)},
+		{"cors.allowed_origins", "CORS_ALLOWED_ORIGINS", "cors-allowed-origins", "origins allowed to call the api from a browser, comma separated", (*listValue)(&c.CORS.AllowedOrigins)},
+		{"log.level", "LOG_LEVEL", "log-level", "lowest level logged: debug, info, warn or error", (*stringValue)(&c.Log.Level)},
+		{"log.format", "LOG_FORMAT", "log-format", "how logs are written: " + strings.Join(logging.Formats, ", "), (*stringValue)(&c.Log.Format)},
+		{"tracing.exporter", "TRACING_EXPORTER", "tracing-exporter", "where spans go: " + strings.Join(tracing.Exporters, ", "), (*stringValue)(&c.Tracing.Exporter)},
+		{"tracing.file", "TRACING_FILE", "tracing-file", "file the file exporter appends spans to", (*stringValue)(&c.Tracing.File)},
+		{"tracing.otlp_endpoint", "TRACING_OTLP_ENDPOINT", "tracing-otlp-endpoint", "url of the collector the otlp exporter sends spans to", (*stringValue)(&c.Tracing.OTLPEndpoint)},
+		{"features.signup", "FEATURE_SIGNUP", "feature-signup", "let anyone sign up", (*boolValue)(&c.Features.Signup)},
+		{"features.impersonation", "FEATURE_IMPERSONATION", "feature-impersonation", "let admins impersonate customers", (*boolValue)(&c.Features.Impersonation)},
+		{"features.returns", "FEATURE_RETURNS", "feature-returns", "let customers return delivered orders", (*boolValue)(&c.Features.Returns)},
+		{"features.webhooks", "FEATURE_WEBHOOKS", "feature-webhooks", "accept payment provider webhooks", (*boolValue)(&c.Features.Webhooks)},
+	}
+}
+
+// Load reads the configuration, args being the command line flags without
+// the program name and getenv looking up environment variables, as
+// os.Getenv does. The configuration is returned only once it validates.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	fs := flag.NewFlagSet("order-service", flag.ContinueOnError)
+	cfg, err := load(fs, args, getenv, nil)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("config: unexpected argument %q", fs.Arg(0))
+	}
+	return cfg, nil
+}
+
+// LoadSettings is Load for the commands that need only some settings, named
+// by keys such as "database.url". Only those are read from the environment
+// and flags and validated, the others keep their default or the value of the
+// file. The flags of the command are defined on fs, they are parsed along with
+// the ones of the settings and its arguments are left to the command.
+func LoadSettings(fs *flag.FlagSet, args []string, getenv func(string) string, keys ...string) (*Config, error) {
+	only := map[string]bool{}
+	defaults := Default()
+	for _, key := range keys {
+		if !slices.ContainsFunc(settings(&defaults), func(s setting) bool { return s.key == key }) {
+			return nil, fmt.Errorf("config: unknown setting %q", key)
+		}
+		only[key] = true
+	}
+	return load(fs, args, getenv, only)
+}
+
+// load reads the settings in only, or every setting when only is nil, into
+// the configuration, parsing args with fs.
+func load(fs *flag.FlagSet, args []string, getenv func(string) string, only map[string]bool) (*Config, error) {
+	fs.SetOutput(io.Discard)
+	file := fs.String("config", getenv("CONFIG_FILE"), "YAML configuration file (CONFIG_FILE)")
+
+	// flags win over the file and the environment, so they are only recorded
+	// here and applied last
+	flagged := map[string]string{}
+	defaults := Default()
+	for _, s := range selected(&defaults, only) {
+		_, isBool := s.value.(*boolValue)
+		fs.Var(&recordedFlag{name: s.flag, values: flagged, def: s.value.String(), isBool: isBool}, s.flag, fmt.Sprintf("%s (%s)", s.usage, s.env))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		var usage strings.Builder
+		fs.SetOutput(&usage)
+		fs.PrintDefaults()
+		return nil, fmt.Errorf("config: %w\n%s", err, usage.String())
+	}
+
+	cfg := Default()
+	if *file != "" {
+		if err := readFile(*file, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range selected(&cfg, only) {
+		if raw := getenv(s.env); raw != "" {
+			if err := s.value.Set(raw); err != nil {
+				return nil, fmt.Errorf("config: %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range selected(&cfg, only) {
+		if raw, ok := flagged[s.flag]; ok {
+			if err := s.value.Set(raw); err != nil {
+				return nil, fmt.Errorf("config: -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.validate(only); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// selected returns the settings of c in only, or all of them when only is
+// nil.
+func selected(c *Config, only map[string]bool) []setting {
+	all := settings(c)
+	if only == nil {
+		return all
+	}
+
+	var kept []setting
+	for _, s := range all {
+		if only[s.key] {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+func readFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	// a misspelled key would otherwise be silently ignored
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// ValidationError lists every invalid setting, so they can all be fixed at
+// once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "config: invalid configuration:\n\t" + strings.Join(e.Problems, "\n\t")
+}
+
+// Validate checks every setting and returns a *ValidationError listing the
+// invalid ones.
+func (c *Config) Validate() error {
+	return c.validate(nil)
+}
+
+// validate checks the settings in only, or every setting when only is nil.
+func (c *Config) validate(only map[string]bool) error {
+	sources := map[string]setting{}
+	for _, s := range settings(c) {
+		sources[s.key] = s
+	}
+
+	var problems []string
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok && (only == nil || only[key]) {
+			s := sources[key]
+			problems = append(problems, fmt.Sprintf("%s (%s, -%s) %s", key, s.env, s.flag, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.Database.URL != "", "database.url", "is required")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns", "must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns", "must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns", "must not exceed database.max_open_conns (%d)", c.Database.MaxOpenConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "must not be negative")
+
+	_, _, err := net.SplitHostPort(c.Server.Addr)
+	check(err == nil, "server.addr", "must be host:port, such as :8080")
+	check(c.Server.RequestTimeout >= 0, "server.request_timeout", "must not be negative")
+	patterns := make([]string, 0, len(c.Server.RouteTimeouts))
+	for pattern := range c.Server.RouteTimeouts {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		method, path, _ := strings.Cut(pattern, " ")
+		check(method != "" && strings.HasPrefix(path, "/"), "server.route_timeouts",
+			"has invalid route %q, expected a method and a path such as \"GET /orders\"", pattern)
+		check(c.Server.RouteTimeouts[pattern] >= 0, "server.route_timeouts", "has a negative timeout for %s", pattern)
+	}
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay", "must not be negative")
+	check(c.Server.HealthCheckTimeout > 0, "server.health_check_timeout", "must be positive")
+
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret", "is required")
+	check(c.Auth.JWTSecret == "" || len(c.Auth.JWTSecret) >= minJWTSecretSize,
+		"auth.jwt_secret", "must be at least %d bytes", minJWTSecretSize)
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl", "must be positive")
+	check(c.Auth.ImpersonationTokenTTL > 0, "auth.impersonation_token_ttl", "must be positive")
+	check(c.Auth.PasswordResetTokenTTL > 0, "auth.password_reset_token_ttl", "must be positive")
+
+	check(c.PII.Keyfile != "", "pii.keyfile", "is required")
+
+	check(c.Payments.Gateway != "", "payments.gateway", "is required")
+	if c.Payments.Gateway != "" {
+		check(slices.Contains(payment.Providers, c.Payments.Gateway), "payments.gateway", "must be one of %s", strings.Join(payment.Providers, ", "))
+	}
+	check(c.Payments.Gateway != payment.ProviderFake || c.Payments.AllowFakeGateway,
+		"payments.gateway", "is %s, which charges nothing, without payments.allow_fake_gateway", payment.ProviderFake)
+	check(c.Payments.CardVaultKey != "", "payments.card_vault_key", "is required")
+	if c.Payments.CardVaultKey != "" {
+		_, err := vault.ParseKey(c.Payments.CardVaultKey)
+		check(err == nil, "payments.card_vault_key", "must be 32 bytes, base64 encoded")
+	}
+	check(!c.Features.Webhooks || len(c.Payments.WebhookSecrets) > 0,
+		"payments.webhook_secrets", "is required when features.webhooks is on")
+	providers := make([]string, 0, len(c.Payments.WebhookSecrets))
+	for provider := range c.Payments.WebhookSecrets {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	for _, provider := range providers {
+		check(c.Payments.WebhookSecrets[provider] != "", "payments.webhook_secrets", "has no secret for %s", provider)
+	}
+
+	check(slices.Contains(email.Senders, c.Mail.Sender), "mail.sender", "must be one of %s", strings.Join(email.Senders, ", "))
+	smtp := c.Mail.Sender == email.SenderSMTP
+	check(!smtp || c.Mail.SMTPAddr != "", "mail.smtp_addr", "is required when mail.sender is %s", email.SenderSMTP)
+	if c.Mail.SMTPAddr != "" {
+		_, _, err := net.SplitHostPort(c.Mail.SMTPAddr)
+		check(err == nil, "mail.smtp_addr", "must be host:port, such as smtp.example.com:587")
+	}
+	check(!smtp || c.Mail.From != "", "mail.from", "is required when mail.sender is %s", email.SenderSMTP)
+	if c.Mail.From != "" {
+		_, err := mail.ParseAddress(c.Mail.From)
+		check(err == nil, "mail.from", "must be an email address")
+	}
+
+	check(c.Orders.CancellationWindow > 0, "orders.cancellation_window", "must be positive")
+	check(c.Orders.ReturnWindow > 0, "orders.return_window", "must be positive")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(validOrigin(origin), "cors.allowed_origins", "has invalid origin %q, expected * or scheme://host[:port]", origin)
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level", "must be one of debug, info, warn, error")
+	check(slices.Contains(logging.Formats, c.Log.Format), "log.format", "must be one of %s", strings.Join(logging.Formats, ", "))
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterFile:
+		check(c.Tracing.File != "", "tracing.file", "is required when tracing.exporter is %s", tracing.ExporterFile)
+	case tracing.ExporterOTLP:
+		_, err := url.ParseRequestURI(c.Tracing.OTLPEndpoint)
+		check(err == nil, "tracing.otlp_endpoint", "must be a url when tracing.exporter is %s", tracing.ExporterOTLP)
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	default:
+		check(false, "tracing.exporter", "must be one of %s", strings.Join(tracing.Exporters, ", "))
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
@@ -0,0 +1,361 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSecret   = "0123456789abcdef0123456789abcdef"
+	testVaultKey = "QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI="
+)
+
+// env is a getenv reading from a map.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// required holds the settings without a default.
+var required = map[string]string{
+	"DATABASE_URL":       "sqlite:orders.db",
+	"JWT_SECRET":         testSecret,
+	"PII_KEYFILE":        "/etc/goecommerce/pii.json",
+	"CARD_VAULT_KEY":     testVaultKey,
+	"PAYMENT_GATEWAY":    "fake",
+	"ALLOW_FAKE_GATEWAY": "true",
+	"MAIL_SMTP_ADDR":     "localhost:25",
+	"MAIL_FROM":          "shop@example.com",
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, env(required))
+	assert.NoError(t, err)
+
+	want := Default()
+	want.Database.URL = "sqlite:orders.db"
+	want.Auth.JWTSecret = testSecret
+	want.PII.Keyfile = "/etc/goecommerce/pii.json"
+	want.Payments.CardVaultKey = testVaultKey
+	want.Payments.Gateway = "fake"
+	want.Payments.AllowFakeGateway = true
+	want.Mail.SMTPAddr = "localhost:25"
+	want.Mail.From = "shop@example.com"
+	assert.Equal(t, &want, cfg)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, `
+database:
+  url: postgres://file
+  max_open_conns: 10
+server:
+  addr: ":9000"
+  request_timeout: 2s
+  route_timeouts:
+    POST /orders/{order_id}/payments: 1m
+auth:
+  token_ttl: 1h
+cors:
+  allowed_origins: [https://shop.example.com]
+features:
+  returns: false
+`)
+
+	vars := map[string]string{
+		"CONFIG_FILE":             file,
+		"JWT_SECRET":              testSecret,
+		"PII_KEYFILE":             "/etc/goecommerce/pii.json",
+		"CARD_VAULT_KEY":          testVaultKey,
+		"PAYMENT_GATEWAY":         "fake",
+		"ALLOW_FAKE_GATEWAY":      "true",
+		"MAIL_SMTP_ADDR":          "localhost:25",
+		"MAIL_FROM":               "shop@example.com",
+		"DATABASE_MAX_OPEN_CONNS": "20",
+		"LISTEN_ADDR":             ":9001",
+		"WEBHOOK_SECRETS":         "fake=secret, other=secret2",
+	}
+	args := []string{"-addr", ":9002", "-feature-webhooks", "-cors-allowed-origins", "https://a.example.com,https://b.example.com"}
+
+	cfg, err := Load(args, env(vars))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "postgres://file", cfg.Database.URL, "from the file")
+	assert.Equal(t, 20, cfg.Database.MaxOpenConns, "the environment wins over the file")
+	assert.Equal(t, 5, cfg.Database.MaxIdleConns, "the default")
+	assert.Equal(t, ":9002", cfg.Server.Addr, "flags win over the environment")
+	assert.Equal(t, 2*time.Second, cfg.Server.RequestTimeout)
+	assert.Equal(t, time.Minute, cfg.Server.RouteTimeouts["POST /orders/{order_id}/payments"], "the file sets single routes")
+	assert.Equal(t, 30*time.Second, cfg.Server.RouteTimeouts["POST /orders/{order_id}/refunds"], "the default of the other routes")
+	assert.Equal(t, time.Hour, cfg.Auth.TokenTTL)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORS.AllowedOrigins)
+	assert.Equal(t, map[string]string{"fake": "secret", "other": "secret2"}, cfg.Payments.WebhookSecrets)
+	assert.Equal(t, Features{Signup: true, Impersonation: true, Returns: false, Webhooks: true}, cfg.Features)
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	file := writeFile(t, "server:\n  addr: \":9000\"\n")
+
+	cfg, err := Load([]string{"-config", file}, env(required))
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", cfg.Server.Addr)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		vars    map[string]string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "unknown key in file",
+			file:    "database:\n  uri: postgres://file\n",
+			wantErr: "field uri not found",
+		},
+		{
+			name:    "invalid duration in environment",
+			vars:    map[string]string{"TOKEN_TTL": "a day"},
+			wantErr: `TOKEN_TTL: "a day" is not a duration`,
+		},
+		{
+			name:    "invalid integer flag",
+			args:    []string{"-database-max-open-conns", "many"},
+			wantErr: `-database-max-open-conns: "many" is not an integer`,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"-verbose"},
+			wantErr: "flag provided but not defined: -verbose",
+		},
+		{
+			name:    "invalid timeout of a route",
+			vars:    map[string]string{"ROUTE_TIMEOUTS": "GET /orders=soon"},
+			wantErr: `ROUTE_TIMEOUTS: "soon" is not a duration`,
+		},
+		{
+			name:    "invalid map",
+			vars:    map[string]string{"WEBHOOK_SECRETS": "secret"},
+			wantErr: "WEBHOOK_SECRETS: expected key=value pairs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{}
+			for key, value := range required {
+				vars[key] = value
+			}
+			for key, value := range tt.vars {
+				vars[key] = value
+			}
+			if tt.file != "" {
+				vars["CONFIG_FILE"] = writeFile(t, tt.file)
+			}
+
+			_, err := Load(tt.args, env(vars))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := Load(nil, env(required))
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Database.URL = ""
+	cfg.Database.MaxIdleConns = 50
+	cfg.Server.Addr = "8080"
+	cfg.Server.RouteTimeouts = map[string]time.Duration{"/orders": time.Second, "GET /orders": -time.Second}
+	cfg.Server.HealthCheckTimeout = 0
+	cfg.Auth.JWTSecret = "short"
+	cfg.Auth.TokenTTL = 0
+	cfg.Payments.CardVaultKey = "not a key"
+	cfg.Features.Webhooks = true
+	cfg.Mail.SMTPAddr = "localhost"
+	cfg.Mail.From = ""
+	cfg.CORS.AllowedOrigins = []string{"https://shop.example.com/path"}
+	cfg.Log.Level = "verbose"
+	cfg.Log.Format = "logfmt"
+	cfg.Tracing.Exporter = "jaeger"
+
+	err = cfg.Validate()
+	var validationErr *ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{
+		"database.url (DATABASE_URL, -database-url) is required",
+		"database.max_idle_conns (DATABASE_MAX_IDLE_CONNS, -database-max-idle-conns) must not exceed database.max_open_conns (25)",
+		"server.addr (LISTEN_ADDR, -addr) must be host:port, such as :8080",
+		`server.route_timeouts (ROUTE_TIMEOUTS, -route-timeouts) has invalid route "/orders", expected a method and a path such as "GET /orders"`,
+		"server.route_timeouts (ROUTE_TIMEOUTS, -route-timeouts) has a negative timeout for GET /orders",
+		"server.health_check_timeout (HEALTH_CHECK_TIMEOUT, -health-check-timeout) must be positive",
+		"auth.jwt_secret (JWT_SECRET, -jwt-secret) must be at least 32 bytes",
+		"auth.token_ttl (TOKEN_TTL, -token-ttl) must be positive",
+		"payments.card_vault_key (CARD_VAULT_KEY, -card-vault-key) must be 32 bytes, base64 encoded",
+		"payments.webhook_secrets (WEBHOOK_SECRETS, -webhook-secrets) is required when features.webhooks is on",
+		"mail.smtp_addr (MAIL_SMTP_ADDR, -mail-smtp-addr) must be host:port, such as smtp.example.com:587",
+		"mail.from (MAIL_FROM, -mail-from) is required when mail.sender is smtp",
+		`cors.allowed_origins (CORS_ALLOWED_ORIGINS, -cors-allowed-origins) has invalid origin "https://shop.example.com/path", expected * or scheme://host[:port]`,
+		"log.level (LOG_LEVEL, -log-level) must be one of debug, info, warn, error",
+		"log.format (LOG_FORMAT, -log-format) must be one of json, text",
+		"tracing.exporter (TRACING_EXPORTER, -tracing-exporter) must be one of none, stdout, file, otlp",
+	}, validationErr.Problems)
+}
+
+func TestValidateTracing(t *testing.T) {
+	tests := []struct {
+		name    string
+		tracing Tracing
+		want    string
+	}{
+		{"stdout", Tracing{Exporter: "stdout"}, ""},
+		{"file", Tracing{Exporter: "file", File: "spans.json"}, ""},
+		{"file without a path", Tracing{Exporter: "file"}, "tracing.file (TRACING_FILE, -tracing-file) is required when tracing.exporter is file"},
+		{"otlp", Tracing{Exporter: "otlp", OTLPEndpoint: "http://localhost:4318"}, ""},
+		{"otlp without a url", Tracing{Exporter: "otlp", OTLPEndpoint: "localhost"}, "tracing.otlp_endpoint (TRACING_OTLP_ENDPOINT, -tracing-otlp-endpoint) must be a url when tracing.exporter is otlp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(nil, env(required))
+			assert.NoError(t, err)
+
+			cfg.Tracing = tt.tracing
+			if tt.want == "" {
+				assert.NoError(t, cfg.Validate())
+			} else {
+				assert.ErrorContains(t, cfg.Validate(), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePaymentGateway(t *testing.T) {
+	tests := []struct {
+		name     string
+		payments Payments
+		want     string
+	}{
+		{"fake allowed", Payments{Gateway: "fake", AllowFakeGateway: true}, ""},
+		{"fake not allowed", Payments{Gateway: "fake"}, "payments.gateway (PAYMENT_GATEWAY, -payment-gateway) is fake, which charges nothing, without payments.allow_fake_gateway"},
+		{"missing", Payments{}, "payments.gateway (PAYMENT_GATEWAY, -payment-gateway) is required"},
+		{"unknown", Payments{Gateway: "acme"}, "payments.gateway (PAYMENT_GATEWAY, -payment-gateway) must be one of fake"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(nil, env(required))
+			assert.NoError(t, err)
+
+			tt.payments.CardVaultKey = testVaultKey
+			cfg.Payments = tt.payments
+			if tt.want == "" {
+				assert.NoError(t, cfg.Validate())
+			} else {
+				assert.ErrorContains(t, cfg.Validate(), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateMailSender(t *testing.T) {
+	tests := []struct {
+		name string
+		mail Mail
+		want string
+	}{
+		{"smtp", Mail{Sender: "smtp", SMTPAddr: "localhost:25", From: "shop@example.com"}, ""},
+		{"smtp without a relay", Mail{Sender: "smtp", From: "shop@example.com"}, "mail.smtp_addr (MAIL_SMTP_ADDR, -mail-smtp-addr) is required when mail.sender is smtp"},
+		{"log without a relay", Mail{Sender: "log"}, ""},
+		{"unknown", Mail{Sender: "sendmail"}, "mail.sender (MAIL_SENDER, -mail-sender) must be one of smtp, log"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(nil, env(required))
+			assert.NoError(t, err)
+
+			cfg.Mail = tt.mail
+			if tt.want == "" {
+				assert.NoError(t, cfg.Validate())
+			} else {
+				assert.ErrorContains(t, cfg.Validate(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	fs := flag.NewFlagSet("tool", flag.ContinueOnError)
+	batchSize := fs.Int("batch-size", 500, "")
+	vars := map[string]string{"DATABASE_URL": "sqlite:orders.db", "PII_KEYFILE": "/etc/goecommerce/pii.json"}
+
+	// the other required settings are missing, and so is ignored
+	cfg, err := LoadSettings(fs, []string{"-batch-size", "10", "-pii-keyfile", "pii.json", "up"}, env(vars), "database.url", "pii.keyfile")
+	assert.NoError(t, err)
+	assert.Equal(t, "sqlite:orders.db", cfg.Database.URL)
+	assert.Equal(t, "pii.json", cfg.PII.Keyfile)
+	assert.Equal(t, 10, *batchSize)
+	assert.Equal(t, []string{"up"}, fs.Args())
+
+	_, err = LoadSettings(flag.NewFlagSet("tool", flag.ContinueOnError), nil, env(nil), "database.url")
+	assert.ErrorContains(t, err, "database.url (DATABASE_URL, -database-url) is required")
+
+	_, err = LoadSettings(flag.NewFlagSet("tool", flag.ContinueOnError), []string{"-jwt-secret", testSecret}, env(vars), "database.url")
+	assert.ErrorContains(t, err, "flag provided but not defined: -jwt-secret")
+
+	_, err = LoadSettings(flag.NewFlagSet("tool", flag.ContinueOnError), nil, env(vars), "database.uri")
+	assert.ErrorContains(t, err, `unknown setting "database.uri"`)
+}
+
+func TestLoadMissingSecret(t *testing.T) {
+	vars := map[string]string{}
+	for key, value := range required {
+		vars[key] = value
+	}
+	delete(vars, "JWT_SECRET")
+
+	_, err := Load(nil, env(vars))
+	assert.ErrorContains(t, err, "auth.jwt_secret (JWT_SECRET, -jwt-secret) is required")
+}
+
+func TestExampleFile(t *testing.T) {
+	vars := map[string]string{
+		"CONFIG_FILE":    "../../config.example.yaml",
+		"JWT_SECRET":     testSecret,
+		"CARD_VAULT_KEY": testVaultKey,
+	}
+
+	cfg, err := Load(nil, env(vars))
+	assert.NoError(t, err)
+
+	want := Default()
+	want.Database.URL = "sqlite:orders.db"
+	want.Auth.JWTSecret = testSecret
+	want.PII.Keyfile = "/etc/goecommerce/pii.json"
+	want.Payments.CardVaultKey = testVaultKey
+	want.Payments.Gateway = "fake"
+	want.Payments.AllowFakeGateway = true
+	want.Payments.WebhookSecrets = map[string]string{}
+	want.Mail.SMTPAddr = "localhost:25"
+	want.Mail.From = "shop@example.com"
+	want.CORS.AllowedOrigins = []string{}
+	assert.Equal(t, &want, cfg, "the example should hold the defaults")
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The values below set a field of Config from the text of an environment
+// variable or a flag.
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+func (v *intValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration, such as 30s or 15m", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string {
+	return time.Duration(*v).String()
+}
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string {
+	return strconv.FormatBool(bool(*v))
+}
+
+// listValue is a comma separated list, blank items are dropped.
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*v = items
+	return nil
+}
+
+func (v *listValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+// mapValue is a comma separated list of key=value pairs.
+type mapValue map[string]string
+
+func (v *mapValue) Set(s string) error {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return errors.New("expected key=value pairs separated by commas")
+		}
+		pairs[key] = value
+	}
+	*v = pairs
+	return nil
+}
+
+func (v *mapValue) String() string {
+	keys := make([]string, 0, len(*v))
+	for key := range *v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		// only the keys, the values are secrets
+		pairs[i] = key + "=..."
+	}
+	return strings.Join(pairs, ",")
+}
+
+// durationMapValue is a comma separated list of key=duration pairs.
+type durationMapValue map[string]time.Duration
+
+func (v *durationMapValue) Set(s string) error {
+	pairs := map[string]time.Duration{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return errors.New("expected key=duration pairs separated by commas")
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration, such as 30s or 15m", value)
+		}
+		pairs[key] = d
+	}
+	*v = pairs
+	return nil
+}
+
+func (v *durationMapValue) String() string {
+	keys := make([]string, 0, len(*v))
+	for key := range *v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + (*v)[key].String()
+	}
+	return strings.Join(pairs, ",")
+}
+
+// recordedFlag keeps the text of a flag in values under its name, to be set
+// once the file and the environment were read.
+type recordedFlag struct {
+	name   string
+	values map[string]string
+	def    string
+	isBool bool
+}
+
+func (f *recordedFlag) Set(s string) error {
+	f.values[f.name] = s
+	return nil
+}
+
+func (f *recordedFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.def
+}
+
+func (f *recordedFlag) IsBoolFlag() bool {
+	return f.isBool
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect is the flavour of SQL a database speaks. Queries are written for
+// postgres, Conn translates them for the other dialects.
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	SQLite
+)
+
+// DialectOf tells the dialect of db from the driver it was opened with.
+func DialectOf(db *sqlx.DB) Dialect {
+	if db.DriverName() == "sqlite3" {
+		return SQLite
+	}
+	return Postgres
+}
+
+// Open connects to the database at url, either a postgres connection string
+// or a file path prefixed with sqlite:, as in sqlite:orders.db. The SQLite
+// file is created when missing and has its foreign keys enforced.
+func Open(url string) (*sqlx.DB, error) {
+	path, ok := strings.CutPrefix(url, "sqlite:")
+	if !ok {
+		return sqlx.Connect("postgres", url)
+	}
+
+	// transactions take the write lock when they begin, so two of them never
+	// deadlock upgrading a read lock, and wait for each other up to the busy
+	// timeout instead of failing right away
+	dsn := "file:" + path + "?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+	return sqlx.Connect("sqlite3", dsn)
+}
+
+// IsUniqueViolation reports whether err is a write refused by a unique or
+// primary key constraint, in any dialect.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Name() == "unique_violation"
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
+
+// IsForeignKeyViolation reports whether err is a write refused by a foreign
+// key constraint, as deleting a row others still refer to, in any dialect.
+func IsForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Name() == "foreign_key_violation"
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+	}
+	return false
+}
+
+// sqliteTimeFormat is how times are stored in SQLite, as text comparing in
+// the order of the times. Columns defaulting to the current time use the same
+// format, see migrations/sqlite.
+const sqliteTimeFormat = "2006-01-02T15:04:05Z"
+
+const sqliteNow = `strftime('%Y-%m-%dT%H:%M:%SZ', 'now')`
+
+// sqliteRewrites turn the postgres constructs used by the queries into their
+// SQLite equivalent, in order.
+var sqliteRewrites = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`CURRENT_TIMESTAMP ([+-]) \$(\d+) \* INTERVAL '1 second'`), `strftime('%Y-%m-%dT%H:%M:%SZ', 'now', '$1' || ?$2 || ' seconds')`},
+	{regexp.MustCompile(`\bCURRENT_TIMESTAMP\b`), sqliteNow},
+	{regexp.MustCompile(`CAST\(\$(\d+) AS DATE\) \+ 1`), `date(?$1, '+1 day')`},
+	{regexp.MustCompile(`CAST\(\$(\d+) AS DATE\)`), `date(?$1)`},
+	// LIKE is already case insensitive, but takes no escape character unless
+	// told so
+	{regexp.MustCompile(`\bILIKE \$(\d+)`), `LIKE ?$1 ESCAPE '\'`},
+	// a transaction holds the lock of the whole database already
+	{regexp.MustCompile(`\s+FOR UPDATE( SKIP LOCKED)?`), ``},
+	{regexp.MustCompile(`\$(\d+)`), `?$1`},
+}
+
+// rewriteSQLite translates query, written for postgres, to SQLite.
+func rewriteSQLite(query string) string {
+	for _, r := range sqliteRewrites {
+		query = r.pattern.ReplaceAllString(query, r.replace)
+	}
+	return query
+}
+
+// sqliteArgs stores the times among args in sqliteTimeFormat.
+func sqliteArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			converted[i] = v.UTC().Format(sqliteTimeFormat)
+		case *time.Time:
+			if v != nil {
+				converted[i] = v.UTC().Format(sqliteTimeFormat)
+			}
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// sqliteConn runs the queries of a SQLite database or transaction once
+// translated.
+type sqliteConn struct {
+	q Querier
+}
+
+func (c sqliteConn) DriverName() string {
+	return c.q.DriverName()
+}
+
+func (c sqliteConn) Rebind(query string) string {
+	return c.q.Rebind(query)
+}
+
+func (c sqliteConn) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	return c.q.BindNamed(query, arg)
+}
+
+func (c sqliteConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.q.QueryContext(ctx, rewriteSQLite(query), sqliteArgs(args)...)
+}
+
+func (c sqliteConn) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return c.q.QueryxContext(ctx, rewriteSQLite(query), sqliteArgs(args)...)
+}
+
+func (c sqliteConn) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	return c.q.QueryRowxContext(ctx, rewriteSQLite(query), sqliteArgs(args)...)
+}
+
+func (c sqliteConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.q.ExecContext(ctx, rewriteSQLite(query), sqliteArgs(args)...)
+}
+
+func (c sqliteConn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.q.GetContext(ctx, dest, rewriteSQLite(query), sqliteArgs(args)...)
+}
+
+func (c sqliteConn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.q.SelectContext(ctx, dest, rewriteSQLite(query), sqliteArgs(args)...)
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteSQLite(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "placeholders",
+			query: "UPDATE users SET email = $2 WHERE user_id = $1 OR user_id = $10",
+			want:  "UPDATE users SET email = ?2 WHERE user_id = ?1 OR user_id = ?10",
+		},
+		{
+			name:  "current timestamp",
+			query: "DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP",
+			want:  "DELETE FROM idempotency_keys WHERE expires_at <= strftime('%Y-%m-%dT%H:%M:%SZ', 'now')",
+		},
+		{
+			name:  "interval after now",
+			query: "VALUES ($1, CURRENT_TIMESTAMP + $4 * INTERVAL '1 second')",
+			want:  "VALUES (?1, strftime('%Y-%m-%dT%H:%M:%SZ', 'now', '+' || ?4 || ' seconds'))",
+		},
+		{
+			name:  "interval before now",
+			query: "SELECT order_date >= CURRENT_TIMESTAMP - $3 * INTERVAL '1 second' AS within_window",
+			want:  "SELECT order_date >= strftime('%Y-%m-%dT%H:%M:%SZ', 'now', '-' || ?3 || ' seconds') AS within_window",
+		},
+		{
+			name:  "dates",
+			query: "order_date >= CAST($2 AS DATE) AND order_date < CAST($3 AS DATE) + 1",
+			want:  "order_date >= date(?2) AND order_date < date(?3, '+1 day')",
+		},
+		{
+			name:  "case insensitive match",
+			query: "(first_name || ' ' || last_name) ILIKE $1",
+			want:  `(first_name || ' ' || last_name) LIKE ?1 ESCAPE '\'`,
+		},
+		{
+			name:  "row locks",
+			query: "SELECT order_status FROM orders WHERE order_id = $1\n\t\tFOR UPDATE",
+			want:  "SELECT order_status FROM orders WHERE order_id = ?1",
+		},
+		{
+			name:  "skipped row locks",
+			query: "SELECT user_id FROM users LIMIT $2 FOR UPDATE SKIP LOCKED",
+			want:  "SELECT user_id FROM users LIMIT ?2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rewriteSQLite(tt.query))
+		})
+	}
+}
+
+func TestSQLiteArgs(t *testing.T) {
+	at := time.Date(2024, 2, 15, 9, 30, 0, 500, time.FixedZone("BRT", -3*60*60))
+
+	got := sqliteArgs([]interface{}{1, "john", at, &at, (*time.Time)(nil)})
+	assert.Equal(t, []interface{}{1, "john", "2024-02-15T12:30:00Z", "2024-02-15T12:30:00Z", nil}, got)
+}
+
+func TestConnSQLite(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+	defer db.Close()
+
+	sqliteDB := sqlx.NewDb(db, "sqlite3")
+	assert.Equal(t, SQLite, DialectOf(sqliteDB))
+	assert.Equal(t, instrumentedConn{q: sqliteConn{q: sqliteDB}, dialect: SQLite, operation: unknownOperation}, Conn(context.Background(), sqliteDB), "Conn() should translate the queries")
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"postgres unique violation", &pq.Error{Code: "23505"}, true},
+		{"postgres foreign key violation", &pq.Error{Code: "23503"}, false},
+		{"sqlite unique constraint", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, true},
+		{"sqlite primary key constraint", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}, true},
+		{"sqlite foreign key constraint", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintForeignKey}, false},
+		{"wrapped", fmt.Errorf("creating user: %w", &pq.Error{Code: "23505"}), true},
+		{"other error", errors.New("failed"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsUniqueViolation(tt.err))
+		})
+	}
+}
+
+func TestIsRetryableSQLite(t *testing.T) {
+	assert.True(t, IsRetryable(sqlite3.Error{Code: sqlite3.ErrBusy}))
+	assert.True(t, IsRetryable(sqlite3.Error{Code: sqlite3.ErrLocked}))
+	assert.False(t, IsRetryable(sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}))
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+)
+
+// unknownOperation labels the queries of a context no service method named.
+const unknownOperation = "unknown"
+
+var tracer = otel.Tracer("github.com/mathesukkj/goecommerce/order-service/internal/database")
+
+type operationKey struct{}
+
+// WithOperation names the service method ctx runs for, such as
+// "UserService.Login". The queries made through Conn with it are timed under
+// that name, the innermost one when methods call each other.
+func WithOperation(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, operationKey{}, name)
+}
+
+// Operation is the name WithOperation gave ctx.
+func Operation(ctx context.Context) string {
+	if name, ok := ctx.Value(operationKey{}).(string); ok {
+		return name
+	}
+	return unknownOperation
+}
+
+var (
+	stringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numberLiteral = regexp.MustCompile(`(^|[^\w$?.])\d+(?:\.\d+)?\b`)
+	whitespace    = regexp.MustCompile(`\s+`)
+)
+
+// sanitizeSQL replaces the literals of query with ?, so the statement
+// recorded in traces never holds a value, and puts it on a single line.
+// Values passed as arguments are left out of traces altogether.
+func sanitizeSQL(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numberLiteral.ReplaceAllString(query, "${1}?")
+	return strings.TrimSpace(whitespace.ReplaceAllString(query, " "))
+}
+
+// instrumentedConn times the queries it runs in metrics.QueryDuration and
+// traces each in a span holding its sanitized statement, up to the first row
+// for the queries returning rows.
+type instrumentedConn struct {
+	q         Querier
+	dialect   Dialect
+	operation string
+}
+
+// start begins tracing and timing query, the function returned ends both
+// with the error the query failed with.
+func (c instrumentedConn) start(ctx context.Context, query string) (context.Context, func(err error)) {
+	statement := sanitizeSQL(query)
+	verb, _, _ := strings.Cut(statement, " ")
+	verb = strings.ToUpper(verb)
+
+	system := semconv.DBSystemPostgreSQL
+	if c.dialect == SQLite {
+		system = semconv.DBSystemSqlite
+	}
+
+	ctx, span := tracer.Start(ctx, verb,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			system,
+			semconv.DBOperation(verb),
+			semconv.DBStatement(statement),
+			attribute.String("service.method", c.operation),
+		),
+	)
+	start := time.Now()
+
+	return ctx, func(err error) {
+		metrics.QueryDuration.WithLabelValues(c.operation).Observe(time.Since(start).Seconds())
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (c instrumentedConn) DriverName() string {
+	return c.q.DriverName()
+}
+
+func (c instrumentedConn) Rebind(query string) string {
+	return c.q.Rebind(query)
+}
+
+func (c instrumentedConn) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	return c.q.BindNamed(query, arg)
+}
+
+func (c instrumentedConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, end := c.start(ctx, query)
+	rows, err := c.q.QueryContext(ctx, query, args...)
+	end(err)
+	return rows, err
+}
+
+func (c instrumentedConn) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, end := c.start(ctx, query)
+	rows, err := c.q.QueryxContext(ctx, query, args...)
+	end(err)
+	return rows, err
+}
+
+func (c instrumentedConn) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	ctx, end := c.start(ctx, query)
+	row := c.q.QueryRowxContext(ctx, query, args...)
+	end(row.Err())
+	return row
+}
+
+func (c instrumentedConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, end := c.start(ctx, query)
+	result, err := c.q.ExecContext(ctx, query, args...)
+	end(err)
+	return result, err
+}
+
+func (c instrumentedConn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, end := c.start(ctx, query)
+	err := c.q.GetContext(ctx, dest, query, args...)
+	end(err)
+	return err
+}
+
+func (c instrumentedConn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, end := c.start(ctx, query)
+	err := c.q.SelectContext(ctx, dest, query, args...)
+	end(err)
+	return err
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	clientmodel "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+)
+
+// queryCount is how many queries were timed under operation.
+func queryCount(t *testing.T, operation string) uint64 {
+	t.Helper()
+
+	var m clientmodel.Metric
+	if err := metrics.QueryDuration.WithLabelValues(operation).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatalf("failed to read metric: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestOperation(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, unknownOperation, Operation(ctx))
+
+	ctx = WithOperation(ctx, "UserService.Login")
+	assert.Equal(t, "UserService.Login", Operation(ctx))
+	assert.Equal(t, "UserService.CreateUser", Operation(WithOperation(ctx, "UserService.CreateUser")), "the innermost method should win")
+}
+
+func TestConnMeasuresQueries(t *testing.T) {
+	_, db, mock := setupTxManager(t)
+	ctx := WithOperation(context.Background(), "ThingService.Rename")
+	before := queryCount(t, "ThingService.Rename")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE things SET name = $1")).WithArgs("thing").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM things")).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("thing"))
+
+	_, err := Conn(ctx, db).ExecContext(ctx, "UPDATE things SET name = $1", "thing")
+	assert.NoError(t, err)
+	var names []string
+	assert.NoError(t, Conn(ctx, db).SelectContext(ctx, &names, "SELECT name FROM things"))
+
+	assert.Equal(t, before+2, queryCount(t, "ThingService.Rename"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "placeholders",
+			query: "SELECT user_id FROM users WHERE email = $1 AND user_id > $2",
+			want:  "SELECT user_id FROM users WHERE email = $1 AND user_id > $2",
+		},
+		{
+			name:  "string literals",
+			query: "UPDATE users SET email = 'john@example.com', note = 'it''s' WHERE user_id = $1",
+			want:  "UPDATE users SET email = ?, note = ? WHERE user_id = $1",
+		},
+		{
+			name:  "number literals",
+			query: "SELECT amount FROM payments WHERE amount > 100 AND fee = 2.5 LIMIT 10",
+			want:  "SELECT amount FROM payments WHERE amount > ? AND fee = ? LIMIT ?",
+		},
+		{
+			name:  "identifiers with digits",
+			query: "SELECT t1.col2 FROM table3 t1",
+			want:  "SELECT t1.col2 FROM table3 t1",
+		},
+		{
+			name:  "multiline",
+			query: "\n\t\tSELECT user_id\n\t\tFROM users\n\t",
+			want:  "SELECT user_id FROM users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeSQL(tt.query))
+		})
+	}
+}
+
+func TestConnTracesQueries(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	_, db, mock := setupTxManager(t)
+	ctx := WithOperation(context.Background(), "ThingService.Rename")
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE things SET name = $1 WHERE kind = 'old'")).
+		WithArgs("secret name").
+		WillReturnError(errors.New("connection reset"))
+
+	_, err := Conn(ctx, db).ExecContext(ctx, "UPDATE things SET name = $1 WHERE kind = 'old'", "secret name")
+	assert.Error(t, err)
+
+	ended := spans.Ended()
+	if assert.Len(t, ended, 1) {
+		span := ended[0]
+		assert.Equal(t, "UPDATE", span.Name())
+		assert.Subset(t, span.Attributes(), []attribute.KeyValue{
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", "UPDATE things SET name = $1 WHERE kind = ?"),
+			attribute.String("service.method", "ThingService.Rename"),
+		})
+		assert.Equal(t, codes.Error, span.Status().Code)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
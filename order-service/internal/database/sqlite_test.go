@@ -0,0 +1,741 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/repositorytest"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/sqlrepo"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+	"github.com/mathesukkj/goecommerce/order-service/pkg/testutils"
+)
+
+func TestMain(m *testing.M) {
+	keyring, err := fieldcrypt.NewKeyring(1, map[int][]byte{1: bytes.Repeat([]byte{0x01}, 32)})
+	if err != nil {
+		panic(err)
+	}
+	fieldcrypt.SetKeyring(keyring)
+
+	os.Exit(m.Run())
+}
+
+func newSQLiteDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db := testutils.NewSQLiteDB(filepath.Join(t.TempDir(), "orders.db"))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// TestSQLiteContract runs the repositories written for postgres on SQLite.
+func TestSQLiteContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		db := newSQLiteDB(t)
+
+		return repositorytest.Repositories{
+			Users:          sqlrepo.NewUserRepository(db),
+			Addresses:      sqlrepo.NewAddressRepository(db),
+			PaymentMethods: sqlrepo.NewPaymentMethodRepository(db),
+		}
+	})
+}
+
+func TestSQLiteUserAlreadyExists(t *testing.T) {
+	auth := config.Default().Auth
+	ttls := service.TokenTTLs{
+		Session:       auth.TokenTTL,
+		Impersonation: auth.ImpersonationTokenTTL,
+		PasswordReset: auth.PasswordResetTokenTTL,
+	}
+	users := service.NewUserService(sqlrepo.NewUserRepository(newSQLiteDB(t)), ttls, nil)
+	payload := dto.SignupPayload{
+		Username: "john",
+		Password: "password123",
+		Email:    "john@example.com",
+	}
+
+	_, err := users.CreateUser(context.Background(), payload)
+	assert.NoError(t, err)
+
+	_, err = users.CreateUser(context.Background(), payload)
+	assert.ErrorIs(t, err, service.ErrUserAlreadyExists)
+}
+
+func TestSQLiteEncryptedFieldsBoundToTheirRow(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	users := sqlrepo.NewUserRepository(db)
+	addresses := sqlrepo.NewAddressRepository(db)
+
+	johnID, err := users.Create(ctx, entity.User{Username: "john", Password: "hash", Email: "john@example.com", PhoneNumber: "555-0100"})
+	assert.NoError(t, err)
+	janeID, err := users.Create(ctx, entity.User{Username: "jane", Password: "hash", Email: "jane@example.com", PhoneNumber: "555-0199"})
+	assert.NoError(t, err)
+	address, err := addresses.Create(ctx, entity.Address{UserID: johnID, StreetAddress: "123 Main St", City: "Anytown", PostalCode: "12345", Country: "USA"})
+	assert.NoError(t, err)
+	assert.Equal(t, fieldcrypt.EncryptedString("123 Main St"), address.StreetAddress)
+
+	john, err := users.FindByID(ctx, johnID)
+	assert.NoError(t, err)
+	assert.Equal(t, fieldcrypt.EncryptedString("555-0100"), john.PhoneNumber)
+
+	// a value copied over to another row or column doesn't decrypt
+	db.MustExec("UPDATE users SET phone_number = (SELECT phone_number FROM users WHERE user_id = $1) WHERE user_id = $2", johnID, janeID)
+	_, err = users.FindByID(ctx, janeID)
+	assert.ErrorIs(t, err, fieldcrypt.ErrInvalidEnvelope)
+
+	db.MustExec("UPDATE addresses SET city = street_address WHERE address_id = $1", address.AddressID)
+	_, err = addresses.FindByID(ctx, address.AddressID, johnID)
+	assert.ErrorIs(t, err, fieldcrypt.ErrInvalidEnvelope)
+}
+
+func TestSQLiteIdempotencyKeys(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	userID, err := sqlrepo.NewUserRepository(db).Create(ctx, entity.User{Username: "john", Password: "hash", Email: "john@example.com"})
+	assert.NoError(t, err)
+	keys := service.NewIdempotencyService(db)
+
+	first, stored, err := keys.BeginRequest(ctx, userID, "key", "fingerprint", time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, stored, "the key should be reserved")
+
+	_, stored, err = keys.BeginRequest(ctx, userID, "key", "fingerprint", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stored.StatusCode, "the key should be in progress")
+
+	// the request never finished and its lease ran out
+	db.MustExec("UPDATE idempotency_keys SET locked_until = '2000-01-01T00:00:00Z'")
+	_, stored, err = keys.BeginRequest(ctx, userID, "key", "other", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "fingerprint", stored.Fingerprint, "another request should not take the key over")
+	retry, stored, err := keys.BeginRequest(ctx, userID, "key", "fingerprint", time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, stored, "a retry should take the key over")
+
+	// the first request finishes after all, its key is no longer its own
+	header := http.Header{"Content-Type": {"application/json"}, "Location": {"/addresses/1"}}
+	assert.ErrorIs(t, keys.CompleteRequest(ctx, userID, "key", first, 500, nil, nil), service.ErrIdempotencyLeaseLost)
+	assert.ErrorIs(t, keys.ReleaseRequest(ctx, userID, "key", first), service.ErrIdempotencyLeaseLost)
+	assert.NoError(t, keys.CompleteRequest(ctx, userID, "key", retry, 201, header, []byte(`{"id":1}`)))
+	assert.ErrorIs(t, keys.CompleteRequest(ctx, userID, "key", retry, 201, header, []byte(`{"id":2}`)), service.ErrIdempotencyLeaseLost)
+
+	db.MustExec("UPDATE idempotency_keys SET locked_until = '2000-01-01T00:00:00Z'")
+	_, stored, err = keys.BeginRequest(ctx, userID, "key", "fingerprint", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.IdempotencyRecord{
+		Fingerprint:  "fingerprint",
+		StatusCode:   201,
+		Header:       header,
+		ResponseBody: []byte(`{"id":1}`),
+	}, stored, "a finished request should be replayed")
+
+	db.MustExec("UPDATE idempotency_keys SET expires_at = '2000-01-01T00:00:00Z'")
+	_, stored, err = keys.BeginRequest(ctx, userID, "key", "other", time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, stored, "the expired key should be reserved again")
+
+	purged, err := keys.PurgeExpired(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+}
+
+func TestSQLiteTransaction(t *testing.T) {
+	db := newSQLiteDB(t)
+	users := sqlrepo.NewUserRepository(db)
+	addresses := sqlrepo.NewAddressRepository(db)
+	txm := database.NewTxManager(db, nil)
+	errFailed := errors.New("failed")
+
+	var userID int
+	err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+		var err error
+		userID, err = users.Create(ctx, entity.User{Username: "john", Password: "hash", Email: "john@example.com"})
+		if err != nil {
+			return err
+		}
+
+		err = txm.WithinTx(ctx, func(ctx context.Context) error {
+			if _, err := addresses.Create(ctx, entity.Address{UserID: userID, Country: "USA"}); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	_, err = users.FindByID(context.Background(), userID)
+	assert.NoError(t, err, "the user should be committed")
+	q, err := listquery.Parse(url.Values{}, repository.AddressListSpec)
+	assert.NoError(t, err)
+	page, err := addresses.ListByUser(context.Background(), userID, q)
+	assert.NoError(t, err)
+	assert.Empty(t, page.Items, "the address should be rolled back")
+}
+
+func TestSQLiteVaultTransaction(t *testing.T) {
+	db := newSQLiteDB(t)
+	cardVault, err := vault.NewLocalVault(db, bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+	errFailed := errors.New("failed")
+
+	var token string
+	err = database.NewTxManager(db, nil).WithinTx(context.Background(), func(ctx context.Context) error {
+		var err error
+		if token, err = cardVault.Tokenize(ctx, "4242424242424242"); err != nil {
+			return err
+		}
+
+		pan, err := cardVault.Detokenize(ctx, token)
+		assert.NoError(t, err, "the card should be seen within the transaction")
+		assert.Equal(t, "4242424242424242", pan)
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	_, err = cardVault.Detokenize(context.Background(), token)
+	assert.ErrorIs(t, err, vault.ErrTokenNotFound, "the card should be rolled back")
+}
+
+// countingGateway counts the distinct idempotency keys authorizations were
+// asked for, that is the charges a real gateway would make.
+type countingGateway struct {
+	*payment.FakeGateway
+
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (g *countingGateway) Authorize(ctx context.Context, idempotencyKey string, c payment.Card, amount int) (string, error) {
+	g.mu.Lock()
+	g.keys[idempotencyKey] = true
+	g.mu.Unlock()
+
+	return g.FakeGateway.Authorize(ctx, idempotencyKey, c, amount)
+}
+
+// slowVault takes a while to detokenize, as a remote vault would, which
+// widens the window concurrent payments of an order race in.
+type slowVault struct {
+	*vault.LocalVault
+}
+
+func (v slowVault) Detokenize(ctx context.Context, token string) (string, error) {
+	time.Sleep(20 * time.Millisecond)
+	return v.LocalVault.Detokenize(ctx, token)
+}
+
+// seedOrder gives a new user the order 1, pending payment, of two items
+// costing 500 each paid with a card kept in the returned vault.
+func seedOrder(t *testing.T, db *sqlx.DB) (int, *vault.LocalVault) {
+	t.Helper()
+
+	ctx := context.Background()
+	userID, err := sqlrepo.NewUserRepository(db).Create(ctx, entity.User{Username: "john", Password: "hash", Email: "john@example.com"})
+	if err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	cardVault, err := vault.NewLocalVault(db, bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+	paymentMethod, err := service.NewPaymentMethodService(sqlrepo.NewPaymentMethodRepository(db), cardVault, database.NewTxManager(db, nil)).CreatePaymentMethod(ctx, dto.PaymentMethodPayload{
+		PaymentType:    "visa",
+		CardNumber:     "4242424242424242",
+		ExpirationDate: "2040-12-31",
+		CardHolderName: "John Doe",
+	}, userID)
+	if err != nil {
+		t.Fatalf("failed to seed payment method: %v", err)
+	}
+
+	db.MustExec("INSERT INTO products (product_name, price, stock_quantity) VALUES ('Mug', 500, 10), ('Plate', 500, 10)")
+	db.MustExec(
+		"INSERT INTO orders (user_id, total_amount, payment_method_id, order_status) VALUES ($1, $2, $3, $4)",
+		userID, 1000, paymentMethod.PaymentMethodID, entity.OrderStatusPendingPayment,
+	)
+	db.MustExec("INSERT INTO order_items (order_id, product_id, quantity, price_per_unit) VALUES (1, 1, 1, 500), (1, 2, 1, 500)")
+	return userID, cardVault
+}
+
+func TestSQLiteConcurrentAuthorizations(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	userID, cardVault := seedOrder(t, db)
+
+	gateway := &countingGateway{FakeGateway: payment.NewFakeGateway(), keys: map[string]bool{}}
+	payments := service.NewPaymentService(db, slowVault{cardVault}, gateway)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := payments.AuthorizeOrder(ctx, 1, userID)
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			assert.ErrorIs(t, err, service.ErrInvalidOrderStatus, "late calls should find the order authorized")
+		}
+	}
+	assert.Len(t, gateway.keys, 1, "the card should be charged once")
+
+	var authorizations int
+	assert.NoError(t, db.Get(&authorizations, "SELECT COUNT(*) FROM payments WHERE operation = 'authorize'"))
+	assert.Equal(t, 1, authorizations)
+
+	var status string
+	assert.NoError(t, db.Get(&status, "SELECT order_status FROM orders WHERE order_id = 1"))
+	assert.Equal(t, entity.OrderStatusAuthorized, status)
+}
+
+// slowGateway takes a while to refund, as a remote gateway would, which
+// widens the window concurrent refunds of an order race in.
+type slowGateway struct {
+	*payment.FakeGateway
+}
+
+func (g slowGateway) Refund(ctx context.Context, idempotencyKey, captureRef string, amount int) (string, error) {
+	time.Sleep(20 * time.Millisecond)
+	return g.FakeGateway.Refund(ctx, idempotencyKey, captureRef, amount)
+}
+
+func TestSQLiteConcurrentRefunds(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	userID, cardVault := seedOrder(t, db)
+	gateway := slowGateway{payment.NewFakeGateway()}
+	payments := service.NewPaymentService(db, cardVault, gateway)
+	_, err := payments.AuthorizeOrder(ctx, 1, userID)
+	assert.NoError(t, err)
+	_, err = payments.CaptureOrder(ctx, 1)
+	assert.NoError(t, err)
+
+	refunds := service.NewRefundService(db, cardVault, gateway)
+	payload := dto.RefundPayload{Items: []dto.RefundItemPayload{{OrderItemID: 1, Quantity: 1}}}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, 3)
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := refunds.RefundOrder(ctx, 1, userID, payload)
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, service.ErrRefundQuantityExceeded)
+	}
+	assert.Equal(t, 1, succeeded, "the item should be refunded once")
+
+	refundable, err := payments.RefundableAmount(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 500, refundable, "only the price of the item should go back")
+
+	var stock int
+	assert.NoError(t, db.Get(&stock, "SELECT stock_quantity FROM products WHERE product_id = 1"))
+	assert.Equal(t, 11, stock)
+}
+
+// timeoutGateway times out on every authorization and refund, leaving their
+// outcome to the provider webhook.
+type timeoutGateway struct {
+	*payment.FakeGateway
+}
+
+func (g timeoutGateway) Authorize(ctx context.Context, idempotencyKey string, c payment.Card, amount int) (string, error) {
+	return "", payment.ErrGatewayTimeout
+}
+
+func (g timeoutGateway) Refund(ctx context.Context, idempotencyKey, captureRef string, amount int) (string, error) {
+	return "", payment.ErrGatewayTimeout
+}
+
+func TestSQLiteRefundSettledByWebhook(t *testing.T) {
+	tests := []struct {
+		name           string
+		eventType      string
+		wantStock      int
+		wantRefunds    int
+		wantRefundable int
+	}{
+		{
+			name:           "succeeded",
+			eventType:      entity.PaymentEventSucceeded,
+			wantStock:      11,
+			wantRefunds:    1,
+			wantRefundable: 500,
+		},
+		{
+			name:           "failed",
+			eventType:      entity.PaymentEventFailed,
+			wantStock:      10,
+			wantRefunds:    0,
+			wantRefundable: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSQLiteDB(t)
+			ctx := context.Background()
+			userID, cardVault := seedOrder(t, db)
+			gateway := payment.NewFakeGateway()
+			payments := service.NewPaymentService(db, cardVault, gateway)
+			_, err := payments.AuthorizeOrder(ctx, 1, userID)
+			assert.NoError(t, err)
+			_, err = payments.CaptureOrder(ctx, 1)
+			assert.NoError(t, err)
+
+			payload := dto.RefundPayload{Items: []dto.RefundItemPayload{{OrderItemID: 1, Quantity: 1}}}
+			_, err = service.NewRefundService(db, cardVault, timeoutGateway{gateway}).RefundOrder(ctx, 1, userID, payload)
+			assert.ErrorIs(t, err, payment.ErrGatewayTimeout)
+
+			var stock int
+			assert.NoError(t, db.Get(&stock, "SELECT stock_quantity FROM products WHERE product_id = 1"))
+			assert.Equal(t, 10, stock, "nothing should be restocked before the refund settles")
+
+			var key string
+			assert.NoError(t, db.Get(&key, "SELECT idempotency_key FROM payments WHERE operation = 'refund'"))
+			err = service.NewPaymentEventService(db).IngestEvent(ctx, "fake", dto.PaymentEventPayload{
+				ID:   "evt_1",
+				Type: tt.eventType,
+				Data: dto.PaymentEventData{IdempotencyKey: key, Amount: 500, Currency: "USD", Reference: "ref_1"},
+			}, []byte(`{"id":"evt_1"}`))
+			assert.NoError(t, err)
+
+			assert.NoError(t, db.Get(&stock, "SELECT stock_quantity FROM products WHERE product_id = 1"))
+			assert.Equal(t, tt.wantStock, stock)
+
+			var refunds int
+			assert.NoError(t, db.Get(&refunds, "SELECT COUNT(*) FROM refunds"))
+			assert.Equal(t, tt.wantRefunds, refunds)
+
+			refundable, err := payments.RefundableAmount(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRefundable, refundable)
+
+			// the item of a failed refund can be refunded again
+			_, err = service.NewRefundService(db, cardVault, gateway).RefundOrder(ctx, 1, userID, payload)
+			if tt.eventType == entity.PaymentEventFailed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, service.ErrRefundQuantityExceeded)
+			}
+		})
+	}
+}
+
+func TestSQLiteCancelOrderWithPendingAuthorization(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	userID, cardVault := seedOrder(t, db)
+	gateway := payment.NewFakeGateway()
+
+	_, err := service.NewPaymentService(db, cardVault, timeoutGateway{gateway}).AuthorizeOrder(ctx, 1, userID)
+	assert.ErrorIs(t, err, payment.ErrGatewayTimeout)
+
+	cancellations := service.NewCancellationService(db, cardVault, gateway, config.Default().Orders.CancellationWindow)
+	err = cancellations.CancelOrder(ctx, 1, userID, "changed my mind")
+	assert.ErrorIs(t, err, service.ErrPaymentPending)
+
+	var stock int
+	assert.NoError(t, db.Get(&stock, "SELECT stock_quantity FROM products WHERE product_id = 1"))
+	assert.Equal(t, 10, stock, "stock should not be released")
+
+	// an order cancelled anyway stays cancelled once the authorization lands
+	db.MustExec("UPDATE orders SET order_status = $1 WHERE order_id = 1", entity.OrderStatusCancelled)
+	var key string
+	assert.NoError(t, db.Get(&key, "SELECT idempotency_key FROM payments WHERE operation = 'authorize'"))
+	_, err = service.NewPaymentService(db, nil, nil).SettlePayment(ctx, "fake", key, 1000, "USD", "auth_1", "")
+	assert.NoError(t, err)
+
+	var status string
+	assert.NoError(t, db.Get(&status, "SELECT order_status FROM orders WHERE order_id = 1"))
+	assert.Equal(t, entity.OrderStatusCancelled, status)
+}
+
+func TestSQLiteCancelOrderResumesRefund(t *testing.T) {
+	tests := []struct {
+		name string
+		// settle has the provider webhook settle the refund before the
+		// cancellation is retried
+		settle bool
+	}{
+		{name: "refund still pending"},
+		{name: "refund settled by webhook", settle: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSQLiteDB(t)
+			ctx := context.Background()
+			userID, cardVault := seedOrder(t, db)
+			gateway := payment.NewFakeGateway()
+			payments := service.NewPaymentService(db, cardVault, gateway)
+			_, err := payments.AuthorizeOrder(ctx, 1, userID)
+			assert.NoError(t, err)
+			_, err = payments.CaptureOrder(ctx, 1)
+			assert.NoError(t, err)
+
+			err = service.NewCancellationService(db, cardVault, timeoutGateway{gateway}, config.Default().Orders.CancellationWindow).
+				CancelOrder(ctx, 1, userID, "changed my mind")
+			assert.ErrorIs(t, err, payment.ErrGatewayTimeout)
+
+			if tt.settle {
+				var key string
+				assert.NoError(t, db.Get(&key, "SELECT idempotency_key FROM payments WHERE operation = 'refund'"))
+				_, err = service.NewPaymentService(db, nil, nil).SettlePayment(ctx, "fake", key, 1000, "USD", "ref_1", "")
+				assert.NoError(t, err)
+			}
+
+			err = service.NewCancellationService(db, cardVault, gateway, config.Default().Orders.CancellationWindow).
+				CancelOrder(ctx, 1, userID, "changed my mind")
+			assert.NoError(t, err)
+
+			var refunds int
+			assert.NoError(t, db.Get(&refunds, "SELECT COUNT(*) FROM payments WHERE operation = 'refund'"))
+			assert.Equal(t, 1, refunds, "the retry should resume the refund of the first attempt")
+
+			refundable, err := payments.RefundableAmount(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, refundable)
+
+			var status string
+			assert.NoError(t, db.Get(&status, "SELECT order_status FROM orders WHERE order_id = 1"))
+			assert.Equal(t, entity.OrderStatusCancelled, status)
+
+			var stock int
+			assert.NoError(t, db.Get(&stock, "SELECT stock_quantity FROM products WHERE product_id = 1"))
+			assert.Equal(t, 11, stock, "the cancellation alone should put the item back")
+		})
+	}
+}
+
+func TestSQLiteCancelOrderIgnoresAdminRefund(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	userID, cardVault := seedOrder(t, db)
+	gateway := payment.NewFakeGateway()
+	payments := service.NewPaymentService(db, cardVault, gateway)
+	_, err := payments.AuthorizeOrder(ctx, 1, userID)
+	assert.NoError(t, err)
+	_, err = payments.CaptureOrder(ctx, 1)
+	assert.NoError(t, err)
+
+	// an admin refund that merely reads like a cancellation
+	payload := dto.RefundPayload{Reason: "order cancelled", Items: []dto.RefundItemPayload{{OrderItemID: 1, Quantity: 1}}}
+	_, err = service.NewRefundService(db, cardVault, timeoutGateway{gateway}).RefundOrder(ctx, 1, userID, payload)
+	assert.ErrorIs(t, err, payment.ErrGatewayTimeout)
+
+	err = service.NewCancellationService(db, cardVault, gateway, config.Default().Orders.CancellationWindow).
+		CancelOrder(ctx, 1, userID, "changed my mind")
+	assert.ErrorIs(t, err, service.ErrPaymentPending, "the admin refund should not be resumed as the cancellation refund")
+
+	var status string
+	assert.NoError(t, db.Get(&status, "SELECT order_status FROM orders WHERE order_id = 1"))
+	assert.Equal(t, entity.OrderStatusPaid, status)
+}
+
+func TestSQLiteReceiveReturnResumesRefund(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	userID, cardVault := seedOrder(t, db)
+	gateway := payment.NewFakeGateway()
+	payments := service.NewPaymentService(db, cardVault, gateway)
+	_, err := payments.AuthorizeOrder(ctx, 1, userID)
+	assert.NoError(t, err)
+	_, err = payments.CaptureOrder(ctx, 1)
+	assert.NoError(t, err)
+
+	// placed long before the return window, delivered just now
+	db.MustExec("UPDATE orders SET order_date = strftime('%Y-%m-%dT%H:%M:%SZ', 'now', '-60 days') WHERE order_id = 1")
+	db.MustExec("UPDATE orders SET order_status = $1 WHERE order_id = 1", entity.OrderStatusDelivered)
+	var delivered bool
+	assert.NoError(t, db.Get(&delivered, "SELECT delivered_at IS NOT NULL FROM orders WHERE order_id = 1"))
+	assert.True(t, delivered, "the delivery should be recorded")
+
+	returns := service.NewReturnService(db, cardVault, timeoutGateway{gateway}, config.Default().Orders.ReturnWindow)
+	ret, err := returns.RequestReturn(ctx, 1, userID, dto.ReturnPayload{
+		Items: []dto.ReturnItemPayload{{OrderItemID: 1, Quantity: 1, ReasonCode: entity.ReturnReasonDamaged}},
+	})
+	assert.NoError(t, err, "the window should count from the delivery")
+	ret, err = returns.ApproveReturn(ctx, ret.ReturnID)
+	assert.NoError(t, err)
+
+	inspection := dto.InspectionPayload{
+		Items: []dto.InspectedItemPayload{{ReturnItemID: ret.Items[0].ReturnItemID, Outcome: entity.ReturnOutcomeRestock}},
+	}
+	_, err = returns.ReceiveReturn(ctx, ret.ReturnID, userID, inspection)
+	assert.ErrorIs(t, err, payment.ErrGatewayTimeout)
+
+	ret, err = service.NewReturnService(db, cardVault, gateway, config.Default().Orders.ReturnWindow).ReceiveReturn(ctx, ret.ReturnID, userID, inspection)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.ReturnStatusCompleted, ret.Status)
+
+	var refunds int
+	assert.NoError(t, db.Get(&refunds, "SELECT COUNT(*) FROM payments WHERE operation = 'refund'"))
+	assert.Equal(t, 1, refunds, "the retry should resume the refund of the first attempt")
+
+	refundable, err := payments.RefundableAmount(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 500, refundable)
+
+	var stock int
+	assert.NoError(t, db.Get(&stock, "SELECT stock_quantity FROM products WHERE product_id = 1"))
+	assert.Equal(t, 11, stock, "the inspection alone should put the item back")
+}
+
+func TestSQLiteReceiveReturnAfterAdminRefund(t *testing.T) {
+	tests := []struct {
+		name         string
+		returned     []dto.ReturnItemPayload
+		wantRefunded int
+		wantRefund   bool
+	}{
+		{
+			name: "other item left to refund",
+			returned: []dto.ReturnItemPayload{
+				{OrderItemID: 1, Quantity: 1, ReasonCode: entity.ReturnReasonDamaged},
+				{OrderItemID: 2, Quantity: 1, ReasonCode: entity.ReturnReasonDamaged},
+			},
+			wantRefunded: 500,
+			wantRefund:   true,
+		},
+		{
+			name:     "nothing left to refund",
+			returned: []dto.ReturnItemPayload{{OrderItemID: 1, Quantity: 1, ReasonCode: entity.ReturnReasonDamaged}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSQLiteDB(t)
+			ctx := context.Background()
+			userID, cardVault := seedOrder(t, db)
+			gateway := payment.NewFakeGateway()
+			payments := service.NewPaymentService(db, cardVault, gateway)
+			_, err := payments.AuthorizeOrder(ctx, 1, userID)
+			assert.NoError(t, err)
+			_, err = payments.CaptureOrder(ctx, 1)
+			assert.NoError(t, err)
+			db.MustExec("UPDATE orders SET order_status = $1 WHERE order_id = 1", entity.OrderStatusDelivered)
+
+			returns := service.NewReturnService(db, cardVault, gateway, config.Default().Orders.ReturnWindow)
+			ret, err := returns.RequestReturn(ctx, 1, userID, dto.ReturnPayload{Items: tt.returned})
+			assert.NoError(t, err)
+			ret, err = returns.ApproveReturn(ctx, ret.ReturnID)
+			assert.NoError(t, err)
+
+			// an admin refunds the first item meanwhile
+			_, err = service.NewRefundService(db, cardVault, gateway).RefundOrder(ctx, 1, userID, dto.RefundPayload{
+				Items: []dto.RefundItemPayload{{OrderItemID: 1, Quantity: 1}},
+			})
+			assert.NoError(t, err)
+
+			var inspection dto.InspectionPayload
+			for _, item := range ret.Items {
+				inspection.Items = append(inspection.Items, dto.InspectedItemPayload{ReturnItemID: item.ReturnItemID, Outcome: entity.ReturnOutcomeWriteOff})
+			}
+			ret, err = returns.ReceiveReturn(ctx, ret.ReturnID, userID, inspection)
+			assert.NoError(t, err)
+			assert.Equal(t, entity.ReturnStatusCompleted, ret.Status)
+			assert.Equal(t, tt.wantRefund, ret.RefundID != 0)
+
+			var refunded int
+			assert.NoError(t, db.Get(&refunded, "SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE refund_id IN (SELECT refund_id FROM returns)"))
+			assert.Equal(t, tt.wantRefunded, refunded)
+		})
+	}
+}
+
+func TestSQLiteDeletePaymentMethodInUse(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	userID, cardVault := seedOrder(t, db)
+	paymentMethods := service.NewPaymentMethodService(sqlrepo.NewPaymentMethodRepository(db), cardVault, database.NewTxManager(db, nil))
+
+	err := paymentMethods.DeletePaymentMethod(ctx, 1, userID)
+	assert.ErrorIs(t, err, service.ErrPaymentMethodInUse)
+
+	var token string
+	assert.NoError(t, db.Get(&token, "SELECT card_token FROM payment_methods WHERE payment_method_id = 1"))
+	_, err = cardVault.Detokenize(ctx, token)
+	assert.NoError(t, err, "the card should stay in the vault")
+}
+
+// failingVault fails to delete cards.
+type failingVault struct {
+	vault.Vault
+}
+
+func (v failingVault) Delete(ctx context.Context, token string) error {
+	return errors.New("vault unavailable")
+}
+
+func TestSQLiteDeletePaymentMethodVaultFailure(t *testing.T) {
+	db := newSQLiteDB(t)
+	ctx := context.Background()
+	userID, cardVault := seedOrder(t, db)
+	paymentMethods := service.NewPaymentMethodService(sqlrepo.NewPaymentMethodRepository(db), failingVault{cardVault}, database.NewTxManager(db, nil))
+	paymentMethod, err := paymentMethods.CreatePaymentMethod(ctx, dto.PaymentMethodPayload{
+		PaymentType:    "visa",
+		CardNumber:     "4111111111111111",
+		ExpirationDate: "2040-12-31",
+		CardHolderName: "John Doe",
+	}, userID)
+	assert.NoError(t, err)
+
+	err = paymentMethods.DeletePaymentMethod(ctx, paymentMethod.PaymentMethodID, userID)
+	assert.Error(t, err)
+
+	_, err = paymentMethods.GetPaymentMethodByID(ctx, paymentMethod.PaymentMethodID, userID)
+	assert.NoError(t, err, "the payment method should be kept along with its card")
+}
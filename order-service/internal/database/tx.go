@@ -0,0 +1,158 @@
+// Package database lets services and repositories run their queries in the
+// transaction a caller started, so writes spanning several of them commit or
+// roll back as one unit of work.
+//
+// TxManager.WithinTx carries the transaction in the context it passes on, and
+// Conn picks it back up, falling back to the database outside of one.
+//
+// Queries are written for postgres, Conn translates them when the database is
+// a SQLite file, which lets the service run without a postgres server. It
+// also times and traces them by the service method, named with WithOperation,
+// they run for.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// maxAttempts is how many times WithinTx runs a transaction the database keeps
+// aborting, see IsRetryable.
+const maxAttempts = 3
+
+// retryBackoff is the pause before the second attempt, it grows linearly with
+// each attempt.
+var retryBackoff = 20 * time.Millisecond
+
+// Querier is what *sqlx.DB and *sqlx.Tx have in common.
+type Querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+type txKey struct{}
+
+// ambientTx is the transaction a context runs in, savepoints counts the
+// savepoints opened in it to name each one uniquely.
+type ambientTx struct {
+	tx         *sqlx.Tx
+	savepoints int
+}
+
+// Conn returns the transaction ctx runs in, or db when it runs in none. On
+// SQLite the queries made through it are translated from postgres. Every
+// query is timed under the Operation of ctx and traced.
+func Conn(ctx context.Context, db *sqlx.DB) Querier {
+	var q Querier = db
+	if a, ok := ctx.Value(txKey{}).(*ambientTx); ok {
+		q = a.tx
+	}
+
+	dialect := DialectOf(db)
+	if dialect == SQLite {
+		q = sqliteConn{q: q}
+	}
+	return instrumentedConn{q: q, dialect: dialect, operation: Operation(ctx)}
+}
+
+type TxManager struct {
+	db   *sqlx.DB
+	opts *sql.TxOptions
+}
+
+// NewTxManager starts its transactions with opts, nil keeping the isolation
+// level of the database.
+func NewTxManager(db *sqlx.DB, opts *sql.TxOptions) *TxManager {
+	return &TxManager{db: db, opts: opts}
+}
+
+// WithinTx runs fn in a transaction, committed when fn returns nil and rolled
+// back otherwise. The queries fn makes through Conn with the context it is
+// given run in that transaction.
+//
+// Inside another transaction fn runs in a savepoint of it instead, so its
+// failure only undoes its own writes and the caller decides what to do next.
+//
+// A transaction the database aborts for a reason IsRetryable accepts is run
+// again from the start, so fn must have no effect outside the database.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if a, ok := ctx.Value(txKey{}).(*ambientTx); ok {
+		return a.savepoint(ctx, fn)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := m.run(ctx, fn)
+		if attempt == maxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
+	}
+}
+
+func (m *TxManager) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := m.db.BeginTxx(ctx, m.opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, &ambientTx{tx: tx})); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (a *ambientTx) savepoint(ctx context.Context, fn func(ctx context.Context) error) error {
+	a.savepoints++
+	name := fmt.Sprintf("sp_%d", a.savepoints)
+
+	if _, err := a.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	if err := fn(ctx); err != nil {
+		if _, rollbackErr := a.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+
+	_, err := a.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+// IsRetryable reports whether err is the database aborting a transaction
+// that may go through when run again: a serialization failure or a deadlock
+// on postgres, SQLite still being locked by another writer once its busy
+// timeout passed.
+func IsRetryable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	switch pqErr.Code.Name() {
+	case "serialization_failure", "deadlock_detected":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTxManager(t *testing.T) (*TxManager, *sqlx.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	return NewTxManager(sqlxDB, nil), sqlxDB, mock
+}
+
+// insert is a write made through the ambient transaction of ctx.
+func insert(ctx context.Context, db *sqlx.DB, name string) error {
+	_, err := Conn(ctx, db).ExecContext(ctx, "INSERT INTO things (name) VALUES ($1)", name)
+	return err
+}
+
+func expectInsert(mock sqlmock.Sqlmock, name string) *sqlmock.ExpectedExec {
+	return mock.ExpectExec(regexp.QuoteMeta("INSERT INTO things (name) VALUES ($1)")).WithArgs(name)
+}
+
+func TestWithinTx(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name    string
+		fn      func(ctx context.Context, db *sqlx.DB) error
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "commits when fn succeeds",
+			fn: func(ctx context.Context, db *sqlx.DB) error {
+				return insert(ctx, db, "a")
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectInsert(mock, "a").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "rolls back when fn fails",
+			fn: func(ctx context.Context, db *sqlx.DB) error {
+				if err := insert(ctx, db, "a"); err != nil {
+					return err
+				}
+				return errFailed
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectInsert(mock, "a").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectRollback()
+			},
+			wantErr: errFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txm, db, mock := setupTxManager(t)
+			tt.expect(mock)
+
+			err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+				return tt.fn(ctx, db)
+			})
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestWithinTxNested(t *testing.T) {
+	txm, db, mock := setupTxManager(t)
+	errFailed := errors.New("failed")
+
+	mock.ExpectBegin()
+	expectInsert(mock, "outer").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectInsert(mock, "kept").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectInsert(mock, "undone").WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+		if err := insert(ctx, db, "outer"); err != nil {
+			return err
+		}
+
+		err := txm.WithinTx(ctx, func(ctx context.Context) error {
+			return insert(ctx, db, "kept")
+		})
+		if err != nil {
+			return err
+		}
+
+		err = txm.WithinTx(ctx, func(ctx context.Context) error {
+			if err := insert(ctx, db, "undone"); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithinTxRetry(t *testing.T) {
+	retryBackoff = 0
+	serializationFailure := &pq.Error{Code: "40001"}
+
+	t.Run("retries a serialization failure", func(t *testing.T) {
+		txm, db, mock := setupTxManager(t)
+
+		mock.ExpectBegin()
+		expectInsert(mock, "a").WillReturnError(serializationFailure)
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		expectInsert(mock, "a").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		attempts := 0
+		err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return insert(ctx, db, "a")
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		txm, db, mock := setupTxManager(t)
+
+		for range maxAttempts {
+			mock.ExpectBegin()
+			expectInsert(mock, "a").WillReturnError(&pq.Error{Code: "40P01"})
+			mock.ExpectRollback()
+		}
+
+		err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+			return insert(ctx, db, "a")
+		})
+		assert.True(t, IsRetryable(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		txm, db, mock := setupTxManager(t)
+
+		mock.ExpectBegin()
+		expectInsert(mock, "a").WillReturnError(&pq.Error{Code: "23505"})
+		mock.ExpectRollback()
+
+		err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+			return insert(ctx, db, "a")
+		})
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestConn(t *testing.T) {
+	txm, db, mock := setupTxManager(t)
+
+	assert.Equal(t, instrumentedConn{q: db, dialect: Postgres, operation: unknownOperation}, Conn(context.Background(), db))
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+		_, ok := Conn(ctx, db).(instrumentedConn).q.(*sqlx.Tx)
+		assert.True(t, ok, "Conn() should return the ambient transaction")
+		return nil
+	})
+	assert.NoError(t, err)
+}
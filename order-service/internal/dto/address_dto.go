@@ -1,7 +1,5 @@
 package dto
 
-import "github.com/go-playground/validator/v10"
-
 type AddressPayload struct {
 	StreetAddress string `json:"street_address" validate:"required"`
 	City          string `json:"city" validate:"required"`
@@ -11,6 +9,5 @@ type AddressPayload struct {
 }
 
 func (a *AddressPayload) Validate() error {
-	validate := validator.New()
-	return validate.Struct(a)
+	return validateStruct(a)
 }
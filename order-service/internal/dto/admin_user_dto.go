@@ -0,0 +1,27 @@
+package dto
+
+import "github.com/mathesukkj/goecommerce/order-service/internal/entity"
+
+const (
+	DefaultUserSearchPageSize = 20
+	MaxUserSearchPageSize     = 100
+)
+
+type UserSearchQuery struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Page     int    `json:"page" validate:"min=1"`
+	PageSize int    `json:"page_size" validate:"min=1,max=100"`
+}
+
+func (q *UserSearchQuery) Validate() error {
+	return validateStruct(q)
+}
+
+type UserSearchResponse struct {
+	Users    []entity.User `json:"users"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Total    int           `json:"total"`
+}
@@ -0,0 +1,38 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserSearchQuery_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   UserSearchQuery
+		wantErr bool
+	}{
+		{
+			name:    "valid query",
+			query:   UserSearchQuery{Email: "user@example.com", Page: 1, PageSize: 20},
+			wantErr: false,
+		},
+		{
+			name:    "page zero",
+			query:   UserSearchQuery{Page: 0, PageSize: 20},
+			wantErr: true,
+		},
+		{
+			name:    "page size above maximum",
+			query:   UserSearchQuery{Page: 1, PageSize: MaxUserSearchPageSize + 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
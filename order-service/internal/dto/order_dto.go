@@ -1,7 +1,5 @@
 package dto
 
-import "github.com/go-playground/validator/v10"
-
 type OrderPayload struct {
 	OrderDate         string `json:"order_date" validate:"required"`
 	TotalAmount       int    `json:"total_amount" validate:"required,min=1"`
@@ -11,6 +9,27 @@ type OrderPayload struct {
 }
 
 func (a *OrderPayload) Validate() error {
-	validate := validator.New()
-	return validate.Struct(a)
+	return validateStruct(a)
+}
+
+type CancelOrderPayload struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+func (a *CancelOrderPayload) Validate() error {
+	return validateStruct(a)
+}
+
+// OrderSearchQuery narrows down the order history, dates are inclusive and
+// every field is optional.
+type OrderSearchQuery struct {
+	OrderDateFrom string `json:"order_date_from" validate:"omitempty,datetime=2006-01-02"`
+	OrderDateTo   string `json:"order_date_to" validate:"omitempty,datetime=2006-01-02"`
+	MinAmount     int    `json:"min_amount" validate:"min=0"`
+	MaxAmount     int    `json:"max_amount" validate:"omitempty,gtefield=MinAmount"`
+	Product       string `json:"product" validate:"max=100"`
+}
+
+func (a *OrderSearchQuery) Validate() error {
+	return validateStruct(a)
 }
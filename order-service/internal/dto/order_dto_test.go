@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -87,3 +88,81 @@ func TestOrderPayload_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestCancelOrderPayload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload CancelOrderPayload
+		wantErr bool
+	}{
+		{
+			name:    "valid payload",
+			payload: CancelOrderPayload{Reason: "ordered by mistake"},
+			wantErr: false,
+		},
+		{
+			name:    "missing reason",
+			payload: CancelOrderPayload{},
+			wantErr: true,
+		},
+		{
+			name:    "reason too long",
+			payload: CancelOrderPayload{Reason: strings.Repeat("a", 256)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.payload.Validate()
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestOrderSearchQuery_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   OrderSearchQuery
+		wantErr bool
+	}{
+		{
+			name:    "no filters",
+			query:   OrderSearchQuery{},
+			wantErr: false,
+		},
+		{
+			name: "every filter",
+			query: OrderSearchQuery{
+				OrderDateFrom: "2024-01-01",
+				OrderDateTo:   "2024-12-31",
+				MinAmount:     100,
+				MaxAmount:     500,
+				Product:       "keyboard",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "invalid date",
+			query:   OrderSearchQuery{OrderDateFrom: "01/01/2024"},
+			wantErr: true,
+		},
+		{
+			name:    "negative amount",
+			query:   OrderSearchQuery{MinAmount: -1},
+			wantErr: true,
+		},
+		{
+			name:    "max below min",
+			query:   OrderSearchQuery{MinAmount: 500, MaxAmount: 100},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package dto
+
+// PaymentEventPayload is the body of a payment provider webhook.
+type PaymentEventPayload struct {
+	ID   string           `json:"id" validate:"required,max=255"`
+	Type string           `json:"type" validate:"required,max=100"`
+	Data PaymentEventData `json:"data"`
+}
+
+type PaymentEventData struct {
+	// IdempotencyKey is the key we sent with the gateway call the event is
+	// about.
+	IdempotencyKey string `json:"idempotency_key" validate:"required,max=64"`
+	// Amount and Currency are what the gateway call moved, or would have.
+	Amount      int    `json:"amount" validate:"gt=0"`
+	Currency    string `json:"currency" validate:"required,len=3"`
+	Reference   string `json:"reference" validate:"max=64"`
+	FailureCode string `json:"failure_code" validate:"max=50"`
+}
+
+func (p *PaymentEventPayload) Validate() error {
+	return validateStruct(p)
+}
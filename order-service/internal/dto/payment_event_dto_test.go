@@ -0,0 +1,75 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentEventPayload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload PaymentEventPayload
+		wantErr bool
+	}{
+		{
+			name: "valid payload",
+			payload: PaymentEventPayload{
+				ID:   "evt_1",
+				Type: "payment.succeeded",
+				Data: PaymentEventData{IdempotencyKey: "pay_1", Amount: 1000, Currency: "USD", Reference: "auth_1"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing amount",
+			payload: PaymentEventPayload{
+				ID:   "evt_1",
+				Type: "payment.succeeded",
+				Data: PaymentEventData{IdempotencyKey: "pay_1", Currency: "USD"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid currency",
+			payload: PaymentEventPayload{
+				ID:   "evt_1",
+				Type: "payment.succeeded",
+				Data: PaymentEventData{IdempotencyKey: "pay_1", Amount: 1000, Currency: "dollars"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing id",
+			payload: PaymentEventPayload{
+				Type: "payment.succeeded",
+				Data: PaymentEventData{IdempotencyKey: "pay_1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing type",
+			payload: PaymentEventPayload{
+				ID:   "evt_1",
+				Data: PaymentEventData{IdempotencyKey: "pay_1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing idempotency key",
+			payload: PaymentEventPayload{
+				ID:   "evt_1",
+				Type: "payment.failed",
+				Data: PaymentEventData{FailureCode: "card_declined"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.payload.Validate()
+			assert.Equal(t, tt.wantErr, err != nil, "Validate() error = %v, wantErr %v", err, tt.wantErr)
+		})
+	}
+}
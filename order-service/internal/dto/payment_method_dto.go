@@ -1,15 +1,32 @@
 package dto
 
-import "github.com/go-playground/validator/v10"
+import (
+	"strings"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/card"
+)
 
 type PaymentMethodPayload struct {
-	PaymentType    string `json:"payment_type" validate:"required"`
-	CardNumber     string `json:"card_number" validate:"required"`
-	ExpirationDate string `json:"expiration_date" validate:"required"`
-	CardHolderName string `json:"card_holder_name" validate:"required"`
+	// filled from the card number by Normalize, any value sent is replaced
+	PaymentType    string `json:"payment_type"`
+	CardNumber     string `json:"card_number" validate:"required,card_number,card_brand"`
+	ExpirationDate string `json:"expiration_date" validate:"required,card_expiry"`
+	CardHolderName string `json:"card_holder_name" validate:"required,min=2,max=100,card_holder"`
 }
 
 func (p *PaymentMethodPayload) Validate() error {
-	validate := validator.New()
-	return validate.Struct(p)
+	return validateStruct(p)
+}
+
+// Normalize must be called after a successful Validate, it strips the card
+// number, detects its brand and turns the MM/YY expiry into the date stored.
+func (p *PaymentMethodPayload) Normalize() {
+	p.CardNumber = card.Normalize(p.CardNumber)
+	p.PaymentType = string(card.DetectBrand(p.CardNumber))
+	p.CardHolderName = strings.TrimSpace(p.CardHolderName)
+
+	if expiry, err := card.ParseExpiry(p.ExpirationDate); err == nil {
+		p.ExpirationDate = expiry.Format(time.DateOnly)
+	}
 }
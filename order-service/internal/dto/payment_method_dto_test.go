@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
 )
 
 func TestPaymentMethodPayload_Validate(t *testing.T) {
@@ -15,27 +17,43 @@ func TestPaymentMethodPayload_Validate(t *testing.T) {
 		{
 			name: "valid payload",
 			payload: PaymentMethodPayload{
-				PaymentType:    "credit_card",
-				CardNumber:     "1234567890123456",
-				ExpirationDate: "12/25",
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "12/40",
 				CardHolderName: "John Doe",
 			},
 			wantErr: false,
 		},
 		{
-			name: "missing payment type",
+			name: "card number with separators",
+			payload: PaymentMethodPayload{
+				CardNumber:     "3782-822463-10005",
+				ExpirationDate: "12/40",
+				CardHolderName: "Mary-Jane O'Neil",
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing card number",
+			payload: PaymentMethodPayload{
+				ExpirationDate: "12/40",
+				CardHolderName: "John Doe",
+			},
+			wantErr: true,
+		},
+		{
+			name: "card number failing luhn check",
 			payload: PaymentMethodPayload{
 				CardNumber:     "1234567890123456",
-				ExpirationDate: "12/25",
+				ExpirationDate: "12/40",
 				CardHolderName: "John Doe",
 			},
 			wantErr: true,
 		},
 		{
-			name: "missing card number",
+			name: "unsupported card brand",
 			payload: PaymentMethodPayload{
-				PaymentType:    "credit_card",
-				ExpirationDate: "12/25",
+				CardNumber:     "9999999999999995",
+				ExpirationDate: "12/40",
 				CardHolderName: "John Doe",
 			},
 			wantErr: true,
@@ -43,8 +61,25 @@ func TestPaymentMethodPayload_Validate(t *testing.T) {
 		{
 			name: "missing expiration date",
 			payload: PaymentMethodPayload{
-				PaymentType:    "credit_card",
-				CardNumber:     "1234567890123456",
+				CardNumber:     "4242424242424242",
+				CardHolderName: "John Doe",
+			},
+			wantErr: true,
+		},
+		{
+			name: "expiration date in the past",
+			payload: PaymentMethodPayload{
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "12/20",
+				CardHolderName: "John Doe",
+			},
+			wantErr: true,
+		},
+		{
+			name: "expiration date in the wrong format",
+			payload: PaymentMethodPayload{
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "2040-12-31",
 				CardHolderName: "John Doe",
 			},
 			wantErr: true,
@@ -52,9 +87,17 @@ func TestPaymentMethodPayload_Validate(t *testing.T) {
 		{
 			name: "missing card holder name",
 			payload: PaymentMethodPayload{
-				PaymentType:    "credit_card",
-				CardNumber:     "1234567890123456",
-				ExpirationDate: "12/25",
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "12/40",
+			},
+			wantErr: true,
+		},
+		{
+			name: "card holder name with digits",
+			payload: PaymentMethodPayload{
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "12/40",
+				CardHolderName: "J0hn Doe",
 			},
 			wantErr: true,
 		},
@@ -67,3 +110,40 @@ func TestPaymentMethodPayload_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestPaymentMethodPayload_Normalize(t *testing.T) {
+	payload := PaymentMethodPayload{
+		PaymentType:    "credit_card",
+		CardNumber:     "5555 5555 5555 4444",
+		ExpirationDate: "02/40",
+		CardHolderName: " John Doe ",
+	}
+
+	payload.Normalize()
+
+	assert.Equal(t, PaymentMethodPayload{
+		PaymentType:    "mastercard",
+		CardNumber:     "5555555555554444",
+		ExpirationDate: "2040-02-29",
+		CardHolderName: "John Doe",
+	}, payload)
+}
+
+func TestPaymentMethodPayload_ValidationMessages(t *testing.T) {
+	payload := PaymentMethodPayload{
+		CardNumber:     "4242424242424241",
+		ExpirationDate: "13/40",
+		CardHolderName: "John Doe",
+	}
+
+	err := payload.Validate()
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Validate() returned %T, want *ValidationError", err)
+	}
+
+	assert.Equal(t, []problem.FieldError{
+		{Field: "card_number", Code: "card_number", Message: "card_number must be a valid card number"},
+		{Field: "expiration_date", Code: "card_expiry", Message: "expiration_date must be a future date in the MM/YY format"},
+	}, validationErr.Translate())
+}
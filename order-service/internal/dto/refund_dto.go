@@ -0,0 +1,17 @@
+package dto
+
+// RefundPayload refunds the listed order items, or everything not refunded
+// yet when Items is empty.
+type RefundPayload struct {
+	Items  []RefundItemPayload `json:"items" validate:"omitempty,dive"`
+	Reason string              `json:"reason" validate:"max=255"`
+}
+
+type RefundItemPayload struct {
+	OrderItemID int `json:"order_item_id" validate:"required,min=1"`
+	Quantity    int `json:"quantity" validate:"required,min=1"`
+}
+
+func (p *RefundPayload) Validate() error {
+	return validateStruct(p)
+}
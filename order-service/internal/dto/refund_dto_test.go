@@ -0,0 +1,55 @@
+package dto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefundPayload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload RefundPayload
+		wantErr bool
+	}{
+		{
+			name:    "full refund",
+			payload: RefundPayload{Reason: "damaged"},
+			wantErr: false,
+		},
+		{
+			name: "partial refund",
+			payload: RefundPayload{
+				Items: []RefundItemPayload{{OrderItemID: 1, Quantity: 2}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing order item",
+			payload: RefundPayload{
+				Items: []RefundItemPayload{{Quantity: 2}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero quantity",
+			payload: RefundPayload{
+				Items: []RefundItemPayload{{OrderItemID: 1}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "reason too long",
+			payload: RefundPayload{Reason: strings.Repeat("a", 256)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.payload.Validate()
+			assert.Equal(t, tt.wantErr, err != nil, "Validate() error = %v, wantErr %v", err, tt.wantErr)
+		})
+	}
+}
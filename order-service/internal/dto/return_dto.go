@@ -0,0 +1,38 @@
+package dto
+
+type ReturnPayload struct {
+	Items []ReturnItemPayload `json:"items" validate:"required,min=1,dive"`
+}
+
+type ReturnItemPayload struct {
+	OrderItemID int    `json:"order_item_id" validate:"required,min=1"`
+	Quantity    int    `json:"quantity" validate:"required,min=1"`
+	ReasonCode  string `json:"reason_code" validate:"required,oneof=damaged defective wrong_item not_as_described no_longer_needed other"`
+}
+
+func (p *ReturnPayload) Validate() error {
+	return validateStruct(p)
+}
+
+type RejectReturnPayload struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+func (p *RejectReturnPayload) Validate() error {
+	return validateStruct(p)
+}
+
+// InspectionPayload records what was decided for every item of a received
+// return.
+type InspectionPayload struct {
+	Items []InspectedItemPayload `json:"items" validate:"required,min=1,dive"`
+}
+
+type InspectedItemPayload struct {
+	ReturnItemID int    `json:"return_item_id" validate:"required,min=1"`
+	Outcome      string `json:"outcome" validate:"required,oneof=restock write_off"`
+}
+
+func (p *InspectionPayload) Validate() error {
+	return validateStruct(p)
+}
@@ -0,0 +1,84 @@
+package dto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReturnPayload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload ReturnPayload
+		wantErr bool
+	}{
+		{
+			name: "valid payload",
+			payload: ReturnPayload{
+				Items: []ReturnItemPayload{{OrderItemID: 1, Quantity: 1, ReasonCode: "damaged"}},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "no items",
+			payload: ReturnPayload{},
+			wantErr: true,
+		},
+		{
+			name: "unknown reason code",
+			payload: ReturnPayload{
+				Items: []ReturnItemPayload{{OrderItemID: 1, Quantity: 1, ReasonCode: "bored"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero quantity",
+			payload: ReturnPayload{
+				Items: []ReturnItemPayload{{OrderItemID: 1, ReasonCode: "defective"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.payload.Validate()
+			assert.Equal(t, tt.wantErr, err != nil, "Validate() error = %v, wantErr %v", err, tt.wantErr)
+		})
+	}
+}
+
+func TestInspectionPayload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload InspectionPayload
+		wantErr bool
+	}{
+		{
+			name: "valid payload",
+			payload: InspectionPayload{
+				Items: []InspectedItemPayload{{ReturnItemID: 1, Outcome: "restock"}, {ReturnItemID: 2, Outcome: "write_off"}},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "no items",
+			payload: InspectionPayload{},
+			wantErr: true,
+		},
+		{
+			name: "unknown outcome",
+			payload: InspectionPayload{
+				Items: []InspectedItemPayload{{ReturnItemID: 1, Outcome: "resell"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.payload.Validate()
+			assert.Equal(t, tt.wantErr, err != nil, "Validate() error = %v, wantErr %v", err, tt.wantErr)
+		})
+	}
+}
@@ -1,7 +1,5 @@
 package dto
 
-import "github.com/go-playground/validator/v10"
-
 type SignupPayload struct {
 	Username    string `json:"username" validate:"required"`
 	Password    string `json:"password" validate:"required"`
@@ -12,8 +10,7 @@ type SignupPayload struct {
 }
 
 func (s *SignupPayload) Validate() error {
-	validate := validator.New()
-	return validate.Struct(s)
+	return validateStruct(s)
 }
 
 type UpdateUserPayload struct {
@@ -25,8 +22,7 @@ type UpdateUserPayload struct {
 }
 
 func (u *UpdateUserPayload) Validate() error {
-	validate := validator.New()
-	return validate.Struct(u)
+	return validateStruct(u)
 }
 
 type LoginPayload struct {
@@ -35,11 +31,19 @@ type LoginPayload struct {
 }
 
 func (l *LoginPayload) Validate() error {
-	validate := validator.New()
-	return validate.Struct(l)
+	return validateStruct(l)
 }
 
 // used for login and signup response
 type LoginResponse struct {
 	Token string `json:"token"`
 }
+
+type ResetPasswordPayload struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+func (r *ResetPasswordPayload) Validate() error {
+	return validateStruct(r)
+}
@@ -159,3 +159,34 @@ func TestSignupPayload_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestResetPasswordPayload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload ResetPasswordPayload
+		wantErr bool
+	}{
+		{
+			name:    "valid payload",
+			payload: ResetPasswordPayload{Token: "token", NewPassword: "newpassword"},
+			wantErr: false,
+		},
+		{
+			name:    "missing token",
+			payload: ResetPasswordPayload{NewPassword: "newpassword"},
+			wantErr: true,
+		},
+		{
+			name:    "missing new password",
+			payload: ResetPasswordPayload{Token: "token"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.payload.Validate()
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
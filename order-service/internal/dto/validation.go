@@ -0,0 +1,168 @@
+package dto
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/pt_BR"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	pt_BR_translations "github.com/go-playground/validator/v10/translations/pt_BR"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/card"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+)
+
+// shared by every payload, validator caches struct metadata so it should
+// only be built once
+var (
+	validate   = validator.New()
+	translator = ut.New(en.New(), en.New(), pt_BR.New())
+)
+
+func init() {
+	// report fields by the name clients send, not the go struct field
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	enTrans, _ := translator.GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(validate, enTrans); err != nil {
+		panic(err)
+	}
+
+	ptTrans, _ := translator.GetTranslator("pt_BR")
+	if err := pt_BR_translations.RegisterDefaultTranslations(validate, ptTrans); err != nil {
+		panic(err)
+	}
+
+	for _, v := range customValidations {
+		if err := validate.RegisterValidation(v.tag, v.fn); err != nil {
+			panic(err)
+		}
+		registerTranslation(enTrans, v.tag, v.en)
+		registerTranslation(ptTrans, v.tag, v.ptBR)
+	}
+}
+
+var cardHolderPattern = regexp.MustCompile(`^\p{L}[\p{L} '.-]*$`)
+
+var customValidations = []struct {
+	tag  string
+	fn   validator.Func
+	en   string
+	ptBR string
+}{
+	{
+		tag: "card_number",
+		fn: func(fl validator.FieldLevel) bool {
+			return card.Valid(card.Normalize(fl.Field().String()))
+		},
+		en:   "{0} must be a valid card number",
+		ptBR: "{0} deve ser um número de cartão válido",
+	},
+	{
+		tag: "card_brand",
+		fn: func(fl validator.FieldLevel) bool {
+			return card.DetectBrand(card.Normalize(fl.Field().String())) != card.BrandUnknown
+		},
+		en:   "{0} must be from a supported card brand",
+		ptBR: "{0} deve ser de uma bandeira de cartão suportada",
+	},
+	{
+		tag: "card_expiry",
+		fn: func(fl validator.FieldLevel) bool {
+			expiry, err := card.ParseExpiry(fl.Field().String())
+			return err == nil && !card.Expired(expiry, time.Now())
+		},
+		en:   "{0} must be a future date in the MM/YY format",
+		ptBR: "{0} deve ser uma data futura no formato MM/AA",
+	},
+	{
+		tag: "card_holder",
+		fn: func(fl validator.FieldLevel) bool {
+			return cardHolderPattern.MatchString(strings.TrimSpace(fl.Field().String()))
+		},
+		en:   "{0} must contain only letters, spaces, apostrophes, dots and hyphens",
+		ptBR: "{0} deve conter apenas letras, espaços, apóstrofos, pontos e hífens",
+	},
+}
+
+func registerTranslation(trans ut.Translator, tag, text string) {
+	err := validate.RegisterTranslation(
+		tag,
+		trans,
+		func(ut ut.Translator) error {
+			return ut.Add(tag, text, true)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T(tag, fe.Field())
+			return t
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ValidationError is returned by every payload Validate method when one or
+// more fields are invalid.
+type ValidationError struct {
+	fieldErrors validator.ValidationErrors
+}
+
+func (e *ValidationError) Error() string {
+	fieldErrors := e.Translate()
+
+	messages := make([]string, len(fieldErrors))
+	for i, fieldError := range fieldErrors {
+		messages[i] = fieldError.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Translate returns the field errors with messages in the first supported
+// locale, falling back to english.
+func (e *ValidationError) Translate(locales ...string) []problem.FieldError {
+	trans, _ := translator.FindTranslator(locales...)
+
+	fieldErrors := make([]problem.FieldError, len(e.fieldErrors))
+	for i, fe := range e.fieldErrors {
+		fieldErrors[i] = problem.FieldError{
+			Field:   fe.Field(),
+			Code:    fe.Tag(),
+			Message: fe.Translate(trans),
+		}
+	}
+	return fieldErrors
+}
+
+// ParseAcceptLanguage turns an Accept-Language header into locales in the
+// format expected by Translate, keeping the client order.
+func ParseAcceptLanguage(header string) []string {
+	var locales []string
+	for _, part := range strings.Split(header, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		locales = append(locales, strings.ReplaceAll(tag, "-", "_"))
+	}
+	return locales
+}
+
+func validateStruct(s interface{}) error {
+	err := validate.Struct(s)
+	if fieldErrors, ok := err.(validator.ValidationErrors); ok {
+		return &ValidationError{fieldErrors: fieldErrors}
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package dto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+)
+
+func TestValidationError_Translate(t *testing.T) {
+	payload := LoginPayload{
+		Email:    "testexample.com",
+		Password: "",
+	}
+
+	err := payload.Validate()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate() returned %T, want *ValidationError", err)
+	}
+
+	tests := []struct {
+		name    string
+		locales []string
+		want    []problem.FieldError
+	}{
+		{
+			name:    "default locale",
+			locales: nil,
+			want: []problem.FieldError{
+				{Field: "email", Code: "email", Message: "email must be a valid email address"},
+				{Field: "password", Code: "required", Message: "password is a required field"},
+			},
+		},
+		{
+			name:    "portuguese locale",
+			locales: []string{"pt_BR"},
+			want: []problem.FieldError{
+				{Field: "email", Code: "email", Message: "email deve ser um endereço de e-mail válido"},
+				{Field: "password", Code: "required", Message: "password é um campo obrigatório"},
+			},
+		},
+		{
+			name:    "unsupported locale falls back to english",
+			locales: []string{"fr"},
+			want: []problem.FieldError{
+				{Field: "email", Code: "email", Message: "email must be a valid email address"},
+				{Field: "password", Code: "required", Message: "password is a required field"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validationErr.Translate(tt.locales...))
+		})
+	}
+
+	assert.Equal(t, "email must be a valid email address; password is a required field", err.Error())
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{
+			name:   "empty header",
+			header: "",
+			want:   nil,
+		},
+		{
+			name:   "weighted languages",
+			header: "pt-BR,pt;q=0.9,en;q=0.8,*;q=0.5",
+			want:   []string{"pt_BR", "pt", "en"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseAcceptLanguage(tt.header))
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package email
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpServer accepts a single message on a local port, without STARTTLS nor
+// authentication, and returns what the client sent.
+func smtpServer(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var lines []string
+		text.PrintfLine("220 localhost ready")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			lines = append(lines, line)
+
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				text.PrintfLine("250 localhost")
+			case line == "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotLines()
+				if err != nil {
+					return
+				}
+				lines = append(lines, data...)
+				text.PrintfLine("250 queued")
+			case line == "QUIT":
+				text.PrintfLine("221 bye")
+				received <- lines
+				return
+			default:
+				text.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	return l.Addr().String(), received
+}
+
+func TestSMTPSender(t *testing.T) {
+	addr, received := smtpServer(t)
+	sender := NewSMTPSender(addr, "shop@example.com", "", "")
+
+	err := sender.Send(context.Background(), Message{
+		To:      "john@example.com",
+		Subject: "Reset your password",
+		Body:    "token\nabc",
+	})
+	assert.NoError(t, err)
+
+	select {
+	case lines := <-received:
+		assert.Contains(t, lines, "MAIL FROM:<shop@example.com>")
+		assert.Contains(t, lines, "RCPT TO:<john@example.com>")
+		assert.Contains(t, lines, "Subject: Reset your password")
+		assert.Equal(t, []string{"token", "abc", "QUIT"}, lines[len(lines)-3:])
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message never reached the server")
+	}
+}
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	_, err := format("shop@example.com", Message{To: "john@example.com\r\nBcc: eve@example.com"}, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	_, err = format("shop@example.com", Message{To: "not an address"}, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestLogSender(t *testing.T) {
+	var logs strings.Builder
+	sender := NewLogSender(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	err := sender.Send(context.Background(), Message{To: "john@example.com", Subject: "Password reset", Body: "Your token is abc"})
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), "to=john@example.com")
+	assert.Contains(t, logs.String(), `body="Your token is abc"`)
+}
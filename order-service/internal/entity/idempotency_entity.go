@@ -0,0 +1,13 @@
+package entity
+
+import "net/http"
+
+// IdempotencyRecord is what was stored for an Idempotency-Key, StatusCode is
+// 0 while the request that first used the key has not finished. Header holds
+// the response headers the handler set.
+type IdempotencyRecord struct {
+	Fingerprint  string      `db:"fingerprint"`
+	StatusCode   int         `db:"status_code"`
+	Header       http.Header `db:"-"`
+	ResponseBody []byte      `db:"response_body"`
+}
@@ -0,0 +1,11 @@
+package entity
+
+type ImpersonationAudit struct {
+	AuditID     int    `json:"audit_id" db:"audit_id"`
+	ActorUserID int    `json:"actor_user_id" db:"actor_user_id"`
+	UserID      int    `json:"user_id" db:"user_id"`
+	Method      string `json:"method" db:"method"`
+	Path        string `json:"path" db:"path"`
+	StatusCode  int    `json:"status_code" db:"status_code"`
+	CreatedAt   string `json:"created_at" db:"created_at"`
+}
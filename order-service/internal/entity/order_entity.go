@@ -1,11 +1,33 @@
 package entity
 
+const (
+	OrderStatusPendingPayment = "pending_payment"
+	OrderStatusPaymentFailed  = "payment_failed"
+	OrderStatusAuthorized     = "authorized"
+	OrderStatusPaid           = "paid"
+	OrderStatusVoided         = "voided"
+	OrderStatusCancelled      = "cancelled"
+	OrderStatusShipped        = "shipped"
+	OrderStatusDelivered      = "delivered"
+)
+
+// The refund status of an order is kept apart from its order status, so a
+// refund does not undo its fulfilment. An order nothing was refunded of has
+// none.
+const (
+	RefundStatusNone              = ""
+	RefundStatusPartiallyRefunded = "partially_refunded"
+	RefundStatusRefunded          = "refunded"
+)
+
 type Order struct {
-	OrderID           int    `json:"order_id" db:"order_id"`
-	UserID            int    `json:"-" db:"user_id"`
-	OrderDate         string `json:"order_date" db:"order_date"`
-	TotalAmount       int    `json:"total_amount" db:"total_amount"`
-	PaymentMethodID   int    `json:"payment_method_id" db:"payment_method_id"`
-	ShippingAddressID int    `json:"shipping_address_id" db:"shipping_address_id"`
-	OrderStatus       string `json:"order_status" db:"order_status"`
+	OrderID            int    `json:"order_id" db:"order_id"`
+	UserID             int    `json:"-" db:"user_id"`
+	OrderDate          string `json:"order_date" db:"order_date"`
+	TotalAmount        int    `json:"total_amount" db:"total_amount"`
+	PaymentMethodID    int    `json:"payment_method_id" db:"payment_method_id"`
+	ShippingAddressID  int    `json:"shipping_address_id" db:"shipping_address_id"`
+	OrderStatus        string `json:"order_status" db:"order_status"`
+	CancellationReason string `json:"cancellation_reason,omitempty" db:"cancellation_reason"`
+	RefundStatus       string `json:"refund_status,omitempty" db:"refund_status"`
 }
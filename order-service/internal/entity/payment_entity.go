@@ -0,0 +1,28 @@
+package entity
+
+const (
+	PaymentOperationAuthorize = "authorize"
+	PaymentOperationCapture   = "capture"
+	PaymentOperationVoid      = "void"
+	PaymentOperationRefund    = "refund"
+
+	// PaymentStatusPending is a call whose outcome is unknown, it is retried
+	// with the same idempotency key.
+	PaymentStatusPending   = "pending"
+	PaymentStatusSucceeded = "succeeded"
+	PaymentStatusFailed    = "failed"
+)
+
+type Payment struct {
+	PaymentID        int    `json:"payment_id" db:"payment_id"`
+	OrderID          int    `json:"order_id" db:"order_id"`
+	Operation        string `json:"operation" db:"operation"`
+	Amount           int    `json:"amount" db:"amount"`
+	Status           string `json:"status" db:"status"`
+	Provider         string `json:"provider" db:"provider"`
+	Currency         string `json:"currency" db:"currency"`
+	IdempotencyKey   string `json:"-" db:"idempotency_key"`
+	GatewayReference string `json:"gateway_reference,omitempty" db:"gateway_reference"`
+	FailureCode      string `json:"failure_code,omitempty" db:"failure_code"`
+	CreatedAt        string `json:"created_at" db:"created_at"`
+}
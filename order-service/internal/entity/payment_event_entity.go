@@ -0,0 +1,21 @@
+package entity
+
+import "time"
+
+// Payment event types applied to payments, other types are stored but
+// ignored.
+const (
+	PaymentEventSucceeded = "payment.succeeded"
+	PaymentEventFailed    = "payment.failed"
+)
+
+type PaymentEvent struct {
+	EventID         int        `json:"event_id" db:"event_id"`
+	Provider        string     `json:"provider" db:"provider"`
+	ProviderEventID string     `json:"provider_event_id" db:"provider_event_id"`
+	EventType       string     `json:"event_type" db:"event_type"`
+	Payload         string     `json:"-" db:"payload"`
+	ReceivedAt      time.Time  `json:"received_at" db:"received_at"`
+	ProcessedAt     *time.Time `json:"processed_at,omitempty" db:"processed_at"`
+	ProcessingError string     `json:"processing_error,omitempty" db:"processing_error"`
+}
@@ -4,7 +4,10 @@ type PaymentMethod struct {
 	PaymentMethodID int    `json:"payment_method_id" db:"payment_method_id"`
 	UserID          int    `json:"-" db:"user_id"`
 	PaymentType     string `json:"payment_type" db:"payment_type"`
-	CardNumber      string `json:"card_number" db:"card_number"`
-	ExpirationDate  string `json:"expiration_date" db:"expiration_date"`
-	CardHolderName  string `json:"card_holder_name" db:"card_holder_name"`
+	CardToken       string `json:"-" db:"card_token"`
+	CardLast4       string `json:"-" db:"card_last4"`
+	// masked, built from CardLast4, the full number is only in the card vault
+	CardNumber     string `json:"card_number" db:"-"`
+	ExpirationDate string `json:"expiration_date" db:"expiration_date"`
+	CardHolderName string `json:"card_holder_name" db:"card_holder_name"`
 }
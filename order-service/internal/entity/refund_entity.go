@@ -0,0 +1,20 @@
+package entity
+
+type Refund struct {
+	RefundID  int          `json:"refund_id" db:"refund_id"`
+	OrderID   int          `json:"order_id" db:"order_id"`
+	PaymentID int          `json:"payment_id" db:"payment_id"`
+	Amount    int          `json:"amount" db:"amount"`
+	Reason    string       `json:"reason,omitempty" db:"reason"`
+	CreatedBy int          `json:"created_by" db:"created_by"`
+	CreatedAt string       `json:"created_at" db:"created_at"`
+	Items     []RefundItem `json:"items" db:"-"`
+}
+
+type RefundItem struct {
+	RefundItemID int `json:"refund_item_id" db:"refund_item_id"`
+	RefundID     int `json:"-" db:"refund_id"`
+	OrderItemID  int `json:"order_item_id" db:"order_item_id"`
+	Quantity     int `json:"quantity" db:"quantity"`
+	Amount       int `json:"amount" db:"amount"`
+}
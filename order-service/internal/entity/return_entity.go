@@ -0,0 +1,44 @@
+package entity
+
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+	ReturnStatusCompleted = "completed"
+)
+
+const (
+	ReturnReasonDamaged        = "damaged"
+	ReturnReasonDefective      = "defective"
+	ReturnReasonWrongItem      = "wrong_item"
+	ReturnReasonNotAsDescribed = "not_as_described"
+	ReturnReasonNoLongerNeeded = "no_longer_needed"
+	ReturnReasonOther          = "other"
+)
+
+const (
+	ReturnOutcomeRestock  = "restock"
+	ReturnOutcomeWriteOff = "write_off"
+)
+
+type Return struct {
+	ReturnID        int          `json:"return_id" db:"return_id"`
+	OrderID         int          `json:"order_id" db:"order_id"`
+	Status          string       `json:"status" db:"status"`
+	LabelCode       string       `json:"label_code,omitempty" db:"label_code"`
+	RejectionReason string       `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	RefundID        int          `json:"refund_id,omitempty" db:"refund_id"`
+	CreatedAt       string       `json:"created_at" db:"created_at"`
+	UpdatedAt       string       `json:"updated_at" db:"updated_at"`
+	Items           []ReturnItem `json:"items" db:"-"`
+}
+
+type ReturnItem struct {
+	ReturnItemID int    `json:"return_item_id" db:"return_item_id"`
+	ReturnID     int    `json:"-" db:"return_id"`
+	OrderItemID  int    `json:"order_item_id" db:"order_item_id"`
+	Quantity     int    `json:"quantity" db:"quantity"`
+	ReasonCode   string `json:"reason_code" db:"reason_code"`
+	Outcome      string `json:"outcome,omitempty" db:"outcome"`
+}
@@ -1,11 +1,25 @@
 package entity
 
+import "github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+)
+
 type User struct {
-	UserID      int    `json:"user_id" db:"user_id"`
-	Username    string `json:"username" db:"username"`
-	Password    string `json:"-" db:"password"`
-	Email       string `json:"email" db:"email"`
-	FirstName   string `json:"first_name" db:"first_name"`
-	LastName    string `json:"last_name" db:"last_name"`
-	PhoneNumber string `json:"phone_number" db:"phone_number"`
+	UserID      int                        `json:"user_id" db:"user_id"`
+	Username    string                     `json:"username" db:"username"`
+	Password    string                     `json:"-" db:"password"`
+	Email       string                     `json:"email" db:"email"`
+	FirstName   string                     `json:"first_name" db:"first_name"`
+	LastName    string                     `json:"last_name" db:"last_name"`
+	PhoneNumber fieldcrypt.EncryptedString `json:"phone_number" db:"phone_number"`
+	Role        string                     `json:"role,omitempty" db:"role"`
+	Disabled    bool                       `json:"disabled,omitempty" db:"disabled"`
+
+	PasswordResetRequired bool `json:"password_reset_required,omitempty" db:"password_reset_required"`
+	// TokenVersion is carried by the tokens of the user, the tokens of an
+	// older version are revoked.
+	TokenVersion int `json:"-" db:"token_version"`
 }
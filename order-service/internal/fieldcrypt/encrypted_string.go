@@ -0,0 +1,124 @@
+package fieldcrypt
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// envelopePrefix marks a column value as encrypted, anything else is a
+// legacy cleartext value.
+const envelopePrefix = "enc:"
+
+// EncryptedString is a string stored encrypted, it marshals to JSON as the
+// plain string. It is written sealed to its row with Seal, and read as stored
+// until Open decrypts it.
+type EncryptedString string
+
+// Seal encrypts s for column of the row of table with primary key id, empty
+// strings are stored as is.
+func (s EncryptedString) Seal(table, column string, id int) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	k := keyring.Load()
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+
+	envelope, err := k.Encrypt([]byte(s), additionalData(table, column, id))
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + base64.StdEncoding.EncodeToString(envelope), nil
+}
+
+// Open decrypts the value Scan read from column of the row of table with
+// primary key id, legacy cleartext values are left as they are.
+func (s *EncryptedString) Open(table, column string, id int) error {
+	encoded, ok := strings.CutPrefix(string(*s), envelopePrefix)
+	if !ok {
+		return nil
+	}
+
+	k := keyring.Load()
+	if k == nil {
+		return ErrNoKeyring
+	}
+
+	envelope, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidEnvelope
+	}
+
+	plaintext, _, err := k.Decrypt(envelope, additionalData(table, column, id))
+	if err != nil {
+		return fmt.Errorf("%s.%s of %d: %w", table, column, id, err)
+	}
+
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// Value refuses to store s as it is, it must be sealed to its row with Seal.
+// Empty strings are stored as is.
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	return nil, ErrNotSealed
+}
+
+// Scan reads the value as it is stored, see Open.
+func (s *EncryptedString) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s = ""
+	case string:
+		*s = EncryptedString(v)
+	case []byte:
+		*s = EncryptedString(v)
+	default:
+		return fmt.Errorf("fieldcrypt: cannot scan %T into EncryptedString", src)
+	}
+	return nil
+}
+
+// additionalData binds a value to the column of the row it is stored in.
+func additionalData(table, column string, id int) []byte {
+	return []byte(fmt.Sprintf("%s.%s:%d", table, column, id))
+}
+
+// Field is an encrypted field of a row, along with the column it is stored in.
+type Field struct {
+	Column string
+	Value  *EncryptedString
+}
+
+// SealRow seals fields to the row of table with primary key id, returning
+// the values to store in their order.
+func SealRow(table string, id int, fields ...Field) ([]any, error) {
+	sealed := make([]any, len(fields))
+	for i, field := range fields {
+		value, err := field.Value.Seal(table, field.Column, id)
+		if err != nil {
+			return nil, err
+		}
+		sealed[i] = value
+	}
+	return sealed, nil
+}
+
+// OpenRow opens the fields Scan read from the row of table with primary key
+// id.
+func OpenRow(table string, id int, fields ...Field) error {
+	for _, field := range fields {
+		if err := field.Value.Open(table, field.Column, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
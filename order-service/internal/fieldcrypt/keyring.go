@@ -0,0 +1,222 @@
+// Package fieldcrypt encrypts PII columns with envelope encryption: every
+// value is sealed with its own AES-GCM data key, and the data key is wrapped
+// by a versioned master key loaded from a local keyfile. The table, column
+// and primary key of the row a value is stored in are bound to it as
+// additional data, so a value copied to another row or column fails to
+// decrypt.
+//
+// The process wide keyring is installed with SetKeyring at startup, after
+// which the repositories seal EncryptedString fields on write and open them
+// on read. Values written before encryption was enabled are read back as is,
+// until the reencrypt command rotates them to the current master key.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	keySize     = 32
+	versionSize = 4
+	// a wrapped data key is its nonce, the sealed key and the GCM tag
+	wrappedKeySize = 12 + keySize + 16
+)
+
+var (
+	ErrNoKeyring       = errors.New("fieldcrypt: no keyring configured")
+	ErrUnknownVersion  = errors.New("fieldcrypt: unknown master key version")
+	ErrInvalidKeyfile  = errors.New("fieldcrypt: invalid keyfile")
+	ErrInvalidEnvelope = errors.New("fieldcrypt: invalid envelope")
+	ErrNotSealed       = errors.New("fieldcrypt: value must be sealed to its row")
+)
+
+// Keyring holds every master key still needed to read stored values, and the
+// version new values are wrapped with.
+type Keyring struct {
+	current int
+	keys    map[int]cipher.AEAD
+}
+
+// keyfile is the on disk format of the master keys:
+//
+//	{"current_version": 2, "keys": {"1": "<base64>", "2": "<base64>"}}
+type keyfile struct {
+	CurrentVersion int               `json:"current_version"`
+	Keys           map[string]string `json:"keys"`
+}
+
+func NewKeyring(current int, keys map[int][]byte) (*Keyring, error) {
+	if current < 1 {
+		return nil, fmt.Errorf("%w: current version must be positive", ErrInvalidKeyfile)
+	}
+
+	keyring := &Keyring{current: current, keys: make(map[int]cipher.AEAD, len(keys))}
+	for version, key := range keys {
+		if len(key) != keySize {
+			return nil, fmt.Errorf("%w: key %d must be %d bytes", ErrInvalidKeyfile, version, keySize)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		keyring.keys[version] = aead
+	}
+
+	if _, ok := keyring.keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current version %d has no key", ErrInvalidKeyfile, current)
+	}
+
+	return keyring, nil
+}
+
+// LoadKeyfile reads the master keys from the JSON keyfile at path.
+func LoadKeyfile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyfile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeyfile, err)
+	}
+
+	keys := make(map[int][]byte, len(file.Keys))
+	for version, encoded := range file.Keys {
+		v, err := strconv.Atoi(version)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("%w: key version %q", ErrInvalidKeyfile, version)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d is not base64", ErrInvalidKeyfile, v)
+		}
+		keys[v] = key
+	}
+
+	return NewKeyring(file.CurrentVersion, keys)
+}
+
+// CurrentVersion is the master key version new values are wrapped with.
+func (k *Keyring) CurrentVersion() int {
+	return k.current
+}
+
+// Encrypt seals plaintext under a fresh data key wrapped by the current
+// master key, returning the version, the wrapped key and the sealed value as
+// a single envelope. The envelope only decrypts with the same additionalData.
+func (k *Keyring) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := seal(k.keys[k.current], dataKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(dataAEAD, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, versionSize, versionSize+len(wrappedKey)+len(sealed))
+	binary.BigEndian.PutUint32(envelope, uint32(k.current))
+	envelope = append(envelope, wrappedKey...)
+	return append(envelope, sealed...), nil
+}
+
+// Decrypt opens an envelope made by Encrypt with any master key still in the
+// keyring, returning the plaintext and the master key version it used.
+func (k *Keyring) Decrypt(envelope, additionalData []byte) ([]byte, int, error) {
+	if len(envelope) < versionSize+wrappedKeySize {
+		return nil, 0, ErrInvalidEnvelope
+	}
+
+	version := int(binary.BigEndian.Uint32(envelope))
+	masterAEAD, ok := k.keys[version]
+	if !ok {
+		return nil, version, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	dataKey, err := open(masterAEAD, envelope[versionSize:versionSize+wrappedKeySize], nil)
+	if err != nil {
+		return nil, version, err
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, version, err
+	}
+
+	plaintext, err := open(dataAEAD, envelope[versionSize+wrappedKeySize:], additionalData)
+	if err != nil {
+		return nil, version, err
+	}
+
+	return plaintext, version, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, ErrInvalidEnvelope
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEnvelope, err)
+	}
+	return plaintext, nil
+}
+
+var keyring atomic.Pointer[Keyring]
+
+// SetKeyring installs the keyring used by EncryptedString values.
+func SetKeyring(k *Keyring) {
+	keyring.Store(k)
+}
+
+// CurrentKeyVersion is the version recorded next to rows written now, 0 when
+// no keyring is configured.
+func CurrentKeyVersion() int {
+	k := keyring.Load()
+	if k == nil {
+		return 0
+	}
+	return k.CurrentVersion()
+}
@@ -0,0 +1,176 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	keyV1 = bytes.Repeat([]byte{0x01}, 32)
+	keyV2 = bytes.Repeat([]byte{0x02}, 32)
+)
+
+func mustKeyring(t *testing.T, current int, keys map[int][]byte) *Keyring {
+	t.Helper()
+
+	keyring, err := NewKeyring(current, keys)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	return keyring
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int
+		keys    map[int][]byte
+		wantErr bool
+	}{
+		{
+			name:    "valid keyring",
+			current: 2,
+			keys:    map[int][]byte{1: keyV1, 2: keyV2},
+			wantErr: false,
+		},
+		{
+			name:    "current version without key",
+			current: 3,
+			keys:    map[int][]byte{1: keyV1, 2: keyV2},
+			wantErr: true,
+		},
+		{
+			name:    "short key",
+			current: 1,
+			keys:    map[int][]byte{1: keyV1[:16]},
+			wantErr: true,
+		},
+		{
+			name:    "no current version",
+			current: 0,
+			keys:    map[int][]byte{1: keyV1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.current, tt.keys)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidKeyfile)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLoadKeyfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pii.json")
+	contents := `{"current_version": 2, "keys": {"1": "` + base64.StdEncoding.EncodeToString(keyV1) +
+		`", "2": "` + base64.StdEncoding.EncodeToString(keyV2) + `"}}`
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write keyfile: %v", err)
+	}
+
+	keyring, err := LoadKeyfile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, keyring.CurrentVersion())
+
+	if err := os.WriteFile(path, []byte(`{"current_version": 1, "keys": {"1": "not base64!"}}`), 0o600); err != nil {
+		t.Fatalf("failed to write keyfile: %v", err)
+	}
+
+	_, err = LoadKeyfile(path)
+	assert.ErrorIs(t, err, ErrInvalidKeyfile)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	keyring := mustKeyring(t, 1, map[int][]byte{1: keyV1})
+
+	envelope, err := keyring.Encrypt([]byte("555-0100"), []byte("users.phone_number:1"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(envelope), "555-0100")
+
+	plaintext, version, err := keyring.Decrypt(envelope, []byte("users.phone_number:1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "555-0100", string(plaintext))
+	assert.Equal(t, 1, version)
+
+	_, _, err = keyring.Decrypt(envelope, []byte("users.phone_number:2"))
+	assert.ErrorIs(t, err, ErrInvalidEnvelope)
+
+	envelope[len(envelope)-1] ^= 0xff
+	_, _, err = keyring.Decrypt(envelope, []byte("users.phone_number:1"))
+	assert.ErrorIs(t, err, ErrInvalidEnvelope)
+}
+
+func TestDecryptAfterRotation(t *testing.T) {
+	oldKeyring := mustKeyring(t, 1, map[int][]byte{1: keyV1})
+	rotatedKeyring := mustKeyring(t, 2, map[int][]byte{1: keyV1, 2: keyV2})
+	retiredKeyring := mustKeyring(t, 2, map[int][]byte{2: keyV2})
+
+	envelope, err := oldKeyring.Encrypt([]byte("555-0100"), nil)
+	assert.NoError(t, err)
+
+	plaintext, version, err := rotatedKeyring.Decrypt(envelope, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "555-0100", string(plaintext))
+	assert.Equal(t, 1, version)
+
+	_, _, err = retiredKeyring.Decrypt(envelope, nil)
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+}
+
+func TestEncryptedString(t *testing.T) {
+	SetKeyring(nil)
+
+	_, err := EncryptedString("555-0100").Seal("users", "phone_number", 1)
+	assert.ErrorIs(t, err, ErrNoKeyring)
+
+	SetKeyring(mustKeyring(t, 1, map[int][]byte{1: keyV1}))
+	defer SetKeyring(nil)
+
+	stored, err := EncryptedString("555-0100").Seal("users", "phone_number", 1)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "555-0100", stored)
+
+	var value EncryptedString
+	assert.NoError(t, value.Scan(stored))
+	assert.NoError(t, value.Open("users", "phone_number", 1))
+	assert.Equal(t, EncryptedString("555-0100"), value)
+
+	// a value copied to another row or column doesn't decrypt
+	for _, row := range []struct {
+		table, column string
+		id            int
+	}{
+		{"users", "phone_number", 2},
+		{"addresses", "postal_code", 1},
+	} {
+		assert.NoError(t, value.Scan(stored))
+		assert.ErrorIs(t, value.Open(row.table, row.column, row.id), ErrInvalidEnvelope)
+	}
+
+	// rows written before encryption was enabled are read as they are
+	assert.NoError(t, value.Scan([]byte("555-0199")))
+	assert.NoError(t, value.Open("users", "phone_number", 1))
+	assert.Equal(t, EncryptedString("555-0199"), value)
+
+	assert.NoError(t, value.Scan(nil))
+	assert.NoError(t, value.Open("users", "phone_number", 1))
+	assert.Equal(t, EncryptedString(""), value)
+
+	stored, err = EncryptedString("").Seal("users", "phone_number", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "", stored)
+
+	// values are only stored sealed
+	_, err = EncryptedString("555-0100").Value()
+	assert.ErrorIs(t, err, ErrNotSealed)
+}
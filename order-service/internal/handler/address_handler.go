@@ -8,6 +8,9 @@ import (
 	"github.com/jmoiron/sqlx"
 
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/sqlrepo"
 	"github.com/mathesukkj/goecommerce/order-service/internal/service"
 )
 
@@ -16,44 +19,47 @@ type AddressHandler struct {
 }
 
 func NewAddressHandler(db *sqlx.DB) *AddressHandler {
-	return &AddressHandler{service: service.NewAddressService(db)}
+	return &AddressHandler{service: service.NewAddressService(sqlrepo.NewAddressRepository(db))}
 }
 
 func (h *AddressHandler) ListUserAddresses(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(keyUserId).(int)
 	if !ok || userID == 0 {
-		http.Error(w, "user not logged in", http.StatusUnauthorized)
+		writeError(w, r, errNotLoggedIn)
 		return
 	}
 
-	addresses, err := h.service.ListUserAddresses(userID)
+	q, err := listquery.Parse(r.URL.Query(), service.AddressListSpec)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(addresses)
+	addresses, err := h.service.ListUserAddresses(r.Context(), userID, q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writePage(w, r, addresses)
 }
 
 func (h *AddressHandler) GetAddressByID(w http.ResponseWriter, r *http.Request) {
 	addressID, err := strconv.Atoi(r.PathValue("address_id"))
 	if err != nil {
-		http.Error(w, "invalid address id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid address id")
 		return
 	}
 
 	userID, ok := r.Context().Value(keyUserId).(int)
 	if !ok || userID == 0 {
-		http.Error(w, "user not logged in", http.StatusUnauthorized)
+		writeError(w, r, errNotLoggedIn)
 		return
 	}
 
-	address, err := h.service.GetAddressByID(addressID, userID)
-	if err == service.ErrAddressNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	address, err := h.service.GetAddressByID(r.Context(), addressID, userID)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -63,19 +69,24 @@ func (h *AddressHandler) GetAddressByID(w http.ResponseWriter, r *http.Request)
 func (h *AddressHandler) CreateAddress(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(keyUserId).(int)
 	if !ok || userID == 0 {
-		http.Error(w, "user not logged in", http.StatusUnauthorized)
+		writeError(w, r, errNotLoggedIn)
 		return
 	}
 
 	var payload dto.AddressPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	address, err := h.service.CreateAddress(payload, userID)
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	address, err := h.service.CreateAddress(r.Context(), payload, userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -83,24 +94,32 @@ func (h *AddressHandler) CreateAddress(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AddressHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
 	addressID, err := strconv.Atoi(r.PathValue("address_id"))
 	if err != nil {
-		http.Error(w, "invalid address id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid address id")
 		return
 	}
 
 	var payload dto.AddressPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	address, err := h.service.UpdateAddress(addressID, payload)
-	if err == service.ErrAddressNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
 		return
-	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+
+	address, err := h.service.UpdateAddress(r.Context(), addressID, payload, userID)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -108,17 +127,20 @@ func (h *AddressHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AddressHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
 	addressID, err := strconv.Atoi(r.PathValue("address_id"))
 	if err != nil {
-		http.Error(w, "invalid address id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid address id")
 		return
 	}
 
-	if err := h.service.DeleteAddress(addressID); err == service.ErrAddressNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.DeleteAddress(r.Context(), addressID, userID); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
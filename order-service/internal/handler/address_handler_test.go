@@ -13,6 +13,7 @@ import (
 
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
 	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
 )
 
 func setupAddressHandler(t *testing.T) (*AddressHandler, *postgres.PostgresContainer) {
@@ -88,15 +89,55 @@ func TestListUserAddresses(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, rr.Code)
 
 			if tt.expectedStatus == http.StatusOK {
-				var addresses []entity.Address
+				var addresses listquery.Page[entity.Address]
 				err = json.NewDecoder(rr.Body).Decode(&addresses)
 				assert.NoError(t, err)
-				assert.Len(t, addresses, tt.expectedLength)
+				assert.Len(t, addresses.Items, tt.expectedLength)
 			}
 		})
 	}
 }
 
+func TestListUserAddressesPagination(t *testing.T) {
+	addressHandler, _ := setupAddressHandler(t)
+	seedAddress(t)
+	for i := 0; i < 2; i++ {
+		db.MustExec(`
+			INSERT INTO addresses (user_id, street_address, city, state, postal_code, country)
+			VALUES (1, '123 Main St', 'Anytown', 'CA', '12345', 'USA')
+		`)
+	}
+
+	var ids []int
+	target := "/addresses?limit=2&sort=-address_id"
+	for pages := 0; target != ""; pages++ {
+		assert.Less(t, pages, 2, "three addresses should fit in two pages")
+
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), keyUserId, 1))
+		rr := httptest.NewRecorder()
+
+		addressHandler.ListUserAddresses(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var page listquery.Page[entity.Address]
+		err := json.NewDecoder(rr.Body).Decode(&page)
+		assert.NoError(t, err)
+		for _, address := range page.Items {
+			ids = append(ids, address.AddressID)
+		}
+
+		target = ""
+		if page.NextCursor != "" {
+			assert.Contains(t, rr.Header().Get("Link"), `rel="next"`)
+			target = "/addresses?limit=2&sort=-address_id&cursor=" + page.NextCursor
+		}
+	}
+
+	assert.Equal(t, []int{3, 2, 1}, ids)
+}
+
 func TestGetAddressByID(t *testing.T) {
 	addressHandler, _ := setupAddressHandler(t)
 	seedAddress(t)
@@ -222,13 +263,28 @@ func TestUpdateAddress(t *testing.T) {
 	tests := []struct {
 		name            string
 		addressID       string
+		userID          int
 		payload         dto.AddressPayload
 		expectedStatus  int
 		expectedAddress *entity.Address
 	}{
+		{
+			name:      "address of another user",
+			addressID: "1",
+			userID:    2,
+			payload: dto.AddressPayload{
+				StreetAddress: "1 Stolen St",
+				City:          "Anytown",
+				State:         "CA",
+				PostalCode:    "12345",
+				Country:       "USA",
+			},
+			expectedStatus: http.StatusNotFound,
+		},
 		{
 			name:      "success",
 			addressID: "1",
+			userID:    1,
 			payload: dto.AddressPayload{
 				StreetAddress: "123 Main St",
 				City:          "Anytown",
@@ -259,7 +315,7 @@ func TestUpdateAddress(t *testing.T) {
 			req.SetPathValue("address_id", tt.addressID)
 			assert.NoError(t, err)
 
-			ctx := context.WithValue(req.Context(), keyUserId, 1)
+			ctx := context.WithValue(req.Context(), keyUserId, tt.userID)
 			req = req.WithContext(ctx)
 
 			rr := httptest.NewRecorder()
@@ -285,22 +341,32 @@ func TestDeleteAddress(t *testing.T) {
 	tests := []struct {
 		name           string
 		addressID      string
+		userID         int
 		expectedStatus int
 		serviceErr     error
 	}{
+		{
+			name:           "address of another user",
+			addressID:      "1",
+			userID:         2,
+			expectedStatus: http.StatusNotFound,
+		},
 		{
 			name:           "success",
 			addressID:      "1",
+			userID:         1,
 			expectedStatus: http.StatusNoContent,
 		},
 		{
 			name:           "invalid address id",
 			addressID:      "invalid",
+			userID:         1,
 			expectedStatus: http.StatusBadRequest,
 		},
 		{
 			name:           "address not found",
 			addressID:      "999",
+			userID:         1,
 			expectedStatus: http.StatusNotFound,
 		},
 	}
@@ -310,6 +376,7 @@ func TestDeleteAddress(t *testing.T) {
 			req, err := http.NewRequest(http.MethodDelete, "/addresses/"+tt.addressID, nil)
 			req.SetPathValue("address_id", tt.addressID)
 			assert.NoError(t, err)
+			req = req.WithContext(context.WithValue(req.Context(), keyUserId, tt.userID))
 
 			rr := httptest.NewRecorder()
 			addressHandler.DeleteAddress(rr, req)
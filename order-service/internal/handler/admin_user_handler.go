@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/email"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/sqlrepo"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+// AdminUserHandler serves the support endpoints, every route must be wrapped
+// in middleware.RequireAdmin.
+type AdminUserHandler struct {
+	users          *service.UserService
+	addresses      *service.AddressService
+	paymentMethods *service.PaymentMethodService
+	orders         *service.OrderService
+	audits         *service.ImpersonationAuditService
+}
+
+func NewAdminUserHandler(db *sqlx.DB, cardVault vault.Vault, ttls service.TokenTTLs, mail email.Sender) *AdminUserHandler {
+	return &AdminUserHandler{
+		users:          service.NewUserService(sqlrepo.NewUserRepository(db), ttls, mail),
+		addresses:      service.NewAddressService(sqlrepo.NewAddressRepository(db)),
+		paymentMethods: service.NewPaymentMethodService(sqlrepo.NewPaymentMethodRepository(db), cardVault, database.NewTxManager(db, nil)),
+		orders:         service.NewOrderService(db),
+		audits:         service.NewImpersonationAuditService(db),
+	}
+}
+
+func (h *AdminUserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := dto.UserSearchQuery{
+		Email:    query.Get("email"),
+		Username: query.Get("username"),
+		Name:     query.Get("name"),
+		Page:     1,
+		PageSize: dto.DefaultUserSearchPageSize,
+	}
+
+	if page := query.Get("page"); page != "" {
+		p, err := strconv.Atoi(page)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, "invalid page")
+			return
+		}
+		search.Page = p
+	}
+
+	if pageSize := query.Get("page_size"); pageSize != "" {
+		p, err := strconv.Atoi(pageSize)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, "invalid page size")
+			return
+		}
+		search.PageSize = p
+	}
+
+	if err := search.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	users, total, err := h.users.SearchUsers(r.Context(), search)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := dto.UserSearchResponse{
+		Users:    users,
+		Page:     search.Page,
+		PageSize: search.PageSize,
+		Total:    total,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AdminUserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	user, err := h.users.GetUserDetailsByID(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *AdminUserHandler) ListUserAddresses(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	q, err := listquery.Parse(r.URL.Query(), service.AddressListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	addresses, err := h.addresses.ListUserAddresses(r.Context(), userID, q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writePage(w, r, addresses)
+}
+
+func (h *AdminUserHandler) ListUserPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	q, err := listquery.Parse(r.URL.Query(), service.PaymentMethodListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	paymentMethods, err := h.paymentMethods.ListUserPaymentMethods(r.Context(), userID, q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writePage(w, r, paymentMethods)
+}
+
+func (h *AdminUserHandler) ListUserOrders(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	listUserOrders(w, r, h.orders, userID)
+}
+
+func (h *AdminUserHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, true)
+}
+
+func (h *AdminUserHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, false)
+}
+
+func (h *AdminUserHandler) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := h.users.SetUserDisabled(r.Context(), userID, disabled); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminUserHandler) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	// the reset token goes to the user by email, never in the response
+	if err := h.users.ForcePasswordReset(r.Context(), userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminUserHandler) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || adminID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	token, err := h.users.Impersonate(r.Context(), adminID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// the token is only handed out once its issuance is on the audit log
+	err = h.audits.RecordImpersonation(r.Context(), entity.ImpersonationAudit{
+		ActorUserID: adminID,
+		UserID:      userID,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		StatusCode:  http.StatusOK,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response := dto.LoginResponse{
+		Token: token,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AdminUserHandler) ListUserImpersonations(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	audits, err := h.audits.ListUserImpersonations(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(audits)
+}
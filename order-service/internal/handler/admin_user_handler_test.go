@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/email"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+)
+
+func setupAdminUserHandler(t *testing.T) (*AdminUserHandler, *postgres.PostgresContainer) {
+	t.Helper()
+
+	db.MustExec("TRUNCATE TABLE payment_methods CASCADE")
+	db.MustExec("ALTER SEQUENCE payment_methods_payment_method_id_seq RESTART WITH 1")
+	db.MustExec("TRUNCATE TABLE users CASCADE")
+	db.MustExec("ALTER SEQUENCE users_user_id_seq RESTART WITH 1")
+
+	adminUserHandler := NewAdminUserHandler(db, cardVault, defaultTokenTTLs(), email.NewFakeSender())
+	return adminUserHandler, pgContainer
+}
+
+func TestAdminSearchUsers(t *testing.T) {
+	adminUserHandler, _ := setupAdminUserHandler(t)
+	seedUsers(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTotal  int
+	}{
+		{
+			name:       "no filters",
+			query:      "",
+			wantStatus: http.StatusOK,
+			wantTotal:  1,
+		},
+		{
+			name:       "matching email",
+			query:      "?email=TEST@example",
+			wantStatus: http.StatusOK,
+			wantTotal:  1,
+		},
+		{
+			name:       "no matching name",
+			query:      "?name=nobody",
+			wantStatus: http.StatusOK,
+			wantTotal:  0,
+		},
+		{
+			name:       "invalid page",
+			query:      "?page=abc",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "page size above maximum",
+			query:      "?page_size=1000",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/users"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			adminUserHandler.SearchUsers(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+
+			if tt.wantStatus == http.StatusOK {
+				var response dto.UserSearchResponse
+				err := json.NewDecoder(rr.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantTotal, response.Total)
+				assert.Len(t, response.Users, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	adminUserHandler, _ := setupAdminUserHandler(t)
+	seedUsers(t)
+
+	tests := []struct {
+		name       string
+		userID     string
+		wantStatus int
+	}{
+		{
+			name:       "success",
+			userID:     "1",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "invalid user id",
+			userID:     "invalid",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "user not found",
+			userID:     "999",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/users/"+tt.userID+"/disable", nil)
+			req.SetPathValue("user_id", tt.userID)
+			rr := httptest.NewRecorder()
+
+			adminUserHandler.DisableUser(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+
+	var disabled bool
+	err := db.Get(&disabled, "SELECT disabled FROM users WHERE user_id = 1")
+	assert.NoError(t, err)
+	assert.True(t, disabled)
+}
+
+func TestAdminListUserPaymentMethods(t *testing.T) {
+	adminUserHandler, _ := setupAdminUserHandler(t)
+	seedPaymentMethods(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users/1/payment-methods", nil)
+	req.SetPathValue("user_id", "1")
+	rr := httptest.NewRecorder()
+
+	adminUserHandler.ListUserPaymentMethods(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var paymentMethods listquery.Page[entity.PaymentMethod]
+	err := json.NewDecoder(rr.Body).Decode(&paymentMethods)
+	assert.NoError(t, err)
+	assert.Len(t, paymentMethods.Items, 1)
+	assert.Equal(t, "**** 3456", paymentMethods.Items[0].CardNumber)
+}
+
+func TestAdminForcePasswordReset(t *testing.T) {
+	setupAdminUserHandler(t)
+	seedUsers(t)
+	mail := email.NewFakeSender()
+	adminUserHandler := NewAdminUserHandler(db, cardVault, defaultTokenTTLs(), mail)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/1/password-reset", nil)
+	req.SetPathValue("user_id", "1")
+	rr := httptest.NewRecorder()
+
+	adminUserHandler.ForcePasswordReset(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Empty(t, rr.Body.String(), "the reset token must not reach the admin")
+	if sent := mail.Sent(); assert.Len(t, sent, 1) {
+		assert.Regexp(t, `[0-9a-f]{64}`, sent[0].Body)
+	}
+
+	var required bool
+	err := db.Get(&required, "SELECT password_reset_required FROM users WHERE user_id = 1")
+	assert.NoError(t, err)
+	assert.True(t, required)
+}
+
+func TestAdminImpersonateUser(t *testing.T) {
+	adminUserHandler, _ := setupAdminUserHandler(t)
+	seedUsers(t)
+	// the admin impersonating, audited as the actor
+	db.MustExec(`
+		INSERT INTO users (username, password, email, first_name, last_name, phone_number, role)
+		VALUES ('admin', 'password', 'admin@example.com', 'Admin', 'User', '0987654321', $1)
+	`, entity.RoleAdmin)
+
+	tests := []struct {
+		name       string
+		adminID    int
+		userID     string
+		wantStatus int
+	}{
+		{
+			name:       "success",
+			adminID:    2,
+			userID:     "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "user not found",
+			adminID:    2,
+			userID:     "999",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "admin not logged in",
+			adminID:    0,
+			userID:     "1",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/users/"+tt.userID+"/impersonate", nil)
+			req.SetPathValue("user_id", tt.userID)
+			req = req.WithContext(context.WithValue(req.Context(), keyUserId, tt.adminID))
+			rr := httptest.NewRecorder()
+
+			adminUserHandler.ImpersonateUser(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+
+			if tt.wantStatus == http.StatusOK {
+				var response dto.LoginResponse
+				err := json.NewDecoder(rr.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.NotEmpty(t, response.Token)
+
+				audits, err := adminUserHandler.audits.ListUserImpersonations(context.Background(), 1)
+				assert.NoError(t, err)
+				if assert.NotEmpty(t, audits, "the issuance should be audited") {
+					assert.Equal(t, 2, audits[0].ActorUserID)
+					assert.Equal(t, "/admin/users/1/impersonate", audits[0].Path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+type CancellationHandler struct {
+	cancellations *service.CancellationService
+	orders        *service.OrderService
+}
+
+// NewCancellationHandler lets customers cancel their orders up to window
+// after placing them.
+func NewCancellationHandler(db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway, window time.Duration) *CancellationHandler {
+	return &CancellationHandler{
+		cancellations: service.NewCancellationService(db, cardVault, gateway, window),
+		orders:        service.NewOrderService(db),
+	}
+}
+
+func (h *CancellationHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("order_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	var payload dto.CancelOrderPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	if err := h.cancellations.CancelOrder(r.Context(), orderID, userID, payload.Reason); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	order, err := h.orders.GetOrderByID(r.Context(), orderID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
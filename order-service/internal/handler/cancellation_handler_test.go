@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+)
+
+func setupCancellationHandler(t *testing.T, gateway payment.PaymentGateway) (*CancellationHandler, *postgres.PostgresContainer) {
+	t.Helper()
+
+	setupPaymentHandler(t)
+	db.MustExec("TRUNCATE TABLE order_items, products CASCADE")
+	db.MustExec("ALTER SEQUENCE order_items_order_item_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE products_product_id_seq RESTART WITH 1")
+
+	// an order of 2 x 300 and 1 x 400
+	seedOrder(t, "4242424242424242")
+	db.MustExec(`
+		INSERT INTO products (product_name, price, stock_quantity)
+		VALUES ('Product 1', 300, 10), ('Product 2', 400, 10)
+	`)
+	db.MustExec(`
+		INSERT INTO order_items (order_id, product_id, quantity, price_per_unit)
+		VALUES (1, 1, 2, 300), (1, 2, 1, 400)
+	`)
+
+	cancellationHandler := NewCancellationHandler(db, cardVault, gateway, config.Default().Orders.CancellationWindow)
+	return cancellationHandler, pgContainer
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		orderStatus     string
+		refundStatus    string
+		orderAge        string
+		userID          int
+		body            string
+		pay             bool
+		expectedStatus  int
+		expectedOrder   string
+		expectedStock   []int
+		expectedPayment []string
+	}{
+		{
+			name:           "pending payment",
+			orderStatus:    entity.OrderStatusPendingPayment,
+			orderAge:       "0 minutes",
+			userID:         1,
+			body:           `{"reason":"ordered by mistake"}`,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  entity.OrderStatusCancelled,
+			expectedStock:  []int{12, 11},
+		},
+		{
+			name:            "paid order is refunded",
+			orderStatus:     entity.OrderStatusPendingPayment,
+			orderAge:        "0 minutes",
+			userID:          1,
+			body:            `{"reason":"found it cheaper"}`,
+			pay:             true,
+			expectedStatus:  http.StatusOK,
+			expectedOrder:   entity.OrderStatusCancelled,
+			expectedStock:   []int{12, 11},
+			expectedPayment: []string{entity.PaymentOperationAuthorize, entity.PaymentOperationCapture, entity.PaymentOperationRefund},
+		},
+		{
+			name:           "shipped",
+			orderStatus:    entity.OrderStatusShipped,
+			orderAge:       "0 minutes",
+			userID:         1,
+			body:           `{"reason":"too slow"}`,
+			expectedStatus: http.StatusConflict,
+			expectedOrder:  entity.OrderStatusShipped,
+			expectedStock:  []int{10, 10},
+		},
+		{
+			name:           "shipped and partially refunded",
+			orderStatus:    entity.OrderStatusShipped,
+			refundStatus:   entity.RefundStatusPartiallyRefunded,
+			orderAge:       "0 minutes",
+			userID:         1,
+			body:           `{"reason":"too slow"}`,
+			expectedStatus: http.StatusConflict,
+			expectedOrder:  entity.OrderStatusShipped,
+			expectedStock:  []int{10, 10},
+		},
+		{
+			name:           "window closed",
+			orderStatus:    entity.OrderStatusPendingPayment,
+			orderAge:       "2 hours",
+			userID:         1,
+			body:           `{"reason":"ordered by mistake"}`,
+			expectedStatus: http.StatusConflict,
+			expectedOrder:  entity.OrderStatusPendingPayment,
+			expectedStock:  []int{10, 10},
+		},
+		{
+			name:           "other user's order",
+			orderStatus:    entity.OrderStatusPendingPayment,
+			orderAge:       "0 minutes",
+			userID:         2,
+			body:           `{"reason":"ordered by mistake"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedOrder:  entity.OrderStatusPendingPayment,
+			expectedStock:  []int{10, 10},
+		},
+		{
+			name:           "missing reason",
+			orderStatus:    entity.OrderStatusPendingPayment,
+			orderAge:       "0 minutes",
+			userID:         1,
+			body:           `{}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedOrder:  entity.OrderStatusPendingPayment,
+			expectedStock:  []int{10, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the cancellation refunds through the gateway that captured the payment
+			gateway := payment.NewFakeGateway()
+			cancellationHandler, _ := setupCancellationHandler(t, gateway)
+			db.MustExec(
+				"UPDATE orders SET order_status = $1, order_date = CURRENT_TIMESTAMP - CAST($2 AS INTERVAL), refund_status = $3 WHERE order_id = 1",
+				tt.orderStatus, tt.orderAge, tt.refundStatus,
+			)
+
+			if tt.pay {
+				paymentHandler := NewPaymentHandler(db, cardVault, gateway)
+				req := httptest.NewRequest(http.MethodPost, "/orders/1/pay", nil)
+				req.SetPathValue("order_id", "1")
+				req = req.WithContext(context.WithValue(req.Context(), keyUserId, 1))
+				paymentHandler.PayOrder(httptest.NewRecorder(), req)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/1/cancel", bytes.NewBufferString(tt.body))
+			req.SetPathValue("order_id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), keyUserId, tt.userID))
+			rr := httptest.NewRecorder()
+
+			cancellationHandler.CancelOrder(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var orderStatus string
+			err := db.Get(&orderStatus, "SELECT order_status FROM orders WHERE order_id = 1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedOrder, orderStatus)
+
+			var stock []int
+			err = db.Select(&stock, "SELECT stock_quantity FROM products ORDER BY product_id")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStock, stock)
+
+			var operations []string
+			err = db.Select(&operations, "SELECT operation FROM payments WHERE order_id = 1 AND status = 'succeeded' ORDER BY payment_id")
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.expectedPayment, operations)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+)
+
+type OrderHandler struct {
+	orders *service.OrderService
+}
+
+func NewOrderHandler(db *sqlx.DB) *OrderHandler {
+	return &OrderHandler{orders: service.NewOrderService(db)}
+}
+
+// ListOrders searches the order history of the logged in user, see
+// service.OrderListSpec for the sorts and dto.OrderSearchQuery for the
+// filters.
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	listUserOrders(w, r, h.orders, userID)
+}
+
+func listUserOrders(w http.ResponseWriter, r *http.Request, orders *service.OrderService, userID int) {
+	query := r.URL.Query()
+	search := dto.OrderSearchQuery{
+		OrderDateFrom: query.Get("order_date_from"),
+		OrderDateTo:   query.Get("order_date_to"),
+		Product:       query.Get("product"),
+	}
+
+	if minAmount := query.Get("min_amount"); minAmount != "" {
+		a, err := strconv.Atoi(minAmount)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, "invalid min amount")
+			return
+		}
+		search.MinAmount = a
+	}
+
+	if maxAmount := query.Get("max_amount"); maxAmount != "" {
+		a, err := strconv.Atoi(maxAmount)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, "invalid max amount")
+			return
+		}
+		search.MaxAmount = a
+	}
+
+	if err := search.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	q, err := listquery.Parse(query, service.OrderListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	page, err := orders.ListUserOrders(r.Context(), userID, search, q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writePage(w, r, page)
+}
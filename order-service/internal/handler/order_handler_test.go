@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+)
+
+func setupOrderHandler(t *testing.T) (*OrderHandler, *postgres.PostgresContainer) {
+	t.Helper()
+
+	setupPaymentHandler(t)
+	db.MustExec("TRUNCATE TABLE order_items, products CASCADE")
+	db.MustExec("ALTER SEQUENCE order_items_order_item_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE products_product_id_seq RESTART WITH 1")
+
+	// order 1: 1000 on 2024-01-10 with a keyboard, pending payment
+	// order 2: 500 on 2024-02-15 with a cable, paid
+	// order 3: 2500 on 2024-03-20 with both, delivered
+	seedOrder(t, "4242424242424242")
+	db.MustExec(`
+		INSERT INTO orders (user_id, order_date, total_amount, payment_method_id, shipping_address_id, order_status)
+		VALUES (1, '2024-02-15 12:00:00', 500, 1, 1, $1), (1, '2024-03-20 08:00:00', 2500, 1, 1, $2)
+	`, entity.OrderStatusPaid, entity.OrderStatusDelivered)
+	db.MustExec("UPDATE orders SET order_date = '2024-01-10 18:00:00' WHERE order_id = 1")
+	db.MustExec(`
+		INSERT INTO products (product_name, price, stock_quantity)
+		VALUES ('Wireless Keyboard', 1000, 10), ('USB Cable', 500, 10)
+	`)
+	db.MustExec(`
+		INSERT INTO order_items (order_id, product_id, quantity, price_per_unit)
+		VALUES (1, 1, 1, 1000), (2, 2, 1, 500), (3, 1, 2, 1000), (3, 2, 1, 500)
+	`)
+
+	orderHandler := NewOrderHandler(db)
+	return orderHandler, pgContainer
+}
+
+func TestListOrders(t *testing.T) {
+	orderHandler, _ := setupOrderHandler(t)
+
+	tests := []struct {
+		name           string
+		target         string
+		userID         int
+		expectedStatus int
+		expectedIDs    []int
+	}{
+		{
+			name:           "newest first by default",
+			target:         "/orders",
+			userID:         1,
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{3, 2, 1},
+		},
+		{
+			name:           "sorted by amount",
+			target:         "/orders?sort=total_amount",
+			userID:         1,
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{2, 1, 3},
+		},
+		{
+			name:           "by status",
+			target:         "/orders?order_status=paid",
+			userID:         1,
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{2},
+		},
+		{
+			name:           "by date range",
+			target:         "/orders?order_date_from=2024-01-10&order_date_to=2024-02-15",
+			userID:         1,
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{2, 1},
+		},
+		{
+			name:           "by amount range",
+			target:         "/orders?min_amount=600&max_amount=3000",
+			userID:         1,
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{3, 1},
+		},
+		{
+			name:           "by product name",
+			target:         "/orders?product=keyboard",
+			userID:         1,
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{3, 1},
+		},
+		{
+			name:           "someone else's orders",
+			target:         "/orders",
+			userID:         2,
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{},
+		},
+		{
+			name:           "invalid date",
+			target:         "/orders?order_date_from=10/01/2024",
+			userID:         1,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "invalid amount",
+			target:         "/orders?min_amount=ten",
+			userID:         1,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unsupported sort",
+			target:         "/orders?sort=payment_method_id",
+			userID:         1,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "user not logged in",
+			target:         "/orders",
+			userID:         0,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req = req.WithContext(context.WithValue(req.Context(), keyUserId, tt.userID))
+			rr := httptest.NewRecorder()
+
+			orderHandler.ListOrders(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var page listquery.Page[entity.Order]
+				err := json.NewDecoder(rr.Body).Decode(&page)
+				assert.NoError(t, err)
+
+				ids := []int{}
+				for _, order := range page.Items {
+					ids = append(ids, order.OrderID)
+				}
+				assert.Equal(t, tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestListOrdersPagination(t *testing.T) {
+	orderHandler, _ := setupOrderHandler(t)
+
+	var ids []int
+	target := "/orders?limit=2&sort=-total_amount"
+	for pages := 0; target != ""; pages++ {
+		assert.Less(t, pages, 2, "three orders should fit in two pages")
+
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), keyUserId, 1))
+		rr := httptest.NewRecorder()
+
+		orderHandler.ListOrders(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var page listquery.Page[entity.Order]
+		err := json.NewDecoder(rr.Body).Decode(&page)
+		assert.NoError(t, err)
+		for _, order := range page.Items {
+			ids = append(ids, order.OrderID)
+		}
+
+		target = ""
+		if page.NextCursor != "" {
+			target = "/orders?limit=2&sort=-total_amount&cursor=" + page.NextCursor
+		}
+	}
+
+	assert.Equal(t, []int{3, 1, 2}, ids)
+}
+
+func TestListOrdersAbortedRequest(t *testing.T) {
+	orderHandler, _ := setupOrderHandler(t)
+
+	timedOut, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{name: "timed out", ctx: timedOut},
+		{name: "client gone", ctx: cancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(tt.ctx, keyUserId, 1)
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(ctx)
+			rr := httptest.NewRecorder()
+
+			orderHandler.ListOrders(rr, req)
+
+			assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+type PaymentHandler struct {
+	payments *service.PaymentService
+	orders   *service.OrderService
+}
+
+func NewPaymentHandler(db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway) *PaymentHandler {
+	return &PaymentHandler{
+		payments: service.NewPaymentService(db, cardVault, gateway),
+		orders:   service.NewOrderService(db),
+	}
+}
+
+// PayOrder authorizes and captures the order total on the order payment
+// method, answering with the order in its new status. A retry after a failed
+// capture only captures the order again.
+func (h *PaymentHandler) PayOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("order_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	if _, err := h.payments.PayOrder(r.Context(), orderID, userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	order, err := h.orders.GetOrderByID(r.Context(), orderID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h *PaymentHandler) ListOrderPayments(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("order_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	if _, err := h.orders.GetOrderByID(r.Context(), orderID, userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	payments, err := h.payments.ListOrderPayments(r.Context(), orderID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(payments)
+}
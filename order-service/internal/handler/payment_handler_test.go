@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+)
+
+func setupPaymentHandler(t *testing.T) (*PaymentHandler, *postgres.PostgresContainer) {
+	t.Helper()
+
+	db.MustExec("TRUNCATE TABLE payments, orders, payment_methods, addresses CASCADE")
+	db.MustExec("ALTER SEQUENCE orders_order_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE payments_payment_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE payment_methods_payment_method_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE addresses_address_id_seq RESTART WITH 1")
+	db.MustExec("TRUNCATE TABLE users CASCADE")
+	db.MustExec("ALTER SEQUENCE users_user_id_seq RESTART WITH 1")
+
+	paymentHandler := NewPaymentHandler(db, cardVault, payment.NewFakeGateway())
+	return paymentHandler, pgContainer
+}
+
+// seedOrder creates an order for user 1 paid with cardNumber.
+func seedOrder(t *testing.T, cardNumber string) {
+	t.Helper()
+
+	seedUsers(t)
+
+	cardToken, err := cardVault.Tokenize(context.Background(), cardNumber)
+	if err != nil {
+		t.Fatalf("failed to tokenize card number: %s", err)
+	}
+
+	db.MustExec(`
+		INSERT INTO payment_methods (user_id, payment_type, card_token, card_last4, expiration_date, card_holder_name)
+		VALUES (1, 'visa', $1, $2, '2040-12-31', 'John Doe')
+	`, cardToken, cardNumber[len(cardNumber)-4:])
+	db.MustExec(`
+		INSERT INTO addresses (user_id, street_address, city, state, postal_code, country)
+		VALUES (1, '123 Main St', 'New York', 'NY', '10001', 'USA')
+	`)
+	db.MustExec(`
+		INSERT INTO orders (user_id, total_amount, payment_method_id, shipping_address_id, order_status)
+		VALUES (1, 1000, 1, 1, $1)
+	`, entity.OrderStatusPendingPayment)
+}
+
+func TestPayOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		cardNumber      string
+		userID          int
+		expectedStatus  int
+		expectedOrder   string
+		expectedPayment []string
+	}{
+		{
+			name:            "success",
+			cardNumber:      "4242424242424242",
+			userID:          1,
+			expectedStatus:  http.StatusOK,
+			expectedOrder:   entity.OrderStatusPaid,
+			expectedPayment: []string{entity.PaymentStatusSucceeded, entity.PaymentStatusSucceeded},
+		},
+		{
+			name:            "card declined",
+			cardNumber:      payment.FakeCardDeclined,
+			userID:          1,
+			expectedStatus:  http.StatusPaymentRequired,
+			expectedOrder:   entity.OrderStatusPaymentFailed,
+			expectedPayment: []string{entity.PaymentStatusFailed},
+		},
+		{
+			name:            "gateway timeout",
+			cardNumber:      payment.FakeCardTimeout,
+			userID:          1,
+			expectedStatus:  http.StatusGatewayTimeout,
+			expectedOrder:   entity.OrderStatusPendingPayment,
+			expectedPayment: []string{entity.PaymentStatusPending},
+		},
+		{
+			name:            "other user's order",
+			cardNumber:      "4242424242424242",
+			userID:          2,
+			expectedStatus:  http.StatusNotFound,
+			expectedOrder:   entity.OrderStatusPendingPayment,
+			expectedPayment: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paymentHandler, _ := setupPaymentHandler(t)
+			seedOrder(t, tt.cardNumber)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/1/pay", nil)
+			req.SetPathValue("order_id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), keyUserId, tt.userID))
+			rr := httptest.NewRecorder()
+
+			paymentHandler.PayOrder(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var orderStatus string
+			err := db.Get(&orderStatus, "SELECT order_status FROM orders WHERE order_id = 1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedOrder, orderStatus)
+
+			var paymentStatuses []string
+			err = db.Select(&paymentStatuses, "SELECT status FROM payments WHERE order_id = 1 ORDER BY payment_id")
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.expectedPayment, paymentStatuses)
+		})
+	}
+}
+
+func TestListOrderPayments(t *testing.T) {
+	paymentHandler, _ := setupPaymentHandler(t)
+	seedOrder(t, "4242424242424242")
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/1/pay", nil)
+	req.SetPathValue("order_id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), keyUserId, 1))
+	paymentHandler.PayOrder(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/orders/1/payments", nil)
+	req.SetPathValue("order_id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), keyUserId, 1))
+	rr := httptest.NewRecorder()
+
+	paymentHandler.ListOrderPayments(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var payments []entity.Payment
+	err := json.NewDecoder(rr.Body).Decode(&payments)
+	assert.NoError(t, err)
+	assert.Len(t, payments, 2)
+	assert.Equal(t, entity.PaymentOperationAuthorize, payments[0].Operation)
+	assert.Equal(t, entity.PaymentOperationCapture, payments[1].Operation)
+}
@@ -6,53 +6,61 @@ import (
 	"strconv"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/sqlrepo"
 	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
 )
 
 type PaymentMethodHandler struct {
 	service *service.PaymentMethodService
 }
 
-func NewPaymentMethodHandler(db *sqlx.DB) *PaymentMethodHandler {
-	return &PaymentMethodHandler{service: service.NewPaymentMethodService(db)}
+func NewPaymentMethodHandler(db *sqlx.DB, cardVault vault.Vault) *PaymentMethodHandler {
+	return &PaymentMethodHandler{service: service.NewPaymentMethodService(sqlrepo.NewPaymentMethodRepository(db), cardVault, database.NewTxManager(db, nil))}
 }
 
 func (h *PaymentMethodHandler) ListUserPaymentMethods(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(keyUserId).(int)
 	if !ok || userID == 0 {
-		http.Error(w, "user not logged in", http.StatusUnauthorized)
+		writeError(w, r, errNotLoggedIn)
 		return
 	}
 
-	paymentMethods, err := h.service.ListUserPaymentMethods(userID)
+	q, err := listquery.Parse(r.URL.Query(), service.PaymentMethodListSpec)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(paymentMethods)
+	paymentMethods, err := h.service.ListUserPaymentMethods(r.Context(), userID, q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writePage(w, r, paymentMethods)
 }
 
 func (h *PaymentMethodHandler) GetPaymentMethodByID(w http.ResponseWriter, r *http.Request) {
 	paymentMethodID, err := strconv.Atoi(r.PathValue("payment_method_id"))
 	if err != nil {
-		http.Error(w, "invalid paymentMethod id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid paymentMethod id")
 		return
 	}
 
 	userID, ok := r.Context().Value(keyUserId).(int)
 	if !ok || userID == 0 {
-		http.Error(w, "user not logged in", http.StatusUnauthorized)
+		writeError(w, r, errNotLoggedIn)
 		return
 	}
 
-	paymentMethod, err := h.service.GetPaymentMethodByID(paymentMethodID, userID)
-	if err == service.ErrPaymentMethodNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	paymentMethod, err := h.service.GetPaymentMethodByID(r.Context(), paymentMethodID, userID)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -62,19 +70,25 @@ func (h *PaymentMethodHandler) GetPaymentMethodByID(w http.ResponseWriter, r *ht
 func (h *PaymentMethodHandler) CreatePaymentMethod(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(keyUserId).(int)
 	if !ok || userID == 0 {
-		http.Error(w, "user not logged in", http.StatusUnauthorized)
+		writeError(w, r, errNotLoggedIn)
 		return
 	}
 
 	var payload dto.PaymentMethodPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	paymentMethod, err := h.service.CreatePaymentMethod(payload, userID)
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	payload.Normalize()
+
+	paymentMethod, err := h.service.CreatePaymentMethod(r.Context(), payload, userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -82,24 +96,33 @@ func (h *PaymentMethodHandler) CreatePaymentMethod(w http.ResponseWriter, r *htt
 }
 
 func (h *PaymentMethodHandler) UpdatePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
 	paymentMethodID, err := strconv.Atoi(r.PathValue("payment_method_id"))
 	if err != nil {
-		http.Error(w, "invalid paymentMethod id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid paymentMethod id")
 		return
 	}
 
 	var payload dto.PaymentMethodPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	paymentMethod, err := h.service.UpdatePaymentMethod(paymentMethodID, payload)
-	if err == service.ErrPaymentMethodNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
 		return
-	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	payload.Normalize()
+
+	paymentMethod, err := h.service.UpdatePaymentMethod(r.Context(), paymentMethodID, payload, userID)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -107,17 +130,20 @@ func (h *PaymentMethodHandler) UpdatePaymentMethod(w http.ResponseWriter, r *htt
 }
 
 func (h *PaymentMethodHandler) DeletePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
 	paymentMethodID, err := strconv.Atoi(r.PathValue("payment_method_id"))
 	if err != nil {
-		http.Error(w, "invalid paymentMethod id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid paymentMethod id")
 		return
 	}
 
-	if err := h.service.DeletePaymentMethod(paymentMethodID); err == service.ErrPaymentMethodNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.DeletePaymentMethod(r.Context(), paymentMethodID, userID); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
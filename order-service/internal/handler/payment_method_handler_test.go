@@ -13,6 +13,7 @@ import (
 
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
 	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
 )
 
 func setupPaymentMethodHandler(t *testing.T) (*PaymentMethodHandler, *postgres.PostgresContainer) {
@@ -23,7 +24,7 @@ func setupPaymentMethodHandler(t *testing.T) (*PaymentMethodHandler, *postgres.P
 	db.MustExec("TRUNCATE TABLE users CASCADE")
 	db.MustExec("ALTER SEQUENCE users_user_id_seq RESTART WITH 1")
 
-	paymentMethodHandler := NewPaymentMethodHandler(db)
+	paymentMethodHandler := NewPaymentMethodHandler(db, cardVault)
 	return paymentMethodHandler, pgContainer
 }
 
@@ -32,17 +33,23 @@ func seedPaymentMethods(t *testing.T) {
 
 	seedUsers(t)
 
+	cardToken, err := cardVault.Tokenize(context.Background(), "4000056655663456")
+	if err != nil {
+		t.Fatalf("failed to tokenize card number: %s", err)
+	}
+
 	params := map[string]interface{}{
 		"user_id":          1,
 		"payment_type":     "credit_card",
-		"card_number":      "1234567890123456",
+		"card_token":       cardToken,
+		"card_last4":       "3456",
 		"expiration_date":  "2025-12-31",
 		"card_holder_name": "John Doe",
 	}
 
-	_, err := db.NamedExec(`
-		INSERT INTO payment_methods (user_id, payment_type, card_number, expiration_date, card_holder_name) 
-		VALUES (:user_id, :payment_type, :card_number, :expiration_date, :card_holder_name)
+	_, err = db.NamedExec(`
+		INSERT INTO payment_methods (user_id, payment_type, card_token, card_last4, expiration_date, card_holder_name) 
+		VALUES (:user_id, :payment_type, :card_token, :card_last4, :expiration_date, :card_holder_name)
 	`, params)
 	if err != nil {
 		t.Fatalf("failed to seed paymentMethod: %s", err)
@@ -87,10 +94,10 @@ func TestListUserPaymentMethods(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, rr.Code)
 
 			if tt.expectedStatus == http.StatusOK {
-				var paymentMethods []entity.PaymentMethod
+				var paymentMethods listquery.Page[entity.PaymentMethod]
 				err = json.NewDecoder(rr.Body).Decode(&paymentMethods)
 				assert.NoError(t, err)
-				assert.Len(t, paymentMethods, tt.expectedLength)
+				assert.Len(t, paymentMethods.Items, tt.expectedLength)
 			}
 		})
 	}
@@ -113,7 +120,7 @@ func TestGetPaymentMethodByID(t *testing.T) {
 			expectedPaymentMethod: &entity.PaymentMethod{
 				PaymentMethodID: 1,
 				PaymentType:     "credit_card",
-				CardNumber:      "1234567890123456",
+				CardNumber:      "**** 3456",
 				ExpirationDate:  "2025-12-31T00:00:00Z",
 				CardHolderName:  "John Doe",
 			},
@@ -171,20 +178,39 @@ func TestCreatePaymentMethod(t *testing.T) {
 			name:   "success",
 			userID: 1,
 			payload: dto.PaymentMethodPayload{
-				PaymentType:    "credit_card",
-				CardNumber:     "1234567890123456",
-				ExpirationDate: "2025-12-31",
+				CardNumber:     "4242 4242 4242 4242",
+				ExpirationDate: "12/40",
 				CardHolderName: "John Doe",
 			},
 			expectedStatus: http.StatusOK,
 			expectedPaymentMethod: &entity.PaymentMethod{
 				PaymentMethodID: 2,
-				PaymentType:     "credit_card",
-				CardNumber:      "1234567890123456",
-				ExpirationDate:  "2025-12-31T00:00:00Z",
+				PaymentType:     "visa",
+				CardNumber:      "**** 4242",
+				ExpirationDate:  "2040-12-31T00:00:00Z",
 				CardHolderName:  "John Doe",
 			},
 		},
+		{
+			name:   "invalid card number",
+			userID: 1,
+			payload: dto.PaymentMethodPayload{
+				CardNumber:     "4242424242424241",
+				ExpirationDate: "12/40",
+				CardHolderName: "John Doe",
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "expired card",
+			userID: 1,
+			payload: dto.PaymentMethodPayload{
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "01/20",
+				CardHolderName: "John Doe",
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
 	}
 
 	for _, tt := range tests {
@@ -222,28 +248,51 @@ func TestUpdatePaymentMethod(t *testing.T) {
 	tests := []struct {
 		name                  string
 		paymentMethodID       string
+		userID                int
 		payload               dto.PaymentMethodPayload
 		expectedStatus        int
 		expectedPaymentMethod *entity.PaymentMethod
 	}{
+		{
+			name:            "payment method of another user",
+			paymentMethodID: "1",
+			userID:          2,
+			payload: dto.PaymentMethodPayload{
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "06/40",
+				CardHolderName: "Jane Doe",
+			},
+			expectedStatus: http.StatusNotFound,
+		},
 		{
 			name:            "success",
 			paymentMethodID: "1",
+			userID:          1,
 			payload: dto.PaymentMethodPayload{
-				PaymentType:    "credit_card",
-				CardNumber:     "1235567890123456",
-				ExpirationDate: "2025-12-31",
+				CardNumber:     "5555555555554444",
+				ExpirationDate: "06/40",
 				CardHolderName: "John Doe",
 			},
 			expectedStatus: http.StatusOK,
 			expectedPaymentMethod: &entity.PaymentMethod{
 				PaymentMethodID: 1,
-				PaymentType:     "credit_card",
-				CardNumber:      "1235567890123456",
-				ExpirationDate:  "2025-12-31T00:00:00Z",
+				PaymentType:     "mastercard",
+				CardNumber:      "**** 4444",
+				ExpirationDate:  "2040-06-30T00:00:00Z",
 				CardHolderName:  "John Doe",
 			},
 		},
+		{
+			name:            "invalid card holder name",
+			paymentMethodID: "1",
+			userID:          1,
+			payload: dto.PaymentMethodPayload{
+				CardNumber:     "5555555555554444",
+				ExpirationDate: "06/40",
+				CardHolderName: "J0hn D0e",
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
 	}
 
 	for _, tt := range tests {
@@ -257,7 +306,7 @@ func TestUpdatePaymentMethod(t *testing.T) {
 			req.SetPathValue("payment_method_id", tt.paymentMethodID)
 			assert.NoError(t, err)
 
-			ctx := context.WithValue(req.Context(), keyUserId, 1)
+			ctx := context.WithValue(req.Context(), keyUserId, tt.userID)
 			req = req.WithContext(ctx)
 
 			rr := httptest.NewRecorder()
@@ -283,22 +332,32 @@ func TestDeletePaymentMethod(t *testing.T) {
 	tests := []struct {
 		name            string
 		paymentMethodID string
+		userID          int
 		expectedStatus  int
 		serviceErr      error
 	}{
+		{
+			name:            "payment method of another user",
+			paymentMethodID: "1",
+			userID:          2,
+			expectedStatus:  http.StatusNotFound,
+		},
 		{
 			name:            "success",
 			paymentMethodID: "1",
+			userID:          1,
 			expectedStatus:  http.StatusNoContent,
 		},
 		{
 			name:            "invalid paymentMethod id",
 			paymentMethodID: "invalid",
+			userID:          1,
 			expectedStatus:  http.StatusBadRequest,
 		},
 		{
 			name:            "paymentMethod not found",
 			paymentMethodID: "999",
+			userID:          1,
 			expectedStatus:  http.StatusNotFound,
 		},
 	}
@@ -312,6 +371,7 @@ func TestDeletePaymentMethod(t *testing.T) {
 			)
 			req.SetPathValue("payment_method_id", tt.paymentMethodID)
 			assert.NoError(t, err)
+			req = req.WithContext(context.WithValue(req.Context(), keyUserId, tt.userID))
 
 			rr := httptest.NewRecorder()
 			paymentMethodHandler.DeletePaymentMethod(rr, req)
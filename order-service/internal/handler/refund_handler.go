@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+// RefundHandler serves the admin refund endpoints, it must be mounted behind
+// middleware.RequireAdmin.
+type RefundHandler struct {
+	refunds *service.RefundService
+}
+
+func NewRefundHandler(db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway) *RefundHandler {
+	return &RefundHandler{refunds: service.NewRefundService(db, cardVault, gateway)}
+}
+
+func (h *RefundHandler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("order_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	adminID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || adminID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	var payload dto.RefundPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	refund, err := h.refunds.RefundOrder(r.Context(), orderID, adminID, payload)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(refund)
+}
+
+func (h *RefundHandler) ListOrderRefunds(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("order_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	refunds, err := h.refunds.ListOrderRefunds(r.Context(), orderID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(refunds)
+}
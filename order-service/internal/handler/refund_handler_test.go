@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+)
+
+// setupRefundHandler pays the order through gateway, which the refund handler
+// then refunds through.
+func setupRefundHandler(t *testing.T, gateway payment.PaymentGateway) (*RefundHandler, *postgres.PostgresContainer) {
+	t.Helper()
+
+	setupPaymentHandler(t)
+	db.MustExec("TRUNCATE TABLE refunds, refund_items, order_items, products CASCADE")
+	db.MustExec("ALTER SEQUENCE refunds_refund_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE refund_items_refund_item_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE order_items_order_item_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE products_product_id_seq RESTART WITH 1")
+
+	// a paid order of 2 x 300 and 1 x 400
+	seedOrder(t, "4242424242424242")
+	db.MustExec(`
+		INSERT INTO products (product_name, price, stock_quantity)
+		VALUES ('Product 1', 300, 10), ('Product 2', 400, 10)
+	`)
+	db.MustExec(`
+		INSERT INTO order_items (order_id, product_id, quantity, price_per_unit)
+		VALUES (1, 1, 2, 300), (1, 2, 1, 400)
+	`)
+
+	paymentHandler := NewPaymentHandler(db, cardVault, gateway)
+	req := httptest.NewRequest(http.MethodPost, "/orders/1/pay", nil)
+	req.SetPathValue("order_id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), keyUserId, 1))
+	paymentHandler.PayOrder(httptest.NewRecorder(), req)
+
+	refundHandler := NewRefundHandler(db, cardVault, gateway)
+	return refundHandler, pgContainer
+}
+
+func TestCreateRefund(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedOrder  string
+		expectedRefund string
+		expectedAmount int
+		expectedStock  []int
+	}{
+		{
+			name:           "full refund",
+			body:           `{"reason":"damaged"}`,
+			expectedStatus: http.StatusCreated,
+			expectedOrder:  entity.OrderStatusPaid,
+			expectedRefund: entity.RefundStatusRefunded,
+			expectedAmount: 1000,
+			expectedStock:  []int{12, 11},
+		},
+		{
+			name:           "partial refund",
+			body:           `{"items":[{"order_item_id":1,"quantity":1}]}`,
+			expectedStatus: http.StatusCreated,
+			expectedOrder:  entity.OrderStatusPaid,
+			expectedRefund: entity.RefundStatusPartiallyRefunded,
+			expectedAmount: 300,
+			expectedStock:  []int{11, 10},
+		},
+		{
+			name:           "quantity exceeded",
+			body:           `{"items":[{"order_item_id":2,"quantity":2}]}`,
+			expectedStatus: http.StatusConflict,
+			expectedOrder:  entity.OrderStatusPaid,
+			expectedAmount: 0,
+			expectedStock:  []int{10, 10},
+		},
+		{
+			name:           "unknown order item",
+			body:           `{"items":[{"order_item_id":9,"quantity":1}]}`,
+			expectedStatus: http.StatusNotFound,
+			expectedOrder:  entity.OrderStatusPaid,
+			expectedAmount: 0,
+			expectedStock:  []int{10, 10},
+		},
+		{
+			name:           "invalid quantity",
+			body:           `{"items":[{"order_item_id":1,"quantity":0}]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedOrder:  entity.OrderStatusPaid,
+			expectedAmount: 0,
+			expectedStock:  []int{10, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refundHandler, _ := setupRefundHandler(t, payment.NewFakeGateway())
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/1/refunds", bytes.NewBufferString(tt.body))
+			req.SetPathValue("order_id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), keyUserId, 1))
+			rr := httptest.NewRecorder()
+
+			refundHandler.CreateRefund(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var order struct {
+				OrderStatus  string `db:"order_status"`
+				RefundStatus string `db:"refund_status"`
+			}
+			err := db.Get(&order, "SELECT order_status, refund_status FROM orders WHERE order_id = 1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedOrder, order.OrderStatus)
+			assert.Equal(t, tt.expectedRefund, order.RefundStatus)
+
+			var refunded int
+			err = db.Get(&refunded, "SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id = 1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedAmount, refunded)
+
+			var stock []int
+			err = db.Select(&stock, "SELECT stock_quantity FROM products ORDER BY product_id")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStock, stock)
+		})
+	}
+}
+
+func TestCreateRefundNeverExceedsCapture(t *testing.T) {
+	refundHandler, _ := setupRefundHandler(t, payment.NewFakeGateway())
+
+	for _, expectedStatus := range []int{http.StatusCreated, http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodPost, "/orders/1/refunds", bytes.NewBufferString(`{}`))
+		req.SetPathValue("order_id", "1")
+		req = req.WithContext(context.WithValue(req.Context(), keyUserId, 1))
+		rr := httptest.NewRecorder()
+
+		refundHandler.CreateRefund(rr, req)
+
+		assert.Equal(t, expectedStatus, rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/1/refunds", nil)
+	req.SetPathValue("order_id", "1")
+	rr := httptest.NewRecorder()
+
+	refundHandler.ListOrderRefunds(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var refunds []entity.Refund
+	err := json.NewDecoder(rr.Body).Decode(&refunds)
+	assert.NoError(t, err)
+	assert.Len(t, refunds, 1)
+	assert.Equal(t, 1000, refunds[0].Amount)
+	assert.Len(t, refunds[0].Items, 2)
+}
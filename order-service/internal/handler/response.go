@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/webhook"
+)
+
+var errNotLoggedIn = errors.New("user not logged in")
+
+type errorProblem struct {
+	err    error
+	status int
+	slug   string
+	title  string
+}
+
+// errorProblems maps the service sentinel errors to the problem returned to
+// clients, any error missing here is answered as an internal error.
+var errorProblems = []errorProblem{
+	{errNotLoggedIn, http.StatusUnauthorized, "not-logged-in", "User not logged in"},
+	{service.ErrUserNotFound, http.StatusNotFound, "user-not-found", "User not found"},
+	{service.ErrUserAlreadyExists, http.StatusConflict, "user-already-exists", "User already exists"},
+	{service.ErrPasswordTooLong, http.StatusBadRequest, "password-too-long", "Password too long"},
+	{service.ErrInvalidPassword, http.StatusUnauthorized, "invalid-credentials", "Invalid credentials"},
+	{service.ErrUserDisabled, http.StatusForbidden, "user-disabled", "User account disabled"},
+	{service.ErrPasswordResetRequired, http.StatusForbidden, "password-reset-required", "Password reset required"},
+	{service.ErrInvalidResetToken, http.StatusBadRequest, "invalid-reset-token", "Invalid password reset token"},
+	{service.ErrCannotImpersonateAdmin, http.StatusForbidden, "cannot-impersonate-admin", "Cannot impersonate admin"},
+	{service.ErrAddressNotFound, http.StatusNotFound, "address-not-found", "Address not found"},
+	{service.ErrPaymentMethodNotFound, http.StatusNotFound, "payment-method-not-found", "Payment method not found"},
+	{service.ErrPaymentMethodInUse, http.StatusConflict, "payment-method-in-use", "Payment method in use"},
+	{service.ErrOrderNotFound, http.StatusNotFound, "order-not-found", "Order not found"},
+	{service.ErrPaymentNotFound, http.StatusNotFound, "payment-not-found", "Payment not found"},
+	{service.ErrPaymentEventMismatch, http.StatusUnprocessableEntity, "payment-event-mismatch", "Payment event does not match the payment"},
+	{service.ErrInvalidOrderStatus, http.StatusConflict, "invalid-order-status", "Invalid order status"},
+	{service.ErrPaymentPending, http.StatusConflict, "payment-pending", "Payment pending"},
+	{service.ErrRefundExceedsCapture, http.StatusConflict, "refund-exceeds-capture", "Refund exceeds captured amount"},
+	{service.ErrOrderItemNotFound, http.StatusNotFound, "order-item-not-found", "Order item not found"},
+	{service.ErrRefundQuantityExceeded, http.StatusConflict, "refund-quantity-exceeded", "Refund quantity exceeded"},
+	{service.ErrNothingToRefund, http.StatusConflict, "nothing-to-refund", "Nothing to refund"},
+	{service.ErrOrderAlreadyShipped, http.StatusConflict, "order-already-shipped", "Order already shipped"},
+	{service.ErrCancellationWindowClosed, http.StatusConflict, "cancellation-window-closed", "Cancellation window closed"},
+	{service.ErrReturnNotFound, http.StatusNotFound, "return-not-found", "Return not found"},
+	{service.ErrOrderNotDelivered, http.StatusConflict, "order-not-delivered", "Order not delivered"},
+	{service.ErrReturnWindowClosed, http.StatusConflict, "return-window-closed", "Return window closed"},
+	{service.ErrReturnQuantityExceeded, http.StatusConflict, "return-quantity-exceeded", "Return quantity exceeded"},
+	{service.ErrInvalidReturnStatus, http.StatusConflict, "invalid-return-status", "Invalid return status"},
+	{service.ErrReturnInspectionMissing, http.StatusUnprocessableEntity, "return-inspection-missing", "Return inspection missing"},
+	{payment.ErrCardDeclined, http.StatusPaymentRequired, "card-declined", "Card declined"},
+	{payment.ErrInsufficientFunds, http.StatusPaymentRequired, "insufficient-funds", "Insufficient funds"},
+	{payment.ErrExpiredCard, http.StatusPaymentRequired, "expired-card", "Card expired"},
+	{payment.ErrGatewayTimeout, http.StatusGatewayTimeout, "payment-gateway-timeout", "Payment gateway timed out"},
+	{webhook.ErrMalformedSignature, http.StatusBadRequest, "malformed-signature", "Malformed webhook signature"},
+	{webhook.ErrInvalidSignature, http.StatusUnauthorized, "invalid-signature", "Invalid webhook signature"},
+	{webhook.ErrStaleSignature, http.StatusUnauthorized, "stale-signature", "Webhook signature expired"},
+	{listquery.ErrInvalidLimit, http.StatusBadRequest, "invalid-limit", "Invalid limit"},
+	{listquery.ErrInvalidCursor, http.StatusBadRequest, "invalid-cursor", "Invalid cursor"},
+	{listquery.ErrInvalidSort, http.StatusBadRequest, "invalid-sort", "Invalid sort"},
+}
+
+// writeError answers with the problem mapped to err, hiding unmapped errors
+// behind a logged request id.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, p := range errorProblems {
+		if errors.Is(err, p.err) {
+			problem.Write(w, r, &problem.Problem{
+				Type:   "/problems/" + p.slug,
+				Title:  p.title,
+				Status: p.status,
+				Detail: err.Error(),
+			})
+			return
+		}
+	}
+
+	problem.Internal(w, r, err)
+}
+
+// writeValidationError responds with the field errors of a payload that
+// failed validation, translated to the client Accept-Language.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *dto.ValidationError
+	if !errors.As(err, &validationErr) {
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	locales := dto.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	problem.Write(w, r, &problem.Problem{
+		Type:   "/problems/validation-error",
+		Title:  "Invalid request payload",
+		Status: http.StatusUnprocessableEntity,
+		Detail: "one or more fields are invalid",
+		Errors: validationErr.Translate(locales...),
+	})
+}
+
+// writePage responds with a page of a list endpoint, linking to the next
+// page when there is one.
+func writePage[T any](w http.ResponseWriter, r *http.Request, page listquery.Page[T]) {
+	if page.NextCursor != "" {
+		w.Header().Set("Link", `<`+listquery.NextURL(r.URL, page.NextCursor)+`>; rel="next"`)
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
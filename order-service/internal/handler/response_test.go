@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantType   string
+		wantDetail string
+	}{
+		{
+			name:       "mapped sentinel error",
+			err:        service.ErrAddressNotFound,
+			wantStatus: http.StatusNotFound,
+			wantType:   "/problems/address-not-found",
+			wantDetail: "address not found",
+		},
+		{
+			name:       "wrapped sentinel error",
+			err:        fmt.Errorf("signup: %w", service.ErrUserAlreadyExists),
+			wantStatus: http.StatusConflict,
+			wantType:   "/problems/user-already-exists",
+			wantDetail: "signup: user with this username or email already exists",
+		},
+		{
+			name:       "internal error",
+			err:        errors.New("pq: connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantType:   "about:blank",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/addresses/1", nil)
+			rr := httptest.NewRecorder()
+
+			writeError(rr, req, tt.err)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+
+			var body problem.Problem
+			err := json.NewDecoder(rr.Body).Decode(&body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantType, body.Type)
+			if tt.wantDetail != "" {
+				assert.Equal(t, tt.wantDetail, body.Detail)
+			} else {
+				assert.NotContains(t, body.Detail, "pq:")
+			}
+		})
+	}
+}
+
+func TestWriteValidationError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		acceptLanguage string
+		wantStatus     int
+		wantErrors     []problem.FieldError
+	}{
+		{
+			name:           "validation error",
+			err:            (&dto.LoginPayload{Email: "test@example.com"}).Validate(),
+			acceptLanguage: "en-US,en;q=0.9",
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErrors: []problem.FieldError{
+				{Field: "password", Code: "required", Message: "password is a required field"},
+			},
+		},
+		{
+			name:       "other error",
+			err:        errors.New("something went wrong"),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/login", nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			rr := httptest.NewRecorder()
+
+			writeValidationError(rr, req, tt.err)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+
+			var body problem.Problem
+			err := json.NewDecoder(rr.Body).Decode(&body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantErrors, body.Errors)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+// ReturnHandler serves the customer return requests and, behind
+// middleware.RequireAdmin, the approval and inspection of returns.
+type ReturnHandler struct {
+	returns *service.ReturnService
+}
+
+// NewReturnHandler accepts returns up to window after the order was delivered.
+func NewReturnHandler(db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway, window time.Duration) *ReturnHandler {
+	return &ReturnHandler{returns: service.NewReturnService(db, cardVault, gateway, window)}
+}
+
+func (h *ReturnHandler) RequestReturn(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("order_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	var payload dto.ReturnPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	ret, err := h.returns.RequestReturn(r.Context(), orderID, userID, payload)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (h *ReturnHandler) ListOrderReturns(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("order_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	returns, err := h.returns.ListOrderReturns(r.Context(), orderID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(returns)
+}
+
+func (h *ReturnHandler) GetReturn(w http.ResponseWriter, r *http.Request) {
+	returnID, err := strconv.Atoi(r.PathValue("return_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid return id")
+		return
+	}
+
+	userID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || userID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	// admins see the returns of every customer
+	var ret *entity.Return
+	if role, _ := r.Context().Value(keyUserRole).(string); role == entity.RoleAdmin {
+		ret, err = h.returns.GetAnyReturn(r.Context(), returnID)
+	} else {
+		ret, err = h.returns.GetReturn(r.Context(), returnID, userID)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (h *ReturnHandler) ApproveReturn(w http.ResponseWriter, r *http.Request) {
+	returnID, err := strconv.Atoi(r.PathValue("return_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid return id")
+		return
+	}
+
+	ret, err := h.returns.ApproveReturn(r.Context(), returnID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (h *ReturnHandler) RejectReturn(w http.ResponseWriter, r *http.Request) {
+	returnID, err := strconv.Atoi(r.PathValue("return_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid return id")
+		return
+	}
+
+	var payload dto.RejectReturnPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	ret, err := h.returns.RejectReturn(r.Context(), returnID, payload.Reason)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(ret)
+}
+
+// ReceiveReturn records the inspection of the returned items and refunds
+// them, completing the return.
+func (h *ReturnHandler) ReceiveReturn(w http.ResponseWriter, r *http.Request) {
+	returnID, err := strconv.Atoi(r.PathValue("return_id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid return id")
+		return
+	}
+
+	adminID, ok := r.Context().Value(keyUserId).(int)
+	if !ok || adminID == 0 {
+		writeError(w, r, errNotLoggedIn)
+		return
+	}
+
+	var payload dto.InspectionPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	ret, err := h.returns.ReceiveReturn(r.Context(), returnID, adminID, payload)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(ret)
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+)
+
+func setupReturnHandler(t *testing.T) (*ReturnHandler, *postgres.PostgresContainer) {
+	t.Helper()
+
+	// a paid order of 2 x 300 and 1 x 400, delivered, refunded through the
+	// gateway that captured it
+	gateway := payment.NewFakeGateway()
+	setupRefundHandler(t, gateway)
+	db.MustExec("TRUNCATE TABLE returns, return_items CASCADE")
+	db.MustExec("ALTER SEQUENCE returns_return_id_seq RESTART WITH 1")
+	db.MustExec("ALTER SEQUENCE return_items_return_item_id_seq RESTART WITH 1")
+	db.MustExec("UPDATE orders SET order_status = $1 WHERE order_id = 1", entity.OrderStatusDelivered)
+
+	returnHandler := NewReturnHandler(db, cardVault, gateway, config.Default().Orders.ReturnWindow)
+	return returnHandler, pgContainer
+}
+
+func returnRequest(method, target, body string, pathValues map[string]string, userID int) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	for name, value := range pathValues {
+		req.SetPathValue(name, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), keyUserId, userID))
+}
+
+func TestRequestReturn(t *testing.T) {
+	tests := []struct {
+		name           string
+		orderStatus    string
+		undelivered    bool
+		userID         int
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "success",
+			orderStatus:    entity.OrderStatusDelivered,
+			userID:         1,
+			body:           `{"items":[{"order_item_id":1,"quantity":2,"reason_code":"damaged"}]}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "not delivered",
+			orderStatus:    entity.OrderStatusPaid,
+			userID:         1,
+			body:           `{"items":[{"order_item_id":1,"quantity":1,"reason_code":"damaged"}]}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "delivered before deliveries were recorded",
+			orderStatus:    entity.OrderStatusDelivered,
+			undelivered:    true,
+			userID:         1,
+			body:           `{"items":[{"order_item_id":1,"quantity":1,"reason_code":"damaged"}]}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "more than ordered",
+			orderStatus:    entity.OrderStatusDelivered,
+			userID:         1,
+			body:           `{"items":[{"order_item_id":2,"quantity":2,"reason_code":"wrong_item"}]}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "other user's order",
+			orderStatus:    entity.OrderStatusDelivered,
+			userID:         2,
+			body:           `{"items":[{"order_item_id":1,"quantity":1,"reason_code":"damaged"}]}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "unknown reason code",
+			orderStatus:    entity.OrderStatusDelivered,
+			userID:         1,
+			body:           `{"items":[{"order_item_id":1,"quantity":1,"reason_code":"bored"}]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returnHandler, _ := setupReturnHandler(t)
+			db.MustExec("UPDATE orders SET order_status = $1 WHERE order_id = 1", tt.orderStatus)
+			if tt.undelivered {
+				db.MustExec("UPDATE orders SET delivered_at = NULL WHERE order_id = 1")
+			}
+
+			req := returnRequest(http.MethodPost, "/orders/1/returns", tt.body, map[string]string{"order_id": "1"}, tt.userID)
+			rr := httptest.NewRecorder()
+
+			returnHandler.RequestReturn(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestReturnWorkflow(t *testing.T) {
+	returnHandler, _ := setupReturnHandler(t)
+
+	body := `{"items":[
+		{"order_item_id":1,"quantity":2,"reason_code":"damaged"},
+		{"order_item_id":2,"quantity":1,"reason_code":"no_longer_needed"}
+	]}`
+	rr := httptest.NewRecorder()
+	returnHandler.RequestReturn(rr, returnRequest(http.MethodPost, "/orders/1/returns", body, map[string]string{"order_id": "1"}, 1))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	// receiving before approval is refused
+	rr = httptest.NewRecorder()
+	returnHandler.ReceiveReturn(rr, returnRequest(http.MethodPost, "/returns/1/receive",
+		`{"items":[{"return_item_id":1,"outcome":"restock"},{"return_item_id":2,"outcome":"restock"}]}`,
+		map[string]string{"return_id": "1"}, 1))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = httptest.NewRecorder()
+	returnHandler.ApproveReturn(rr, returnRequest(http.MethodPost, "/returns/1/approve", "", map[string]string{"return_id": "1"}, 1))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var approved entity.Return
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&approved))
+	assert.Equal(t, entity.ReturnStatusApproved, approved.Status)
+	assert.NotEmpty(t, approved.LabelCode)
+
+	// every item must be inspected
+	rr = httptest.NewRecorder()
+	returnHandler.ReceiveReturn(rr, returnRequest(http.MethodPost, "/returns/1/receive",
+		`{"items":[{"return_item_id":1,"outcome":"restock"}]}`,
+		map[string]string{"return_id": "1"}, 1))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = httptest.NewRecorder()
+	returnHandler.ReceiveReturn(rr, returnRequest(http.MethodPost, "/returns/1/receive",
+		`{"items":[{"return_item_id":1,"outcome":"restock"},{"return_item_id":2,"outcome":"write_off"}]}`,
+		map[string]string{"return_id": "1"}, 1))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var completed entity.Return
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&completed))
+	assert.Equal(t, entity.ReturnStatusCompleted, completed.Status)
+	assert.NotZero(t, completed.RefundID)
+
+	var stock []int
+	err := db.Select(&stock, "SELECT stock_quantity FROM products ORDER BY product_id")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{12, 10}, stock, "written off items should not be restocked")
+
+	var refunded int
+	err = db.Get(&refunded, "SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, refunded)
+
+	var order struct {
+		OrderStatus  string `db:"order_status"`
+		RefundStatus string `db:"refund_status"`
+	}
+	err = db.Get(&order, "SELECT order_status, refund_status FROM orders WHERE order_id = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.OrderStatusDelivered, order.OrderStatus, "a refund should not undo the delivery")
+	assert.Equal(t, entity.RefundStatusRefunded, order.RefundStatus)
+}
+
+func TestRejectReturn(t *testing.T) {
+	returnHandler, _ := setupReturnHandler(t)
+
+	rr := httptest.NewRecorder()
+	returnHandler.RequestReturn(rr, returnRequest(http.MethodPost, "/orders/1/returns",
+		`{"items":[{"order_item_id":1,"quantity":1,"reason_code":"other"}]}`,
+		map[string]string{"order_id": "1"}, 1))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = httptest.NewRecorder()
+	returnHandler.RejectReturn(rr, returnRequest(http.MethodPost, "/returns/1/reject",
+		`{"reason":"outside of policy"}`,
+		map[string]string{"return_id": "1"}, 1))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	returnHandler.ListOrderReturns(rr, returnRequest(http.MethodGet, "/orders/1/returns", "", map[string]string{"order_id": "1"}, 1))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var returns []entity.Return
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&returns))
+	assert.Len(t, returns, 1)
+	assert.Equal(t, entity.ReturnStatusRejected, returns[0].Status)
+	assert.Equal(t, "outside of policy", returns[0].RejectionReason)
+
+	// a rejected return frees its items for a new request
+	rr = httptest.NewRecorder()
+	returnHandler.RequestReturn(rr, returnRequest(http.MethodPost, "/orders/1/returns",
+		`{"items":[{"order_item_id":1,"quantity":2,"reason_code":"other"}]}`,
+		map[string]string{"order_id": "1"}, 1))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+}
+
+func TestGetReturn(t *testing.T) {
+	returnHandler, _ := setupReturnHandler(t)
+
+	rr := httptest.NewRecorder()
+	returnHandler.RequestReturn(rr, returnRequest(http.MethodPost, "/orders/1/returns",
+		`{"items":[{"order_item_id":1,"quantity":1,"reason_code":"damaged"}]}`,
+		map[string]string{"order_id": "1"}, 1))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	tests := []struct {
+		name           string
+		userID         int
+		role           string
+		expectedStatus int
+	}{
+		{
+			name:           "customer of the order",
+			userID:         1,
+			role:           entity.RoleCustomer,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "another customer",
+			userID:         2,
+			role:           entity.RoleCustomer,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "admin",
+			userID:         2,
+			role:           entity.RoleAdmin,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := returnRequest(http.MethodGet, "/returns/1", "", map[string]string{"return_id": "1"}, tt.userID)
+			req = req.WithContext(context.WithValue(req.Context(), keyUserRole, tt.role))
+			rr := httptest.NewRecorder()
+
+			returnHandler.GetReturn(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var ret entity.Return
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&ret))
+				assert.Len(t, ret.Items, 1)
+			}
+		})
+	}
+}
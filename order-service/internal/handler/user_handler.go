@@ -6,46 +6,41 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/middleware"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/sqlrepo"
 	"github.com/mathesukkj/goecommerce/order-service/internal/service"
 )
 
-type key string
-
 const (
-	keyUserId key = "user_id"
+	keyUserId   = middleware.KeyUserId
+	keyUserRole = middleware.KeyUserRole
 )
 
 type UserHandler struct {
 	service *service.UserService
 }
 
-func NewUserHandler(db *sqlx.DB) *UserHandler {
-	return &UserHandler{service: service.NewUserService(db)}
+func NewUserHandler(db *sqlx.DB, ttls service.TokenTTLs) *UserHandler {
+	// only admins force password resets, no mail is sent from here
+	return &UserHandler{service: service.NewUserService(sqlrepo.NewUserRepository(db), ttls, nil)}
 }
 
 func (h *UserHandler) Signup(w http.ResponseWriter, r *http.Request) {
 	var body dto.SignupPayload
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if err := body.Validate(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, r, err)
 		return
 	}
 
-	token, err := h.service.Signup(body)
-	switch err {
-	case service.ErrUserAlreadyExists:
-		http.Error(w, err.Error(), http.StatusConflict)
-		return
-	case service.ErrPasswordTooLong:
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	case nil:
-	default:
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	token, err := h.service.Signup(r.Context(), body)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -58,26 +53,22 @@ func (h *UserHandler) Signup(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var body dto.LoginPayload
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if err := body.Validate(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, r, err)
 		return
 	}
 
-	token, err := h.service.Login(body)
-	switch err {
-	case service.ErrUserNotFound:
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	case service.ErrInvalidPassword:
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	case nil:
-	default:
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	token, err := h.service.Login(r.Context(), body)
+	if err == service.ErrUserNotFound {
+		// don't tell apart unknown emails from wrong passwords
+		err = service.ErrInvalidPassword
+	}
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -90,13 +81,17 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) GetLoggedInUser(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(keyUserId).(int)
 	if !ok {
-		http.Error(w, "user not logged in", http.StatusUnauthorized)
+		writeError(w, r, errNotLoggedIn)
 		return
 	}
 
-	user, err := h.service.GetUserByID(userID)
+	user, err := h.service.GetUserByID(r.Context(), userID)
+	if err == service.ErrUserNotFound {
+		// the token outlived its user
+		err = errNotLoggedIn
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, r, err)
 		return
 	}
 
@@ -106,29 +101,47 @@ func (h *UserHandler) GetLoggedInUser(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(keyUserId).(int)
 	if !ok {
-		http.Error(w, "user not logged in", http.StatusUnauthorized)
+		writeError(w, r, errNotLoggedIn)
 		return
 	}
 
 	var body dto.UpdateUserPayload
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if err := body.Validate(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, r, err)
 		return
 	}
 
-	updatedUser, err := h.service.UpdateUser(userID, body)
-	if err == service.ErrUserNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	updatedUser, err := h.service.UpdateUser(r.Context(), userID, body)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(updatedUser)
 }
+
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body dto.ResetPasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	err := h.service.ResetPassword(r.Context(), body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
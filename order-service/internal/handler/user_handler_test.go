@@ -10,8 +10,13 @@ import (
 	"testing"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
 	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/jwtauth"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
 	"github.com/mathesukkj/goecommerce/order-service/pkg/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -19,10 +24,24 @@ import (
 
 var db *sqlx.DB
 var pgContainer *postgres.PostgresContainer
+var cardVault vault.Vault
 
 func TestMain(m *testing.M) {
 	pgContainer, db = testutils.NewPostgresContainerDB()
 
+	localVault, err := vault.NewLocalVault(db, bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		panic(err)
+	}
+	cardVault = localVault
+
+	keyring, err := fieldcrypt.NewKeyring(1, map[int][]byte{1: bytes.Repeat([]byte{0x01}, 32)})
+	if err != nil {
+		panic(err)
+	}
+	fieldcrypt.SetKeyring(keyring)
+	jwtauth.SetSecret([]byte("test_secret"))
+
 	os.Exit(m.Run())
 }
 
@@ -32,10 +51,20 @@ func setupUserHandler(t *testing.T) (*UserHandler, *postgres.PostgresContainer)
 	db.MustExec("TRUNCATE TABLE users CASCADE")
 	db.MustExec("ALTER SEQUENCE users_user_id_seq RESTART WITH 1")
 
-	userHandler := NewUserHandler(db)
+	userHandler := NewUserHandler(db, defaultTokenTTLs())
 	return userHandler, pgContainer
 }
 
+// defaultTokenTTLs are the token lifetimes of the default configuration.
+func defaultTokenTTLs() service.TokenTTLs {
+	auth := config.Default().Auth
+	return service.TokenTTLs{
+		Session:       auth.TokenTTL,
+		Impersonation: auth.ImpersonationTokenTTL,
+		PasswordReset: auth.PasswordResetTokenTTL,
+	}
+}
+
 func seedUsers(t *testing.T) {
 	t.Helper()
 
@@ -85,7 +114,7 @@ func TestSignup(t *testing.T) {
 				Password: "password",
 				Email:    "test@example.com",
 			},
-			want: http.StatusBadRequest,
+			want: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "user with email already exists",
@@ -280,7 +309,7 @@ func TestUpdateUser(t *testing.T) {
 			payload: dto.UpdateUserPayload{
 				Username: "",
 			},
-			wantStatus: http.StatusBadRequest,
+			wantStatus: http.StatusUnprocessableEntity,
 		},
 		{
 			name:   "user not found",
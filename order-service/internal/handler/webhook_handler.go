@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/webhook"
+)
+
+const maxWebhookBodySize = 1 << 20
+
+type WebhookHandler struct {
+	events    *service.PaymentEventService
+	secrets   map[string][]byte
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+// NewWebhookHandler accepts events from the providers in secrets, keyed by
+// the provider name used in the webhook url.
+func NewWebhookHandler(db *sqlx.DB, secrets map[string][]byte) *WebhookHandler {
+	return &WebhookHandler{
+		events:    service.NewPaymentEventService(db),
+		secrets:   secrets,
+		tolerance: webhook.DefaultTolerance,
+		now:       time.Now,
+	}
+}
+
+func (h *WebhookHandler) ReceivePaymentEvent(w http.ResponseWriter, r *http.Request) {
+	provider := r.PathValue("provider")
+	secret, ok := h.secrets[provider]
+	if !ok {
+		problem.Error(w, r, http.StatusNotFound, "unknown payment provider")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		problem.Error(w, r, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	if err := webhook.Verify(secret, r.Header.Get(webhook.SignatureHeader), body, h.now(), h.tolerance); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var payload dto.PaymentEventPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	if err := h.events.IngestEvent(r.Context(), provider, payload, body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/webhook"
+)
+
+var webhookSecret = []byte("whsec_test")
+
+func setupWebhookHandler(t *testing.T) (*WebhookHandler, *postgres.PostgresContainer) {
+	t.Helper()
+
+	db.MustExec("TRUNCATE TABLE payment_events")
+	db.MustExec("ALTER SEQUENCE payment_events_event_id_seq RESTART WITH 1")
+
+	webhookHandler := NewWebhookHandler(db, map[string][]byte{"fake": webhookSecret})
+	return webhookHandler, pgContainer
+}
+
+func TestReceivePaymentEvent(t *testing.T) {
+	body := []byte(`{"id":"evt_1","type":"payment.succeeded","data":{"idempotency_key":"pay_pending","amount":1000,"currency":"USD","reference":"auth_1"}}`)
+
+	tests := []struct {
+		name            string
+		provider        string
+		signature       string
+		expectedStatus  int
+		expectedPayment string
+		expectedOrder   string
+	}{
+		{
+			name:            "valid event",
+			provider:        "fake",
+			signature:       webhook.Sign(webhookSecret, body, time.Now()),
+			expectedStatus:  http.StatusNoContent,
+			expectedPayment: entity.PaymentStatusSucceeded,
+			expectedOrder:   entity.OrderStatusAuthorized,
+		},
+		{
+			name:            "invalid signature",
+			provider:        "fake",
+			signature:       webhook.Sign([]byte("whsec_other"), body, time.Now()),
+			expectedStatus:  http.StatusUnauthorized,
+			expectedPayment: entity.PaymentStatusPending,
+			expectedOrder:   entity.OrderStatusPendingPayment,
+		},
+		{
+			name:            "stale signature",
+			provider:        "fake",
+			signature:       webhook.Sign(webhookSecret, body, time.Now().Add(-time.Hour)),
+			expectedStatus:  http.StatusUnauthorized,
+			expectedPayment: entity.PaymentStatusPending,
+			expectedOrder:   entity.OrderStatusPendingPayment,
+		},
+		{
+			name:            "unknown provider",
+			provider:        "other",
+			signature:       webhook.Sign(webhookSecret, body, time.Now()),
+			expectedStatus:  http.StatusNotFound,
+			expectedPayment: entity.PaymentStatusPending,
+			expectedOrder:   entity.OrderStatusPendingPayment,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupPaymentHandler(t)
+			webhookHandler, _ := setupWebhookHandler(t)
+			seedOrder(t, "4242424242424242")
+			db.MustExec(`
+				INSERT INTO payments (order_id, operation, amount, status, provider, currency, idempotency_key)
+				VALUES (1, 'authorize', 1000, 'pending', 'fake', 'USD', 'pay_pending')
+			`)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/payments/"+tt.provider, bytes.NewReader(body))
+			req.SetPathValue("provider", tt.provider)
+			req.Header.Set(webhook.SignatureHeader, tt.signature)
+			rr := httptest.NewRecorder()
+
+			webhookHandler.ReceivePaymentEvent(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var paymentStatus string
+			err := db.Get(&paymentStatus, "SELECT status FROM payments WHERE idempotency_key = 'pay_pending'")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedPayment, paymentStatus)
+
+			var orderStatus string
+			err = db.Get(&orderStatus, "SELECT order_status FROM orders WHERE order_id = 1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedOrder, orderStatus)
+		})
+	}
+}
+
+func TestReceivePaymentEventDuplicate(t *testing.T) {
+	setupPaymentHandler(t)
+	webhookHandler, _ := setupWebhookHandler(t)
+	seedOrder(t, "4242424242424242")
+	db.MustExec(`
+		INSERT INTO payments (order_id, operation, amount, status, provider, currency, idempotency_key)
+		VALUES (1, 'authorize', 1000, 'pending', 'fake', 'USD', 'pay_pending')
+	`)
+
+	body := []byte(`{"id":"evt_1","type":"payment.failed","data":{"idempotency_key":"pay_pending","amount":1000,"currency":"USD","failure_code":"card_declined"}}`)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/payments/fake", bytes.NewReader(body))
+		req.SetPathValue("provider", "fake")
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(webhookSecret, body, time.Now()))
+		rr := httptest.NewRecorder()
+
+		webhookHandler.ReceivePaymentEvent(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	}
+
+	var events int
+	err := db.Get(&events, "SELECT COUNT(*) FROM payment_events WHERE processed_at IS NOT NULL")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, events)
+
+	var orderStatus string
+	err = db.Get(&orderStatus, "SELECT order_status FROM orders WHERE order_id = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.OrderStatusPaymentFailed, orderStatus)
+}
@@ -0,0 +1,151 @@
+// Package health answers the probes of the orchestrator running the service:
+// /healthz while the process is alive, /readyz while it can serve requests,
+// that is every dependency check passes and it isn't shutting down.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusFailing     = "failing"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// The errors reported for a failing check, the probes are served without
+// authentication so what went wrong is only logged.
+const (
+	ErrorCheckFailed = "check failed"
+	ErrorTimedOut    = "timed out"
+)
+
+// Check reports whether a dependency is usable, it should give up once ctx is
+// done.
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type Checker struct {
+	timeout  time.Duration
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+// NewChecker returns a Checker giving each check timeout to pass.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: map[string]Check{}}
+}
+
+// Add registers check under name, it isn't safe to call once probes are
+// served.
+func (c *Checker) Add(name string, check Check) {
+	c.checks[name] = check
+}
+
+// Drain fails readiness from now on, so load balancers stop sending requests
+// before the server shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Run runs every check at once and reports them, the report is ok only when
+// all of them passed.
+func (c *Checker) Run(ctx context.Context) Report {
+	if c.draining.Load() {
+		return Report{Status: StatusDraining}
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := c.run(ctx, name, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusUnavailable
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// run bounds check by the timeout, even when it doesn't watch its context,
+// and logs why it failed.
+func (c *Checker) run(ctx context.Context, name string, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	result := CheckResult{Status: StatusOK}
+	var err error
+	select {
+	case err = <-done:
+		if err != nil {
+			result.Error = ErrorCheckFailed
+		}
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", c.timeout)
+		result.Error = ErrorTimedOut
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		result.Status = StatusFailing
+		logging.FromContext(ctx).Warn("readiness check failed", "check", name, "error", err)
+	}
+	return result
+}
+
+// Live answers as long as the process can serve http at all.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready answers 200 with the report of every check when they all pass and
+// 503 otherwise.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeReport(w, status, report)
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ready(c *Checker) (int, Report) {
+	rr := httptest.NewRecorder()
+	c.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report Report
+	json.NewDecoder(rr.Body).Decode(&report)
+	return rr.Code, report
+}
+
+func TestLive(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	rr := httptest.NewRecorder()
+	c.Live(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code, "liveness shouldn't depend on the checks")
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestReady(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("migrations", func(ctx context.Context) error { return nil })
+
+	code, report := ready(c)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, StatusOK, report.Checks["migrations"].Status)
+}
+
+func TestReadyFailingCheck(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("migrations", func(ctx context.Context) error { return errors.New("migration is not applied: 0002_add_orders") })
+
+	code, report := ready(c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusUnavailable, report.Status)
+	assert.Equal(t, CheckResult{Status: StatusOK}, report.Checks["database"])
+	assert.Equal(t, CheckResult{Status: StatusFailing, Error: ErrorCheckFailed}, report.Checks["migrations"], "the error should not be exposed")
+}
+
+func TestReadyCheckTimeout(t *testing.T) {
+	c := NewChecker(10 * time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+	c.Add("gateway", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	start := time.Now()
+	code, report := ready(c)
+	assert.Less(t, time.Since(start), time.Second, "a check ignoring its context shouldn't hold the probe")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFailing, report.Checks["gateway"].Status)
+	assert.Equal(t, ErrorTimedOut, report.Checks["gateway"].Error)
+}
+
+func TestReadyDraining(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Drain()
+
+	code, report := ready(c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, Report{Status: StatusDraining}, report)
+
+	rr := httptest.NewRecorder()
+	c.Live(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code, "the process is still alive while draining")
+}
@@ -0,0 +1,53 @@
+// Package jwtauth signs and verifies the HS256 tokens users authenticate
+// with.
+//
+// The process wide secret is installed with SetSecret at startup. Until then
+// every token is refused, so a missing secret never signs tokens anyone could
+// forge.
+package jwtauth
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrNoSecret = errors.New("jwtauth: no signing secret configured")
+
+var secret atomic.Pointer[[]byte]
+
+// SetSecret installs the secret tokens are signed and verified with.
+func SetSecret(s []byte) {
+	secret.Store(&s)
+}
+
+func currentSecret() ([]byte, error) {
+	s := secret.Load()
+	if s == nil || len(*s) == 0 {
+		return nil, ErrNoSecret
+	}
+	return *s, nil
+}
+
+// Sign returns claims as a signed token.
+func Sign(claims jwt.MapClaims) (string, error) {
+	key, err := currentSecret()
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// Parse verifies tokenString and reads its claims into claims. Tokens signed
+// with anything but HMAC are refused.
+func Parse(tokenString string, claims jwt.MapClaims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return currentSecret()
+	})
+}
@@ -0,0 +1,50 @@
+package jwtauth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndParse(t *testing.T) {
+	SetSecret([]byte("secret"))
+	defer SetSecret(nil)
+
+	tokenString, err := Sign(jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Hour).Unix()})
+	assert.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	token, err := Parse(tokenString, claims)
+	assert.NoError(t, err)
+	assert.True(t, token.Valid)
+	assert.Equal(t, float64(1), claims["user_id"])
+
+	SetSecret([]byte("other"))
+	_, err = Parse(tokenString, jwt.MapClaims{})
+	assert.Error(t, err, "a token signed with another secret")
+}
+
+func TestNoSecret(t *testing.T) {
+	SetSecret(nil)
+
+	_, err := Sign(jwt.MapClaims{"user_id": 1})
+	assert.ErrorIs(t, err, ErrNoSecret)
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1}).SignedString([]byte{})
+	assert.NoError(t, err)
+	_, err = Parse(unsigned, jwt.MapClaims{})
+	assert.ErrorIs(t, err, ErrNoSecret, "a token signed with an empty secret")
+}
+
+func TestParseRefusesOtherMethods(t *testing.T) {
+	SetSecret([]byte("secret"))
+	defer SetSecret(nil)
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"user_id": 1}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(t, err)
+
+	_, err = Parse(unsigned, jwt.MapClaims{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+// Package listquery parses the limit, cursor, sort and filter parameters of
+// list endpoints and turns them into keyset paginated sql.
+//
+//	GET /addresses?limit=10&sort=-address_id&country=USA&cursor=...
+//
+// Pages are ordered by the sort column and then by the row id, the cursor
+// holds both values of the last row so the next page starts right after it
+// whatever was inserted or deleted in between.
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultLimit = 20
+	// MaxLimit caps every page, larger limits are lowered to it.
+	MaxLimit = 100
+)
+
+var (
+	ErrInvalidLimit  = errors.New("limit must be a positive integer")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("unsupported sort field")
+)
+
+// Spec declares what a list endpoint can be sorted and filtered by, mapping
+// the names used in the query string to columns.
+type Spec struct {
+	// IDColumn breaks ties between rows with the same sort value, it must be
+	// unique.
+	IDColumn string
+	Sorts    map[string]string
+	// DefaultSort is a key of Sorts, prefixed with "-" for descending order.
+	DefaultSort string
+	// Filters are matched for equality.
+	Filters map[string]string
+}
+
+type Query struct {
+	Limit      int
+	Sort       string
+	Descending bool
+	Filters    map[string]string
+	After      *Cursor
+
+	spec Spec
+}
+
+// Cursor points at the last row of a page. Sort is kept so a cursor is not
+// reused with another sort order.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// Page is a list response, NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Parse reads limit, sort, cursor and the filters of spec from values.
+// Unknown parameters are ignored.
+func Parse(values url.Values, spec Spec) (Query, error) {
+	q := Query{Limit: DefaultLimit, Filters: map[string]string{}, spec: spec}
+
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 {
+			return Query{}, ErrInvalidLimit
+		}
+		q.Limit = min(l, MaxLimit)
+	}
+
+	sortParam := values.Get("sort")
+	if sortParam == "" {
+		sortParam = spec.DefaultSort
+	}
+	q.Sort = strings.TrimPrefix(sortParam, "-")
+	q.Descending = strings.HasPrefix(sortParam, "-")
+	if _, ok := spec.Sorts[q.Sort]; !ok {
+		return Query{}, fmt.Errorf("%w: %s", ErrInvalidSort, q.Sort)
+	}
+
+	for name := range spec.Filters {
+		if value := values.Get(name); value != "" {
+			q.Filters[name] = value
+		}
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil || c.Sort != sortParam {
+			return Query{}, ErrInvalidCursor
+		}
+		q.After = c
+	}
+
+	return q, nil
+}
+
+// Apply appends the filter, cursor, order and limit clauses to query, which
+// must end in a WHERE clause whose placeholders are args. One row more than
+// the limit is selected, for Paginate to know whether another page follows.
+func (q Query) Apply(query string, args []any) (string, []any) {
+	var b strings.Builder
+	b.WriteString(query)
+
+	names := make([]string, 0, len(q.Filters))
+	for name := range q.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		args = append(args, q.Filters[name])
+		fmt.Fprintf(&b, " AND %s = $%d", q.spec.Filters[name], len(args))
+	}
+
+	column := q.spec.Sorts[q.Sort]
+	direction, comparison := "ASC", ">"
+	if q.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if q.After != nil {
+		if column == q.spec.IDColumn {
+			args = append(args, q.After.ID)
+			fmt.Fprintf(&b, " AND %s %s $%d", column, comparison, len(args))
+		} else {
+			args = append(args, q.After.Value, q.After.ID)
+			fmt.Fprintf(&b, " AND (%s, %s) %s ($%d, $%d)", column, q.spec.IDColumn, comparison, len(args)-1, len(args))
+		}
+	}
+
+	if column == q.spec.IDColumn {
+		fmt.Fprintf(&b, " ORDER BY %s %s", column, direction)
+	} else {
+		fmt.Fprintf(&b, " ORDER BY %s %s, %s %s", column, direction, q.spec.IDColumn, direction)
+	}
+
+	args = append(args, q.Limit+1)
+	fmt.Fprintf(&b, " LIMIT $%d", len(args))
+
+	return b.String(), args
+}
+
+// Paginate turns the rows selected with Apply into a page. key returns the
+// sort value and id of a row, as used by the cursor of the next page.
+func Paginate[T any](q Query, rows []T, key func(T) (string, int)) Page[T] {
+	page := Page[T]{Items: rows}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	if len(rows) > q.Limit {
+		page.Items = rows[:q.Limit]
+
+		sortParam := q.Sort
+		if q.Descending {
+			sortParam = "-" + sortParam
+		}
+		value, id := key(page.Items[q.Limit-1])
+		page.NextCursor = encodeCursor(Cursor{Sort: sortParam, Value: value, ID: id})
+	}
+
+	return page
+}
+
+// NextURL is u pointing at the page after the one with nextCursor.
+func NextURL(u *url.URL, nextCursor string) string {
+	next := *u
+	query := next.Query()
+	query.Set("cursor", nextCursor)
+	next.RawQuery = query.Encode()
+	return next.RequestURI()
+}
+
+func encodeCursor(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
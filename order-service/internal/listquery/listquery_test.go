@@ -0,0 +1,148 @@
+package listquery
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSpec = Spec{
+	IDColumn: "order_id",
+	Sorts: map[string]string{
+		"order_id":   "order_id",
+		"order_date": "order_date",
+	},
+	DefaultSort: "-order_date",
+	Filters:     map[string]string{"status": "order_status"},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    Query
+		wantErr error
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  Query{Limit: DefaultLimit, Sort: "order_date", Descending: true, Filters: map[string]string{}},
+		},
+		{
+			name:  "sort, filter and limit",
+			query: "sort=order_id&status=paid&limit=5&other=ignored",
+			want:  Query{Limit: 5, Sort: "order_id", Filters: map[string]string{"status": "paid"}},
+		},
+		{
+			name:  "limit above the maximum",
+			query: "limit=1000",
+			want:  Query{Limit: MaxLimit, Sort: "order_date", Descending: true, Filters: map[string]string{}},
+		},
+		{
+			name:    "invalid limit",
+			query:   "limit=0",
+			wantErr: ErrInvalidLimit,
+		},
+		{
+			name:    "unknown sort",
+			query:   "sort=total_amount",
+			wantErr: ErrInvalidSort,
+		},
+		{
+			name:    "malformed cursor",
+			query:   "cursor=not-a-cursor",
+			wantErr: ErrInvalidCursor,
+		},
+		{
+			name:    "cursor of another sort",
+			query:   "sort=order_id&cursor=" + encodeCursor(Cursor{Sort: "-order_date", Value: "2024-01-01", ID: 3}),
+			wantErr: ErrInvalidCursor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+
+			got, err := Parse(values, testSpec)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			tt.want.spec = testSpec
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	base := "SELECT order_id FROM orders WHERE user_id = $1"
+
+	tests := []struct {
+		name      string
+		query     string
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			name:      "first page",
+			query:     "status=paid&limit=10",
+			wantQuery: base + " AND order_status = $2 ORDER BY order_date DESC, order_id DESC LIMIT $3",
+			wantArgs:  []any{1, "paid", 11},
+		},
+		{
+			name:      "next page",
+			query:     "cursor=" + encodeCursor(Cursor{Sort: "-order_date", Value: "2024-01-01T00:00:00Z", ID: 3}),
+			wantQuery: base + " AND (order_date, order_id) < ($2, $3) ORDER BY order_date DESC, order_id DESC LIMIT $4",
+			wantArgs:  []any{1, "2024-01-01T00:00:00Z", 3, DefaultLimit + 1},
+		},
+		{
+			name:      "next page sorted by id",
+			query:     "sort=order_id&cursor=" + encodeCursor(Cursor{Sort: "order_id", ID: 3}),
+			wantQuery: base + " AND order_id > $2 ORDER BY order_id ASC LIMIT $3",
+			wantArgs:  []any{1, 3, DefaultLimit + 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			q, err := Parse(values, testSpec)
+			assert.NoError(t, err)
+
+			gotQuery, gotArgs := q.Apply(base, []any{1})
+			assert.Equal(t, tt.wantQuery, gotQuery)
+			assert.Equal(t, tt.wantArgs, gotArgs)
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	q, err := Parse(url.Values{"limit": {"2"}, "sort": {"order_id"}}, testSpec)
+	assert.NoError(t, err)
+
+	key := func(id int) (string, int) { return "", id }
+
+	page := Paginate(q, []int{1, 2, 3}, key)
+	assert.Equal(t, []int{1, 2}, page.Items)
+	assert.NotEmpty(t, page.NextCursor)
+
+	next, err := Parse(url.Values{"limit": {"2"}, "sort": {"order_id"}, "cursor": {page.NextCursor}}, testSpec)
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Sort: "order_id", ID: 2}, next.After)
+
+	last := Paginate(next, []int{3}, key)
+	assert.Equal(t, []int{3}, last.Items)
+	assert.Empty(t, last.NextCursor)
+
+	empty := Paginate(q, nil, key)
+	assert.NotNil(t, empty.Items, "an empty page should encode as []")
+}
+
+func TestNextURL(t *testing.T) {
+	u, _ := url.Parse("/orders?limit=2&cursor=old")
+	assert.Equal(t, "/orders?cursor=new&limit=2", NextURL(u, "new"))
+}
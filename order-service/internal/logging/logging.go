@@ -0,0 +1,177 @@
+// Package logging builds the slog logger of the service and carries a logger
+// per request in the context, holding the request id, route and, once
+// authenticated, the user the request is made by.
+//
+// Whatever is logged goes through the redaction of the handler: attributes
+// named like a password, token, secret or card number are replaced, and so is
+// anything shaped like a card number, even inside logged payloads.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/card"
+)
+
+// Formats.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+var Formats = []string{FormatJSON, FormatText}
+
+// Redacted replaces the values kept out of the logs.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are the parts of attribute and payload field names whose
+// values are redacted.
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie", "card_number", "cardnumber", "cvv", "cvc"}
+
+// cardNumber matches the digit runs that may be card numbers, card.Valid
+// tells them apart.
+var cardNumber = regexp.MustCompile(`\d(?:[ -]?\d){11,18}`)
+
+// New returns a logger writing records of level and above to w in format,
+// FormatJSON or FormatText, with the sensitive values redacted.
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+
+	switch format {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+		return slog.Any(a.Key, redactPayload(a.Value.Any()))
+	}
+	return a
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactString(s string) string {
+	return cardNumber.ReplaceAllStringFunc(s, func(digits string) string {
+		if card.Valid(card.Normalize(digits)) {
+			return Redacted
+		}
+		return digits
+	})
+}
+
+// redactPayload redacts the fields of v as it would be encoded to JSON, so
+// the payloads of requests can be logged as they are.
+func redactPayload(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Redacted
+	}
+
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return Redacted
+	}
+	return redactDecoded(decoded)
+}
+
+func redactDecoded(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if sensitiveKey(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactDecoded(value)
+			}
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = redactDecoded(value)
+		}
+		return v
+	case string:
+		return redactString(v)
+	}
+	return v
+}
+
+type loggerKey struct{}
+
+// requestLogger is the logger of a request, shared by the contexts derived
+// from its own so attributes added deep in the handlers reach the access log.
+type requestLogger struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+}
+
+// WithLogger returns a context carrying logger, see FromContext.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, &requestLogger{logger: logger})
+}
+
+// FromContext returns the logger of the request ctx belongs to, or the
+// default logger outside of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*requestLogger); ok {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.logger
+	}
+	return slog.Default()
+}
+
+// AddAttrs adds args, as slog.Logger.With takes them, to the logger of the
+// request ctx belongs to, for everything logged about it from then on.
+func AddAttrs(ctx context.Context, args ...any) {
+	if l, ok := ctx.Value(loggerKey{}).(*requestLogger); ok {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.logger = l.logger.With(args...)
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the id of the request it belongs
+// to, see RequestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the id of the request ctx belongs to, empty outside of a
+// request.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// record logs msg with args through a logger built by New and returns the
+// JSON record written.
+func record(t *testing.T, args ...any) map[string]any {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	logger.Info("message", args...)
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid record %q: %v", buf.String(), err)
+	}
+	return got
+}
+
+func TestRedaction(t *testing.T) {
+	type payment struct {
+		CardNumber string `json:"card_number"`
+		HolderName string `json:"holder_name"`
+	}
+	type signup struct {
+		Username string    `json:"username"`
+		Password string    `json:"password"`
+		Payments []payment `json:"payments"`
+	}
+
+	tests := []struct {
+		name string
+		args []any
+		want map[string]any
+	}{
+		{
+			name: "sensitive keys",
+			args: []any{"password", "hunter2", "reset_token", "abc", "Authorization", "Bearer abc", "user_id", 1},
+			want: map[string]any{"password": Redacted, "reset_token": Redacted, "Authorization": Redacted, "user_id": float64(1)},
+		},
+		{
+			name: "card number in a string",
+			args: []any{"detail", "charging 4242 4242 4242 4242 for order 1234567890123"},
+			want: map[string]any{"detail": "charging " + Redacted + " for order 1234567890123"},
+		},
+		{
+			name: "card number in an error",
+			args: []any{"error", errors.New("gateway rejected 4242424242424242")},
+			want: map[string]any{"error": "gateway rejected " + Redacted},
+		},
+		{
+			name: "payload",
+			args: []any{"payload", signup{
+				Username: "john",
+				Password: "password123",
+				Payments: []payment{{CardNumber: "4242424242424242", HolderName: "John Doe"}},
+			}},
+			want: map[string]any{"payload": map[string]any{
+				"username": "john",
+				"password": Redacted,
+				"payments": []any{map[string]any{"card_number": Redacted, "holder_name": "John Doe"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := record(t, tt.args...)
+			for key, want := range tt.want {
+				assert.Equal(t, want, got[key], key)
+			}
+		})
+	}
+}
+
+func TestNewUnknownFormat(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, "logfmt", slog.LevelInfo)
+	assert.EqualError(t, err, `unknown log format "logfmt"`)
+}
+
+func TestAddAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, FormatJSON, slog.LevelInfo)
+
+	ctx := WithLogger(context.Background(), logger.With("request_id", "request-1"))
+	// attributes added through a derived context reach the request logger
+	derived, cancel := context.WithCancel(ctx)
+	defer cancel()
+	AddAttrs(derived, "user_id", 1)
+
+	FromContext(ctx).Info("request")
+
+	var got map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "request-1", got["request_id"])
+	assert.Equal(t, float64(1), got["user_id"])
+
+	assert.Same(t, slog.Default(), FromContext(context.Background()), "outside of a request")
+}
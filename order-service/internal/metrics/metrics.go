@@ -0,0 +1,95 @@
+// Package metrics holds the prometheus metrics of the service, served from
+// Registry on /metrics.
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "order_service"
+
+// Login results.
+const (
+	LoginSucceeded = "succeeded"
+	LoginFailed    = "failed"
+)
+
+// Registry gathers every metric of the service, along with the go runtime and
+// process ones.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts the requests by the pattern of their route and the
+	// status they were answered with.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests served, by route pattern and status.",
+	}, []string{"route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve requests, by route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	// QueryDuration times the queries by the service method running them, see
+	// database.WithOperation.
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken to run queries, by the service method running them.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	Signups = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signups_total",
+		Help:      "Customers signed up.",
+	})
+
+	// Logins counts the logins by result, LoginSucceeded or LoginFailed.
+	// Logins that didn't get an answer for the credentials aren't counted.
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Logins, by result.",
+	}, []string{"result"})
+
+	// PaymentAuthorizations counts the payments the gateway authorized.
+	PaymentAuthorizations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_authorizations_total",
+		Help:      "Payments authorized.",
+	})
+
+	PaymentDeclines = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_declines_total",
+		Help:      "Payments declined, by failure code.",
+	}, []string{"code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		QueryDuration,
+		Signups,
+		Logins,
+		PaymentAuthorizations,
+		PaymentDeclines,
+	)
+}
+
+// RegisterDBStats exposes the connection pool stats of db, it must be called
+// once per database.
+func RegisterDBStats(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
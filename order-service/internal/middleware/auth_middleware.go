@@ -2,54 +2,148 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/jwtauth"
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
 )
 
-type userIdContextKey string
+type ContextKey string
 
-const jwtUserIdKey userIdContextKey = "user_id"
+const (
+	KeyUserId   ContextKey = "user_id"
+	KeyUserRole ContextKey = "role"
+	// KeyActorId holds the admin user id when the request is made with an
+	// impersonation token, and is absent otherwise.
+	KeyActorId ContextKey = "act"
+)
 
-func JwtUserId(next http.HandlerFunc) http.HandlerFunc {
+// AccountChecker loads the current state of the account a token belongs to,
+// so disabled accounts and revoked tokens are rejected even while the token
+// is valid.
+type AccountChecker interface {
+	// Account returns the user, or nil when it no longer exists.
+	Account(ctx context.Context, userID int) (*entity.User, error)
+}
+
+// JwtUserId authenticates the bearer token of the request against the
+// account of its owner, loaded from checker on every request: a disabled
+// account can't keep using a token issued before it was disabled, a token of
+// an older version than the account was revoked, and the role is the current
+// one rather than the one the token was issued with. The admin an
+// impersonation token was issued to must still be an active admin, and its
+// writes are refused by AuditImpersonation, which must wrap next, once they
+// are recorded.
+func JwtUserId(checker AccountChecker, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "user not logged in", http.StatusUnauthorized)
+			problem.Error(w, r, http.StatusUnauthorized, "user not logged in")
 			return
 		}
 
 		bearerToken := strings.Split(authHeader, " ")
 		if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			problem.Error(w, r, http.StatusUnauthorized, "invalid token")
 			return
 		}
 
 		tokenString := bearerToken[1]
 		claims := jwt.MapClaims{}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		token, err := jwtauth.Parse(tokenString, claims)
 
 		if err != nil || !token.Valid {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			problem.Error(w, r, http.StatusUnauthorized, "invalid token")
 			return
 		}
 
 		userID, ok := claims["user_id"].(float64)
 		if !ok {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			problem.Error(w, r, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		logging.AddAttrs(r.Context(), "user_id", int(userID))
+
+		account, err := checker.Account(r.Context(), int(userID))
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if account == nil || account.Disabled {
+			problem.Error(w, r, http.StatusForbidden, "user account is disabled")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), jwtUserIdKey, int(userID))
+		// tokens issued before versions were carried are of version 0
+		version, _ := claims["ver"].(float64)
+		if int(version) != account.TokenVersion {
+			problem.Error(w, r, http.StatusUnauthorized, "token was revoked")
+			return
+		}
+
+		role := account.Role
+		if role == "" {
+			role = entity.RoleCustomer
+		}
+
+		ctx := context.WithValue(r.Context(), KeyUserId, int(userID))
+		ctx = context.WithValue(ctx, KeyUserRole, role)
+
+		if act, ok := claims["act"]; ok {
+			actorID, ok := actorUserID(act)
+			if !ok {
+				problem.Error(w, r, http.StatusUnauthorized, "invalid token")
+				return
+			}
+
+			actor, err := checker.Account(r.Context(), actorID)
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+			if actor == nil || actor.Disabled || actor.Role != entity.RoleAdmin {
+				problem.Error(w, r, http.StatusForbidden, "impersonating user is no longer an admin")
+				return
+			}
+
+			ctx = context.WithValue(ctx, KeyActorId, actorID)
+			logging.AddAttrs(ctx, "actor_user_id", actorID)
+		}
+
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// RequireAdmin must run after JwtUserId, it rejects every user whose account
+// is not an admin one now, whatever role their token was issued with.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value(KeyUserRole).(string)
+		if role != entity.RoleAdmin {
+			problem.Error(w, r, http.StatusForbidden, "admin access required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func actorUserID(act interface{}) (int, bool) {
+	actClaims, ok := act.(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	actorID, ok := actClaims["user_id"].(float64)
+	if !ok {
+		return 0, false
+	}
+
+	return int(actorID), true
+}
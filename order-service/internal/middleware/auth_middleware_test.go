@@ -1,19 +1,22 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/jwtauth"
 )
 
 func TestAuthMiddlewareToken(t *testing.T) {
-	os.Setenv("JWT_SECRET", "secret")
-	defer os.Unsetenv("JWT_SECRET")
+	jwtauth.SetSecret([]byte("secret"))
+	defer jwtauth.SetSecret(nil)
 
 	tests := []struct {
 		name        string
@@ -67,11 +70,11 @@ func TestAuthMiddlewareToken(t *testing.T) {
 			tt.setupAuth(req)
 
 			recorder := httptest.NewRecorder()
-			handler := JwtUserId(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				userID := r.Context().Value(jwtUserIdKey)
+			handler := JwtUserId(activeAccounts, func(w http.ResponseWriter, r *http.Request) {
+				userID := r.Context().Value(KeyUserId)
 				assert.NotNil(t, userID)
 				w.WriteHeader(http.StatusOK)
-			}))
+			})
 
 			handler.ServeHTTP(recorder, req)
 			tt.checkResult(t, recorder)
@@ -79,13 +82,269 @@ func TestAuthMiddlewareToken(t *testing.T) {
 	}
 }
 
+type fakeAccountChecker map[int]*entity.User
+
+func (f fakeAccountChecker) Account(ctx context.Context, userID int) (*entity.User, error) {
+	return f[userID], nil
+}
+
+// activeAccounts is a checker finding user 1 an active customer.
+var activeAccounts = fakeAccountChecker{1: {UserID: 1, Role: entity.RoleCustomer}}
+
+func TestAuthMiddlewareDisabledAccount(t *testing.T) {
+	jwtauth.SetSecret([]byte("secret"))
+	defer jwtauth.SetSecret(nil)
+
+	checker := fakeAccountChecker{
+		1: {UserID: 1},
+		2: {UserID: 2, Disabled: true},
+	}
+
+	tests := []struct {
+		name       string
+		userID     int
+		wantStatus int
+	}{
+		{
+			name:       "active user",
+			userID:     1,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "disabled user",
+			userID:     2,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "deleted user",
+			userID:     3,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+generateTestToken(tt.userID))
+
+			recorder := httptest.NewRecorder()
+			handler := JwtUserId(checker, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	jwtauth.SetSecret([]byte("secret"))
+	defer jwtauth.SetSecret(nil)
+
+	checker := fakeAccountChecker{
+		1: {UserID: 1, Role: entity.RoleAdmin},
+		2: {UserID: 2, Role: entity.RoleCustomer},
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "admin user",
+			token:      generateTestTokenWithRole(1, "admin"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "customer user",
+			token:      generateTestTokenWithRole(2, "customer"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "admin token of a demoted user",
+			token:      generateTestTokenWithRole(2, "admin"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "admin without role in the token",
+			token:      generateTestToken(1),
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			recorder := httptest.NewRecorder()
+			handler := JwtUserId(checker, RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+		})
+	}
+}
+
+func TestAuthMiddlewareImpersonation(t *testing.T) {
+	jwtauth.SetSecret([]byte("secret"))
+	defer jwtauth.SetSecret(nil)
+
+	checker := fakeAccountChecker{
+		1: {UserID: 1, Role: entity.RoleCustomer},
+		7: {UserID: 7, Role: entity.RoleAdmin},
+		8: {UserID: 8, Role: entity.RoleCustomer},
+		9: {UserID: 9, Role: entity.RoleAdmin, Disabled: true},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		act        interface{}
+		wantStatus int
+		wantActor  int
+	}{
+		{
+			name:       "read request",
+			method:     http.MethodGet,
+			act:        map[string]interface{}{"user_id": 7},
+			wantStatus: http.StatusOK,
+			wantActor:  7,
+		},
+		{
+			// refused by AuditImpersonation once recorded
+			name:       "write request",
+			method:     http.MethodPost,
+			act:        map[string]interface{}{"user_id": 7},
+			wantStatus: http.StatusOK,
+			wantActor:  7,
+		},
+		{
+			name:       "malformed act claim",
+			method:     http.MethodGet,
+			act:        "7",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "actor no longer an admin",
+			method:     http.MethodGet,
+			act:        map[string]interface{}{"user_id": 8},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "actor disabled",
+			method:     http.MethodGet,
+			act:        map[string]interface{}{"user_id": 9},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "actor deleted",
+			method:     http.MethodGet,
+			act:        map[string]interface{}{"user_id": 10},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"user_id": 1,
+				"act":     tt.act,
+				"exp":     time.Now().Add(time.Minute).Unix(),
+			})
+			tokenStr, err := token.SignedString([]byte("secret"))
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest(tt.method, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenStr)
+
+			recorder := httptest.NewRecorder()
+			handler := JwtUserId(checker, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, 1, r.Context().Value(KeyUserId))
+				assert.Equal(t, tt.wantActor, r.Context().Value(KeyActorId))
+				w.WriteHeader(http.StatusOK)
+			})
+
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+		})
+	}
+}
+
+func TestAuthMiddlewareRevokedToken(t *testing.T) {
+	jwtauth.SetSecret([]byte("secret"))
+	defer jwtauth.SetSecret(nil)
+
+	// the password reset of the user was forced once since the token was
+	// issued
+	checker := fakeAccountChecker{1: {UserID: 1, TokenVersion: 1}}
+
+	tests := []struct {
+		name       string
+		version    interface{}
+		wantStatus int
+	}{
+		{
+			name:       "current version",
+			version:    1,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "older version",
+			version:    0,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token without version",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"user_id": 1,
+				"exp":     time.Now().Add(time.Minute).Unix(),
+			}
+			if tt.version != nil {
+				claims["ver"] = tt.version
+			}
+			tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenStr)
+
+			recorder := httptest.NewRecorder()
+			handler := JwtUserId(checker, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+		})
+	}
+}
+
 func generateTestToken(userId int) string {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	return generateTestTokenWithRole(userId, "")
+}
+
+func generateTestTokenWithRole(userId int, role string) string {
+	claims := jwt.MapClaims{
 		"user_id": userId,
 		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
+	}
+	if role != "" {
+		claims["role"] = role
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	tokenStr, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenStr, err := token.SignedString([]byte("secret"))
 	if err != nil {
 		return ""
 	}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+var (
+	corsMethods = strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}, ", ")
+	corsHeaders = strings.Join([]string{"Authorization", "Content-Type", IdempotencyKeyHeader}, ", ")
+)
+
+// corsMaxAge is how long, in seconds, browsers may cache a preflight answer.
+const corsMaxAge = "600"
+
+// CORS lets browsers on allowedOrigins call next, answering their preflight
+// requests itself. An allowed origin of * allows every origin, none allows no
+// cross origin call.
+func CORS(allowedOrigins []string, next http.Handler) http.Handler {
+	allowAny := slices.Contains(allowedOrigins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := allowAny || slices.Contains(allowedOrigins, origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			// without the headers below the browser refuses the call
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowedOrigins []string
+		method         string
+		origin         string
+		preflight      bool
+		wantStatus     int
+		wantOrigin     string
+		wantMethods    bool
+	}{
+		{
+			name:           "same origin request",
+			allowedOrigins: []string{"https://shop.example.com"},
+			method:         http.MethodGet,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name:           "allowed origin",
+			allowedOrigins: []string{"https://shop.example.com"},
+			method:         http.MethodGet,
+			origin:         "https://shop.example.com",
+			wantStatus:     http.StatusOK,
+			wantOrigin:     "https://shop.example.com",
+		},
+		{
+			name:           "any origin",
+			allowedOrigins: []string{"*"},
+			method:         http.MethodGet,
+			origin:         "https://other.example.com",
+			wantStatus:     http.StatusOK,
+			wantOrigin:     "https://other.example.com",
+		},
+		{
+			name:           "disallowed origin",
+			allowedOrigins: []string{"https://shop.example.com"},
+			method:         http.MethodGet,
+			origin:         "https://evil.example.com",
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name:           "allowed preflight",
+			allowedOrigins: []string{"https://shop.example.com"},
+			method:         http.MethodOptions,
+			origin:         "https://shop.example.com",
+			preflight:      true,
+			wantStatus:     http.StatusNoContent,
+			wantOrigin:     "https://shop.example.com",
+			wantMethods:    true,
+		},
+		{
+			name:       "disallowed preflight",
+			method:     http.MethodOptions,
+			origin:     "https://evil.example.com",
+			preflight:  true,
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/orders", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := CORS(tt.allowedOrigins, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.wantMethods, rr.Header().Get("Access-Control-Allow-Methods") != "")
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from a previous
+	// request with the same key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize bounds the bodies read to fingerprint requests.
+	maxIdempotentBodySize = 1 << 20
+
+	// idempotencyLeaseMargin is how long past the deadline of its request a
+	// key stays leased to it, for the response to be stored.
+	idempotencyLeaseMargin = 30 * time.Second
+	// unboundedIdempotencyLease leases the keys of requests without a
+	// deadline.
+	unboundedIdempotencyLease = 5 * time.Minute
+)
+
+type IdempotencyStore interface {
+	BeginRequest(ctx context.Context, userID int, key, fingerprint string, lease time.Duration) (string, *entity.IdempotencyRecord, error)
+	CompleteRequest(ctx context.Context, userID int, key, token string, statusCode int, header http.Header, body []byte) error
+	ReleaseRequest(ctx context.Context, userID int, key, token string) error
+}
+
+// Idempotent must run after JwtUserId, it makes POST, PUT and DELETE
+// requests carrying an Idempotency-Key header safe to retry: the first
+// response for a key is stored per user and replayed to later requests with
+// the same key, with the headers the handler set. Server errors are not
+// stored, so those requests run again. A key stays leased to its request
+// until a little past the request deadline, after which a retry takes over
+// a request that never finished.
+func Idempotent(store IdempotencyStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		userID, ok := r.Context().Value(KeyUserId).(int)
+		if key == "" || !ok || !acceptsIdempotencyKey(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			problem.Error(w, r, http.StatusBadRequest, "idempotency key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				problem.Error(w, r, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			problem.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+		lease := unboundedIdempotencyLease
+		if deadline, ok := r.Context().Deadline(); ok {
+			lease = time.Until(deadline) + idempotencyLeaseMargin
+		}
+
+		token, stored, err := store.BeginRequest(r.Context(), userID, key, fingerprint, lease)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		if stored != nil {
+			switch {
+			case stored.Fingerprint != fingerprint:
+				problem.Error(w, r, http.StatusUnprocessableEntity, "idempotency key was already used for a different request")
+			case stored.StatusCode == 0:
+				problem.Error(w, r, http.StatusConflict, "a request with this idempotency key is still in progress")
+			default:
+				for name, values := range stored.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(stored.StatusCode)
+				w.Write(stored.ResponseBody)
+			}
+			return
+		}
+
+		// the headers set before, as the request id, belong to this request
+		// and are not replayed
+		before := w.Header().Clone()
+		rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		// the key stays reserved unless this runs, even when the client went
+		// away or the request timed out
+		ctx := context.WithoutCancel(r.Context())
+		if rw.status >= http.StatusInternalServerError {
+			err = store.ReleaseRequest(ctx, userID, key, token)
+		} else {
+			err = store.CompleteRequest(ctx, userID, key, token, rw.status, headersSet(before, rw.Header()), rw.body.Bytes())
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to store idempotent response", "error", err)
+		}
+	}
+}
+
+// requestFingerprint tells apart requests reusing a key for something else.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// headersSet returns the headers of after that differ from before.
+func headersSet(before, after http.Header) http.Header {
+	set := http.Header{}
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			set[name] = values
+		}
+	}
+	return set
+}
+
+func acceptsIdempotencyKey(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodDelete
+}
+
+// recordingWriter keeps a copy of the response on its way to the client.
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
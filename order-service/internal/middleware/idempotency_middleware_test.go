@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+)
+
+type fakeIdempotencyStore struct {
+	records map[string]*entity.IdempotencyRecord
+	leases  map[string]time.Time
+	tokens  map[string]string
+}
+
+func newFakeIdempotencyStore() *fakeIdempotencyStore {
+	return &fakeIdempotencyStore{
+		records: map[string]*entity.IdempotencyRecord{},
+		leases:  map[string]time.Time{},
+		tokens:  map[string]string{},
+	}
+}
+
+func (f *fakeIdempotencyStore) BeginRequest(ctx context.Context, userID int, key, fingerprint string, lease time.Duration) (string, *entity.IdempotencyRecord, error) {
+	id := f.id(userID, key)
+	if record, ok := f.records[id]; ok {
+		takeOver := record.StatusCode == 0 && record.Fingerprint == fingerprint && !f.leases[id].After(time.Now())
+		if !takeOver {
+			stored := *record
+			return "", &stored, nil
+		}
+	}
+	f.records[id] = &entity.IdempotencyRecord{Fingerprint: fingerprint}
+	f.leases[id] = time.Now().Add(lease)
+	f.tokens[id] = fmt.Sprintf("lease-%d", len(f.tokens)+1)
+	return f.tokens[id], nil, nil
+}
+
+func (f *fakeIdempotencyStore) CompleteRequest(ctx context.Context, userID int, key, token string, statusCode int, header http.Header, body []byte) error {
+	id := f.id(userID, key)
+	record, ok := f.records[id]
+	if !ok || record.StatusCode != 0 || f.tokens[id] != token {
+		return errors.New("lease lost")
+	}
+	record.StatusCode = statusCode
+	record.Header = header
+	record.ResponseBody = body
+	return nil
+}
+
+func (f *fakeIdempotencyStore) ReleaseRequest(ctx context.Context, userID int, key, token string) error {
+	id := f.id(userID, key)
+	if record, ok := f.records[id]; !ok || record.StatusCode != 0 || f.tokens[id] != token {
+		return errors.New("lease lost")
+	}
+	delete(f.records, id)
+	return nil
+}
+
+func (f *fakeIdempotencyStore) id(userID int, key string) string {
+	return fmt.Sprintf("%d/%s", userID, key)
+}
+
+func TestIdempotent(t *testing.T) {
+	store := newFakeIdempotencyStore()
+	calls := 0
+	status := http.StatusCreated
+	handler := Idempotent(store, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/addresses/1")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"address_id":1}`))
+	})
+
+	send := func(method string, userID int, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/addresses", bytes.NewBufferString(body))
+		req.Header.Set("X-Request-ID", "request-"+strconv.Itoa(calls))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), KeyUserId, userID))
+		rr := httptest.NewRecorder()
+		// as the access log does before the handler runs
+		rr.Header().Set("X-Request-ID", req.Header.Get("X-Request-ID"))
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		userID         int
+		key            string
+		body           string
+		serverStatus   int
+		wantStatus     int
+		wantCalls      int
+		wantReplayed   bool
+		wantBodySubstr string
+	}{
+		{
+			name:           "first request runs",
+			method:         http.MethodPost,
+			userID:         1,
+			key:            "key-1",
+			body:           `{"city":"New York"}`,
+			wantStatus:     http.StatusCreated,
+			wantCalls:      1,
+			wantBodySubstr: `"address_id":1`,
+		},
+		{
+			name:           "retry is replayed",
+			method:         http.MethodPost,
+			userID:         1,
+			key:            "key-1",
+			body:           `{"city":"New York"}`,
+			wantStatus:     http.StatusCreated,
+			wantCalls:      1,
+			wantReplayed:   true,
+			wantBodySubstr: `"address_id":1`,
+		},
+		{
+			name:           "same key with another body",
+			method:         http.MethodPost,
+			userID:         1,
+			key:            "key-1",
+			body:           `{"city":"Boston"}`,
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantCalls:      1,
+			wantBodySubstr: "different request",
+		},
+		{
+			name:       "same key for another user",
+			method:     http.MethodPost,
+			userID:     2,
+			key:        "key-1",
+			body:       `{"city":"Boston"}`,
+			wantStatus: http.StatusCreated,
+			wantCalls:  2,
+		},
+		{
+			name:       "without a key",
+			method:     http.MethodPost,
+			userID:     1,
+			body:       `{"city":"New York"}`,
+			wantStatus: http.StatusCreated,
+			wantCalls:  3,
+		},
+		{
+			name:       "reads ignore the key",
+			method:     http.MethodGet,
+			userID:     1,
+			key:        "key-1",
+			wantStatus: http.StatusCreated,
+			wantCalls:  4,
+		},
+		{
+			name:         "server errors are not stored",
+			method:       http.MethodDelete,
+			userID:       1,
+			key:          "key-2",
+			serverStatus: http.StatusGatewayTimeout,
+			wantStatus:   http.StatusGatewayTimeout,
+			wantCalls:    5,
+		},
+		{
+			name:       "retry after a server error runs again",
+			method:     http.MethodDelete,
+			userID:     1,
+			key:        "key-2",
+			wantStatus: http.StatusCreated,
+			wantCalls:  6,
+		},
+		{
+			name:       "key too long",
+			method:     http.MethodPost,
+			userID:     1,
+			key:        strings.Repeat("k", 256),
+			wantStatus: http.StatusBadRequest,
+			wantCalls:  6,
+		},
+		{
+			name:       "body too large",
+			method:     http.MethodPost,
+			userID:     1,
+			key:        "key-3",
+			body:       strings.Repeat("a", maxIdempotentBodySize+1),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCalls:  6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = http.StatusCreated
+			if tt.serverStatus != 0 {
+				status = tt.serverStatus
+			}
+
+			rr := send(tt.method, tt.userID, tt.key, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantReplayed, rr.Header().Get(IdempotentReplayedHeader) == "true")
+			assert.Contains(t, rr.Body.String(), tt.wantBodySubstr)
+			if tt.wantReplayed {
+				assert.Equal(t, "/addresses/1", rr.Header().Get("Location"))
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				assert.Equal(t, "request-1", rr.Header().Get("X-Request-ID"), "the request id of the retry should be kept")
+			}
+		})
+	}
+}
+
+func TestIdempotentInProgress(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/orders/1/pay", nil)
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	req = req.WithContext(context.WithValue(req.Context(), KeyUserId, 1))
+
+	store := newFakeIdempotencyStore()
+	store.records[store.id(1, "key-1")] = &entity.IdempotencyRecord{Fingerprint: requestFingerprint(req, nil)}
+	store.leases[store.id(1, "key-1")] = time.Now().Add(time.Minute)
+	rr := httptest.NewRecorder()
+
+	Idempotent(store, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not run while the first request is in progress")
+	}).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestIdempotentRetryAfterCrash(t *testing.T) {
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/orders/1/pay", nil)
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		return req.WithContext(context.WithValue(req.Context(), KeyUserId, 1))
+	}
+
+	// the server running the first request went down before storing its
+	// response, leaving the key in progress until its lease ran out
+	store := newFakeIdempotencyStore()
+	store.records[store.id(1, "key-1")] = &entity.IdempotencyRecord{Fingerprint: requestFingerprint(newRequest(), nil)}
+	store.leases[store.id(1, "key-1")] = time.Now().Add(-time.Second)
+
+	calls := 0
+	handler := Idempotent(store, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest())
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, calls, "the retry should take over the key")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest())
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, calls, "the response of the retry should be replayed")
+	assert.Equal(t, "true", rr.Header().Get(IdempotentReplayedHeader))
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+)
+
+type ImpersonationRecorder interface {
+	RecordImpersonation(ctx context.Context, audit entity.ImpersonationAudit) error
+}
+
+// AuditImpersonation must run after JwtUserId, it records every request made
+// with an impersonation token once the response status is known. Impersonation
+// is read only, writes are refused without reaching next and recorded with
+// the status they were refused with.
+func AuditImpersonation(recorder ImpersonationRecorder, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actorID, ok := r.Context().Value(KeyActorId).(int)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		if isReadOnlyMethod(r.Method) {
+			next.ServeHTTP(sw, r)
+		} else {
+			problem.Error(sw, r, http.StatusForbidden, "write operations are not allowed while impersonating")
+		}
+
+		userID, _ := r.Context().Value(KeyUserId).(int)
+		// the audit is recorded even when the client went away
+		err := recorder.RecordImpersonation(context.WithoutCancel(r.Context()), entity.ImpersonationAudit{
+			ActorUserID: actorID,
+			UserID:      userID,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			StatusCode:  sw.status,
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to record impersonated request", "error", err)
+		}
+	}
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
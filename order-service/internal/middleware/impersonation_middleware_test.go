@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+)
+
+type fakeImpersonationRecorder struct {
+	audits []entity.ImpersonationAudit
+}
+
+func (f *fakeImpersonationRecorder) RecordImpersonation(ctx context.Context, audit entity.ImpersonationAudit) error {
+	f.audits = append(f.audits, audit)
+	return nil
+}
+
+func TestAuditImpersonation(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		actorID    int
+		wantStatus int
+		wantAudit  *entity.ImpersonationAudit
+	}{
+		{
+			name:       "impersonated request",
+			method:     http.MethodGet,
+			actorID:    7,
+			wantStatus: http.StatusNotFound,
+			wantAudit: &entity.ImpersonationAudit{
+				ActorUserID: 7,
+				UserID:      1,
+				Method:      http.MethodGet,
+				Path:        "/addresses",
+				StatusCode:  http.StatusNotFound,
+			},
+		},
+		{
+			name:       "impersonated write",
+			method:     http.MethodPost,
+			actorID:    7,
+			wantStatus: http.StatusForbidden,
+			wantAudit: &entity.ImpersonationAudit{
+				ActorUserID: 7,
+				UserID:      1,
+				Method:      http.MethodPost,
+				Path:        "/addresses",
+				StatusCode:  http.StatusForbidden,
+			},
+		},
+		{
+			name:       "regular request",
+			method:     http.MethodPost,
+			actorID:    0,
+			wantStatus: http.StatusNotFound,
+			wantAudit:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &fakeImpersonationRecorder{}
+
+			req := httptest.NewRequest(tt.method, "/addresses", nil)
+			ctx := context.WithValue(req.Context(), KeyUserId, 1)
+			if tt.actorID != 0 {
+				ctx = context.WithValue(ctx, KeyActorId, tt.actorID)
+			}
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			handler := AuditImpersonation(recorder, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			})
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantAudit == nil {
+				assert.Empty(t, recorder.audits)
+			} else {
+				assert.Equal(t, []entity.ImpersonationAudit{*tt.wantAudit}, recorder.audits)
+			}
+		})
+	}
+}
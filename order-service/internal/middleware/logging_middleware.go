@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+)
+
+// RequestID must wrap every other handler, it assigns the request its id,
+// the one in the X-Request-ID header when valid, echoes it back and puts a
+// logger carrying it in the request context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := problem.RequestID(w, r)
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		ctx = logging.WithLogger(ctx, slog.Default().With("request_id", requestID))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AccessLog logs every request of next, registered at pattern, once
+// answered, with its status and latency. The logger of the request carries
+// the route, and the trace id when traced, from then on:
+//
+//	mux.HandleFunc("GET /orders", middleware.AccessLog("GET /orders", orders.ListOrders))
+func AccessLog(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		logging.AddAttrs(r.Context(), "route", pattern)
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			logging.AddAttrs(r.Context(), "trace_id", span.TraceID().String())
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logging.FromContext(r.Context()).Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", sw.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
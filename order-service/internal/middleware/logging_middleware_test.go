@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+	"github.com/mathesukkj/goecommerce/order-service/internal/problem"
+)
+
+// captureLogs makes the default logger write JSON records to the returned
+// buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, logging.FormatJSON, slog.LevelInfo)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		wantSame  bool
+	}{
+		{"sent by the client", "request-1", true},
+		{"missing", "", false},
+		{"invalid", "request 1\r\nX-Admin: true", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inContext string
+			h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inContext = logging.RequestID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if tt.requestID != "" {
+				req.Header.Set(problem.RequestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			got := rr.Header().Get(problem.RequestIDHeader)
+			if tt.wantSame {
+				assert.Equal(t, tt.requestID, got)
+			} else {
+				assert.Regexp(t, `^[0-9a-f]{32}$`, got, "a generated id")
+			}
+			assert.Equal(t, got, inContext)
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+
+	h := RequestID(AccessLog("GET /orders/{order_id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.AddAttrs(r.Context(), "user_id", 1)
+		problem.Internal(w, r, assert.AnError)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	req.Header.Set(problem.RequestIDHeader, "request-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var records []map[string]any
+	decoder := json.NewDecoder(logs)
+	for decoder.More() {
+		var record map[string]any
+		assert.NoError(t, decoder.Decode(&record))
+		records = append(records, record)
+	}
+	if !assert.Len(t, records, 2) {
+		return
+	}
+
+	failure, access := records[0], records[1]
+	assert.Equal(t, "request failed", failure["msg"])
+	assert.Equal(t, assert.AnError.Error(), failure["error"])
+	assert.Equal(t, "request-1", failure["request_id"])
+	assert.Equal(t, float64(1), failure["user_id"])
+
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "ERROR", access["level"])
+	assert.Equal(t, "request-1", access["request_id"])
+	assert.Equal(t, "GET /orders/{order_id}", access["route"])
+	assert.Equal(t, float64(1), access["user_id"])
+	assert.Equal(t, "GET", access["method"])
+	assert.Equal(t, "/orders/1", access["path"])
+	assert.Equal(t, float64(http.StatusInternalServerError), access["status"])
+	assert.Contains(t, access, "duration_ms")
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+)
+
+// Measure counts and times the requests of next, registered at pattern, by
+// the status they are answered with:
+//
+//	mux.HandleFunc("GET /orders", middleware.Measure("GET /orders", orders.ListOrders))
+func Measure(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		status := strconv.Itoa(sw.status)
+		metrics.HTTPRequests.WithLabelValues(pattern, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(pattern, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	clientmodel "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+)
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus string
+	}{
+		{
+			name:       "implicit ok",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) },
+			wantStatus: "200",
+		},
+		{
+			name:       "error status",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) },
+			wantStatus: "404",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := "GET /things/{thing_id} " + tt.name
+			requests := metrics.HTTPRequests.WithLabelValues(pattern, tt.wantStatus)
+			before := testutil.ToFloat64(requests)
+
+			rr := httptest.NewRecorder()
+			Measure(pattern, tt.handler)(rr, httptest.NewRequest(http.MethodGet, "/things/1", nil))
+
+			assert.Equal(t, before+1, testutil.ToFloat64(requests))
+
+			var timed clientmodel.Metric
+			metrics.HTTPRequestDuration.WithLabelValues(pattern, tt.wantStatus).(prometheus.Histogram).Write(&timed)
+			assert.Equal(t, uint64(1), timed.GetHistogram().GetSampleCount(), "the request should be timed under its route")
+		})
+	}
+}
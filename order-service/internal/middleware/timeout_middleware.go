@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeouts holds how long the request of each route may run, keyed by the
+// pattern it is registered with. Routes missing from Routes use Default.
+type Timeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// Wrap bounds next, registered at pattern, with the timeout of its route:
+//
+//	mux.HandleFunc("GET /orders", timeouts.Wrap("GET /orders", orders.ListOrders))
+func (t Timeouts) Wrap(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	timeout, ok := t.Routes[pattern]
+	if !ok {
+		timeout = t.Default
+	}
+
+	return Timeout(timeout, next)
+}
+
+// Timeout cancels the context of the request once timeout passed, aborting
+// the queries still running by then. A zero timeout leaves the request
+// unbounded.
+func Timeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeouts(t *testing.T) {
+	timeouts := Timeouts{
+		Default: time.Second,
+		Routes:  map[string]time.Duration{"GET /orders": time.Minute, "POST /webhooks": 0},
+	}
+
+	tests := []struct {
+		name         string
+		pattern      string
+		wantDeadline time.Duration
+	}{
+		{name: "route timeout", pattern: "GET /orders", wantDeadline: time.Minute},
+		{name: "default timeout", pattern: "GET /addresses", wantDeadline: time.Second},
+		{name: "unbounded route", pattern: "POST /webhooks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deadline time.Time
+			var ok bool
+			handler := timeouts.Wrap(tt.pattern, func(w http.ResponseWriter, r *http.Request) {
+				deadline, ok = r.Context().Deadline()
+			})
+
+			start := time.Now()
+			handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if tt.wantDeadline == 0 {
+				assert.False(t, ok, "the request should have no deadline")
+				return
+			}
+			assert.True(t, ok, "the request should have a deadline")
+			assert.WithinDuration(t, start.Add(tt.wantDeadline), deadline, 100*time.Millisecond)
+		})
+	}
+}
+
+func TestTimeoutCancelsRequest(t *testing.T) {
+	var err error
+	handler := Timeout(10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		err = r.Context().Err()
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
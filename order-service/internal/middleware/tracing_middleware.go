@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Trace runs next, registered at pattern, in a span named after the pattern,
+// continuing the trace of the W3C traceparent header of the request if any:
+//
+//	mux.HandleFunc("GET /orders", middleware.Trace("GET /orders", orders.ListOrders))
+func Trace(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	// the route is the path of the pattern, without its method
+	route := pattern
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		route = path
+	}
+
+	return otelhttp.NewHandler(otelhttp.WithRouteTag(route, next), pattern).ServeHTTP
+}
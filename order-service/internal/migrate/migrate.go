@@ -0,0 +1,444 @@
+// Package migrate applies the numbered up and down sql migrations of a file
+// system, recording each applied version and its checksum in the
+// schema_migrations table.
+//
+// Every run on postgres holds an advisory lock, so instances starting at the
+// same time apply the pending migrations once, SQLite already lets a single
+// writer in at a time. Each migration runs in its own transaction.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+)
+
+// lockID identifies the advisory lock held while migrating, it is shared by
+// every instance of the service.
+const lockID int64 = 4_207_310_518
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	ErrUnknownVersion   = errors.New("applied migration is missing from the migration files")
+	ErrInvalidSteps     = errors.New("steps must be a positive integer")
+	ErrPending          = errors.New("migration is not applied")
+	ErrUnversioned      = errors.New("database has tables but no applied migration")
+	ErrVersioned        = errors.New("database already has applied migrations")
+	ErrNoMigrations     = errors.New("no migration files")
+	ErrBaselineMismatch = errors.New("database tables differ from the first migration")
+)
+
+var (
+	fileName     = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	createdTable = regexp.MustCompile(`(?i)\bCREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status is a migration file and whether it was applied.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the file changed since it was applied.
+	Modified bool
+}
+
+type appliedMigration struct {
+	Version   int       `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+func New(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads the migrations at the root of fsys, ordered by version. Every
+// version needs both its up and down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies every pending migration in order and returns them. Nothing is
+// applied when an already applied migration was modified or removed, or when
+// none was applied yet to a database that already has tables, which Baseline
+// adopts.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn, applied map[int]appliedMigration) error {
+		if len(applied) == 0 {
+			tables, err := m.tables(ctx, conn)
+			if err != nil {
+				return err
+			}
+			if len(tables) > 0 {
+				return fmt.Errorf("%w: found %s, see migrate baseline", ErrUnversioned, strings.Join(tables, ", "))
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if err := m.run(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Baseline records the first migration as applied without running it, for a
+// database whose schema was created by other means, such as from the former
+// init.sql the first migration holds. Up then applies the others. The
+// database must have no applied migration and exactly the tables the first
+// migration creates.
+func (m *Migrator) Baseline(ctx context.Context) (Migration, error) {
+	if len(m.migrations) == 0 {
+		return Migration{}, ErrNoMigrations
+	}
+	first := m.migrations[0]
+
+	err := m.withLock(ctx, func(conn *sqlx.Conn, applied map[int]appliedMigration) error {
+		if len(applied) > 0 {
+			return ErrVersioned
+		}
+
+		tables, err := m.tables(ctx, conn)
+		if err != nil {
+			return err
+		}
+		want := createdTables(first.Up)
+		if strings.Join(tables, ", ") != strings.Join(want, ", ") {
+			return fmt.Errorf("%w: found %s, %d_%s creates %s",
+				ErrBaselineMismatch, strings.Join(tables, ", "), first.Version, first.Name, strings.Join(want, ", "))
+		}
+
+		_, err = conn.ExecContext(ctx,
+			m.db.Rebind("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)"),
+			first.Version, first.Name, first.Checksum,
+		)
+		return err
+	})
+	if err != nil {
+		return Migration{}, err
+	}
+
+	return first, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, ErrInvalidSteps
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn, applied map[int]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if err := m.run(ctx, conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Status lists every migration file with whether it was applied. It only
+// reads the database, every migration is pending while schema_migrations
+// doesn't exist yet.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	versioned, err := m.versioned(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]appliedMigration{}
+	if versioned {
+		if applied, err = selectApplied(ctx, m.db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if a, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.AppliedAt
+			status.Modified = a.Checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Current reports whether the database is at the version of the files, with
+// every migration applied as it is written and none applied that the files
+// don't know. It never creates schema_migrations.
+func (m *Migrator) Current(ctx context.Context) error {
+	applied, err := selectApplied(ctx, m.db)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range applied {
+		migration, ok := m.find(a.Version)
+		if !ok {
+			return fmt.Errorf("%w: %d_%s", ErrUnknownVersion, a.Version, a.Name)
+		}
+		if migration.Checksum != a.Checksum {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, a.Version, a.Name)
+		}
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			return fmt.Errorf("%w: %d_%s", ErrPending, migration.Version, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+const createTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)
+`
+
+// withLock runs fn holding the migration lock, once the applied migrations
+// are checked against the files.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn, applied map[int]appliedMigration) error) error {
+	// advisory locks belong to a session, so everything runs on one connection
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if database.DialectOf(m.db) == database.Postgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return err
+		}
+		// the lock outlives the connection going back to the pool, it is
+		// released even once ctx is cancelled
+		defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockID)
+	}
+
+	if _, err := conn.ExecContext(ctx, createTableQuery); err != nil {
+		return err
+	}
+
+	applied, err := selectApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range applied {
+		migration, ok := m.find(a.Version)
+		if !ok {
+			return fmt.Errorf("%w: %d_%s", ErrUnknownVersion, a.Version, a.Name)
+		}
+		if migration.Checksum != a.Checksum {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, a.Version, a.Name)
+		}
+	}
+
+	return fn(conn, applied)
+}
+
+// versioned reports whether the database has the schema_migrations table.
+func (m *Migrator) versioned(ctx context.Context) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name = 'schema_migrations'
+		)
+	`
+	if database.DialectOf(m.db) == database.SQLite {
+		query = `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`
+	}
+
+	var exists bool
+	if err := m.db.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// tables lists the tables of the database other than schema_migrations, by
+// name.
+func (m *Migrator) tables(ctx context.Context, conn *sqlx.Conn) ([]string, error) {
+	query := `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'
+		ORDER BY table_name
+	`
+	if database.DialectOf(m.db) == database.SQLite {
+		query = `
+			SELECT name FROM sqlite_master
+			WHERE type = 'table' AND name <> 'schema_migrations' AND name NOT LIKE 'sqlite_%'
+			ORDER BY name
+		`
+	}
+
+	var tables []string
+	if err := conn.SelectContext(ctx, &tables, query); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// createdTables lists the tables a migration creates, by name.
+func createdTables(query string) []string {
+	var tables []string
+	for _, match := range createdTable.FindAllStringSubmatch(query, -1) {
+		tables = append(tables, strings.ToLower(match[1]))
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// run executes one direction of migration and records it in the same
+// transaction.
+func (m *Migrator) run(ctx context.Context, conn *sqlx.Conn, migration Migration, query string, up bool) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx,
+			m.db.Rebind("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)"),
+			migration.Version, migration.Name, migration.Checksum,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx, m.db.Rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+func selectApplied(ctx context.Context, q sqlx.QueryerContext) (map[int]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := sqlx.SelectContext(ctx, q, &rows, "SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version"); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
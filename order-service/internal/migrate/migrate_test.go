@@ -0,0 +1,385 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/migrations"
+)
+
+var testFS = fstest.MapFS{
+	"0002_add_orders.up.sql":   {Data: []byte("CREATE TABLE orders (order_id SERIAL PRIMARY KEY);")},
+	"0002_add_orders.down.sql": {Data: []byte("DROP TABLE orders;")},
+	"0001_add_users.up.sql":    {Data: []byte("CREATE TABLE users (user_id SERIAL PRIMARY KEY);")},
+	"0001_add_users.down.sql":  {Data: []byte("DROP TABLE users;")},
+	"README.md":                {Data: []byte("not a migration")},
+}
+
+var appliedColumns = []string{"version", "name", "checksum", "applied_at"}
+
+func setupMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	migrator, err := New(sqlx.NewDb(db, "postgres"), testFS)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	return migrator, mock
+}
+
+// expectLocked expects the statements run before and after a migration
+// holding the lock, applied being the rows of schema_migrations.
+func expectLocked(mock sqlmock.Sqlmock, applied *sqlmock.Rows) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(createTableQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")).
+		WillReturnRows(applied)
+}
+
+// expectTables expects the lookup of the tables of a database with no
+// applied migration.
+func expectTables(mock sqlmock.Sqlmock, tables ...string) {
+	rows := sqlmock.NewRows([]string{"table_name"})
+	for _, table := range tables {
+		rows.AddRow(table)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM information_schema.tables")).WillReturnRows(rows)
+}
+
+func expectUnlocked(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestLoad(t *testing.T) {
+	got, err := Load(testFS)
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, 1, got[0].Version)
+	assert.Equal(t, "add_users", got[0].Name)
+	assert.Equal(t, "DROP TABLE users;", got[0].Down)
+	assert.Len(t, got[0].Checksum, 64)
+	assert.Equal(t, 2, got[1].Version)
+
+	_, err = Load(fstest.MapFS{"0001_add_users.up.sql": {Data: []byte("CREATE TABLE users ();")}})
+	assert.Error(t, err, "a migration without its down file")
+
+	_, err = Load(fstest.MapFS{
+		"0001_add_users.up.sql":    {Data: []byte("CREATE TABLE users ();")},
+		"0001_add_people.down.sql": {Data: []byte("DROP TABLE users;")},
+	})
+	assert.Error(t, err, "a migration with two names")
+}
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	got, err := Load(migrations.FS)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, got)
+	for i, m := range got {
+		assert.Equal(t, i+1, m.Version, "migration versions should have no gaps")
+	}
+}
+
+func TestUp(t *testing.T) {
+	migrator, mock := setupMigrator(t)
+	users := migrator.migrations[0]
+	orders := migrator.migrations[1]
+
+	expectLocked(mock, sqlmock.NewRows(appliedColumns).AddRow(1, users.Name, users.Checksum, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(orders.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)")).
+		WithArgs(2, orders.Name, orders.Checksum).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlocked(mock)
+
+	applied, err := migrator.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, 2, applied[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpFailedMigration(t *testing.T) {
+	migrator, mock := setupMigrator(t)
+	users := migrator.migrations[0]
+
+	expectLocked(mock, sqlmock.NewRows(appliedColumns))
+	expectTables(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(users.Up)).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectUnlocked(mock)
+
+	applied, err := migrator.Up(context.Background())
+	assert.ErrorContains(t, err, "migration 1_add_users: syntax error")
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpRefusesChangedHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		applied     *sqlmock.Rows
+		expectedErr error
+	}{
+		{
+			name:        "modified migration",
+			applied:     sqlmock.NewRows(appliedColumns).AddRow(1, "add_users", "0000", time.Now()),
+			expectedErr: ErrChecksumMismatch,
+		},
+		{
+			name:        "removed migration",
+			applied:     sqlmock.NewRows(appliedColumns).AddRow(3, "add_payments", "0000", time.Now()),
+			expectedErr: ErrUnknownVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, mock := setupMigrator(t)
+
+			expectLocked(mock, tt.applied)
+			expectUnlocked(mock)
+
+			applied, err := migrator.Up(context.Background())
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Empty(t, applied)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpRefusesUnversionedDatabase(t *testing.T) {
+	migrator, mock := setupMigrator(t)
+
+	expectLocked(mock, sqlmock.NewRows(appliedColumns))
+	expectTables(mock, "payment_methods", "users")
+	expectUnlocked(mock)
+
+	applied, err := migrator.Up(context.Background())
+	assert.ErrorIs(t, err, ErrUnversioned)
+	assert.ErrorContains(t, err, "payment_methods, users")
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func openSQLite(t *testing.T) (*sqlx.DB, *Migrator) {
+	t.Helper()
+
+	db, err := database.Open("sqlite:" + filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := New(db, migrations.SQLite)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	return db, migrator
+}
+
+func TestUpSQLite(t *testing.T) {
+	_, migrator := openSQLite(t)
+
+	applied, err := migrator.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrator.migrations))
+	assert.NoError(t, migrator.Current(context.Background()))
+
+	reverted, err := migrator.Down(context.Background(), len(migrator.migrations))
+	assert.NoError(t, err)
+	assert.Len(t, reverted, len(migrator.migrations))
+}
+
+func TestBaselineSQLite(t *testing.T) {
+	db, migrator := openSQLite(t)
+	first := migrator.migrations[0]
+
+	// a database created from init.sql, with no migration recorded
+	if _, err := db.Exec(first.Up); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO payment_methods (payment_type, card_number) VALUES ('credit_card', '4111111111111111')"); err != nil {
+		t.Fatalf("failed to insert payment method: %v", err)
+	}
+
+	_, err := migrator.Up(context.Background())
+	assert.ErrorIs(t, err, ErrUnversioned)
+
+	baselined, err := migrator.Baseline(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, first.Version, baselined.Version)
+
+	_, err = migrator.Baseline(context.Background())
+	assert.ErrorIs(t, err, ErrVersioned)
+
+	// the card number is still there, up stops before dropping it
+	applied, err := migrator.Up(context.Background())
+	assert.ErrorContains(t, err, "tokenize_cards_first")
+	if assert.NotEmpty(t, applied) {
+		assert.Equal(t, "search_indexes", applied[len(applied)-1].Name)
+	}
+	stopped := len(applied)
+
+	// what tokenize-cards does
+	if _, err := db.Exec("UPDATE payment_methods SET card_token = 'tok_1', card_last4 = '1111', card_number = NULL"); err != nil {
+		t.Fatalf("failed to tokenize card: %v", err)
+	}
+	applied, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, applied, len(migrator.migrations)-1-stopped) {
+		assert.Equal(t, "drop_card_number", applied[0].Name)
+	}
+	assert.NoError(t, migrator.Current(context.Background()))
+
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM payment_methods"))
+	assert.Equal(t, 1, count)
+}
+
+func TestBaselineRefusesOtherSchema(t *testing.T) {
+	db, migrator := openSQLite(t)
+
+	if _, err := db.Exec("CREATE TABLE payment_methods (payment_method_id INTEGER PRIMARY KEY, card_number VARCHAR(16))"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	_, err := migrator.Baseline(context.Background())
+	assert.ErrorIs(t, err, ErrBaselineMismatch)
+
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, statuses[0].Applied)
+}
+
+func TestDown(t *testing.T) {
+	migrator, mock := setupMigrator(t)
+	users := migrator.migrations[0]
+	orders := migrator.migrations[1]
+
+	expectLocked(mock, sqlmock.NewRows(appliedColumns).
+		AddRow(1, users.Name, users.Checksum, time.Now()).
+		AddRow(2, orders.Name, orders.Checksum, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(orders.Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlocked(mock)
+
+	reverted, err := migrator.Down(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, 2, reverted[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = migrator.Down(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrInvalidSteps)
+}
+
+func TestStatus(t *testing.T) {
+	migrator, mock := setupMigrator(t)
+	appliedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS")).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")).
+		WillReturnRows(sqlmock.NewRows(appliedColumns).AddRow(1, "add_users", "0000", appliedAt))
+
+	got, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Status{
+		{Version: 1, Name: "add_users", Applied: true, AppliedAt: appliedAt, Modified: true},
+		{Version: 2, Name: "add_orders"},
+	}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatusUnversionedSQLite(t *testing.T) {
+	db, migrator := openSQLite(t)
+
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.False(t, s.Applied)
+	}
+
+	// status only reads the database
+	var tables int
+	assert.NoError(t, db.Get(&tables, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'"))
+	assert.Equal(t, 0, tables)
+}
+
+func TestCurrent(t *testing.T) {
+	migrations, err := Load(testFS)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	appliedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		applied *sqlmock.Rows
+		wantErr error
+	}{
+		{
+			name: "up to date",
+			applied: sqlmock.NewRows(appliedColumns).
+				AddRow(1, "add_users", migrations[0].Checksum, appliedAt).
+				AddRow(2, "add_orders", migrations[1].Checksum, appliedAt),
+		},
+		{
+			name:    "pending",
+			applied: sqlmock.NewRows(appliedColumns).AddRow(1, "add_users", migrations[0].Checksum, appliedAt),
+			wantErr: ErrPending,
+		},
+		{
+			name: "modified",
+			applied: sqlmock.NewRows(appliedColumns).
+				AddRow(1, "add_users", "0000", appliedAt).
+				AddRow(2, "add_orders", migrations[1].Checksum, appliedAt),
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name: "unknown",
+			applied: sqlmock.NewRows(appliedColumns).
+				AddRow(1, "add_users", migrations[0].Checksum, appliedAt).
+				AddRow(2, "add_orders", migrations[1].Checksum, appliedAt).
+				AddRow(3, "add_payments", "0000", appliedAt),
+			wantErr: ErrUnknownVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, mock := setupMigrator(t)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")).
+				WillReturnRows(tt.applied)
+
+			err := migrator.Current(context.Background())
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package payment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/card"
+)
+
+// Magic card numbers making the fake gateway fail, every other valid card is
+// approved.
+const (
+	FakeCardDeclined          = "4000000000000002"
+	FakeCardInsufficientFunds = "4000000000009995"
+	FakeCardTimeout           = "4000000000000119"
+)
+
+type fakeTransaction struct {
+	authorized int
+	captured   int
+	refunded   int
+	voided     bool
+}
+
+type fakeResponse struct {
+	request string
+	ref     string
+	err     error
+}
+
+// FakeGateway is an in memory PaymentGateway for local runs and tests. Its
+// references are derived from the idempotency keys, so the same calls always
+// give the same results.
+type FakeGateway struct {
+	mu           sync.Mutex
+	now          func() time.Time
+	transactions map[string]*fakeTransaction
+	responses    map[string]fakeResponse
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		now:          time.Now,
+		transactions: map[string]*fakeTransaction{},
+		responses:    map[string]fakeResponse{},
+	}
+}
+
+func (g *FakeGateway) Authorize(ctx context.Context, idempotencyKey string, c Card, amount int) (string, error) {
+	request := fmt.Sprintf("authorize:%s:%d", c.Number, amount)
+	return g.once(idempotencyKey, request, func() (string, error) {
+		switch c.Number {
+		case FakeCardDeclined:
+			return "", ErrCardDeclined
+		case FakeCardInsufficientFunds:
+			return "", ErrInsufficientFunds
+		case FakeCardTimeout:
+			return "", ErrGatewayTimeout
+		}
+
+		if !card.Valid(c.Number) {
+			return "", ErrCardDeclined
+		}
+		if card.Expired(c.ExpirationDate, g.now()) {
+			return "", ErrExpiredCard
+		}
+		if amount <= 0 {
+			return "", ErrInvalidAmount
+		}
+
+		ref := reference("auth", idempotencyKey)
+		g.transactions[ref] = &fakeTransaction{authorized: amount}
+		return ref, nil
+	})
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, idempotencyKey, authorizationRef string, amount int) (string, error) {
+	request := fmt.Sprintf("capture:%s:%d", authorizationRef, amount)
+	return g.once(idempotencyKey, request, func() (string, error) {
+		tx, ok := g.transactions[authorizationRef]
+		if !ok {
+			return "", ErrTransactionNotFound
+		}
+		if tx.voided || tx.captured > 0 {
+			return "", ErrInvalidTransition
+		}
+		if amount <= 0 || amount > tx.authorized {
+			return "", ErrInvalidAmount
+		}
+
+		tx.captured = amount
+		ref := reference("cap", idempotencyKey)
+		g.transactions[ref] = tx
+		return ref, nil
+	})
+}
+
+func (g *FakeGateway) Void(ctx context.Context, idempotencyKey, authorizationRef string) error {
+	request := "void:" + authorizationRef
+	_, err := g.once(idempotencyKey, request, func() (string, error) {
+		tx, ok := g.transactions[authorizationRef]
+		if !ok {
+			return "", ErrTransactionNotFound
+		}
+		if tx.captured > 0 {
+			return "", ErrInvalidTransition
+		}
+
+		tx.voided = true
+		return "", nil
+	})
+	return err
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, idempotencyKey, captureRef string, amount int) (string, error) {
+	request := fmt.Sprintf("refund:%s:%d", captureRef, amount)
+	return g.once(idempotencyKey, request, func() (string, error) {
+		tx, ok := g.transactions[captureRef]
+		if !ok || tx.captured == 0 {
+			return "", ErrTransactionNotFound
+		}
+		if amount <= 0 || tx.refunded+amount > tx.captured {
+			return "", ErrInvalidAmount
+		}
+
+		tx.refunded += amount
+		return reference("ref", idempotencyKey), nil
+	})
+}
+
+func (g *FakeGateway) Provider() string {
+	return ProviderFake
+}
+
+func (g *FakeGateway) Currency() string {
+	return "USD"
+}
+
+// Ping always succeeds, the fake gateway runs in process.
+func (g *FakeGateway) Ping(ctx context.Context) error {
+	return nil
+}
+
+// once replays the response of an idempotency key already seen, timeouts are
+// not remembered so retries get through.
+func (g *FakeGateway) once(idempotencyKey, request string, call func() (string, error)) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if response, ok := g.responses[idempotencyKey]; ok {
+		if response.request != request {
+			return "", ErrIdempotencyKeyReuse
+		}
+		return response.ref, response.err
+	}
+
+	ref, err := call()
+	if err != ErrGatewayTimeout {
+		g.responses[idempotencyKey] = fakeResponse{request: request, ref: ref, err: err}
+	}
+	return ref, err
+}
+
+func reference(prefix, idempotencyKey string) string {
+	sum := sha256.Sum256([]byte(idempotencyKey))
+	return prefix + "_" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,120 @@
+package payment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/card"
+)
+
+var validExpiry = time.Date(2040, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+func TestFakeCardsAreValid(t *testing.T) {
+	for _, number := range []string{FakeCardDeclined, FakeCardInsufficientFunds, FakeCardTimeout} {
+		assert.True(t, card.Valid(number), "%s should pass payload validation", number)
+	}
+}
+
+func TestFakeGatewayAuthorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		card    Card
+		wantErr error
+	}{
+		{
+			name:    "approved",
+			card:    Card{Number: "4242424242424242", ExpirationDate: validExpiry},
+			wantErr: nil,
+		},
+		{
+			name:    "declined",
+			card:    Card{Number: FakeCardDeclined, ExpirationDate: validExpiry},
+			wantErr: ErrCardDeclined,
+		},
+		{
+			name:    "insufficient funds",
+			card:    Card{Number: FakeCardInsufficientFunds, ExpirationDate: validExpiry},
+			wantErr: ErrInsufficientFunds,
+		},
+		{
+			name:    "timeout",
+			card:    Card{Number: FakeCardTimeout, ExpirationDate: validExpiry},
+			wantErr: ErrGatewayTimeout,
+		},
+		{
+			name:    "expired card",
+			card:    Card{Number: "4242424242424242", ExpirationDate: time.Date(2020, time.January, 31, 0, 0, 0, 0, time.UTC)},
+			wantErr: ErrExpiredCard,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := NewFakeGateway()
+
+			ref, err := gateway.Authorize(context.Background(), "key-"+tt.name, tt.card, 1000)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, ref)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, ref)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayIdempotency(t *testing.T) {
+	gateway := NewFakeGateway()
+	c := Card{Number: "4242424242424242", ExpirationDate: validExpiry}
+
+	first, err := gateway.Authorize(context.Background(), "key-1", c, 1000)
+	assert.NoError(t, err)
+
+	retried, err := gateway.Authorize(context.Background(), "key-1", c, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, first, retried, "retries should replay the first response")
+
+	_, err = gateway.Authorize(context.Background(), "key-1", c, 2000)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReuse)
+
+	other, err := NewFakeGateway().Authorize(context.Background(), "key-1", c, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, first, other, "references should be deterministic")
+}
+
+func TestFakeGatewayCaptureVoidRefund(t *testing.T) {
+	gateway := NewFakeGateway()
+	c := Card{Number: "4242424242424242", ExpirationDate: validExpiry}
+
+	authorization, err := gateway.Authorize(context.Background(), "auth", c, 1000)
+	assert.NoError(t, err)
+
+	_, err = gateway.Capture(context.Background(), "capture-too-much", authorization, 1500)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	capture, err := gateway.Capture(context.Background(), "capture", authorization, 1000)
+	assert.NoError(t, err)
+
+	err = gateway.Void(context.Background(), "void", authorization)
+	assert.ErrorIs(t, err, ErrInvalidTransition, "captured authorizations cannot be voided")
+
+	_, err = gateway.Refund(context.Background(), "refund-1", capture, 600)
+	assert.NoError(t, err)
+
+	_, err = gateway.Refund(context.Background(), "refund-2", capture, 600)
+	assert.ErrorIs(t, err, ErrInvalidAmount, "refunds cannot exceed the captured amount")
+
+	_, err = gateway.Refund(context.Background(), "refund-3", capture, 400)
+	assert.NoError(t, err)
+
+	voidable, err := gateway.Authorize(context.Background(), "auth-2", c, 500)
+	assert.NoError(t, err)
+	assert.NoError(t, gateway.Void(context.Background(), "void-2", voidable))
+
+	_, err = gateway.Capture(context.Background(), "capture-2", voidable, 500)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+}
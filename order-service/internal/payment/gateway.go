@@ -0,0 +1,111 @@
+// Package payment abstracts the payment provider charging the cards kept in
+// the vault.
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/tracing"
+)
+
+var (
+	ErrCardDeclined        = errors.New("card declined")
+	ErrInsufficientFunds   = errors.New("insufficient funds")
+	ErrExpiredCard         = errors.New("card expired")
+	ErrGatewayTimeout      = errors.New("payment gateway timed out")
+	ErrTransactionNotFound = errors.New("payment transaction not found")
+	ErrInvalidAmount       = errors.New("amount exceeds what the transaction allows")
+	ErrInvalidTransition   = errors.New("transaction can no longer be changed")
+	ErrIdempotencyKeyReuse = errors.New("idempotency key reused for a different request")
+)
+
+// Providers.
+const (
+	// ProviderFake is FakeGateway, which charges nothing and is only meant for
+	// local runs.
+	ProviderFake = "fake"
+)
+
+var Providers = []string{ProviderFake}
+
+// New returns the gateway of provider, one of Providers.
+func New(provider string) (PaymentGateway, error) {
+	switch provider {
+	case ProviderFake:
+		return NewFakeGateway(), nil
+	}
+	return nil, fmt.Errorf("unknown payment provider %q", provider)
+}
+
+// Card is what the gateway needs to charge a payment method, the number comes
+// straight out of the vault and must never be logged or stored.
+type Card struct {
+	Number         string
+	ExpirationDate time.Time
+	HolderName     string
+}
+
+// PaymentGateway moves money with a payment provider. Every call carries an
+// idempotency key, retrying a call with the same key never charges twice and
+// returns the outcome of the first call.
+//
+// Declines are reported with ErrCardDeclined, ErrInsufficientFunds or
+// ErrExpiredCard. ErrGatewayTimeout means the outcome is unknown, the call
+// must be retried with the same key. Gateways calling their provider over
+// HTTP do so with NewHTTPClient, passing ctx along with the requests.
+type PaymentGateway interface {
+	// Provider is the name the webhooks of the provider are received under.
+	Provider() string
+	// Currency is the ISO 4217 code of the amounts the gateway moves.
+	Currency() string
+	// Authorize holds amount on card, returning the authorization reference.
+	Authorize(ctx context.Context, idempotencyKey string, card Card, amount int) (string, error)
+	// Capture settles up to the authorized amount, returning the capture
+	// reference.
+	Capture(ctx context.Context, idempotencyKey, authorizationRef string, amount int) (string, error)
+	// Void releases an authorization that was not captured.
+	Void(ctx context.Context, idempotencyKey, authorizationRef string) error
+	// Refund returns up to the captured amount, returning the refund
+	// reference.
+	Refund(ctx context.Context, idempotencyKey, captureRef string, amount int) (string, error)
+}
+
+// NewHTTPClient is the client gateways call their provider with, it sends the
+// trace context and the X-Request-ID of the context of each request along.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: tracing.Transport(nil), Timeout: timeout}
+}
+
+// Pinger is implemented by the gateways able to tell whether their provider
+// is reachable, readiness checks them.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DeclineCode is the failure code recorded for a declined payment, empty when
+// err is not a decline.
+func DeclineCode(err error) string {
+	switch {
+	case errors.Is(err, ErrCardDeclined):
+		return "card_declined"
+	case errors.Is(err, ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.Is(err, ErrExpiredCard):
+		return "expired_card"
+	}
+	return ""
+}
+
+// IsDeclineCode reports whether code is one DeclineCode returns, rather than
+// the code of a failure the card isn't the cause of.
+func IsDeclineCode(code string) bool {
+	switch code {
+	case "card_declined", "insufficient_funds", "expired_card":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+// Package problem writes RFC 7807 application/problem+json error responses.
+package problem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+)
+
+const (
+	ContentType     = "application/problem+json"
+	RequestIDHeader = "X-Request-ID"
+)
+
+// validRequestID is what a request id sent by the client must look like to
+// be trusted, it ends up in logs and response headers.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a field of the request payload that failed validation, as
+// listed in the errors of a problem.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// New returns a problem with no more semantics than its http status.
+func New(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.RequestID = RequestID(w, r)
+	p.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error is the problem+json counterpart of http.Error.
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}
+
+// Internal logs err under the request id and answers with a generic 500,
+// so driver and sql errors never reach the client.
+//
+// Errors of requests that timed out or were cancelled are answered with a
+// 503 instead, whatever the driver made of the aborted query.
+func Internal(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		Error(w, r, http.StatusServiceUnavailable, "the request took too long, try again later")
+		return
+	}
+	if r.Context().Err() != nil {
+		Error(w, r, http.StatusServiceUnavailable, "the request was cancelled")
+		return
+	}
+
+	requestID := RequestID(w, r)
+	logging.FromContext(r.Context()).Error("request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+
+	Write(w, r, New(
+		http.StatusInternalServerError,
+		"an unexpected error occurred, reference "+requestID+" when contacting support",
+	))
+}
+
+// RequestID returns the id sent by the client, or generates one when it
+// sent none or one that doesn't look like an id, and echoes it back in the
+// response headers.
+func RequestID(w http.ResponseWriter, r *http.Request) string {
+	if requestID := w.Header().Get(RequestIDHeader); requestID != "" {
+		return requestID
+	}
+
+	requestID := r.Header.Get(RequestIDHeader)
+	if !validRequestID.MatchString(requestID) {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		requestID = hex.EncodeToString(buf)
+	}
+
+	w.Header().Set(RequestIDHeader, requestID)
+	return requestID
+}
@@ -0,0 +1,102 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/addresses/abc", nil)
+	req.Header.Set(RequestIDHeader, "request-1")
+	rr := httptest.NewRecorder()
+
+	Error(rr, req, http.StatusBadRequest, "invalid address id")
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, ContentType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, "request-1", rr.Header().Get(RequestIDHeader))
+
+	var got Problem
+	err := json.NewDecoder(rr.Body).Decode(&got)
+	assert.NoError(t, err)
+	assert.Equal(t, Problem{
+		Type:      "about:blank",
+		Title:     "Bad Request",
+		Status:    http.StatusBadRequest,
+		Detail:    "invalid address id",
+		Instance:  "/addresses/abc",
+		RequestID: "request-1",
+	}, got)
+}
+
+func TestInternal(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+	rr := httptest.NewRecorder()
+
+	Internal(rr, req, errors.New(`pq: relation "users" does not exist`))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "pq:")
+
+	var got Problem
+	err := json.NewDecoder(rr.Body).Decode(&got)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, got.RequestID)
+	assert.Equal(t, got.RequestID, rr.Header().Get(RequestIDHeader))
+	assert.Contains(t, got.Detail, got.RequestID)
+}
+
+func TestInternalAbortedRequest(t *testing.T) {
+	timedOut, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		err        error
+		wantDetail string
+	}{
+		{
+			name:       "timed out request",
+			ctx:        timedOut,
+			err:        errors.New("pq: canceling statement due to user request"),
+			wantDetail: "the request took too long, try again later",
+		},
+		{
+			name:       "timed out call",
+			ctx:        context.Background(),
+			err:        context.DeadlineExceeded,
+			wantDetail: "the request took too long, try again later",
+		},
+		{
+			name:       "cancelled request",
+			ctx:        cancelled,
+			err:        context.Canceled,
+			wantDetail: "the request was cancelled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(tt.ctx)
+			rr := httptest.NewRecorder()
+
+			Internal(rr, req, tt.err)
+
+			assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+			var got Problem
+			err := json.NewDecoder(rr.Body).Decode(&got)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantDetail, got.Detail)
+		})
+	}
+}
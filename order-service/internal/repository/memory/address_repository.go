@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
+)
+
+type AddressRepository struct {
+	mu        sync.Mutex
+	nextID    int
+	addresses map[int]entity.Address
+}
+
+func NewAddressRepository() *AddressRepository {
+	return &AddressRepository{nextID: 1, addresses: map[int]entity.Address{}}
+}
+
+func (r *AddressRepository) ListByUser(ctx context.Context, userID int, q listquery.Query) (listquery.Page[entity.Address], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var addresses []entity.Address
+	for _, address := range r.addresses {
+		if address.UserID == userID {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return paginate(q, addresses, addressField, func(a entity.Address) int { return a.AddressID }), nil
+}
+
+func (r *AddressRepository) FindByID(ctx context.Context, addressID, userID int) (*entity.Address, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	address, ok := r.addresses[addressID]
+	if !ok || address.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+
+	return &address, nil
+}
+
+func (r *AddressRepository) Create(ctx context.Context, address entity.Address) (*entity.Address, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	address.AddressID = r.nextID
+	r.nextID++
+	r.addresses[address.AddressID] = address
+
+	return &address, nil
+}
+
+func (r *AddressRepository) Update(ctx context.Context, address entity.Address) (*entity.Address, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.addresses[address.AddressID]
+	if !ok || stored.UserID != address.UserID {
+		return nil, repository.ErrNotFound
+	}
+
+	r.addresses[address.AddressID] = address
+
+	return &address, nil
+}
+
+func (r *AddressRepository) Delete(ctx context.Context, addressID, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if address, ok := r.addresses[addressID]; !ok || address.UserID != userID {
+		return repository.ErrNotFound
+	}
+	delete(r.addresses, addressID)
+
+	return nil
+}
+
+func addressField(a entity.Address, name string) string {
+	switch name {
+	case "address_id":
+		return strconv.Itoa(a.AddressID)
+	case "country":
+		return a.Country
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+// Package memory implements the repositories in maps, for the tests of the
+// services. It follows the same contract as the sqlrepo package but keeps
+// every value in clear.
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+)
+
+// paginate does in memory what listquery.Query.Apply and listquery.Paginate
+// do in sql. field returns the value of row for a sort or filter name of the
+// query and id its unique id.
+func paginate[T any](q listquery.Query, rows []T, field func(row T, name string) string, id func(row T) int) listquery.Page[T] {
+	var matching []T
+	for _, row := range rows {
+		if matches(q, row, field, id) {
+			matching = append(matching, row)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		c := compare(field(matching[i], q.Sort), id(matching[i]), field(matching[j], q.Sort), id(matching[j]))
+		if q.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if len(matching) > q.Limit+1 {
+		matching = matching[:q.Limit+1]
+	}
+
+	return listquery.Paginate(q, matching, func(row T) (string, int) {
+		return field(row, q.Sort), id(row)
+	})
+}
+
+func matches[T any](q listquery.Query, row T, field func(row T, name string) string, id func(row T) int) bool {
+	for name, value := range q.Filters {
+		if field(row, name) != value {
+			return false
+		}
+	}
+
+	if q.After == nil {
+		return true
+	}
+
+	c := compare(field(row, q.Sort), id(row), q.After.Value, q.After.ID)
+	if q.Descending {
+		return c < 0
+	}
+	return c > 0
+}
+
+// compare orders two rows by value then id, values are compared as numbers
+// when both are.
+func compare(valueA string, idA int, valueB string, idB int) int {
+	numberA, errA := strconv.Atoi(valueA)
+	numberB, errB := strconv.Atoi(valueB)
+
+	switch {
+	case errA == nil && errB == nil && numberA != numberB:
+		if numberA < numberB {
+			return -1
+		}
+		return 1
+	case (errA != nil || errB != nil) && valueA != valueB:
+		if valueA < valueB {
+			return -1
+		}
+		return 1
+	case idA < idB:
+		return -1
+	case idA > idB:
+		return 1
+	}
+	return 0
+}
+
+// Transactor runs the functions given to it as they are, the memory
+// repositories have no transactions to run them in.
+type Transactor struct{}
+
+func (Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
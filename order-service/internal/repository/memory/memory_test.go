@@ -0,0 +1,17 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/repositorytest"
+)
+
+func TestContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		return repositorytest.Repositories{
+			Users:          NewUserRepository(),
+			Addresses:      NewAddressRepository(),
+			PaymentMethods: NewPaymentMethodRepository(),
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
+)
+
+type PaymentMethodRepository struct {
+	mu             sync.Mutex
+	nextID         int
+	paymentMethods map[int]entity.PaymentMethod
+}
+
+func NewPaymentMethodRepository() *PaymentMethodRepository {
+	return &PaymentMethodRepository{nextID: 1, paymentMethods: map[int]entity.PaymentMethod{}}
+}
+
+func (r *PaymentMethodRepository) ListByUser(ctx context.Context, userID int, q listquery.Query) (listquery.Page[entity.PaymentMethod], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var paymentMethods []entity.PaymentMethod
+	for _, paymentMethod := range r.paymentMethods {
+		if paymentMethod.UserID == userID {
+			paymentMethods = append(paymentMethods, paymentMethod)
+		}
+	}
+
+	return paginate(q, paymentMethods, paymentMethodField, func(p entity.PaymentMethod) int { return p.PaymentMethodID }), nil
+}
+
+func (r *PaymentMethodRepository) FindByID(ctx context.Context, paymentMethodID, userID int) (*entity.PaymentMethod, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paymentMethod, ok := r.paymentMethods[paymentMethodID]
+	if !ok || paymentMethod.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+
+	return &paymentMethod, nil
+}
+
+func (r *PaymentMethodRepository) CardToken(ctx context.Context, paymentMethodID, userID int) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paymentMethod, ok := r.paymentMethods[paymentMethodID]
+	if !ok || paymentMethod.UserID != userID {
+		return "", repository.ErrNotFound
+	}
+
+	return paymentMethod.CardToken, nil
+}
+
+func (r *PaymentMethodRepository) Create(ctx context.Context, paymentMethod entity.PaymentMethod) (*entity.PaymentMethod, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paymentMethod.PaymentMethodID = r.nextID
+	paymentMethod.ExpirationDate = storedDate(paymentMethod.ExpirationDate)
+	r.nextID++
+	r.paymentMethods[paymentMethod.PaymentMethodID] = paymentMethod
+
+	return &paymentMethod, nil
+}
+
+func (r *PaymentMethodRepository) Update(ctx context.Context, paymentMethod entity.PaymentMethod) (*entity.PaymentMethod, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.paymentMethods[paymentMethod.PaymentMethodID]
+	if !ok || stored.UserID != paymentMethod.UserID {
+		return nil, repository.ErrNotFound
+	}
+
+	paymentMethod.ExpirationDate = storedDate(paymentMethod.ExpirationDate)
+	r.paymentMethods[paymentMethod.PaymentMethodID] = paymentMethod
+
+	return &paymentMethod, nil
+}
+
+func (r *PaymentMethodRepository) Delete(ctx context.Context, paymentMethodID, userID int) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paymentMethod, ok := r.paymentMethods[paymentMethodID]
+	if !ok || paymentMethod.UserID != userID {
+		return "", repository.ErrNotFound
+	}
+	delete(r.paymentMethods, paymentMethodID)
+
+	return paymentMethod.CardToken, nil
+}
+
+func paymentMethodField(p entity.PaymentMethod, name string) string {
+	switch name {
+	case "payment_method_id":
+		return strconv.Itoa(p.PaymentMethodID)
+	case "expiration_date":
+		return p.ExpirationDate
+	case "payment_type":
+		return p.PaymentType
+	}
+	return ""
+}
+
+// storedDate turns a YYYY-MM-DD date into the timestamp postgres reads back
+// from a DATE column.
+func storedDate(date string) string {
+	if d, err := time.Parse(time.DateOnly, date); err == nil {
+		return d.Format(time.RFC3339)
+	}
+	return date
+}
@@ -0,0 +1,225 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
+)
+
+type userRecord struct {
+	user           entity.User
+	resetTokenHash string
+	resetExpiresAt time.Time
+}
+
+type UserRepository struct {
+	mu     sync.Mutex
+	nextID int
+	users  map[int]*userRecord
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{nextID: 1, users: map[int]*userRecord{}}
+}
+
+func (r *UserRepository) Create(ctx context.Context, user entity.User) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.taken(0, user.Username, user.Email) {
+		return 0, repository.ErrDuplicate
+	}
+
+	// like the table defaults, every user starts as an active customer
+	user.UserID = r.nextID
+	user.Role = entity.RoleCustomer
+	user.Disabled = false
+	user.PasswordResetRequired = false
+	user.TokenVersion = 0
+	r.nextID++
+	r.users[user.UserID] = &userRecord{user: user}
+
+	return user.UserID, nil
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, userID int) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.users[userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+
+	return withoutPassword(record.user), nil
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, record := range r.users {
+		if record.user.Email == email {
+			user := record.user
+			return &user, nil
+		}
+	}
+
+	return nil, repository.ErrNotFound
+}
+
+func (r *UserRepository) Update(ctx context.Context, user entity.User) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.users[user.UserID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if r.taken(user.UserID, user.Username, user.Email) {
+		return nil, repository.ErrDuplicate
+	}
+
+	record.user.Username = user.Username
+	record.user.Email = user.Email
+	record.user.FirstName = user.FirstName
+	record.user.LastName = user.LastName
+	record.user.PhoneNumber = user.PhoneNumber
+
+	return withoutPassword(record.user), nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userID]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.users, userID)
+
+	return nil
+}
+
+func (r *UserRepository) Search(ctx context.Context, filter repository.UserFilter, limit, offset int) ([]entity.User, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var users []entity.User
+	for _, record := range r.users {
+		user := record.user
+		if contains(user.Email, filter.Email) &&
+			contains(user.Username, filter.Username) &&
+			contains(fullName(user), filter.Name) {
+			users = append(users, *withoutPassword(user))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+
+	total := len(users)
+	users = users[min(offset, total):min(offset+limit, total)]
+	if len(users) == 0 {
+		users = nil
+	}
+
+	return users, total, nil
+}
+
+// SetRole is not part of repository.UserRepository, roles are only ever
+// granted in the database. Tests use it to make admins.
+func (r *UserRepository) SetRole(userID int, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.users[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	record.user.Role = role
+
+	return nil
+}
+
+func (r *UserRepository) SetDisabled(ctx context.Context, userID int, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.users[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	record.user.Disabled = disabled
+
+	return nil
+}
+
+func (r *UserRepository) RequirePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.users[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	record.user.PasswordResetRequired = true
+	record.user.TokenVersion++
+	record.resetTokenHash = tokenHash
+	record.resetExpiresAt = expiresAt
+
+	return nil
+}
+
+func (r *UserRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, record := range r.users {
+		if record.resetTokenHash != "" && record.resetTokenHash == tokenHash && record.resetExpiresAt.After(now) {
+			record.user.Password = passwordHash
+			record.user.PasswordResetRequired = false
+			record.user.TokenVersion++
+			record.resetTokenHash = ""
+			record.resetExpiresAt = time.Time{}
+			return nil
+		}
+	}
+
+	return repository.ErrNotFound
+}
+
+// taken reports whether a user other than userID has username or email.
+func (r *UserRepository) taken(userID int, username, email string) bool {
+	for _, record := range r.users {
+		if record.user.UserID != userID && (record.user.Username == username || record.user.Email == email) {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutPassword(user entity.User) *entity.User {
+	user.Password = ""
+	return &user
+}
+
+// fullName is concat_ws(' ', first_name, last_name), a missing part is
+// skipped.
+func fullName(user entity.User) string {
+	var parts []string
+	for _, part := range []string{user.FirstName, user.LastName} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// contains is ILIKE '%substr%', an empty substr matches everything.
+func contains(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
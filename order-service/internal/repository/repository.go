@@ -0,0 +1,117 @@
+// Package repository declares how the services load and store each
+// aggregate. The sqlrepo package implements it on the database, postgres or
+// SQLite, and the memory package in maps, for tests; repositorytest holds the
+// contract both must pass.
+//
+// Every method takes the context of the call, the sqlrepo repositories run in
+// the transaction it carries, see database.TxManager.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a write would break a uniqueness rule.
+	ErrDuplicate = errors.New("record already exists")
+	// ErrInUse is returned when a delete would leave other records referring
+	// to the deleted one.
+	ErrInUse = errors.New("record is still in use")
+)
+
+// Transactor runs fn in a transaction the repositories given its context run
+// in, see database.TxManager.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// UserFilter matches users whose fields contain every non empty value,
+// ignoring case. Name is matched against the first and last name.
+type UserFilter struct {
+	Email    string
+	Username string
+	Name     string
+}
+
+// UserRepository stores users. Only FindByEmail returns the password hash.
+type UserRepository interface {
+	// Create stores user, whose Password is already hashed, and returns its
+	// id. It fails with ErrDuplicate when the username or email is taken.
+	Create(ctx context.Context, user entity.User) (int, error)
+	FindByID(ctx context.Context, userID int) (*entity.User, error)
+	FindByEmail(ctx context.Context, email string) (*entity.User, error)
+	// Update changes the profile of user: username, email, names and phone
+	// number.
+	Update(ctx context.Context, user entity.User) (*entity.User, error)
+	Delete(ctx context.Context, userID int) error
+	// Search returns the users matching filter ordered by id, skipping offset
+	// and at most limit of them, along with the total number of matches.
+	Search(ctx context.Context, filter UserFilter, limit, offset int) ([]entity.User, int, error)
+	SetDisabled(ctx context.Context, userID int, disabled bool) error
+	// RequirePasswordReset blocks the logins of the user until ResetPassword
+	// is called with the token hash before expiresAt, and revokes the tokens
+	// issued so far by bumping the token version.
+	RequirePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// ResetPassword replaces the password of the user holding tokenHash and
+	// bumps the token version, it fails with ErrNotFound when no user holds it
+	// or it expired by now.
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) error
+}
+
+// AddressRepository stores addresses, which are listed by their owner. The
+// addresses of other users are never found, not even by id.
+type AddressRepository interface {
+	// ListByUser returns a page of the addresses of userID, q is parsed with
+	// AddressListSpec.
+	ListByUser(ctx context.Context, userID int, q listquery.Query) (listquery.Page[entity.Address], error)
+	FindByID(ctx context.Context, addressID, userID int) (*entity.Address, error)
+	Create(ctx context.Context, address entity.Address) (*entity.Address, error)
+	// Update changes the address if it belongs to address.UserID.
+	Update(ctx context.Context, address entity.Address) (*entity.Address, error)
+	Delete(ctx context.Context, addressID, userID int) error
+}
+
+// PaymentMethodRepository stores payment methods, which hold a card vault
+// token instead of the card number. Like addresses, the payment methods of
+// other users are never found.
+type PaymentMethodRepository interface {
+	// ListByUser returns a page of the payment methods of userID, q is parsed
+	// with PaymentMethodListSpec.
+	ListByUser(ctx context.Context, userID int, q listquery.Query) (listquery.Page[entity.PaymentMethod], error)
+	FindByID(ctx context.Context, paymentMethodID, userID int) (*entity.PaymentMethod, error)
+	// CardToken returns the card vault token of the payment method, locking
+	// the payment method until the transaction of ctx ends.
+	CardToken(ctx context.Context, paymentMethodID, userID int) (string, error)
+	Create(ctx context.Context, paymentMethod entity.PaymentMethod) (*entity.PaymentMethod, error)
+	// Update changes the payment method if it belongs to
+	// paymentMethod.UserID.
+	Update(ctx context.Context, paymentMethod entity.PaymentMethod) (*entity.PaymentMethod, error)
+	// Delete removes the payment method and returns its card vault token, it
+	// fails with ErrInUse while orders were placed with the payment method.
+	Delete(ctx context.Context, paymentMethodID, userID int) (string, error)
+}
+
+// AddressListSpec is what ListByUser can sort and filter addresses by, the
+// other columns are encrypted.
+var AddressListSpec = listquery.Spec{
+	IDColumn:    "address_id",
+	Sorts:       map[string]string{"address_id": "address_id"},
+	DefaultSort: "address_id",
+	Filters:     map[string]string{"country": "country"},
+}
+
+var PaymentMethodListSpec = listquery.Spec{
+	IDColumn: "payment_method_id",
+	Sorts: map[string]string{
+		"payment_method_id": "payment_method_id",
+		"expiration_date":   "expiration_date",
+	},
+	DefaultSort: "payment_method_id",
+	Filters:     map[string]string{"payment_type": "payment_type"},
+}
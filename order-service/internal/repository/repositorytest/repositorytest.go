@@ -0,0 +1,459 @@
+// Package repositorytest is the contract every implementation of the
+// repository interfaces must pass, so the in-memory repositories used by the
+// service tests behave like the sqlrepo ones.
+package repositorytest
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
+)
+
+// ctx runs the contract outside of any transaction.
+var ctx = context.Background()
+
+// Repositories are the implementations under test. They must be empty, with
+// ids starting at 1, every time the constructor passed to Run is called.
+type Repositories struct {
+	Users          repository.UserRepository
+	Addresses      repository.AddressRepository
+	PaymentMethods repository.PaymentMethodRepository
+}
+
+func Run(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	t.Run("users", func(t *testing.T) { testUsers(t, newRepositories) })
+	t.Run("user search", func(t *testing.T) { testUserSearch(t, newRepositories) })
+	t.Run("password reset", func(t *testing.T) { testPasswordReset(t, newRepositories) })
+	t.Run("addresses", func(t *testing.T) { testAddresses(t, newRepositories) })
+	t.Run("address list", func(t *testing.T) { testAddressList(t, newRepositories) })
+	t.Run("payment methods", func(t *testing.T) { testPaymentMethods(t, newRepositories) })
+	t.Run("payment method list", func(t *testing.T) { testPaymentMethodList(t, newRepositories) })
+}
+
+func newUser(username string) entity.User {
+	return entity.User{
+		Username:    username,
+		Password:    "$2a$10$hash-of-" + username,
+		Email:       username + "@example.com",
+		FirstName:   "John",
+		LastName:    username,
+		PhoneNumber: "1234567890",
+	}
+}
+
+func createUser(t *testing.T, users repository.UserRepository, username string) int {
+	t.Helper()
+
+	userID, err := users.Create(ctx, newUser(username))
+	if err != nil {
+		t.Fatalf("failed to create user %s: %s", username, err)
+	}
+	return userID
+}
+
+func testUsers(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	users := newRepositories(t).Users
+
+	userID, err := users.Create(ctx, newUser("john"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, userID)
+
+	_, err = users.Create(ctx, newUser("john"))
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "same username and email")
+
+	duplicateEmail := newUser("jane")
+	duplicateEmail.Email = "john@example.com"
+	_, err = users.Create(ctx, duplicateEmail)
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "same email")
+
+	want := &entity.User{
+		UserID:      userID,
+		Username:    "john",
+		Email:       "john@example.com",
+		FirstName:   "John",
+		LastName:    "john",
+		PhoneNumber: "1234567890",
+		Role:        entity.RoleCustomer,
+	}
+
+	got, err := users.FindByID(ctx, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	got, err = users.FindByEmail(ctx, "john@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "$2a$10$hash-of-john", got.Password)
+
+	_, err = users.FindByID(ctx, 999)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = users.FindByEmail(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	update := newUser("johnny")
+	update.UserID = userID
+	update.PhoneNumber = "9876543210"
+	got, err = users.Update(ctx, update)
+	assert.NoError(t, err)
+	assert.Equal(t, "johnny", got.Username)
+	assert.Equal(t, "johnny@example.com", got.Email)
+	assert.EqualValues(t, "9876543210", got.PhoneNumber)
+
+	update.UserID = 999
+	_, err = users.Update(ctx, update)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	otherID := createUser(t, users, "jane")
+	update.UserID = otherID
+	_, err = users.Update(ctx, update)
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "email of another user")
+
+	assert.NoError(t, users.SetDisabled(ctx, userID, true))
+	got, err = users.FindByID(ctx, userID)
+	assert.NoError(t, err)
+	assert.True(t, got.Disabled)
+	assert.ErrorIs(t, users.SetDisabled(ctx, 999, true), repository.ErrNotFound)
+
+	assert.NoError(t, users.Delete(ctx, userID))
+	_, err = users.FindByID(ctx, userID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.ErrorIs(t, users.Delete(ctx, userID), repository.ErrNotFound)
+}
+
+func testUserSearch(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	users := newRepositories(t).Users
+	for _, username := range []string{"alice", "bob", "carol", "100%_off"} {
+		createUser(t, users, username)
+	}
+	nameless := newUser("dave")
+	nameless.FirstName = "Dave"
+	nameless.LastName = ""
+	if _, err := users.Create(ctx, nameless); err != nil {
+		t.Fatalf("failed to create user dave: %s", err)
+	}
+
+	tests := []struct {
+		name          string
+		filter        repository.UserFilter
+		limit, offset int
+		expectedIDs   []int
+		expectedTotal int
+	}{
+		{
+			name:          "no filters",
+			limit:         2,
+			expectedIDs:   []int{1, 2},
+			expectedTotal: 5,
+		},
+		{
+			name:          "second page",
+			limit:         2,
+			offset:        2,
+			expectedIDs:   []int{3, 4},
+			expectedTotal: 5,
+		},
+		{
+			name:          "past the last page",
+			limit:         2,
+			offset:        10,
+			expectedTotal: 5,
+		},
+		{
+			name:          "email ignoring case",
+			filter:        repository.UserFilter{Email: "BOB@"},
+			limit:         10,
+			expectedIDs:   []int{2},
+			expectedTotal: 1,
+		},
+		{
+			name:          "full name",
+			filter:        repository.UserFilter{Name: "john car"},
+			limit:         10,
+			expectedIDs:   []int{3},
+			expectedTotal: 1,
+		},
+		{
+			name:          "name without a last name",
+			filter:        repository.UserFilter{Name: "dave"},
+			limit:         10,
+			expectedIDs:   []int{5},
+			expectedTotal: 1,
+		},
+		{
+			name:          "wildcards are literal",
+			filter:        repository.UserFilter{Username: "0%_"},
+			limit:         10,
+			expectedIDs:   []int{4},
+			expectedTotal: 1,
+		},
+		{
+			name:          "every filter must match",
+			filter:        repository.UserFilter{Username: "alice", Email: "bob"},
+			limit:         10,
+			expectedTotal: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := users.Search(ctx, tt.filter, tt.limit, tt.offset)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTotal, total)
+
+			var ids []int
+			for _, user := range got {
+				assert.Empty(t, user.Password)
+				ids = append(ids, user.UserID)
+			}
+			assert.Equal(t, tt.expectedIDs, ids)
+		})
+	}
+}
+
+func testPasswordReset(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	users := newRepositories(t).Users
+	userID := createUser(t, users, "john")
+	now := time.Now()
+
+	assert.ErrorIs(t, users.RequirePasswordReset(ctx, 999, "token", now.Add(time.Hour)), repository.ErrNotFound)
+	assert.NoError(t, users.RequirePasswordReset(ctx, userID, "token", now.Add(time.Hour)))
+
+	got, err := users.FindByID(ctx, userID)
+	assert.NoError(t, err)
+	assert.True(t, got.PasswordResetRequired)
+	assert.Equal(t, 1, got.TokenVersion, "the tokens issued before should be revoked")
+
+	assert.ErrorIs(t, users.ResetPassword(ctx, "other", "new-hash", now), repository.ErrNotFound, "unknown token")
+	assert.ErrorIs(t, users.ResetPassword(ctx, "token", "new-hash", now.Add(2*time.Hour)), repository.ErrNotFound, "expired token")
+	assert.NoError(t, users.ResetPassword(ctx, "token", "new-hash", now))
+	assert.ErrorIs(t, users.ResetPassword(ctx, "token", "newer-hash", now), repository.ErrNotFound, "token already used")
+
+	got, err = users.FindByEmail(ctx, "john@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "new-hash", got.Password)
+	assert.False(t, got.PasswordResetRequired)
+	assert.Equal(t, 2, got.TokenVersion)
+}
+
+func newAddress(userID int, country string) entity.Address {
+	return entity.Address{
+		UserID:        userID,
+		StreetAddress: "123 Main St",
+		City:          "Anytown",
+		State:         "CA",
+		PostalCode:    "12345",
+		Country:       country,
+	}
+}
+
+func testAddresses(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	repos := newRepositories(t)
+	userID := createUser(t, repos.Users, "john")
+	otherID := createUser(t, repos.Users, "jane")
+
+	created, err := repos.Addresses.Create(ctx, newAddress(userID, "USA"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created.AddressID)
+	assert.Equal(t, userID, created.UserID)
+
+	got, err := repos.Addresses.FindByID(ctx, created.AddressID, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, created, got)
+
+	_, err = repos.Addresses.FindByID(ctx, created.AddressID, otherID)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "address of another user")
+
+	update := newAddress(otherID, "Canada")
+	update.AddressID = created.AddressID
+	_, err = repos.Addresses.Update(ctx, update)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "update of the address of another user")
+
+	update.UserID = userID
+	update.City = "Toronto"
+	got, err = repos.Addresses.Update(ctx, update)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, got.UserID)
+	assert.EqualValues(t, "Toronto", got.City)
+	assert.Equal(t, "Canada", got.Country)
+
+	update.AddressID = 999
+	_, err = repos.Addresses.Update(ctx, update)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	assert.ErrorIs(t, repos.Addresses.Delete(ctx, created.AddressID, otherID), repository.ErrNotFound, "delete of the address of another user")
+	assert.NoError(t, repos.Addresses.Delete(ctx, created.AddressID, userID))
+	_, err = repos.Addresses.FindByID(ctx, created.AddressID, userID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.ErrorIs(t, repos.Addresses.Delete(ctx, created.AddressID, userID), repository.ErrNotFound)
+}
+
+func testAddressList(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	repos := newRepositories(t)
+	userID := createUser(t, repos.Users, "john")
+	otherID := createUser(t, repos.Users, "jane")
+
+	for _, address := range []entity.Address{
+		newAddress(userID, "USA"),
+		newAddress(userID, "Canada"),
+		newAddress(otherID, "USA"),
+		newAddress(userID, "USA"),
+		newAddress(userID, "USA"),
+	} {
+		if _, err := repos.Addresses.Create(ctx, address); err != nil {
+			t.Fatalf("failed to create address: %s", err)
+		}
+	}
+
+	list := func(values url.Values) ([]int, []int) {
+		return walk(t, values, repository.AddressListSpec, func(q listquery.Query) (listquery.Page[entity.Address], error) {
+			return repos.Addresses.ListByUser(ctx, userID, q)
+		}, func(a entity.Address) int { return a.AddressID })
+	}
+
+	ids, pageSizes := list(url.Values{"limit": {"2"}})
+	assert.Equal(t, []int{1, 2, 4, 5}, ids)
+	assert.Equal(t, []int{2, 2}, pageSizes)
+
+	ids, _ = list(url.Values{"limit": {"2"}, "sort": {"-address_id"}})
+	assert.Equal(t, []int{5, 4, 2, 1}, ids)
+
+	ids, pageSizes = list(url.Values{"limit": {"2"}, "country": {"USA"}})
+	assert.Equal(t, []int{1, 4, 5}, ids)
+	assert.Equal(t, []int{2, 1}, pageSizes)
+}
+
+func newPaymentMethod(userID int, paymentType, expirationDate string) entity.PaymentMethod {
+	return entity.PaymentMethod{
+		UserID:         userID,
+		PaymentType:    paymentType,
+		CardToken:      "tok_" + paymentType + expirationDate,
+		CardLast4:      "4242",
+		ExpirationDate: expirationDate,
+		CardHolderName: "John Doe",
+	}
+}
+
+func testPaymentMethods(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	repos := newRepositories(t)
+	userID := createUser(t, repos.Users, "john")
+	otherID := createUser(t, repos.Users, "jane")
+
+	created, err := repos.PaymentMethods.Create(ctx, newPaymentMethod(userID, "visa", "2040-12-31"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created.PaymentMethodID)
+	assert.Equal(t, "2040-12-31T00:00:00Z", created.ExpirationDate)
+
+	got, err := repos.PaymentMethods.FindByID(ctx, created.PaymentMethodID, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, created, got)
+
+	_, err = repos.PaymentMethods.FindByID(ctx, created.PaymentMethodID, otherID)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "payment method of another user")
+
+	cardToken, err := repos.PaymentMethods.CardToken(ctx, created.PaymentMethodID, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, "tok_visa2040-12-31", cardToken)
+	_, err = repos.PaymentMethods.CardToken(ctx, created.PaymentMethodID, otherID)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "card token of another user")
+	_, err = repos.PaymentMethods.CardToken(ctx, 999, userID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	update := newPaymentMethod(otherID, "mastercard", "2041-06-30")
+	update.PaymentMethodID = created.PaymentMethodID
+	_, err = repos.PaymentMethods.Update(ctx, update)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "update of the payment method of another user")
+
+	update.UserID = userID
+	got, err = repos.PaymentMethods.Update(ctx, update)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, got.UserID)
+	assert.Equal(t, "mastercard", got.PaymentType)
+	assert.Equal(t, "tok_mastercard2041-06-30", got.CardToken)
+
+	update.PaymentMethodID = 999
+	_, err = repos.PaymentMethods.Update(ctx, update)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = repos.PaymentMethods.Delete(ctx, created.PaymentMethodID, otherID)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "delete of the payment method of another user")
+	cardToken, err = repos.PaymentMethods.Delete(ctx, created.PaymentMethodID, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, "tok_mastercard2041-06-30", cardToken)
+	_, err = repos.PaymentMethods.Delete(ctx, created.PaymentMethodID, userID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func testPaymentMethodList(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	repos := newRepositories(t)
+	userID := createUser(t, repos.Users, "john")
+	otherID := createUser(t, repos.Users, "jane")
+
+	for _, paymentMethod := range []entity.PaymentMethod{
+		newPaymentMethod(userID, "visa", "2041-01-31"),
+		newPaymentMethod(userID, "mastercard", "2040-06-30"),
+		newPaymentMethod(otherID, "visa", "2039-01-31"),
+		newPaymentMethod(userID, "visa", "2040-06-30"),
+		newPaymentMethod(userID, "visa", "2042-12-31"),
+	} {
+		if _, err := repos.PaymentMethods.Create(ctx, paymentMethod); err != nil {
+			t.Fatalf("failed to create payment method: %s", err)
+		}
+	}
+
+	list := func(values url.Values) []int {
+		ids, _ := walk(t, values, repository.PaymentMethodListSpec, func(q listquery.Query) (listquery.Page[entity.PaymentMethod], error) {
+			return repos.PaymentMethods.ListByUser(ctx, userID, q)
+		}, func(p entity.PaymentMethod) int { return p.PaymentMethodID })
+		return ids
+	}
+
+	assert.Equal(t, []int{1, 2, 4, 5}, list(url.Values{"limit": {"3"}}))
+	assert.Equal(t, []int{2, 4, 1, 5}, list(url.Values{"limit": {"1"}, "sort": {"expiration_date"}}))
+	assert.Equal(t, []int{5, 1, 4, 2}, list(url.Values{"limit": {"2"}, "sort": {"-expiration_date"}}))
+	assert.Equal(t, []int{4, 1, 5}, list(url.Values{"limit": {"2"}, "sort": {"expiration_date"}, "payment_type": {"visa"}}))
+}
+
+// walk lists every page for values, following the cursors, and returns the
+// ids listed along with the size of each page.
+func walk[T any](
+	t *testing.T,
+	values url.Values,
+	spec listquery.Spec,
+	list func(q listquery.Query) (listquery.Page[T], error),
+	id func(T) int,
+) ([]int, []int) {
+	t.Helper()
+
+	var ids, pageSizes []int
+	for pages := 0; ; pages++ {
+		if pages == 10 {
+			t.Fatalf("listing %v does not end", values)
+		}
+
+		q, err := listquery.Parse(values, spec)
+		if err != nil {
+			t.Fatalf("failed to parse list query: %s", err)
+		}
+
+		page, err := list(q)
+		if err != nil {
+			t.Fatalf("failed to list %v: %s", values, err)
+		}
+
+		for _, item := range page.Items {
+			ids = append(ids, id(item))
+		}
+		pageSizes = append(pageSizes, len(page.Items))
+
+		if page.NextCursor == "" {
+			return ids, pageSizes
+		}
+		values.Set("cursor", page.NextCursor)
+	}
+}
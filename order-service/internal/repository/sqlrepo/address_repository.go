@@ -0,0 +1,122 @@
+package sqlrepo
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+)
+
+const addressColumns = `address_id, user_id, street_address, city, state, postal_code, country`
+
+type AddressRepository struct {
+	db *sqlx.DB
+	tx *database.TxManager
+}
+
+func NewAddressRepository(db *sqlx.DB) *AddressRepository {
+	return &AddressRepository{db: db, tx: database.NewTxManager(db, nil)}
+}
+
+func (r *AddressRepository) ListByUser(ctx context.Context, userID int, q listquery.Query) (listquery.Page[entity.Address], error) {
+	query, args := q.Apply(`SELECT `+addressColumns+` FROM addresses WHERE user_id = $1`, []any{userID})
+
+	var addresses []entity.Address
+	if err := database.Conn(ctx, r.db).SelectContext(ctx, &addresses, query, args...); err != nil {
+		return listquery.Page[entity.Address]{}, err
+	}
+	for i := range addresses {
+		if err := openAddress(&addresses[i]); err != nil {
+			return listquery.Page[entity.Address]{}, err
+		}
+	}
+
+	return listquery.Paginate(q, addresses, func(a entity.Address) (string, int) {
+		return "", a.AddressID
+	}), nil
+}
+
+func (r *AddressRepository) FindByID(ctx context.Context, addressID, userID int) (*entity.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE address_id = $1 AND user_id = $2`
+
+	var address entity.Address
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, query, addressID, userID).StructScan(&address); err != nil {
+		return nil, translateError(err)
+	}
+	if err := openAddress(&address); err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// Create inserts the address before writing its encrypted fields, which are
+// sealed to its id.
+func (r *AddressRepository) Create(ctx context.Context, address entity.Address) (*entity.Address, error) {
+	query := `
+		INSERT INTO addresses (user_id, street_address, city, state, postal_code, country)
+		VALUES ($1, '', '', '', '', $2)
+		RETURNING address_id`
+
+	var created *entity.Address
+	err := r.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, query, address.UserID, address.Country).Scan(&address.AddressID); err != nil {
+			return translateError(err)
+		}
+
+		var err error
+		created, err = r.Update(ctx, address)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (r *AddressRepository) Update(ctx context.Context, address entity.Address) (*entity.Address, error) {
+	query := `
+		UPDATE addresses
+		SET street_address = $1, city = $2, state = $3, postal_code = $4, country = $5, pii_key_version = $6
+		WHERE address_id = $7 AND user_id = $8
+		RETURNING ` + addressColumns
+
+	args, err := fieldcrypt.SealRow("addresses", address.AddressID, addressPII(&address)...)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, address.Country, fieldcrypt.CurrentKeyVersion(), address.AddressID, address.UserID)
+
+	var updated entity.Address
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, query, args...).StructScan(&updated); err != nil {
+		return nil, translateError(err)
+	}
+	if err := openAddress(&updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (r *AddressRepository) Delete(ctx context.Context, addressID, userID int) error {
+	return execOne(ctx, r.db, `DELETE FROM addresses WHERE address_id = $1 AND user_id = $2`, addressID, userID)
+}
+
+// addressPII lists the encrypted fields of address.
+func addressPII(address *entity.Address) []fieldcrypt.Field {
+	return []fieldcrypt.Field{
+		{Column: "street_address", Value: &address.StreetAddress},
+		{Column: "city", Value: &address.City},
+		{Column: "state", Value: &address.State},
+		{Column: "postal_code", Value: &address.PostalCode},
+	}
+}
+
+func openAddress(address *entity.Address) error {
+	return fieldcrypt.OpenRow("addresses", address.AddressID, addressPII(address)...)
+}
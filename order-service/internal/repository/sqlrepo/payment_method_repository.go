@@ -0,0 +1,113 @@
+package sqlrepo
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+)
+
+const paymentMethodColumns = `payment_method_id, user_id, payment_type, card_token, card_last4, expiration_date, card_holder_name`
+
+type PaymentMethodRepository struct {
+	db *sqlx.DB
+}
+
+func NewPaymentMethodRepository(db *sqlx.DB) *PaymentMethodRepository {
+	return &PaymentMethodRepository{db: db}
+}
+
+func (r *PaymentMethodRepository) ListByUser(ctx context.Context, userID int, q listquery.Query) (listquery.Page[entity.PaymentMethod], error) {
+	query, args := q.Apply(`SELECT `+paymentMethodColumns+` FROM payment_methods WHERE user_id = $1`, []any{userID})
+
+	var paymentMethods []entity.PaymentMethod
+	if err := database.Conn(ctx, r.db).SelectContext(ctx, &paymentMethods, query, args...); err != nil {
+		return listquery.Page[entity.PaymentMethod]{}, err
+	}
+
+	return listquery.Paginate(q, paymentMethods, func(p entity.PaymentMethod) (string, int) {
+		return p.ExpirationDate, p.PaymentMethodID
+	}), nil
+}
+
+func (r *PaymentMethodRepository) FindByID(ctx context.Context, paymentMethodID, userID int) (*entity.PaymentMethod, error) {
+	query := `SELECT ` + paymentMethodColumns + ` FROM payment_methods WHERE payment_method_id = $1 AND user_id = $2`
+
+	var paymentMethod entity.PaymentMethod
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, query, paymentMethodID, userID).StructScan(&paymentMethod); err != nil {
+		return nil, translateError(err)
+	}
+
+	return &paymentMethod, nil
+}
+
+func (r *PaymentMethodRepository) CardToken(ctx context.Context, paymentMethodID, userID int) (string, error) {
+	query := `SELECT card_token FROM payment_methods WHERE payment_method_id = $1 AND user_id = $2 FOR UPDATE`
+
+	var cardToken string
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, query, paymentMethodID, userID).Scan(&cardToken); err != nil {
+		return "", translateError(err)
+	}
+
+	return cardToken, nil
+}
+
+func (r *PaymentMethodRepository) Create(ctx context.Context, paymentMethod entity.PaymentMethod) (*entity.PaymentMethod, error) {
+	query := `
+		INSERT INTO payment_methods (user_id, payment_type, card_token, card_last4, expiration_date, card_holder_name)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + paymentMethodColumns
+
+	var created entity.PaymentMethod
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx,
+		query,
+		paymentMethod.UserID,
+		paymentMethod.PaymentType,
+		paymentMethod.CardToken,
+		paymentMethod.CardLast4,
+		paymentMethod.ExpirationDate,
+		paymentMethod.CardHolderName,
+	).StructScan(&created); err != nil {
+		return nil, translateError(err)
+	}
+
+	return &created, nil
+}
+
+func (r *PaymentMethodRepository) Update(ctx context.Context, paymentMethod entity.PaymentMethod) (*entity.PaymentMethod, error) {
+	query := `
+		UPDATE payment_methods
+		SET payment_type = $1, card_token = $2, card_last4 = $3, expiration_date = $4, card_holder_name = $5
+		WHERE payment_method_id = $6 AND user_id = $7
+		RETURNING ` + paymentMethodColumns
+
+	var updated entity.PaymentMethod
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx,
+		query,
+		paymentMethod.PaymentType,
+		paymentMethod.CardToken,
+		paymentMethod.CardLast4,
+		paymentMethod.ExpirationDate,
+		paymentMethod.CardHolderName,
+		paymentMethod.PaymentMethodID,
+		paymentMethod.UserID,
+	).StructScan(&updated); err != nil {
+		return nil, translateError(err)
+	}
+
+	return &updated, nil
+}
+
+func (r *PaymentMethodRepository) Delete(ctx context.Context, paymentMethodID, userID int) (string, error) {
+	query := `DELETE FROM payment_methods WHERE payment_method_id = $1 AND user_id = $2 RETURNING card_token`
+
+	var cardToken string
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, query, paymentMethodID, userID).Scan(&cardToken); err != nil {
+		return "", translateError(err)
+	}
+
+	return cardToken, nil
+}
@@ -0,0 +1,109 @@
+package sqlrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/repositorytest"
+	"github.com/mathesukkj/goecommerce/order-service/pkg/testutils"
+)
+
+var db *sqlx.DB
+
+func TestMain(m *testing.M) {
+	_, db = testutils.NewPostgresContainerDB()
+
+	keyring, err := fieldcrypt.NewKeyring(1, map[int][]byte{1: bytes.Repeat([]byte{0x01}, 32)})
+	if err != nil {
+		panic(err)
+	}
+	fieldcrypt.SetKeyring(keyring)
+
+	os.Exit(m.Run())
+}
+
+func TestContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		db.MustExec("TRUNCATE TABLE payment_methods, addresses, users CASCADE")
+		db.MustExec("ALTER SEQUENCE users_user_id_seq RESTART WITH 1")
+		db.MustExec("ALTER SEQUENCE addresses_address_id_seq RESTART WITH 1")
+		db.MustExec("ALTER SEQUENCE payment_methods_payment_method_id_seq RESTART WITH 1")
+
+		return repositorytest.Repositories{
+			Users:          NewUserRepository(db),
+			Addresses:      NewAddressRepository(db),
+			PaymentMethods: NewPaymentMethodRepository(db),
+		}
+	})
+}
+
+func TestAmbientTransaction(t *testing.T) {
+	db.MustExec("TRUNCATE TABLE payment_methods, addresses, users CASCADE")
+	users := NewUserRepository(db)
+	addresses := NewAddressRepository(db)
+	txm := database.NewTxManager(db, nil)
+	errFailed := errors.New("failed")
+
+	var userID int
+	err := txm.WithinTx(context.Background(), func(ctx context.Context) error {
+		var err error
+		userID, err = users.Create(ctx, entity.User{Username: "john", Password: "hash", Email: "john@example.com"})
+		if err != nil {
+			return err
+		}
+
+		// the failed savepoint only undoes the address
+		err = txm.WithinTx(ctx, func(ctx context.Context) error {
+			if _, err := addresses.Create(ctx, entity.Address{UserID: userID, Country: "USA"}); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	_, err = users.FindByID(context.Background(), userID)
+	assert.NoError(t, err, "the user should be committed")
+	q, err := listquery.Parse(url.Values{}, repository.AddressListSpec)
+	assert.NoError(t, err)
+	page, err := addresses.ListByUser(context.Background(), userID, q)
+	assert.NoError(t, err)
+	assert.Empty(t, page.Items, "the address should be rolled back")
+
+	err = txm.WithinTx(context.Background(), func(ctx context.Context) error {
+		if err := users.Delete(ctx, userID); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	_, err = users.FindByID(context.Background(), userID)
+	assert.NoError(t, err, "the delete should be rolled back")
+}
+
+func TestCancelledQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := database.Conn(ctx, db).ExecContext(ctx, "SELECT pg_sleep(10)")
+	assert.Error(t, err, "the query should be aborted")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,254 @@
+// Package sqlrepo implements the repositories on the SQL database, postgres
+// or SQLite. Their queries are written for postgres and translated for SQLite
+// by database.Conn.
+package sqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
+)
+
+// userColumns reads a missing first or last name, stored as NULL, as empty.
+const userColumns = `user_id, username, email, COALESCE(first_name, '') AS first_name, COALESCE(last_name, '') AS last_name, phone_number, role, disabled, password_reset_required, token_version`
+
+type UserRepository struct {
+	db *sqlx.DB
+	tx *database.TxManager
+}
+
+func NewUserRepository(db *sqlx.DB) *UserRepository {
+	return &UserRepository{db: db, tx: database.NewTxManager(db, nil)}
+}
+
+// Create inserts the user before writing its phone number, which is sealed
+// to its id.
+func (r *UserRepository) Create(ctx context.Context, user entity.User) (int, error) {
+	insertQuery := `
+		INSERT INTO users (username, password, email, first_name, last_name)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
+		RETURNING user_id
+	`
+	piiQuery := `UPDATE users SET phone_number = $1, pii_key_version = $2 WHERE user_id = $3`
+
+	var userID int
+	err := r.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tx := database.Conn(ctx, r.db)
+
+		err := tx.QueryRowxContext(ctx,
+			insertQuery,
+			user.Username,
+			user.Password,
+			user.Email,
+			user.FirstName,
+			user.LastName,
+		).Scan(&userID)
+		if err != nil {
+			return translateError(err)
+		}
+
+		phoneNumber, err := user.PhoneNumber.Seal("users", "phone_number", userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, piiQuery, phoneNumber, fieldcrypt.CurrentKeyVersion(), userID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, userID int) (*entity.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE user_id = $1`
+
+	var user entity.User
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, query, userID).StructScan(&user); err != nil {
+		return nil, translateError(err)
+	}
+	if err := openUser(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*entity.User, error) {
+	query := `SELECT ` + userColumns + `, password FROM users WHERE email = $1`
+
+	var user entity.User
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, query, email).StructScan(&user); err != nil {
+		return nil, translateError(err)
+	}
+	if err := openUser(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, user entity.User) (*entity.User, error) {
+	query := `
+		UPDATE users
+		SET username = $1, email = $2, first_name = NULLIF($3, ''), last_name = NULLIF($4, ''), phone_number = $5, pii_key_version = $6
+		WHERE user_id = $7
+		RETURNING ` + userColumns
+
+	phoneNumber, err := user.PhoneNumber.Seal("users", "phone_number", user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated entity.User
+	err = database.Conn(ctx, r.db).QueryRowxContext(ctx,
+		query,
+		user.Username,
+		user.Email,
+		user.FirstName,
+		user.LastName,
+		phoneNumber,
+		fieldcrypt.CurrentKeyVersion(),
+		user.UserID,
+	).StructScan(&updated)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if err := openUser(&updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, userID int) error {
+	return execOne(ctx, r.db, `DELETE FROM users WHERE user_id = $1`, userID)
+}
+
+func (r *UserRepository) Search(ctx context.Context, filter repository.UserFilter, limit, offset int) ([]entity.User, int, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Email != "" {
+		args = append(args, "%"+escapeLike(filter.Email)+"%")
+		conditions = append(conditions, fmt.Sprintf("email ILIKE $%d", len(args)))
+	}
+	if filter.Username != "" {
+		args = append(args, "%"+escapeLike(filter.Username)+"%")
+		conditions = append(conditions, fmt.Sprintf("username ILIKE $%d", len(args)))
+	}
+	if filter.Name != "" {
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+		// concat_ws skips a missing part, where || would make the whole name NULL
+		conditions = append(conditions, fmt.Sprintf("concat_ws(' ', first_name, last_name) ILIKE $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := database.Conn(ctx, r.db).QueryRowxContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	query := fmt.Sprintf(
+		`SELECT %s FROM users%s ORDER BY user_id LIMIT $%d OFFSET $%d`,
+		userColumns,
+		where,
+		len(args)-1,
+		len(args),
+	)
+
+	var users []entity.User
+	if err := database.Conn(ctx, r.db).SelectContext(ctx, &users, query, args...); err != nil {
+		return nil, 0, err
+	}
+	for i := range users {
+		if err := openUser(&users[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return users, total, nil
+}
+
+func (r *UserRepository) SetDisabled(ctx context.Context, userID int, disabled bool) error {
+	return execOne(ctx, r.db, `UPDATE users SET disabled = $1 WHERE user_id = $2`, disabled, userID)
+}
+
+func (r *UserRepository) RequirePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	query := `
+		UPDATE users
+		SET password_reset_required = TRUE, password_reset_token = $1, password_reset_expires_at = $2,
+			token_version = token_version + 1
+		WHERE user_id = $3
+	`
+
+	return execOne(ctx, r.db, query, tokenHash, expiresAt, userID)
+}
+
+func (r *UserRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) error {
+	query := `
+		UPDATE users
+		SET password = $1, password_reset_required = FALSE, password_reset_token = NULL, password_reset_expires_at = NULL,
+			token_version = token_version + 1
+		WHERE password_reset_token = $2 AND password_reset_expires_at > $3
+	`
+
+	return execOne(ctx, r.db, query, passwordHash, tokenHash, now)
+}
+
+// execOne runs query, in the transaction of ctx if any, and fails with repository.ErrNotFound when it changed
+// no row.
+func execOne(ctx context.Context, db *sqlx.DB, query string, args ...interface{}) error {
+	result, err := database.Conn(ctx, db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func translateError(err error) error {
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	if database.IsUniqueViolation(err) {
+		return repository.ErrDuplicate
+	}
+	if database.IsForeignKeyViolation(err) {
+		return repository.ErrInUse
+	}
+	return err
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func openUser(user *entity.User) error {
+	return user.PhoneNumber.Open("users", "phone_number", user.UserID)
+}
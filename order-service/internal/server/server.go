@@ -0,0 +1,171 @@
+// Package server mounts the handlers of the api on their routes, behind the
+// middlewares each route needs.
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/email"
+	"github.com/mathesukkj/goecommerce/order-service/internal/handler"
+	"github.com/mathesukkj/goecommerce/order-service/internal/health"
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+	"github.com/mathesukkj/goecommerce/order-service/internal/middleware"
+	"github.com/mathesukkj/goecommerce/order-service/internal/migrate"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/sqlrepo"
+	"github.com/mathesukkj/goecommerce/order-service/internal/service"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+	"github.com/mathesukkj/goecommerce/order-service/migrations"
+)
+
+// router registers routes on mux bounded by the timeouts of their pattern,
+// and traced, logged and measured under it.
+type router struct {
+	mux      *http.ServeMux
+	timeouts middleware.Timeouts
+	patterns map[string]bool
+}
+
+func (r router) handle(pattern string, h http.HandlerFunc) {
+	r.patterns[pattern] = true
+	r.mux.HandleFunc(pattern, middleware.Trace(pattern, middleware.AccessLog(pattern, middleware.Measure(pattern, r.timeouts.Wrap(pattern, h)))))
+}
+
+// New returns the api, the routes of the features turned off in cfg are left
+// out. The probes are served by readiness, with the checks of the database,
+// its migrations and the payment gateway added to it. Mail delivers the
+// password reset tokens.
+func New(cfg *config.Config, db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway, mail email.Sender, readiness *health.Checker) http.Handler {
+	ttls := service.TokenTTLs{
+		Session:       cfg.Auth.TokenTTL,
+		Impersonation: cfg.Auth.ImpersonationTokenTTL,
+		PasswordReset: cfg.Auth.PasswordResetTokenTTL,
+	}
+
+	// only checks the accounts are active, it sends no mail
+	users := service.NewUserService(sqlrepo.NewUserRepository(db), ttls, nil)
+	audits := service.NewImpersonationAuditService(db)
+	keys := service.NewIdempotencyService(db)
+
+	// authenticated routes, their writes can be retried with an
+	// Idempotency-Key
+	auth := func(h http.HandlerFunc) http.HandlerFunc {
+		return middleware.JwtUserId(users, middleware.AuditImpersonation(audits, middleware.Idempotent(keys, h)))
+	}
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return auth(middleware.RequireAdmin(h))
+	}
+
+	r := router{
+		mux:      http.NewServeMux(),
+		timeouts: middleware.Timeouts{Default: cfg.Server.RequestTimeout, Routes: cfg.Server.RouteTimeouts},
+		patterns: map[string]bool{},
+	}
+
+	readiness.Add("database", db.PingContext)
+	readiness.Add("migrations", migrationsCheck(db))
+	if pinger, ok := gateway.(payment.Pinger); ok {
+		readiness.Add("payment_gateway", pinger.Ping)
+	}
+	r.handle("GET /healthz", readiness.Live)
+	r.handle("GET /readyz", readiness.Ready)
+	r.handle("GET /metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}).ServeHTTP)
+
+	userHandler := handler.NewUserHandler(db, ttls)
+	if cfg.Features.Signup {
+		r.handle("POST /signup", userHandler.Signup)
+	}
+	r.handle("POST /login", userHandler.Login)
+	r.handle("POST /password-reset", userHandler.ResetPassword)
+	r.handle("GET /users/me", auth(userHandler.GetLoggedInUser))
+	r.handle("PUT /users/me", auth(userHandler.UpdateUser))
+
+	addressHandler := handler.NewAddressHandler(db)
+	r.handle("GET /addresses", auth(addressHandler.ListUserAddresses))
+	r.handle("POST /addresses", auth(addressHandler.CreateAddress))
+	r.handle("GET /addresses/{address_id}", auth(addressHandler.GetAddressByID))
+	r.handle("PUT /addresses/{address_id}", auth(addressHandler.UpdateAddress))
+	r.handle("DELETE /addresses/{address_id}", auth(addressHandler.DeleteAddress))
+
+	paymentMethodHandler := handler.NewPaymentMethodHandler(db, cardVault)
+	r.handle("GET /payment-methods", auth(paymentMethodHandler.ListUserPaymentMethods))
+	r.handle("POST /payment-methods", auth(paymentMethodHandler.CreatePaymentMethod))
+	r.handle("GET /payment-methods/{payment_method_id}", auth(paymentMethodHandler.GetPaymentMethodByID))
+	r.handle("PUT /payment-methods/{payment_method_id}", auth(paymentMethodHandler.UpdatePaymentMethod))
+	r.handle("DELETE /payment-methods/{payment_method_id}", auth(paymentMethodHandler.DeletePaymentMethod))
+
+	orderHandler := handler.NewOrderHandler(db)
+	r.handle("GET /orders", auth(orderHandler.ListOrders))
+
+	paymentHandler := handler.NewPaymentHandler(db, cardVault, gateway)
+	r.handle("POST /orders/{order_id}/payments", auth(paymentHandler.PayOrder))
+	r.handle("GET /orders/{order_id}/payments", auth(paymentHandler.ListOrderPayments))
+
+	cancellationHandler := handler.NewCancellationHandler(db, cardVault, gateway, cfg.Orders.CancellationWindow)
+	r.handle("POST /orders/{order_id}/cancel", auth(cancellationHandler.CancelOrder))
+
+	refundHandler := handler.NewRefundHandler(db, cardVault, gateway)
+	r.handle("POST /orders/{order_id}/refunds", admin(refundHandler.CreateRefund))
+	r.handle("GET /orders/{order_id}/refunds", admin(refundHandler.ListOrderRefunds))
+
+	if cfg.Features.Returns {
+		returnHandler := handler.NewReturnHandler(db, cardVault, gateway, cfg.Orders.ReturnWindow)
+		r.handle("POST /orders/{order_id}/returns", auth(returnHandler.RequestReturn))
+		r.handle("GET /orders/{order_id}/returns", auth(returnHandler.ListOrderReturns))
+		r.handle("GET /returns/{return_id}", auth(returnHandler.GetReturn))
+		r.handle("POST /returns/{return_id}/approve", admin(returnHandler.ApproveReturn))
+		r.handle("POST /returns/{return_id}/reject", admin(returnHandler.RejectReturn))
+		r.handle("POST /returns/{return_id}/receive", admin(returnHandler.ReceiveReturn))
+	}
+
+	adminUserHandler := handler.NewAdminUserHandler(db, cardVault, ttls, mail)
+	r.handle("GET /admin/users", admin(adminUserHandler.SearchUsers))
+	r.handle("GET /admin/users/{user_id}", admin(adminUserHandler.GetUser))
+	r.handle("GET /admin/users/{user_id}/addresses", admin(adminUserHandler.ListUserAddresses))
+	r.handle("GET /admin/users/{user_id}/payment-methods", admin(adminUserHandler.ListUserPaymentMethods))
+	r.handle("GET /admin/users/{user_id}/orders", admin(adminUserHandler.ListUserOrders))
+	r.handle("POST /admin/users/{user_id}/disable", admin(adminUserHandler.DisableUser))
+	r.handle("POST /admin/users/{user_id}/enable", admin(adminUserHandler.EnableUser))
+	r.handle("POST /admin/users/{user_id}/password-reset", admin(adminUserHandler.ForcePasswordReset))
+	if cfg.Features.Impersonation {
+		r.handle("POST /admin/users/{user_id}/impersonate", admin(adminUserHandler.ImpersonateUser))
+		r.handle("GET /admin/users/{user_id}/impersonations", admin(adminUserHandler.ListUserImpersonations))
+	}
+
+	if cfg.Features.Webhooks {
+		secrets := make(map[string][]byte, len(cfg.Payments.WebhookSecrets))
+		for provider, secret := range cfg.Payments.WebhookSecrets {
+			secrets[provider] = []byte(secret)
+		}
+		webhookHandler := handler.NewWebhookHandler(db, secrets)
+		r.handle("POST /webhooks/payments/{provider}", webhookHandler.ReceivePaymentEvent)
+	}
+
+	for pattern := range cfg.Server.RouteTimeouts {
+		if !r.patterns[pattern] {
+			// a typo, or the route of a feature turned off
+			slog.Warn("timeout of a route not served", "pattern", pattern)
+		}
+	}
+
+	return middleware.RequestID(middleware.CORS(cfg.CORS.AllowedOrigins, r.mux))
+}
+
+// migrationsCheck fails while the database isn't at the version of the
+// migrations embedded in the binary.
+func migrationsCheck(db *sqlx.DB) health.Check {
+	migrator, err := migrate.New(db, migrations.For(database.DialectOf(db)))
+	return func(ctx context.Context) error {
+		if err != nil {
+			return err
+		}
+		return migrator.Current(ctx)
+	}
+}
@@ -0,0 +1,348 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/email"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/health"
+	"github.com/mathesukkj/goecommerce/order-service/internal/jwtauth"
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+	"github.com/mathesukkj/goecommerce/order-service/pkg/testutils"
+)
+
+func TestMain(m *testing.M) {
+	keyring, err := fieldcrypt.NewKeyring(1, map[int][]byte{1: bytes.Repeat([]byte{0x01}, 32)})
+	if err != nil {
+		panic(err)
+	}
+	fieldcrypt.SetKeyring(keyring)
+	jwtauth.SetSecret([]byte("test_secret"))
+
+	os.Exit(m.Run())
+}
+
+// newServer serves the api on a fresh SQLite database, configured by
+// configure.
+func newServer(t *testing.T, configure func(cfg *config.Config)) http.Handler {
+	t.Helper()
+
+	return newServerOn(t, newDB(t), configure)
+}
+
+// newServerOn is newServer on db.
+func newServerOn(t *testing.T, db *sqlx.DB, configure func(cfg *config.Config)) http.Handler {
+	t.Helper()
+
+	cardVault, err := vault.NewLocalVault(db, bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+
+	cfg := config.Default()
+	if configure != nil {
+		configure(&cfg)
+	}
+	return New(&cfg, db, cardVault, payment.NewFakeGateway(), email.NewFakeSender(), health.NewChecker(cfg.Server.HealthCheckTimeout))
+}
+
+func newDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db := testutils.NewSQLiteDB(filepath.Join(t.TempDir(), "orders.db"))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func serve(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+const signupBody = `{"username":"john","password":"password123","email":"john@example.com","first_name":"John","last_name":"Doe","phone_number":"555-0100"}`
+
+func TestRoutes(t *testing.T) {
+	h := newServer(t, nil)
+
+	rr := serve(h, http.MethodPost, "/signup", "", signupBody)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = serve(h, http.MethodPost, "/login", "", `{"email":"john@example.com","password":"password123"}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var login struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&login))
+
+	rr = serve(h, http.MethodGet, "/users/me", login.Token, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"username":"john"`)
+
+	rr = serve(h, http.MethodGet, "/users/me", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "without a token")
+
+	rr = serve(h, http.MethodGet, "/admin/users", login.Token, "")
+	assert.Equal(t, http.StatusForbidden, rr.Code, "admin route for a customer")
+
+	rr = serve(h, http.MethodGet, "/orders", login.Token, "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+func TestFeatures(t *testing.T) {
+	h := newServer(t, func(cfg *config.Config) {
+		cfg.Features.Signup = false
+		cfg.Features.Returns = false
+	})
+
+	rr := serve(h, http.MethodPost, "/signup", "", signupBody)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "signup turned off")
+
+	rr = serve(h, http.MethodPost, "/orders/1/returns", "", `{}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "returns turned off")
+
+	rr = serve(h, http.MethodPost, "/webhooks/payments/fake", "", `{}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "webhooks off by default")
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	h := newServer(t, func(cfg *config.Config) {
+		cfg.Server.RouteTimeouts = map[string]time.Duration{"GET /orders": time.Nanosecond}
+	})
+	token := signup(t, h, "john")
+
+	rr := serve(h, http.MethodGet, "/orders", token, "")
+	assert.NotEqual(t, http.StatusOK, rr.Code, "the route timed out")
+
+	rr = serve(h, http.MethodGet, "/users/me", token, "")
+	assert.Equal(t, http.StatusOK, rr.Code, "the other routes use the request timeout")
+}
+
+func TestCORS(t *testing.T) {
+	h := newServer(t, func(cfg *config.Config) {
+		cfg.CORS.AllowedOrigins = []string{"https://shop.example.com"}
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/orders", nil)
+	req.Header.Set("Origin", "https://shop.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://shop.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestProbes(t *testing.T) {
+	db := newDB(t)
+	readiness := health.NewChecker(time.Second)
+	cfg := config.Default()
+	cardVault, err := vault.NewLocalVault(db, bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+	h := New(&cfg, db, cardVault, payment.NewFakeGateway(), email.NewFakeSender(), readiness)
+
+	rr := serve(h, http.MethodGet, "/healthz", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serve(h, http.MethodGet, "/readyz", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var report health.Report
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.ElementsMatch(t, []string{"database", "migrations", "payment_gateway"}, keys(report.Checks))
+
+	db.MustExec("DELETE FROM schema_migrations")
+	rr = serve(h, http.MethodGet, "/readyz", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	report = health.Report{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+	assert.Equal(t, health.StatusFailing, report.Checks["migrations"].Status)
+	assert.Equal(t, health.ErrorCheckFailed, report.Checks["migrations"].Error, "the error should only be logged")
+
+	readiness.Drain()
+	rr = serve(h, http.MethodGet, "/readyz", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status":"draining"}`, rr.Body.String())
+}
+
+func keys(checks map[string]health.CheckResult) []string {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestMetrics(t *testing.T) {
+	h := newServer(t, nil)
+
+	rr := serve(h, http.MethodPost, "/signup", "", signupBody)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = serve(h, http.MethodPost, "/login", "", `{"email":"john@example.com","password":"wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, rr.Body.String())
+
+	rr = serve(h, http.MethodGet, "/metrics", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	for _, want := range []string{
+		`order_service_http_requests_total{route="POST /signup",status="200"}`,
+		`order_service_http_requests_total{route="POST /login",status="401"}`,
+		`order_service_http_request_duration_seconds_bucket{route="POST /signup",status="200",le="+Inf"}`,
+		`order_service_db_query_duration_seconds_count{method="UserService.CreateUser"}`,
+		`order_service_db_query_duration_seconds_count{method="UserService.Login"}`,
+		`order_service_signups_total`,
+		`order_service_logins_total{result="failed"}`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, body, want)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	h := newServer(t, nil)
+
+	rr := serve(h, http.MethodPost, "/signup", "", signupBody)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	byName := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range spans.Ended() {
+		byName[span.Name()] = span
+	}
+	request, signup, createUser, insert := byName["POST /signup"], byName["UserService.Signup"], byName["UserService.CreateUser"], byName["INSERT"]
+	if !assert.NotNil(t, request) || !assert.NotNil(t, signup) || !assert.NotNil(t, createUser) || !assert.NotNil(t, insert) {
+		return
+	}
+	assert.Equal(t, request.SpanContext().SpanID(), signup.Parent().SpanID())
+	assert.Equal(t, signup.SpanContext().SpanID(), createUser.Parent().SpanID())
+	assert.Equal(t, createUser.SpanContext().SpanID(), insert.Parent().SpanID())
+	assert.Equal(t, request.SpanContext().TraceID(), insert.SpanContext().TraceID())
+}
+
+func TestLogging(t *testing.T) {
+	var logs bytes.Buffer
+	logger, _ := logging.New(&logs, logging.FormatJSON, slog.LevelInfo)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	h := newServer(t, nil)
+
+	rr := serve(h, http.MethodPost, "/signup", "", signupBody)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var signup struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&signup))
+	logs.Reset()
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+signup.Token)
+	req.Header.Set("X-Request-ID", "request-1")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "request-1", rr.Header().Get("X-Request-ID"))
+
+	var access map[string]any
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &access), logs.String())
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "request-1", access["request_id"])
+	assert.Equal(t, "GET /users/me", access["route"])
+	assert.Equal(t, float64(1), access["user_id"])
+	assert.Equal(t, float64(http.StatusOK), access["status"])
+	assert.NotContains(t, logs.String(), signup.Token)
+}
+
+// signup signs up username and returns its token.
+func signup(t *testing.T, h http.Handler, username string) string {
+	t.Helper()
+
+	body := `{"username":"` + username + `","password":"password123","email":"` + username + `@example.com","first_name":"John","last_name":"Doe","phone_number":"555-0100"}`
+	rr := serve(h, http.MethodPost, "/signup", "", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("failed to sign up %s: %s", username, rr.Body.String())
+	}
+
+	var response struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	return response.Token
+}
+
+func TestWritesOfAnotherUser(t *testing.T) {
+	h := newServer(t, nil)
+	owner, other := signup(t, h, "john"), signup(t, h, "jane")
+
+	address := `{"street_address":"123 Main St","city":"Anytown","state":"CA","postal_code":"12345","country":"USA"}`
+	rr := serve(h, http.MethodPost, "/addresses", owner, address)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	paymentMethod := `{"card_number":"4242424242424242","expiration_date":"12/40","card_holder_name":"John Doe"}`
+	rr = serve(h, http.MethodPost, "/payment-methods", owner, paymentMethod)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	for _, write := range []struct{ method, path, body string }{
+		{http.MethodPut, "/addresses/1", address},
+		{http.MethodDelete, "/addresses/1", ""},
+		{http.MethodPut, "/payment-methods/1", paymentMethod},
+		{http.MethodDelete, "/payment-methods/1", ""},
+	} {
+		rr = serve(h, write.method, write.path, other, write.body)
+		assert.Equal(t, http.StatusNotFound, rr.Code, "%s %s by another user", write.method, write.path)
+	}
+
+	rr = serve(h, http.MethodGet, "/addresses/1", owner, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Anytown")
+	rr = serve(h, http.MethodGet, "/payment-methods/1", owner, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "4242")
+}
+
+func TestReturnOfAnotherUser(t *testing.T) {
+	db := newDB(t)
+	h := newServerOn(t, db, nil)
+	owner, other := signup(t, h, "john"), signup(t, h, "jane")
+
+	db.MustExec("INSERT INTO products (product_name, price, stock_quantity) VALUES ('Mug', 500, 10)")
+	db.MustExec("INSERT INTO orders (user_id, total_amount, order_status, delivered_at) VALUES (1, 500, 'delivered', strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))")
+	db.MustExec("INSERT INTO order_items (order_id, product_id, quantity, price_per_unit) VALUES (1, 1, 1, 500)")
+	rr := serve(h, http.MethodPost, "/orders/1/returns", owner, `{"items":[{"order_item_id":1,"quantity":1,"reason_code":"damaged"}]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	rr = serve(h, http.MethodGet, "/returns/1", other, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "damaged")
+
+	rr = serve(h, http.MethodGet, "/returns/1", owner, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "damaged")
+}
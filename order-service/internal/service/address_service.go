@@ -1,133 +1,106 @@
 package service
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 
-	"github.com/jmoiron/sqlx"
-
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
 	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
 )
 
 type AddressService struct {
-	db *sqlx.DB
+	addresses repository.AddressRepository
 }
 
 var (
 	ErrAddressNotFound = errors.New("address not found")
 )
 
-func NewAddressService(db *sqlx.DB) *AddressService {
-	return &AddressService{db: db}
-}
+// AddressListSpec is what ListUserAddresses can be sorted and filtered by,
+// the other columns are encrypted.
+var AddressListSpec = repository.AddressListSpec
 
-func (s *AddressService) ListUserAddresses(userID int) ([]entity.Address, error) {
-	query := `SELECT address_id, user_id, street_address, city, state, postal_code, country FROM addresses WHERE user_id = $1`
+func NewAddressService(addresses repository.AddressRepository) *AddressService {
+	return &AddressService{addresses: addresses}
+}
 
-	var addresses []entity.Address
-	rows, err := s.db.Queryx(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var address entity.Address
-		if err := rows.StructScan(&address); err != nil {
-			return nil, err
-		}
-		addresses = append(addresses, address)
-	}
+func (s *AddressService) ListUserAddresses(ctx context.Context, userID int, q listquery.Query) (listquery.Page[entity.Address], error) {
+	ctx, span := startOperation(ctx, "AddressService.ListUserAddresses")
+	defer span.End()
 
-	return addresses, nil
+	return s.addresses.ListByUser(ctx, userID, q)
 }
 
-func (s *AddressService) GetAddressByID(addressID, userID int) (*entity.Address, error) {
-	query := `SELECT address_id, street_address, city, state, postal_code, country  FROM addresses WHERE address_id = $1 AND user_id = $2`
+func (s *AddressService) GetAddressByID(ctx context.Context, addressID, userID int) (*entity.Address, error) {
+	ctx, span := startOperation(ctx, "AddressService.GetAddressByID")
+	defer span.End()
 
-	var address entity.Address
-	if err := s.db.QueryRowx(query, addressID, userID).StructScan(&address); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrAddressNotFound
-		}
+	address, err := s.addresses.FindByID(ctx, addressID, userID)
+	if err == repository.ErrNotFound {
+		return nil, ErrAddressNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	return &address, nil
+	return address, nil
 }
 
 func (s *AddressService) CreateAddress(
+	ctx context.Context,
 	address dto.AddressPayload,
 	userId int,
 ) (*entity.Address, error) {
-	query := `
-		INSERT INTO addresses (user_id, street_address, city, state, postal_code, country)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING address_id, user_id, street_address, city, state, postal_code, country
-	`
-
-	var createdAddress entity.Address
-	if err := s.db.QueryRowx(
-		query,
-		userId,
-		address.StreetAddress,
-		address.City,
-		address.State,
-		address.PostalCode,
-		address.Country,
-	).StructScan(&createdAddress); err != nil {
-		return nil, err
-	}
-
-	return &createdAddress, nil
+	ctx, span := startOperation(ctx, "AddressService.CreateAddress")
+	defer span.End()
+
+	return s.addresses.Create(ctx, entity.Address{
+		UserID:        userId,
+		StreetAddress: fieldcrypt.EncryptedString(address.StreetAddress),
+		City:          fieldcrypt.EncryptedString(address.City),
+		State:         fieldcrypt.EncryptedString(address.State),
+		PostalCode:    fieldcrypt.EncryptedString(address.PostalCode),
+		Country:       address.Country,
+	})
 }
 
 func (s *AddressService) UpdateAddress(
+	ctx context.Context,
 	addressID int,
 	address dto.AddressPayload,
+	userID int,
 ) (*entity.Address, error) {
-	query := `
-		UPDATE addresses
-		SET street_address = $1, city = $2, state = $3, postal_code = $4, country = $5
-		WHERE address_id = $6
-		RETURNING address_id, user_id, street_address, city, state, postal_code, country
-	`
-
-	var updatedAddress entity.Address
-	if err := s.db.QueryRowx(
-		query,
-		address.StreetAddress,
-		address.City,
-		address.State,
-		address.PostalCode,
-		address.Country,
-		addressID,
-	).StructScan(&updatedAddress); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrAddressNotFound
-		}
+	ctx, span := startOperation(ctx, "AddressService.UpdateAddress")
+	defer span.End()
+
+	updatedAddress, err := s.addresses.Update(ctx, entity.Address{
+		AddressID:     addressID,
+		UserID:        userID,
+		StreetAddress: fieldcrypt.EncryptedString(address.StreetAddress),
+		City:          fieldcrypt.EncryptedString(address.City),
+		State:         fieldcrypt.EncryptedString(address.State),
+		PostalCode:    fieldcrypt.EncryptedString(address.PostalCode),
+		Country:       address.Country,
+	})
+	if err == repository.ErrNotFound {
+		return nil, ErrAddressNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	return &updatedAddress, nil
+	return updatedAddress, nil
 }
 
-func (s *AddressService) DeleteAddress(addressID int) error {
-	query := `DELETE FROM addresses WHERE address_id = $1`
-
-	result, err := s.db.Exec(query, addressID)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+func (s *AddressService) DeleteAddress(ctx context.Context, addressID, userID int) error {
+	ctx, span := startOperation(ctx, "AddressService.DeleteAddress")
+	defer span.End()
 
-	if rowsAffected == 0 {
+	if err := s.addresses.Delete(ctx, addressID, userID); err == repository.ErrNotFound {
 		return ErrAddressNotFound
+	} else if err != nil {
+		return err
 	}
 
 	return nil
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+type CancellationService struct {
+	db       *sqlx.DB
+	tx       *database.TxManager
+	payments *PaymentService
+	refunds  *RefundService
+	window   time.Duration
+}
+
+var (
+	ErrOrderAlreadyShipped      = errors.New("order already shipped")
+	ErrCancellationWindowClosed = errors.New("order can no longer be cancelled")
+)
+
+func NewCancellationService(db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway, window time.Duration) *CancellationService {
+	return &CancellationService{
+		db:       db,
+		tx:       database.NewTxManager(db, nil),
+		payments: NewPaymentService(db, cardVault, gateway),
+		refunds:  NewRefundService(db, cardVault, gateway),
+		window:   window,
+	}
+}
+
+// CancelOrder cancels an order of userID that was not fulfilled yet. An
+// authorized payment is voided and a captured one refunded in full, see
+// RefundService.RefundCancelledOrder, before the ordered quantities are put
+// back in stock. An order whose authorization, capture or refund is still
+// pending at the gateway cannot be cancelled until the outcome is known,
+// unless the refund is the one an earlier attempt to cancel it made, which
+// is resumed.
+func (s *CancellationService) CancelOrder(ctx context.Context, orderID, userID int, reason string) error {
+	ctx, span := startOperation(ctx, "CancellationService.CancelOrder")
+	defer span.End()
+
+	windowQuery := `SELECT order_date >= CURRENT_TIMESTAMP - $2 * INTERVAL '1 second' FROM orders WHERE order_id = $1`
+
+	// the order stays locked while it is checked, so no payment operation
+	// starts meanwhile, and an order with no payment yet is cancelled before
+	// the lock is released
+	var status string
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		order, err := s.payments.getOrder(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.UserID != userID {
+			return ErrOrderNotFound
+		}
+
+		var pending string
+		switch order.OrderStatus {
+		case entity.OrderStatusPendingPayment, entity.OrderStatusPaymentFailed:
+			pending = entity.PaymentOperationAuthorize
+		case entity.OrderStatusAuthorized:
+			pending = entity.PaymentOperationCapture
+		case entity.OrderStatusPaid:
+		case entity.OrderStatusShipped, entity.OrderStatusDelivered:
+			return ErrOrderAlreadyShipped
+		default:
+			return ErrInvalidOrderStatus
+		}
+
+		// an earlier attempt that got as far as the refund was made in time
+		// and goes on, even when the refund was settled meanwhile
+		if order.OrderStatus == entity.OrderStatusPaid {
+			refund, _, err := s.refunds.findCancellationRefund(ctx, orderID)
+			if err != nil {
+				return err
+			}
+			if refund != nil {
+				status = entity.OrderStatusPaid
+				return nil
+			}
+			if order.RefundStatus != entity.RefundStatusNone {
+				return ErrInvalidOrderStatus
+			}
+			pending = entity.PaymentOperationRefund
+		}
+
+		var withinWindow bool
+		if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, windowQuery, orderID, int(s.window.Seconds())).Scan(&withinWindow); err != nil {
+			return err
+		}
+		if !withinWindow {
+			return ErrCancellationWindowClosed
+		}
+
+		if pending != "" {
+			if _, err := s.payments.findPayment(ctx, orderID, pending, entity.PaymentStatusPending); err == nil {
+				return ErrPaymentPending
+			} else if err != ErrPaymentNotFound {
+				return err
+			}
+		}
+
+		status = order.OrderStatus
+		if status == entity.OrderStatusPendingPayment || status == entity.OrderStatusPaymentFailed {
+			return s.cancel(ctx, orderID, reason)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case entity.OrderStatusAuthorized:
+		if _, err := s.payments.VoidOrder(ctx, orderID); err != nil {
+			return err
+		}
+	case entity.OrderStatusPaid:
+		if _, err := s.refunds.RefundCancelledOrder(ctx, orderID, userID); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	// the payment is already voided or refunded, the order is cancelled even
+	// when the request went away meanwhile
+	return s.tx.WithinTx(context.WithoutCancel(ctx), func(ctx context.Context) error {
+		return s.cancel(ctx, orderID, reason)
+	})
+}
+
+// cancel marks the order cancelled and releases its stock, in the
+// transaction of ctx, once only even when two cancellations race past the
+// payment step.
+func (s *CancellationService) cancel(ctx context.Context, orderID int, reason string) error {
+	cancelQuery := `
+		UPDATE orders SET order_status = $1, cancellation_reason = $2, cancelled_at = CURRENT_TIMESTAMP
+		WHERE order_id = $3 AND order_status <> $1
+	`
+	releaseQuery := `
+		UPDATE products AS p SET stock_quantity = p.stock_quantity + oi.quantity
+		FROM (SELECT product_id, SUM(quantity) AS quantity FROM order_items WHERE order_id = $1 GROUP BY product_id) oi
+		WHERE oi.product_id = p.product_id
+	`
+
+	tx := database.Conn(ctx, s.db)
+
+	result, err := tx.ExecContext(ctx, cancelQuery, entity.OrderStatusCancelled, reason, orderID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrInvalidOrderStatus
+	}
+
+	_, err = tx.ExecContext(ctx, releaseQuery, orderID)
+	return err
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+)
+
+var (
+	cancellationWindowQuery = `SELECT order_date >= CURRENT_TIMESTAMP - $2 * INTERVAL '1 second' FROM orders WHERE order_id = $1`
+	cancelOrderQuery        = `
+		UPDATE orders SET order_status = $1, cancellation_reason = $2, cancelled_at = CURRENT_TIMESTAMP
+		WHERE order_id = $3 AND order_status <> $1
+	`
+	releaseStockQuery = `
+		UPDATE products AS p SET stock_quantity = p.stock_quantity + oi.quantity
+		FROM (SELECT product_id, SUM(quantity) AS quantity FROM order_items WHERE order_id = $1 GROUP BY product_id) oi
+		WHERE oi.product_id = p.product_id
+	`
+)
+
+func setupCancellationService(t *testing.T) (*CancellationService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	cancellationService := NewCancellationService(sqlx.NewDb(db, "postgres"), newFakeVault(), payment.NewFakeGateway(), config.Default().Orders.CancellationWindow)
+	return cancellationService, mock
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          string
+		refundStatus    string
+		userID          int
+		withinWindow    bool
+		pendingAttempts bool
+		wantErr         error
+	}{
+		{
+			name:         "pending payment",
+			status:       entity.OrderStatusPendingPayment,
+			userID:       1,
+			withinWindow: true,
+			wantErr:      nil,
+		},
+		{
+			name:         "order of another user",
+			status:       entity.OrderStatusPendingPayment,
+			userID:       2,
+			withinWindow: true,
+			wantErr:      ErrOrderNotFound,
+		},
+		{
+			name:         "shipped",
+			status:       entity.OrderStatusShipped,
+			userID:       1,
+			withinWindow: true,
+			wantErr:      ErrOrderAlreadyShipped,
+		},
+		{
+			name:         "shipped and partially refunded",
+			status:       entity.OrderStatusShipped,
+			refundStatus: entity.RefundStatusPartiallyRefunded,
+			userID:       1,
+			withinWindow: true,
+			wantErr:      ErrOrderAlreadyShipped,
+		},
+		{
+			name:         "already cancelled",
+			status:       entity.OrderStatusCancelled,
+			userID:       1,
+			withinWindow: true,
+			wantErr:      ErrInvalidOrderStatus,
+		},
+		{
+			name:         "window closed",
+			status:       entity.OrderStatusPendingPayment,
+			userID:       1,
+			withinWindow: false,
+			wantErr:      ErrCancellationWindowClosed,
+		},
+		{
+			name:            "authorization pending at the gateway",
+			status:          entity.OrderStatusPaymentFailed,
+			userID:          1,
+			withinWindow:    true,
+			pendingAttempts: true,
+			wantErr:         ErrPaymentPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cancellationService, mock := setupCancellationService(t)
+
+			mock.ExpectBegin()
+			expectRefundedOrder(mock, tt.status, tt.refundStatus)
+			if tt.wantErr == ErrOrderNotFound || tt.wantErr == ErrOrderAlreadyShipped || tt.wantErr == ErrInvalidOrderStatus {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectQuery(regexp.QuoteMeta(cancellationWindowQuery)).
+					WithArgs(1, int(config.Default().Orders.CancellationWindow.Seconds())).
+					WillReturnRows(sqlmock.NewRows([]string{"within_window"}).AddRow(tt.withinWindow))
+			}
+			if tt.withinWindow && (tt.wantErr == nil || tt.wantErr == ErrPaymentPending) {
+				rows := sqlmock.NewRows(paymentColumnNames)
+				if tt.pendingAttempts {
+					rows.AddRow(1, 1, entity.PaymentOperationAuthorize, 1000, entity.PaymentStatusPending, "fake", "USD", "pay_1", "", "", "2024-01-01T00:00:00Z")
+				}
+				mock.ExpectQuery(regexp.QuoteMeta(findPaymentQuery)).
+					WithArgs(1, entity.PaymentOperationAuthorize, entity.PaymentStatusPending).
+					WillReturnRows(rows)
+			}
+			switch {
+			case tt.wantErr == nil:
+				mock.ExpectExec(regexp.QuoteMeta(cancelOrderQuery)).
+					WithArgs(entity.OrderStatusCancelled, "changed my mind", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(releaseStockQuery)).
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			case tt.wantErr == ErrCancellationWindowClosed || tt.wantErr == ErrPaymentPending:
+				mock.ExpectRollback()
+			}
+
+			err := cancellationService.CancelOrder(context.Background(), 1, tt.userID, "changed my mind")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCancelOrderConcurrentCancellation(t *testing.T) {
+	cancellationService, mock := setupCancellationService(t)
+
+	mock.ExpectBegin()
+	expectOrder(mock, entity.OrderStatusPendingPayment)
+	mock.ExpectQuery(regexp.QuoteMeta(cancellationWindowQuery)).
+		WithArgs(1, int(config.Default().Orders.CancellationWindow.Seconds())).
+		WillReturnRows(sqlmock.NewRows([]string{"within_window"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta(findPaymentQuery)).
+		WithArgs(1, entity.PaymentOperationAuthorize, entity.PaymentStatusPending).
+		WillReturnRows(sqlmock.NewRows(paymentColumnNames))
+	mock.ExpectExec(regexp.QuoteMeta(cancelOrderQuery)).
+		WithArgs(entity.OrderStatusCancelled, "changed my mind", 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := cancellationService.CancelOrder(context.Background(), 1, 1, "changed my mind")
+	assert.ErrorIs(t, err, ErrInvalidOrderStatus, "stock must be released only once")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+type CardTokenizationService struct {
+	db    *sqlx.DB
+	tx    *database.TxManager
+	vault vault.Vault
+}
+
+func NewCardTokenizationService(db *sqlx.DB, vault vault.Vault) *CardTokenizationService {
+	return &CardTokenizationService{db: db, tx: database.NewTxManager(db, nil), vault: vault}
+}
+
+// Tokenize moves the card numbers payment methods stored before the card
+// vault into it, between migrations 0004_card_vault and 0013_drop_card_number,
+// one short transaction of batchSize payment methods at a time, sleeping
+// pause between batches. Each payment method gets its token and last four
+// digits and loses its card number in the transaction that stores the number
+// in the vault. It only returns once no payment method is left holding its
+// number, like KeyRotationService.Rotate.
+func (s *CardTokenizationService) Tokenize(ctx context.Context, batchSize int, pause time.Duration) (int, error) {
+	ctx, span := startOperation(ctx, "CardTokenizationService.Tokenize")
+	defer span.End()
+
+	total := 0
+	for {
+		tokenized, err := s.tokenizeBatch(ctx, batchSize)
+		if err != nil {
+			return total, err
+		}
+		total += tokenized
+
+		// a short batch may only mean the payment methods left were locked
+		if tokenized < batchSize {
+			remaining, err := s.remaining(ctx)
+			if err != nil {
+				return total, err
+			}
+			if remaining == 0 {
+				return total, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+}
+
+// remaining counts the payment methods still holding their card number,
+// locked or not.
+func (s *CardTokenizationService) remaining(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM payment_methods WHERE card_number IS NOT NULL AND card_token = ''`
+
+	var count int
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *CardTokenizationService) tokenizeBatch(ctx context.Context, batchSize int) (int, error) {
+	selectQuery := `
+		SELECT payment_method_id, card_number FROM payment_methods
+		WHERE card_number IS NOT NULL AND card_token = ''
+		ORDER BY payment_method_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	updateQuery := `UPDATE payment_methods SET card_token = $1, card_last4 = $2, card_number = NULL WHERE payment_method_id = $3`
+
+	type card struct {
+		ID     int    `db:"payment_method_id"`
+		Number string `db:"card_number"`
+	}
+
+	var batch []card
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tx := database.Conn(ctx, s.db)
+
+		// a retried transaction starts over
+		batch = nil
+		if err := tx.SelectContext(ctx, &batch, selectQuery, batchSize); err != nil {
+			return err
+		}
+
+		// the vault joins the transaction, a rolled back batch leaves no
+		// token behind
+		for _, c := range batch {
+			token, err := s.vault.Tokenize(ctx, c.Number)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, updateQuery, token, lastFour(c.Number), c.ID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(batch), nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenizeCards(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+	cardVault := newFakeVault()
+	cardTokenizationService := NewCardTokenizationService(sqlx.NewDb(db, "postgres"), cardVault)
+
+	selectQuery := `
+		SELECT payment_method_id, card_number FROM payment_methods
+		WHERE card_number IS NOT NULL AND card_token = ''
+		ORDER BY payment_method_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	updateQuery := `UPDATE payment_methods SET card_token = $1, card_last4 = $2, card_number = NULL WHERE payment_method_id = $3`
+	remainingQuery := `SELECT COUNT(*) FROM payment_methods WHERE card_number IS NOT NULL AND card_token = ''`
+
+	// a full first batch
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"payment_method_id", "card_number"}).
+			AddRow(1, "4111111111111111").
+			AddRow(2, "5555555555554444"))
+	mock.ExpectExec(regexp.QuoteMeta(updateQuery)).
+		WithArgs("tok_1", "1111", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(updateQuery)).
+		WithArgs("tok_2", "4444", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// a short batch while payment method 4 is locked by a request, which
+	// the next batch gets to
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"payment_method_id", "card_number"}).
+			AddRow(3, "378282246310005"))
+	mock.ExpectExec(regexp.QuoteMeta(updateQuery)).
+		WithArgs("tok_3", "0005", 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(remainingQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"payment_method_id", "card_number"}).
+			AddRow(4, "6011111111111117"))
+	mock.ExpectExec(regexp.QuoteMeta(updateQuery)).
+		WithArgs("tok_4", "1117", 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(remainingQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	tokenized, err := cardTokenizationService.Tokenize(context.Background(), 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, tokenized)
+	assert.Equal(t, "4111111111111111", cardVault.pans["tok_1"])
+	assert.Equal(t, "6011111111111117", cardVault.pans["tok_4"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
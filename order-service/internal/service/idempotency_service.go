@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+)
+
+const idempotencyKeyTTL = time.Hour * 24
+
+// ErrIdempotencyLeaseLost is returned when a request stores or releases a key
+// that is no longer leased to it, as when a retry took it over once its lease
+// ran out.
+var ErrIdempotencyLeaseLost = errors.New("idempotency key is no longer leased to the request")
+
+// IdempotencyService stores the responses replayed by
+// middleware.Idempotent.
+type IdempotencyService struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyService(db *sqlx.DB) *IdempotencyService {
+	return &IdempotencyService{db: db}
+}
+
+// BeginRequest reserves key for userID, leased to the caller for lease, and
+// returns the token of the lease, or returns what was stored for it when the
+// key is already in use. Expired keys are reused, and so are the keys of the
+// same request whose lease ran out before it finished, as when the server
+// running it crashed.
+func (s *IdempotencyService) BeginRequest(ctx context.Context, userID int, key, fingerprint string, lease time.Duration) (string, *entity.IdempotencyRecord, error) {
+	ctx, span := startOperation(ctx, "IdempotencyService.BeginRequest")
+	defer span.End()
+
+	reserveQuery := `
+		INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, locked_until, lease_token, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second', $6, CURRENT_TIMESTAMP + $4 * INTERVAL '1 second')
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint,
+			status_code = 0,
+			response_headers = '{}',
+			response_body = NULL,
+			locked_until = EXCLUDED.locked_until,
+			lease_token = EXCLUDED.lease_token,
+			created_at = CURRENT_TIMESTAMP,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+			OR (
+				idempotency_keys.status_code = 0
+				AND idempotency_keys.fingerprint = EXCLUDED.fingerprint
+				AND (idempotency_keys.locked_until IS NULL OR idempotency_keys.locked_until <= CURRENT_TIMESTAMP)
+			)
+		RETURNING user_id
+	`
+	storedQuery := `
+		SELECT fingerprint, status_code, response_headers, COALESCE(response_body, '') AS response_body
+		FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2
+	`
+
+	token, err := newLeaseToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var reserved int
+	err = database.Conn(ctx, s.db).QueryRowxContext(
+		ctx,
+		reserveQuery,
+		userID,
+		key,
+		fingerprint,
+		int(idempotencyKeyTTL.Seconds()),
+		int(lease.Seconds()),
+		token,
+	).Scan(&reserved)
+	if err == nil {
+		return token, nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", nil, err
+	}
+
+	var record struct {
+		entity.IdempotencyRecord
+		ResponseHeaders string `db:"response_headers"`
+	}
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, storedQuery, userID, key).StructScan(&record); err != nil {
+		if err == sql.ErrNoRows {
+			// released between both queries, the caller can simply retry
+			return "", &entity.IdempotencyRecord{Fingerprint: fingerprint}, nil
+		}
+		return "", nil, err
+	}
+	if err := json.Unmarshal([]byte(record.ResponseHeaders), &record.Header); err != nil {
+		return "", nil, err
+	}
+
+	return "", &record.IdempotencyRecord, nil
+}
+
+// CompleteRequest stores the response of the request holding the lease token
+// of key, or returns ErrIdempotencyLeaseLost when another request took the key
+// over meanwhile.
+func (s *IdempotencyService) CompleteRequest(ctx context.Context, userID int, key, token string, statusCode int, header http.Header, body []byte) error {
+	ctx, span := startOperation(ctx, "IdempotencyService.CompleteRequest")
+	defer span.End()
+
+	query := `
+		UPDATE idempotency_keys SET status_code = $1, response_headers = $2, response_body = $3
+		WHERE user_id = $4 AND idempotency_key = $5 AND lease_token = $6 AND status_code = 0
+	`
+
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	result, err := database.Conn(ctx, s.db).ExecContext(ctx, query, statusCode, string(headers), body, userID, key, token)
+	if err != nil {
+		return err
+	}
+	return leaseHeld(result)
+}
+
+// ReleaseRequest frees a key whose request did not complete, so a retry runs
+// the request again. Like CompleteRequest, only the request holding the lease
+// token of key can release it.
+func (s *IdempotencyService) ReleaseRequest(ctx context.Context, userID int, key, token string) error {
+	ctx, span := startOperation(ctx, "IdempotencyService.ReleaseRequest")
+	defer span.End()
+
+	query := `DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2 AND lease_token = $3 AND status_code = 0`
+
+	result, err := database.Conn(ctx, s.db).ExecContext(ctx, query, userID, key, token)
+	if err != nil {
+		return err
+	}
+	return leaseHeld(result)
+}
+
+// leaseHeld returns ErrIdempotencyLeaseLost when the statement of result
+// matched no key still leased to the request.
+func leaseHeld(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrIdempotencyLeaseLost
+	}
+	return nil
+}
+
+// PurgeExpired deletes the keys past their expiry and returns how many were
+// deleted.
+func (s *IdempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	ctx, span := startOperation(ctx, "IdempotencyService.PurgeExpired")
+	defer span.End()
+
+	query := `DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	result, err := database.Conn(ctx, s.db).ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func newLeaseToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+)
+
+func setupIdempotencyService(t *testing.T) (*IdempotencyService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	idempotencyService := NewIdempotencyService(sqlx.NewDb(db, "postgres"))
+	return idempotencyService, mock
+}
+
+func TestBeginRequest(t *testing.T) {
+	reserveQuery := `
+		INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, locked_until, lease_token, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second', $6, CURRENT_TIMESTAMP + $4 * INTERVAL '1 second')
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint,
+			status_code = 0,
+			response_headers = '{}',
+			response_body = NULL,
+			locked_until = EXCLUDED.locked_until,
+			lease_token = EXCLUDED.lease_token,
+			created_at = CURRENT_TIMESTAMP,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+			OR (
+				idempotency_keys.status_code = 0
+				AND idempotency_keys.fingerprint = EXCLUDED.fingerprint
+				AND (idempotency_keys.locked_until IS NULL OR idempotency_keys.locked_until <= CURRENT_TIMESTAMP)
+			)
+		RETURNING user_id
+	`
+	storedQuery := `
+		SELECT fingerprint, status_code, response_headers, COALESCE(response_body, '') AS response_body
+		FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2
+	`
+
+	tests := []struct {
+		name      string
+		expect    func(mock sqlmock.Sqlmock)
+		want      *entity.IdempotencyRecord
+		wantToken bool
+	}{
+		{
+			name: "new key",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(reserveQuery)).
+					WithArgs(1, "key-1", "fp", 86400, 60, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+			},
+			want:      nil,
+			wantToken: true,
+		},
+		{
+			name: "key in use",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(reserveQuery)).
+					WithArgs(1, "key-1", "fp", 86400, 60, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(storedQuery)).
+					WithArgs(1, "key-1").
+					WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status_code", "response_headers", "response_body"}).
+						AddRow("fp", 201, `{"Content-Type":["application/json"]}`, []byte(`{"address_id":1}`)))
+			},
+			want: &entity.IdempotencyRecord{
+				Fingerprint:  "fp",
+				StatusCode:   201,
+				Header:       http.Header{"Content-Type": {"application/json"}},
+				ResponseBody: []byte(`{"address_id":1}`),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idempotencyService, mock := setupIdempotencyService(t)
+			tt.expect(mock)
+
+			token, got, err := idempotencyService.BeginRequest(context.Background(), 1, "key-1", "fp", time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantToken, token != "")
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCompleteRequest(t *testing.T) {
+	query := `
+		UPDATE idempotency_keys SET status_code = $1, response_headers = $2, response_body = $3
+		WHERE user_id = $4 AND idempotency_key = $5 AND lease_token = $6 AND status_code = 0
+	`
+
+	tests := []struct {
+		name    string
+		rows    int64
+		wantErr error
+	}{
+		{name: "lease held", rows: 1},
+		{name: "lease taken over", rows: 0, wantErr: ErrIdempotencyLeaseLost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idempotencyService, mock := setupIdempotencyService(t)
+			mock.ExpectExec(regexp.QuoteMeta(query)).
+				WithArgs(201, `{"Content-Type":["application/json"]}`, []byte(`{"address_id":1}`), 1, "key-1", "lease").
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+
+			err := idempotencyService.CompleteRequest(context.Background(), 1, "key-1", "lease", 201,
+				http.Header{"Content-Type": {"application/json"}}, []byte(`{"address_id":1}`))
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
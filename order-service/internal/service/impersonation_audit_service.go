@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+)
+
+type ImpersonationAuditService struct {
+	db *sqlx.DB
+}
+
+func NewImpersonationAuditService(db *sqlx.DB) *ImpersonationAuditService {
+	return &ImpersonationAuditService{db: db}
+}
+
+func (s *ImpersonationAuditService) RecordImpersonation(ctx context.Context, audit entity.ImpersonationAudit) error {
+	ctx, span := startOperation(ctx, "ImpersonationAuditService.RecordImpersonation")
+	defer span.End()
+
+	query := `
+		INSERT INTO impersonation_audit_log (actor_user_id, user_id, method, path, status_code)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := database.Conn(ctx, s.db).ExecContext(ctx, query, audit.ActorUserID, audit.UserID, audit.Method, audit.Path, audit.StatusCode)
+	return err
+}
+
+func (s *ImpersonationAuditService) ListUserImpersonations(ctx context.Context, userID int) ([]entity.ImpersonationAudit, error) {
+	ctx, span := startOperation(ctx, "ImpersonationAuditService.ListUserImpersonations")
+	defer span.End()
+
+	query := `SELECT audit_id, actor_user_id, user_id, method, path, status_code, created_at FROM impersonation_audit_log WHERE user_id = $1 ORDER BY audit_id DESC`
+
+	var audits []entity.ImpersonationAudit
+	rows, err := database.Conn(ctx, s.db).QueryxContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var audit entity.ImpersonationAudit
+		if err := rows.StructScan(&audit); err != nil {
+			return nil, err
+		}
+		audits = append(audits, audit)
+	}
+
+	return audits, nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+)
+
+func setupImpersonationAuditService(t *testing.T) (*ImpersonationAuditService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	auditService := NewImpersonationAuditService(sqlx.NewDb(db, "postgres"))
+	return auditService, mock
+}
+
+func TestRecordImpersonation(t *testing.T) {
+	auditService, mock := setupImpersonationAuditService(t)
+	query := `
+		INSERT INTO impersonation_audit_log (actor_user_id, user_id, method, path, status_code)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	audit := entity.ImpersonationAudit{
+		ActorUserID: 2,
+		UserID:      1,
+		Method:      "GET",
+		Path:        "/addresses",
+		StatusCode:  200,
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs(audit.ActorUserID, audit.UserID, audit.Method, audit.Path, audit.StatusCode).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := auditService.RecordImpersonation(context.Background(), audit)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListUserImpersonations(t *testing.T) {
+	auditService, mock := setupImpersonationAuditService(t)
+	query := `SELECT audit_id, actor_user_id, user_id, method, path, status_code, created_at FROM impersonation_audit_log WHERE user_id = $1 ORDER BY audit_id DESC`
+
+	rows := sqlmock.NewRows([]string{"audit_id", "actor_user_id", "user_id", "method", "path", "status_code", "created_at"}).
+		AddRow(2, 2, 1, "GET", "/orders", 200, "2024-01-01T00:01:00Z").
+		AddRow(1, 2, 1, "GET", "/addresses", 200, "2024-01-01T00:00:00Z")
+
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(1).WillReturnRows(rows)
+
+	got, err := auditService.ListUserImpersonations(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, "/orders", got[0].Path)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
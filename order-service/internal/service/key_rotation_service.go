@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+)
+
+// piiTable lists the encrypted columns of a table tracked by pii_key_version.
+type piiTable struct {
+	name     string
+	idColumn string
+	columns  []string
+}
+
+var piiTables = []piiTable{
+	{name: "users", idColumn: "user_id", columns: []string{"phone_number"}},
+	{name: "addresses", idColumn: "address_id", columns: []string{"street_address", "city", "state", "postal_code"}},
+}
+
+type KeyRotationService struct {
+	db *sqlx.DB
+	tx *database.TxManager
+}
+
+func NewKeyRotationService(db *sqlx.DB) *KeyRotationService {
+	return &KeyRotationService{db: db, tx: database.NewTxManager(db, nil)}
+}
+
+// Rotate re-encrypts every PII row not yet on the current master key, one
+// short transaction of batchSize rows at a time, sleeping pause between
+// batches so live traffic keeps its share of the database. Rows are read with
+// any key still in the keyring, so the service stays up during a rotation.
+// It only returns once no row is left on an older key, rows locked by
+// requests are retried after the pause. Cancelling ctx stops it after the
+// batch in flight is rolled back.
+func (s *KeyRotationService) Rotate(ctx context.Context, batchSize int, pause time.Duration) (int, error) {
+	ctx, span := startOperation(ctx, "KeyRotationService.Rotate")
+	defer span.End()
+
+	version := fieldcrypt.CurrentKeyVersion()
+	if version == 0 {
+		return 0, fieldcrypt.ErrNoKeyring
+	}
+
+	total := 0
+	for _, table := range piiTables {
+		for {
+			rotated, err := s.rotateBatch(ctx, table, version, batchSize)
+			if err != nil {
+				return total, fmt.Errorf("rotating %s: %w", table.name, err)
+			}
+			total += rotated
+
+			// a short batch may only mean the rows left were locked
+			if rotated < batchSize {
+				remaining, err := s.remaining(ctx, table, version)
+				if err != nil {
+					return total, fmt.Errorf("rotating %s: %w", table.name, err)
+				}
+				if remaining == 0 {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// remaining counts the rows of table not yet on the key version, locked or
+// not.
+func (s *KeyRotationService) remaining(ctx context.Context, table piiTable, version int) (int, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE pii_key_version <> $1`, table.name)
+
+	var count int
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, version).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *KeyRotationService) rotateBatch(ctx context.Context, table piiTable, version, batchSize int) (int, error) {
+	// SKIP LOCKED leaves rows a request is writing right now for a later
+	// batch instead of waiting on them
+	selectQuery := fmt.Sprintf(
+		`SELECT %s, %s FROM %s WHERE pii_key_version <> $1 ORDER BY %s LIMIT $2 FOR UPDATE SKIP LOCKED`,
+		table.idColumn,
+		strings.Join(table.columns, ", "),
+		table.name,
+		table.idColumn,
+	)
+
+	assignments := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		assignments[i] = fmt.Sprintf("%s = $%d", column, i+1)
+	}
+	updateQuery := fmt.Sprintf(
+		`UPDATE %s SET %s, pii_key_version = $%d WHERE %s = $%d`,
+		table.name,
+		strings.Join(assignments, ", "),
+		len(table.columns)+1,
+		table.idColumn,
+		len(table.columns)+2,
+	)
+
+	var batch [][]any
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tx := database.Conn(ctx, s.db)
+
+		rows, err := tx.QueryxContext(ctx, selectQuery, version, batchSize)
+		if err != nil {
+			return err
+		}
+
+		// a retried transaction starts over
+		batch = nil
+		for rows.Next() {
+			var id int
+			values := make([]fieldcrypt.EncryptedString, len(table.columns))
+			fields := make([]fieldcrypt.Field, len(table.columns))
+
+			dest := []any{&id}
+			for i, column := range table.columns {
+				fields[i] = fieldcrypt.Field{Column: column, Value: &values[i]}
+				dest = append(dest, &values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+
+			args, err := rotateRow(table.name, id, fields)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, append(args, version, id))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, args := range batch {
+			if _, err := tx.ExecContext(ctx, updateQuery, args...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(batch), nil
+}
+
+// rotateRow opens the fields read from the row of table with primary key id
+// and seals them again with the current master key.
+func rotateRow(table string, id int, fields []fieldcrypt.Field) ([]any, error) {
+	if err := fieldcrypt.OpenRow(table, id, fields...); err != nil {
+		return nil, err
+	}
+	return fieldcrypt.SealRow(table, id, fields...)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+)
+
+func setupKeyRotationService(t *testing.T) (*KeyRotationService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	keyRotationService := NewKeyRotationService(sqlx.NewDb(db, "postgres"))
+	return keyRotationService, mock
+}
+
+func TestRotate(t *testing.T) {
+	keyRotationService, mock := setupKeyRotationService(t)
+	usersQuery := `SELECT user_id, phone_number FROM users WHERE pii_key_version <> $1 ORDER BY user_id LIMIT $2 FOR UPDATE SKIP LOCKED`
+	usersUpdate := `UPDATE users SET phone_number = $1, pii_key_version = $2 WHERE user_id = $3`
+	addressesQuery := `SELECT address_id, street_address, city, state, postal_code FROM addresses WHERE pii_key_version <> $1 ORDER BY address_id LIMIT $2 FOR UPDATE SKIP LOCKED`
+	addressesUpdate := `UPDATE addresses SET street_address = $1, city = $2, state = $3, postal_code = $4, pii_key_version = $5 WHERE address_id = $6`
+	usersLeft := `SELECT COUNT(*) FROM users WHERE pii_key_version <> $1`
+	addressesLeft := `SELECT COUNT(*) FROM addresses WHERE pii_key_version <> $1`
+
+	encrypted, err := fieldcrypt.EncryptedString("9876543210").Seal("users", "phone_number", 2)
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+
+	// a full first batch of users, legacy cleartext and already encrypted,
+	// then an empty one
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(usersQuery)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "phone_number"}).
+			AddRow(1, "1234567890").
+			AddRow(2, encrypted))
+	mock.ExpectExec(regexp.QuoteMeta(usersUpdate)).
+		WithArgs(sealed{"users", "phone_number", 1, "1234567890"}, 1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(usersUpdate)).
+		WithArgs(sealed{"users", "phone_number", 2, "9876543210"}, 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(usersQuery)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "phone_number"}))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(usersLeft)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	// a short batch of addresses while address 2 is locked by a request,
+	// which the next batch gets to
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(addressesQuery)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"address_id", "street_address", "city", "state", "postal_code"}).
+			AddRow(1, "123 Main St", "New York", nil, "10001"))
+	mock.ExpectExec(regexp.QuoteMeta(addressesUpdate)).
+		WithArgs(
+			sealed{"addresses", "street_address", 1, "123 Main St"},
+			sealed{"addresses", "city", 1, "New York"},
+			sealed{"addresses", "state", 1, ""},
+			sealed{"addresses", "postal_code", 1, "10001"},
+			1, 1,
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(addressesLeft)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(addressesQuery)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"address_id", "street_address", "city", "state", "postal_code"}).
+			AddRow(2, "456 Elm St", "Chicago", "IL", "60601"))
+	mock.ExpectExec(regexp.QuoteMeta(addressesUpdate)).
+		WithArgs(
+			sealed{"addresses", "street_address", 2, "456 Elm St"},
+			sealed{"addresses", "city", 2, "Chicago"},
+			sealed{"addresses", "state", 2, "IL"},
+			sealed{"addresses", "postal_code", 2, "60601"},
+			1, 2,
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(addressesLeft)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	rotated, err := keyRotationService.Rotate(context.Background(), 2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, rotated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
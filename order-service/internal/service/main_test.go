@@ -0,0 +1,47 @@
+package service
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"os"
+	"testing"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/jwtauth"
+)
+
+func TestMain(m *testing.M) {
+	keyring, err := fieldcrypt.NewKeyring(1, map[int][]byte{1: bytes.Repeat([]byte{0x01}, 32)})
+	if err != nil {
+		panic(err)
+	}
+	fieldcrypt.SetKeyring(keyring)
+	jwtauth.SetSecret([]byte("test_secret"))
+
+	os.Exit(m.Run())
+}
+
+// sealed matches a query argument that opens to plaintext as column of the
+// row of table with primary key id.
+type sealed struct {
+	table     string
+	column    string
+	id        int
+	plaintext string
+}
+
+func (e sealed) Match(v driver.Value) bool {
+	stored, ok := v.(string)
+	if !ok {
+		return false
+	}
+
+	var value fieldcrypt.EncryptedString
+	if err := value.Scan(stored); err != nil {
+		return false
+	}
+	if err := value.Open(e.table, e.column, e.id); err != nil {
+		return false
+	}
+	return string(value) == e.plaintext && (e.plaintext == "" || stored != e.plaintext)
+}
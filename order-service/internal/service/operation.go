@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+)
+
+var tracer = otel.Tracer("github.com/mathesukkj/goecommerce/order-service/internal/service")
+
+// startOperation runs the rest of the service method named name in a span the
+// caller ends, and names it for the queries it makes, see
+// database.WithOperation:
+//
+//	ctx, span := startOperation(ctx, "UserService.Login")
+//	defer span.End()
+func startOperation(ctx context.Context, name string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, name)
+	return database.WithOperation(ctx, name), span
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+)
+
+type OrderService struct {
+	db *sqlx.DB
+}
+
+var (
+	ErrOrderNotFound = errors.New("order not found")
+)
+
+var OrderListSpec = listquery.Spec{
+	IDColumn: "order_id",
+	Sorts: map[string]string{
+		"order_id":     "order_id",
+		"order_date":   "order_date",
+		"total_amount": "total_amount",
+	},
+	DefaultSort: "-order_date",
+	Filters: map[string]string{
+		"order_status":  "order_status",
+		"refund_status": "refund_status",
+	},
+}
+
+func NewOrderService(db *sqlx.DB) *OrderService {
+	return &OrderService{db: db}
+}
+
+// ListUserOrders is a page of the orders of userID matching search.
+func (s *OrderService) ListUserOrders(ctx context.Context, userID int, search dto.OrderSearchQuery, q listquery.Query) (listquery.Page[entity.Order], error) {
+	ctx, span := startOperation(ctx, "OrderService.ListUserOrders")
+	defer span.End()
+
+	conditions := []string{"user_id = $1"}
+	args := []any{userID}
+
+	if search.OrderDateFrom != "" {
+		args = append(args, search.OrderDateFrom)
+		conditions = append(conditions, fmt.Sprintf("order_date >= CAST($%d AS DATE)", len(args)))
+	}
+	if search.OrderDateTo != "" {
+		args = append(args, search.OrderDateTo)
+		conditions = append(conditions, fmt.Sprintf("order_date < CAST($%d AS DATE) + 1", len(args)))
+	}
+	if search.MinAmount > 0 {
+		args = append(args, search.MinAmount)
+		conditions = append(conditions, fmt.Sprintf("total_amount >= $%d", len(args)))
+	}
+	if search.MaxAmount > 0 {
+		args = append(args, search.MaxAmount)
+		conditions = append(conditions, fmt.Sprintf("total_amount <= $%d", len(args)))
+	}
+	if search.Product != "" {
+		args = append(args, "%"+escapeLike(search.Product)+"%")
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM order_items oi JOIN products p ON p.product_id = oi.product_id WHERE oi.order_id = orders.order_id AND p.product_name ILIKE $%d)",
+			len(args),
+		))
+	}
+
+	query, args := q.Apply(
+		`SELECT order_id, user_id, order_date, total_amount, payment_method_id, shipping_address_id, order_status, cancellation_reason, refund_status FROM orders WHERE `+strings.Join(conditions, " AND "),
+		args,
+	)
+
+	var orders []entity.Order
+	rows, err := database.Conn(ctx, s.db).QueryxContext(ctx, query, args...)
+	if err != nil {
+		return listquery.Page[entity.Order]{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order entity.Order
+		if err := rows.StructScan(&order); err != nil {
+			return listquery.Page[entity.Order]{}, err
+		}
+		orders = append(orders, order)
+	}
+
+	return listquery.Paginate(q, orders, func(o entity.Order) (string, int) {
+		switch q.Sort {
+		case "order_date":
+			return o.OrderDate, o.OrderID
+		case "total_amount":
+			return strconv.Itoa(o.TotalAmount), o.OrderID
+		}
+		return "", o.OrderID
+	}), nil
+}
+
+func (s *OrderService) GetOrderByID(ctx context.Context, orderID, userID int) (*entity.Order, error) {
+	ctx, span := startOperation(ctx, "OrderService.GetOrderByID")
+	defer span.End()
+
+	query := `SELECT order_id, user_id, order_date, total_amount, payment_method_id, shipping_address_id, order_status, cancellation_reason, refund_status FROM orders WHERE order_id = $1 AND user_id = $2`
+
+	var order entity.Order
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, orderID, userID).StructScan(&order); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	return &order, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+)
+
+func setupOrderService(t *testing.T) (*OrderService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	orderService := NewOrderService(sqlx.NewDb(db, "postgres"))
+	return orderService, mock
+}
+
+var orderColumns = []string{
+	"order_id",
+	"user_id",
+	"order_date",
+	"total_amount",
+	"payment_method_id",
+	"shipping_address_id",
+	"order_status",
+	"cancellation_reason",
+	"refund_status",
+}
+
+func TestListUserOrders(t *testing.T) {
+	orderService, mock := setupOrderService(t)
+	query := `SELECT order_id, user_id, order_date, total_amount, payment_method_id, shipping_address_id, order_status, cancellation_reason, refund_status FROM orders WHERE user_id = $1 ORDER BY order_date DESC, order_id DESC LIMIT $2`
+	q, err := listquery.Parse(url.Values{}, OrderListSpec)
+	if err != nil {
+		t.Fatalf("failed to parse list query: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		want   int
+	}{
+		{
+			name:   "user with orders",
+			userID: 1,
+			want:   2,
+		},
+		{
+			name:   "user without orders",
+			userID: 2,
+			want:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := sqlmock.NewRows(orderColumns)
+			for i := 0; i < tt.want; i++ {
+				rows.AddRow(i+1, tt.userID, "2024-01-01T00:00:00Z", 1000, 1, 1, "pending", "", "")
+			}
+
+			mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(tt.userID, listquery.DefaultLimit+1).WillReturnRows(rows)
+
+			got, err := orderService.ListUserOrders(context.Background(), tt.userID, dto.OrderSearchQuery{}, q)
+			assert.NoError(t, err)
+			assert.Len(t, got.Items, tt.want)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListUserOrdersSearch(t *testing.T) {
+	orderService, mock := setupOrderService(t)
+	query := `SELECT order_id, user_id, order_date, total_amount, payment_method_id, shipping_address_id, order_status, cancellation_reason, refund_status FROM orders ` +
+		`WHERE user_id = $1 AND order_date >= CAST($2 AS DATE) AND order_date < CAST($3 AS DATE) + 1 AND total_amount >= $4 AND total_amount <= $5 ` +
+		`AND EXISTS (SELECT 1 FROM order_items oi JOIN products p ON p.product_id = oi.product_id WHERE oi.order_id = orders.order_id AND p.product_name ILIKE $6) ` +
+		`AND order_status = $7 ORDER BY total_amount ASC, order_id ASC LIMIT $8`
+
+	q, err := listquery.Parse(url.Values{"sort": {"total_amount"}, "order_status": {"paid"}, "limit": {"1"}}, OrderListSpec)
+	if err != nil {
+		t.Fatalf("failed to parse list query: %v", err)
+	}
+	search := dto.OrderSearchQuery{
+		OrderDateFrom: "2024-01-01",
+		OrderDateTo:   "2024-12-31",
+		MinAmount:     500,
+		MaxAmount:     2000,
+		Product:       "50%",
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs(1, "2024-01-01", "2024-12-31", 500, 2000, `%50\%%`, "paid", 2).
+		WillReturnRows(sqlmock.NewRows(orderColumns).
+			AddRow(1, 1, "2024-03-01T00:00:00Z", 700, 1, 1, "paid", "", "").
+			AddRow(2, 1, "2024-02-01T00:00:00Z", 900, 1, 1, "paid", "", ""))
+
+	got, err := orderService.ListUserOrders(context.Background(), 1, search, q)
+	assert.NoError(t, err)
+	assert.Len(t, got.Items, 1)
+	assert.NotEmpty(t, got.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	next, err := listquery.Parse(url.Values{"sort": {"total_amount"}, "cursor": {got.NextCursor}}, OrderListSpec)
+	assert.NoError(t, err)
+	assert.Equal(t, "700", next.After.Value)
+	assert.Equal(t, 1, next.After.ID)
+}
+
+func TestGetOrderByID(t *testing.T) {
+	orderService, mock := setupOrderService(t)
+	query := `SELECT order_id, user_id, order_date, total_amount, payment_method_id, shipping_address_id, order_status, cancellation_reason, refund_status FROM orders WHERE order_id = $1 AND user_id = $2`
+
+	tests := []struct {
+		name    string
+		orderID int
+		want    *entity.Order
+		wantErr error
+	}{
+		{
+			name:    "existing order",
+			orderID: 1,
+			want: &entity.Order{
+				OrderID:           1,
+				UserID:            1,
+				OrderDate:         "2024-01-01T00:00:00Z",
+				TotalAmount:       1000,
+				PaymentMethodID:   1,
+				ShippingAddressID: 1,
+				OrderStatus:       "pending",
+			},
+		},
+		{
+			name:    "order not found",
+			orderID: 999,
+			wantErr: ErrOrderNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQuery := mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(tt.orderID, 1)
+			if tt.want != nil {
+				mockQuery.WillReturnRows(sqlmock.NewRows(orderColumns).
+					AddRow(tt.want.OrderID, tt.want.UserID, tt.want.OrderDate, tt.want.TotalAmount, tt.want.PaymentMethodID, tt.want.ShippingAddressID, tt.want.OrderStatus, tt.want.CancellationReason, tt.want.RefundStatus))
+			} else {
+				mockQuery.WillReturnError(sql.ErrNoRows)
+			}
+
+			got, err := orderService.GetOrderByID(context.Background(), tt.orderID, 1)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetOrderByIDAbortsOnCancel(t *testing.T) {
+	orderService, mock := setupOrderService(t)
+	query := `SELECT order_id, user_id, order_date, total_amount, payment_method_id, shipping_address_id, order_status, cancellation_reason, refund_status FROM orders WHERE order_id = $1 AND user_id = $2`
+
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs(1, 1).
+		WillDelayFor(time.Minute).
+		WillReturnRows(sqlmock.NewRows(orderColumns))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := orderService.GetOrderByID(ctx, 1, 1)
+	assert.ErrorIs(t, err, sqlmock.ErrCancelled, "the query should be aborted")
+	assert.Less(t, time.Since(start), time.Second)
+}
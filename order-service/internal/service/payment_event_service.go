@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+)
+
+type PaymentEventService struct {
+	db       *sqlx.DB
+	payments *PaymentService
+}
+
+func NewPaymentEventService(db *sqlx.DB) *PaymentEventService {
+	// settling a payment needs neither the vault nor the gateway
+	return &PaymentEventService{db: db, payments: NewPaymentService(db, nil, nil)}
+}
+
+// IngestEvent stores a verified provider event and applies it. Events are
+// deduplicated on the provider event id, a redelivered event is only applied
+// again if it failed to apply the first time.
+func (s *PaymentEventService) IngestEvent(ctx context.Context, provider string, event dto.PaymentEventPayload, payload []byte) error {
+	ctx, span := startOperation(ctx, "PaymentEventService.IngestEvent")
+	defer span.End()
+
+	insertQuery := `
+		INSERT INTO payment_events (provider, provider_event_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, provider_event_id) DO NOTHING
+		RETURNING event_id
+	`
+	selectQuery := `SELECT event_id, processed_at FROM payment_events WHERE provider = $1 AND provider_event_id = $2`
+
+	var eventID int
+	err := database.Conn(ctx, s.db).QueryRowxContext(ctx, insertQuery, provider, event.ID, event.Type, string(payload)).Scan(&eventID)
+	if err == sql.ErrNoRows {
+		var processedAt *time.Time
+		if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, selectQuery, provider, event.ID).Scan(&eventID, &processedAt); err != nil {
+			return err
+		}
+		if processedAt != nil {
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return s.apply(ctx, eventID, provider, event)
+}
+
+// ReplayEvents applies again the events stored for provider, every provider
+// when empty, received since the given time. Only events that failed to
+// apply are replayed unless includeProcessed is set. Applying is idempotent,
+// so replaying processed events is safe.
+func (s *PaymentEventService) ReplayEvents(ctx context.Context, provider string, since time.Time, includeProcessed bool) (int, error) {
+	ctx, span := startOperation(ctx, "PaymentEventService.ReplayEvents")
+	defer span.End()
+
+	query := `
+		SELECT event_id, provider, provider_event_id, event_type, payload, received_at, processed_at, processing_error
+		FROM payment_events
+		WHERE received_at >= $1 AND ($2 = '' OR provider = $2) AND ($3 OR processed_at IS NULL)
+		ORDER BY event_id
+	`
+
+	var events []entity.PaymentEvent
+	if err := database.Conn(ctx, s.db).SelectContext(ctx, &events, query, since, provider, includeProcessed); err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	var errs []error
+	for _, stored := range events {
+		var event dto.PaymentEventPayload
+		if err := json.Unmarshal([]byte(stored.Payload), &event); err != nil {
+			errs = append(errs, fmt.Errorf("event %d: %w", stored.EventID, err))
+			continue
+		}
+
+		if err := s.apply(ctx, stored.EventID, stored.Provider, event); err != nil {
+			errs = append(errs, fmt.Errorf("event %d: %w", stored.EventID, err))
+			continue
+		}
+		replayed++
+	}
+
+	return replayed, errors.Join(errs...)
+}
+
+func (s *PaymentEventService) apply(ctx context.Context, eventID int, provider string, event dto.PaymentEventPayload) error {
+	processedQuery := `UPDATE payment_events SET processed_at = CURRENT_TIMESTAMP, processing_error = '' WHERE event_id = $1`
+	failedQuery := `UPDATE payment_events SET processing_error = $1 WHERE event_id = $2`
+
+	var err error
+	switch event.Type {
+	case entity.PaymentEventSucceeded:
+		_, err = s.payments.SettlePayment(ctx, provider, event.Data.IdempotencyKey, event.Data.Amount, event.Data.Currency, event.Data.Reference, "")
+	case entity.PaymentEventFailed:
+		failureCode := event.Data.FailureCode
+		if failureCode == "" {
+			failureCode = "gateway_error"
+		}
+		_, err = s.payments.SettlePayment(ctx, provider, event.Data.IdempotencyKey, event.Data.Amount, event.Data.Currency, "", failureCode)
+	}
+
+	if err != nil {
+		if _, updateErr := database.Conn(ctx, s.db).ExecContext(ctx, failedQuery, err.Error(), eventID); updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+
+	_, err = database.Conn(ctx, s.db).ExecContext(ctx, processedQuery, eventID)
+	return err
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+)
+
+var (
+	insertEventQuery = `
+		INSERT INTO payment_events (provider, provider_event_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, provider_event_id) DO NOTHING
+		RETURNING event_id
+	`
+	selectEventQuery    = `SELECT event_id, processed_at FROM payment_events WHERE provider = $1 AND provider_event_id = $2`
+	eventProcessedQuery = `UPDATE payment_events SET processed_at = CURRENT_TIMESTAMP, processing_error = '' WHERE event_id = $1`
+	eventFailedQuery    = `UPDATE payment_events SET processing_error = $1 WHERE event_id = $2`
+	settleQuery         = `SELECT ` + paymentColumns + ` FROM payments WHERE idempotency_key = $1 AND provider = $2`
+)
+
+func setupPaymentEventService(t *testing.T) (*PaymentEventService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	paymentEventService := NewPaymentEventService(sqlx.NewDb(db, "postgres"))
+	return paymentEventService, mock
+}
+
+func TestIngestEvent(t *testing.T) {
+	event := dto.PaymentEventPayload{
+		ID:   "evt_1",
+		Type: entity.PaymentEventSucceeded,
+		Data: dto.PaymentEventData{IdempotencyKey: "pay_1", Amount: 1000, Currency: "USD", Reference: "auth_1"},
+	}
+	payload := []byte(`{"id":"evt_1"}`)
+
+	tests := []struct {
+		name    string
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "new event settles the pending payment",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(insertEventQuery)).
+					WithArgs("fake", "evt_1", entity.PaymentEventSucceeded, string(payload)).
+					WillReturnRows(sqlmock.NewRows([]string{"event_id"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta(settleQuery)).
+					WithArgs("pay_1", "fake").
+					WillReturnRows(sqlmock.NewRows(paymentColumnNames).
+						AddRow(1, 1, entity.PaymentOperationAuthorize, 1000, entity.PaymentStatusPending, "fake", "USD", "pay_1", "", "", "2024-01-01T00:00:00Z"))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(paymentSucceededQuery)).
+					WithArgs(entity.PaymentStatusSucceeded, "auth_1", 1, entity.PaymentStatusPending).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(orderStatusQuery)).
+					WithArgs(entity.OrderStatusAuthorized, 1, entity.OrderStatusCancelled).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(regexp.QuoteMeta(eventProcessedQuery)).
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: nil,
+		},
+		{
+			name: "duplicate of a processed event",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(insertEventQuery)).
+					WithArgs("fake", "evt_1", entity.PaymentEventSucceeded, string(payload)).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(selectEventQuery)).
+					WithArgs("fake", "evt_1").
+					WillReturnRows(sqlmock.NewRows([]string{"event_id", "processed_at"}).AddRow(1, time.Now()))
+			},
+			wantErr: nil,
+		},
+		{
+			name: "redelivery of an event that failed to apply",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(insertEventQuery)).
+					WithArgs("fake", "evt_1", entity.PaymentEventSucceeded, string(payload)).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(selectEventQuery)).
+					WithArgs("fake", "evt_1").
+					WillReturnRows(sqlmock.NewRows([]string{"event_id", "processed_at"}).AddRow(1, nil))
+				mock.ExpectQuery(regexp.QuoteMeta(settleQuery)).
+					WithArgs("pay_1", "fake").
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectExec(regexp.QuoteMeta(eventFailedQuery)).
+					WithArgs(ErrPaymentNotFound.Error(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: ErrPaymentNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paymentEventService, mock := setupPaymentEventService(t)
+			tt.expect(mock)
+
+			err := paymentEventService.IngestEvent(context.Background(), "fake", event, payload)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSettlePaymentAlreadySettled(t *testing.T) {
+	paymentService, mock := setupPaymentService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(settleQuery)).
+		WithArgs("pay_1", "fake").
+		WillReturnRows(sqlmock.NewRows(paymentColumnNames).
+			AddRow(1, 1, entity.PaymentOperationCapture, 1000, entity.PaymentStatusSucceeded, "fake", "USD", "pay_1", "cap_1", "", "2024-01-01T00:00:00Z"))
+
+	got, err := paymentService.SettlePayment(context.Background(), "fake", "pay_1", 1000, "USD", "", "card_declined")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.PaymentStatusSucceeded, got.Status, "settled payments should not change")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSettlePaymentMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		amount   int
+		currency string
+		wantErr  error
+	}{
+		{
+			name:     "payment of another provider",
+			provider: "other",
+			amount:   1000,
+			currency: "USD",
+			wantErr:  ErrPaymentNotFound,
+		},
+		{
+			name:     "other amount",
+			provider: "fake",
+			amount:   1,
+			currency: "USD",
+			wantErr:  ErrPaymentEventMismatch,
+		},
+		{
+			name:     "other currency",
+			provider: "fake",
+			amount:   1000,
+			currency: "EUR",
+			wantErr:  ErrPaymentEventMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paymentService, mock := setupPaymentService(t)
+
+			rows := sqlmock.NewRows(paymentColumnNames)
+			if tt.provider == "fake" {
+				rows.AddRow(1, 1, entity.PaymentOperationAuthorize, 1000, entity.PaymentStatusPending, "fake", "USD", "pay_1", "", "", "2024-01-01T00:00:00Z")
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(settleQuery)).
+				WithArgs("pay_1", tt.provider).
+				WillReturnRows(rows)
+
+			_, err := paymentService.SettlePayment(context.Background(), tt.provider, "pay_1", tt.amount, tt.currency, "auth_1", "")
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet(), "the payment should stay pending")
+		})
+	}
+}
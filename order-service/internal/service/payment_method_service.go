@@ -1,125 +1,172 @@
 package service
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
 	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
 )
 
 type PaymentMethodService struct {
-	db *sqlx.DB
+	paymentMethods repository.PaymentMethodRepository
+	vault          vault.Vault
+	tx             repository.Transactor
 }
 
 var (
 	ErrPaymentMethodNotFound = errors.New("payment method not found")
+	ErrPaymentMethodInUse    = errors.New("payment method was used to place orders")
 )
 
-func NewPaymentMethodService(db *sqlx.DB) *PaymentMethodService {
-	return &PaymentMethodService{db: db}
+var PaymentMethodListSpec = repository.PaymentMethodListSpec
+
+// NewPaymentMethodService runs the writes that change both the payment
+// methods and the card vault in a transaction of tx, which the vault joins.
+func NewPaymentMethodService(paymentMethods repository.PaymentMethodRepository, cardVault vault.Vault, tx repository.Transactor) *PaymentMethodService {
+	return &PaymentMethodService{paymentMethods: paymentMethods, vault: cardVault, tx: tx}
 }
 
-func (s *PaymentMethodService) ListUserPaymentMethods(userID int) ([]entity.PaymentMethod, error) {
-	query := `SELECT payment_method_id, user_id, payment_type, card_number, expiration_date, card_holder_name FROM payment_methods WHERE user_id = $1`
+func (s *PaymentMethodService) ListUserPaymentMethods(ctx context.Context, userID int, q listquery.Query) (listquery.Page[entity.PaymentMethod], error) {
+	ctx, span := startOperation(ctx, "PaymentMethodService.ListUserPaymentMethods")
+	defer span.End()
 
-	var paymentMethods []entity.PaymentMethod
-	rows, err := s.db.Queryx(query, userID)
+	page, err := s.paymentMethods.ListByUser(ctx, userID, q)
 	if err != nil {
-		return nil, err
+		return listquery.Page[entity.PaymentMethod]{}, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var paymentMethod entity.PaymentMethod
-		if err := rows.StructScan(&paymentMethod); err != nil {
-			return nil, err
-		}
-		paymentMethods = append(paymentMethods, paymentMethod)
+	for i := range page.Items {
+		page.Items[i].CardNumber = maskCardNumber(page.Items[i].CardLast4)
 	}
 
-	return paymentMethods, nil
+	return page, nil
 }
 
-func (s *PaymentMethodService) GetPaymentMethodByID(paymentMethodID, userID int) (*entity.PaymentMethod, error) {
-	query := `SELECT payment_method_id, user_id, payment_type, card_number, expiration_date, card_holder_name FROM payment_methods WHERE payment_method_id = $1 AND user_id = $2`
+func (s *PaymentMethodService) GetPaymentMethodByID(ctx context.Context, paymentMethodID, userID int) (*entity.PaymentMethod, error) {
+	ctx, span := startOperation(ctx, "PaymentMethodService.GetPaymentMethodByID")
+	defer span.End()
 
-	var paymentMethod entity.PaymentMethod
-	if err := s.db.QueryRowx(query, paymentMethodID, userID).StructScan(&paymentMethod); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrPaymentMethodNotFound
-		}
+	paymentMethod, err := s.paymentMethods.FindByID(ctx, paymentMethodID, userID)
+	if err == repository.ErrNotFound {
+		return nil, ErrPaymentMethodNotFound
+	} else if err != nil {
 		return nil, err
 	}
+	paymentMethod.CardNumber = maskCardNumber(paymentMethod.CardLast4)
 
-	return &paymentMethod, nil
+	return paymentMethod, nil
 }
 
-func (s *PaymentMethodService) CreatePaymentMethod(payload dto.PaymentMethodPayload, userId int) (*entity.PaymentMethod, error) {
-	query := `
-		INSERT INTO payment_methods (user_id,  payment_type, card_number, expiration_date, card_holder_name)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING payment_method_id, user_id, payment_type, card_number, expiration_date, card_holder_name
-	`
-
-	var createdPaymentMethod entity.PaymentMethod
-	if err := s.db.QueryRowx(
-		query,
-		userId,
-		payload.PaymentType,
-		payload.CardNumber,
-		payload.ExpirationDate,
-		payload.CardHolderName,
-	).StructScan(&createdPaymentMethod); err != nil {
+// CreatePaymentMethod stores the card in the vault and the payment method
+// referring to it in one transaction, or neither.
+func (s *PaymentMethodService) CreatePaymentMethod(ctx context.Context, payload dto.PaymentMethodPayload, userId int) (*entity.PaymentMethod, error) {
+	ctx, span := startOperation(ctx, "PaymentMethodService.CreatePaymentMethod")
+	defer span.End()
+
+	var createdPaymentMethod *entity.PaymentMethod
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		cardToken, err := s.vault.Tokenize(ctx, payload.CardNumber)
+		if err != nil {
+			return err
+		}
+
+		createdPaymentMethod, err = s.paymentMethods.Create(ctx, entity.PaymentMethod{
+			UserID:         userId,
+			PaymentType:    payload.PaymentType,
+			CardToken:      cardToken,
+			CardLast4:      lastFour(payload.CardNumber),
+			ExpirationDate: payload.ExpirationDate,
+			CardHolderName: payload.CardHolderName,
+		})
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
+	createdPaymentMethod.CardNumber = maskCardNumber(createdPaymentMethod.CardLast4)
 
-	return &createdPaymentMethod, nil
+	return createdPaymentMethod, nil
 }
 
-func (s *PaymentMethodService) UpdatePaymentMethod(paymentMethodID int, paymentMethod dto.PaymentMethodPayload) (*entity.PaymentMethod, error) {
-	query := `
-		UPDATE payment_methods
-		SET payment_type = $1, card_number = $2, expiration_date = $3, card_holder_name = $4
-		WHERE payment_method_id = $5
-		RETURNING payment_method_id, user_id, payment_type, card_number, expiration_date, card_holder_name
-	`
-
-	var updatedPaymentMethod entity.PaymentMethod
-	if err := s.db.QueryRowx(
-		query,
-		paymentMethod.PaymentType,
-		paymentMethod.CardNumber,
-		paymentMethod.ExpirationDate,
-		paymentMethod.CardHolderName,
-		paymentMethodID,
-	).StructScan(&updatedPaymentMethod); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrPaymentMethodNotFound
+// UpdatePaymentMethod replaces the card of the payment method in the vault
+// and the payment method itself in one transaction, or neither.
+func (s *PaymentMethodService) UpdatePaymentMethod(ctx context.Context, paymentMethodID int, paymentMethod dto.PaymentMethodPayload, userID int) (*entity.PaymentMethod, error) {
+	ctx, span := startOperation(ctx, "PaymentMethodService.UpdatePaymentMethod")
+	defer span.End()
+
+	var updatedPaymentMethod *entity.PaymentMethod
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		previousToken, err := s.paymentMethods.CardToken(ctx, paymentMethodID, userID)
+		if err == repository.ErrNotFound {
+			return ErrPaymentMethodNotFound
+		} else if err != nil {
+			return err
+		}
+
+		cardToken, err := s.vault.Tokenize(ctx, paymentMethod.CardNumber)
+		if err != nil {
+			return err
+		}
+
+		updatedPaymentMethod, err = s.paymentMethods.Update(ctx, entity.PaymentMethod{
+			PaymentMethodID: paymentMethodID,
+			UserID:          userID,
+			PaymentType:     paymentMethod.PaymentType,
+			CardToken:       cardToken,
+			CardLast4:       lastFour(paymentMethod.CardNumber),
+			ExpirationDate:  paymentMethod.ExpirationDate,
+			CardHolderName:  paymentMethod.CardHolderName,
+		})
+		if err == repository.ErrNotFound {
+			return ErrPaymentMethodNotFound
+		} else if err != nil {
+			return err
 		}
+
+		return s.vault.Delete(ctx, previousToken)
+	})
+	if err != nil {
 		return nil, err
 	}
+	updatedPaymentMethod.CardNumber = maskCardNumber(updatedPaymentMethod.CardLast4)
 
-	return &updatedPaymentMethod, nil
+	return updatedPaymentMethod, nil
 }
 
-func (s *PaymentMethodService) DeletePaymentMethod(paymentMethodID int) error {
-	query := `DELETE FROM payment_methods WHERE payment_method_id = $1`
+// DeletePaymentMethod deletes the payment method along with its card in the
+// vault, or neither. A payment method orders were placed with is kept.
+func (s *PaymentMethodService) DeletePaymentMethod(ctx context.Context, paymentMethodID, userID int) error {
+	ctx, span := startOperation(ctx, "PaymentMethodService.DeletePaymentMethod")
+	defer span.End()
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		cardToken, err := s.paymentMethods.Delete(ctx, paymentMethodID, userID)
+		if err == repository.ErrNotFound {
+			return ErrPaymentMethodNotFound
+		} else if err == repository.ErrInUse {
+			return ErrPaymentMethodInUse
+		} else if err != nil {
+			return err
+		}
 
-	result, err := s.db.Exec(query, paymentMethodID)
-	if err != nil {
-		return err
-	}
+		return s.vault.Delete(ctx, cardToken)
+	})
+}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+func maskCardNumber(last4 string) string {
+	if last4 == "" {
+		return ""
 	}
+	return "**** " + last4
+}
 
-	if rowsAffected == 0 {
-		return ErrPaymentMethodNotFound
+func lastFour(cardNumber string) string {
+	if len(cardNumber) <= 4 {
+		return cardNumber
 	}
-
-	return nil
+	return cardNumber[len(cardNumber)-4:]
 }
@@ -1,101 +1,119 @@
 package service
 
 import (
-	"regexp"
+	"context"
+	"fmt"
+	"net/url"
 	"testing"
 
-	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
 	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
-	"github.com/stretchr/testify/assert"
+	"github.com/mathesukkj/goecommerce/order-service/internal/listquery"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/memory"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
 )
 
-func setupPaymentMethodService(t *testing.T) (*PaymentMethodService, sqlmock.Sqlmock) {
+func setupPaymentMethodService(t *testing.T) *PaymentMethodService {
 	t.Helper()
 
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("failed to open mock db: %v", err)
+	return NewPaymentMethodService(memory.NewPaymentMethodRepository(), newFakeVault(), memory.Transactor{})
+}
+
+// fakeVault keeps the card numbers in memory, handing out sequential tokens.
+type fakeVault struct {
+	pans map[string]string
+	next int
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{pans: map[string]string{}}
+}
+
+func (v *fakeVault) Tokenize(ctx context.Context, pan string) (string, error) {
+	v.next++
+	token := fmt.Sprintf("tok_%d", v.next)
+	v.pans[token] = pan
+	return token, nil
+}
+
+func (v *fakeVault) Detokenize(ctx context.Context, token string) (string, error) {
+	pan, ok := v.pans[token]
+	if !ok {
+		return "", vault.ErrTokenNotFound
 	}
+	return pan, nil
+}
 
-	paymentMethodService := NewPaymentMethodService(sqlx.NewDb(db, "postgres"))
-	return paymentMethodService, mock
+func (v *fakeVault) Delete(ctx context.Context, token string) error {
+	delete(v.pans, token)
+	return nil
 }
 
+// seedPaymentMethods gives user 1 the payment method 1, a visa ending in
+// 4242 whose card token is tok_1.
 func seedPaymentMethods(t *testing.T, service *PaymentMethodService) {
 	t.Helper()
 
-	params := map[string]interface{}{
-		"user_id":              1,
-		"street_paymentMethod": "123 Main St",
-		"city":                 "New York",
-		"state":                "NY",
-		"postal_code":          "10001",
-		"country":              "USA",
+	_, err := service.CreatePaymentMethod(context.Background(), dto.PaymentMethodPayload{
+		PaymentType:    "visa",
+		CardNumber:     "4242424242424242",
+		ExpirationDate: "2040-12-31",
+		CardHolderName: "John Doe",
+	}, 1)
+	if err != nil {
+		t.Fatalf("failed to seed payment method: %v", err)
 	}
-
-	service.db.NamedExec(`
-		INSERT INTO payment_methods (user_id, payment_type, card_number, expiration_date, card_holder_name) 
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, params)
 }
 
 func TestListUserPaymentMethods(t *testing.T) {
-	paymentMethodService, mock := setupPaymentMethodService(t)
+	paymentMethodService := setupPaymentMethodService(t)
 	seedPaymentMethods(t, paymentMethodService)
-	query := `SELECT payment_method_id, user_id, payment_type, card_number, expiration_date, card_holder_name FROM payment_methods WHERE user_id = $1`
+	q, err := listquery.Parse(url.Values{}, PaymentMethodListSpec)
+	if err != nil {
+		t.Fatalf("failed to parse list query: %v", err)
+	}
 
 	tests := []struct {
-		name    string
-		userID  int
-		want    int
-		wantErr bool
+		name   string
+		userID int
+		want   int
 	}{
 		{
-			name:    "existing user with payment methods",
-			userID:  1,
-			want:    1,
-			wantErr: false,
+			name:   "existing user with payment methods",
+			userID: 1,
+			want:   1,
 		},
 		{
-			name:    "user with no payment methods",
-			userID:  2,
-			want:    0,
-			wantErr: false,
+			name:   "user with no payment methods",
+			userID: 2,
+			want:   0,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rows := sqlmock.NewRows([]string{"payment_method_id", "user_id", "payment_type", "card_number", "expiration_date", "card_holder_name"})
-
-			if tt.want > 0 {
-				rows.AddRow(1, tt.userID, "Credit Card", "1234567890123456", "2025-12-31", "John Doe")
-			}
-
-			mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(tt.userID).WillReturnRows(rows)
-
-			got, err := paymentMethodService.ListUserPaymentMethods(tt.userID)
-			assert.Equal(t, tt.wantErr, err != nil, "ListUserPaymentMethods() error = %v, wantErr %v", err, tt.wantErr)
-			if !tt.wantErr {
-				assert.Len(t, got, tt.want, "ListUserPaymentMethods() got = %v, want %v", len(got), tt.want)
+			got, err := paymentMethodService.ListUserPaymentMethods(context.Background(), tt.userID, q)
+			assert.NoError(t, err, "ListUserPaymentMethods() unexpected error")
+			assert.Len(t, got.Items, tt.want, "ListUserPaymentMethods() got = %v, want %v", len(got.Items), tt.want)
+			for _, paymentMethod := range got.Items {
+				assert.Equal(t, "**** 4242", paymentMethod.CardNumber, "card number should be masked")
 			}
 		})
 	}
 }
 
 func TestGetPaymentMethodByID(t *testing.T) {
-	paymentMethodService, mock := setupPaymentMethodService(t)
+	paymentMethodService := setupPaymentMethodService(t)
 	seedPaymentMethods(t, paymentMethodService)
-	query := `SELECT payment_method_id, user_id, payment_type, card_number, expiration_date, card_holder_name FROM payment_methods WHERE payment_method_id = $1 AND user_id = $2`
 
 	tests := []struct {
 		name            string
 		paymentMethodID int
 		userID          int
 		want            *entity.PaymentMethod
-		wantErr         bool
+		wantErr         error
 	}{
 		{
 			name:            "existing payment method",
@@ -104,207 +122,204 @@ func TestGetPaymentMethodByID(t *testing.T) {
 			want: &entity.PaymentMethod{
 				PaymentMethodID: 1,
 				UserID:          1,
-				PaymentType:     "Credit Card",
-				CardNumber:      "1234567890123456",
-				ExpirationDate:  "2025-12-31",
+				PaymentType:     "visa",
+				CardNumber:      "**** 4242",
+				CardToken:       "tok_1",
+				CardLast4:       "4242",
+				ExpirationDate:  "2040-12-31T00:00:00Z",
 				CardHolderName:  "John Doe",
 			},
-			wantErr: false,
 		},
 		{
 			name:            "non-existing payment method",
 			paymentMethodID: 999,
-			want:            nil,
-			wantErr:         true,
+			userID:          1,
+			wantErr:         ErrPaymentMethodNotFound,
+		},
+		{
+			name:            "payment method of another user",
+			paymentMethodID: 1,
+			userID:          2,
+			wantErr:         ErrPaymentMethodNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rows := sqlmock.NewRows([]string{"payment_method_id", "user_id", "payment_type", "card_number", "expiration_date", "card_holder_name"})
-
-			if tt.want != nil {
-				rows.AddRow(tt.paymentMethodID, 1, "Credit Card", "1234567890123456", "2025-12-31", "John Doe")
-			}
-
-			mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(tt.paymentMethodID, tt.userID).WillReturnRows(rows)
-
-			got, err := paymentMethodService.GetPaymentMethodByID(tt.paymentMethodID, tt.userID)
-			assert.Equal(t, tt.wantErr, err != nil, "GetPaymentMethodByID() error = %v, wantErr %v", err, tt.wantErr)
-			if !tt.wantErr {
-				assert.Equal(t, tt.want, got, "GetPaymentMethodByID() got = %v, want %v", got, tt.want)
-			}
+			got, err := paymentMethodService.GetPaymentMethodByID(context.Background(), tt.paymentMethodID, tt.userID)
+			assert.Equal(t, tt.wantErr, err, "GetPaymentMethodByID() unexpected error")
+			assert.Equal(t, tt.want, got, "GetPaymentMethodByID() got = %v, want %v", got, tt.want)
 		})
 	}
 }
 
 func TestCreatePaymentMethod(t *testing.T) {
-	paymentMethodService, mock := setupPaymentMethodService(t)
-	query := `
-	INSERT INTO payment_methods (user_id,  payment_type, card_number, expiration_date, card_holder_name)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING payment_method_id, user_id, payment_type, card_number, expiration_date, card_holder_name
-`
-
-	tests := []struct {
-		name    string
-		payload dto.PaymentMethodPayload
-		userID  int
-		want    *entity.PaymentMethod
-		wantErr bool
-	}{
-		{
-			name: "valid payment method",
-			payload: dto.PaymentMethodPayload{
-				PaymentType:    "Credit Card",
-				CardNumber:     "1234567890123456",
-				ExpirationDate: "2025-12-31",
-				CardHolderName: "John Doe",
-			},
-			userID: 1,
-			want: &entity.PaymentMethod{
-				PaymentMethodID: 1,
-				UserID:          1,
-				PaymentType:     "Credit Card",
-				CardNumber:      "1234567890123456",
-				ExpirationDate:  "2025-12-31",
-				CardHolderName:  "John Doe",
-			},
-			wantErr: false,
-		},
+	paymentMethodService := setupPaymentMethodService(t)
+	payload := dto.PaymentMethodPayload{
+		PaymentType:    "visa",
+		CardNumber:     "4242424242424242",
+		ExpirationDate: "2040-12-31",
+		CardHolderName: "John Doe",
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(tt.userID, tt.payload.PaymentType, tt.payload.CardNumber, tt.payload.ExpirationDate, tt.payload.CardHolderName).WillReturnRows(sqlmock.NewRows([]string{"payment_method_id", "user_id", "payment_type", "card_number", "expiration_date", "card_holder_name"}).AddRow(tt.want.PaymentMethodID, tt.want.UserID, tt.want.PaymentType, tt.want.CardNumber, tt.want.ExpirationDate, tt.want.CardHolderName))
-
-			got, err := paymentMethodService.CreatePaymentMethod(tt.payload, tt.userID)
-			assert.Equal(t, tt.wantErr, err != nil, "CreatePaymentMethod() error = %v, wantErr %v", err, tt.wantErr)
-			if !tt.wantErr {
-				assert.Equal(t, tt.want, got, "CreatePaymentMethod() got = %v, want %v", got, tt.want)
-			}
-		})
-	}
+	got, err := paymentMethodService.CreatePaymentMethod(context.Background(), payload, 1)
+	assert.NoError(t, err, "CreatePaymentMethod() unexpected error")
+	assert.Equal(t, &entity.PaymentMethod{
+		PaymentMethodID: 1,
+		UserID:          1,
+		PaymentType:     "visa",
+		CardNumber:      "**** 4242",
+		CardToken:       "tok_1",
+		CardLast4:       "4242",
+		ExpirationDate:  "2040-12-31T00:00:00Z",
+		CardHolderName:  "John Doe",
+	}, got, "CreatePaymentMethod() returned unexpected result")
+
+	pan, err := paymentMethodService.vault.Detokenize(context.Background(), got.CardToken)
+	assert.NoError(t, err)
+	assert.Equal(t, payload.CardNumber, pan, "card number should be kept in the vault")
 }
 
 func TestUpdatePaymentMethod(t *testing.T) {
-	paymentMethodService, mock := setupPaymentMethodService(t)
-	query := `
-		UPDATE payment_methods
-		SET payment_type = $1, card_number = $2, expiration_date = $3, card_holder_name = $4
-		WHERE payment_method_id = $5
-		RETURNING payment_method_id, user_id, payment_type, card_number, expiration_date, card_holder_name
-	`
+	paymentMethodService := setupPaymentMethodService(t)
+	seedPaymentMethods(t, paymentMethodService)
+	previousToken := "tok_1"
 
 	tests := []struct {
 		name            string
 		paymentMethodID int
+		userID          int
 		payload         dto.PaymentMethodPayload
 		want            *entity.PaymentMethod
-		wantErr         bool
+		wantErr         error
 	}{
+		{
+			name:            "payment method of another user",
+			paymentMethodID: 1,
+			userID:          2,
+			payload: dto.PaymentMethodPayload{
+				PaymentType:    "visa",
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "2040-12-31",
+				CardHolderName: "Jane Doe",
+			},
+			wantErr: ErrPaymentMethodNotFound,
+		},
 		{
 			name:            "valid update",
 			paymentMethodID: 1,
+			userID:          1,
 			payload: dto.PaymentMethodPayload{
-				PaymentType:    "Credit Card",
-				CardNumber:     "1234567890123456",
-				ExpirationDate: "2025-12-31",
+				PaymentType:    "mastercard",
+				CardNumber:     "5555555555554444",
+				ExpirationDate: "2041-06-30",
 				CardHolderName: "John Doe",
 			},
 			want: &entity.PaymentMethod{
 				PaymentMethodID: 1,
 				UserID:          1,
-				PaymentType:     "Credit Card",
-				CardNumber:      "1234567890123456",
-				ExpirationDate:  "2025-12-31",
+				PaymentType:     "mastercard",
+				CardNumber:      "**** 4444",
+				CardToken:       "tok_2",
+				CardLast4:       "4444",
+				ExpirationDate:  "2041-06-30T00:00:00Z",
 				CardHolderName:  "John Doe",
 			},
-			wantErr: false,
 		},
 		{
 			name:            "non-existing payment method",
 			paymentMethodID: 999,
+			userID:          1,
 			payload: dto.PaymentMethodPayload{
-				PaymentType:    "Credit Card",
-				CardNumber:     "1234567890123456",
-				ExpirationDate: "2025-12-31",
+				PaymentType:    "visa",
+				CardNumber:     "4242424242424242",
+				ExpirationDate: "2040-12-31",
 				CardHolderName: "John Doe",
 			},
-			wantErr: true,
+			wantErr: ErrPaymentMethodNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rows := sqlmock.NewRows([]string{
-				"payment_type",
-				"user_id",
-				"card_number",
-				"expiration_date",
-				"card_holder_name",
-				"payment_method_id",
-			})
-			if tt.want != nil {
-				rows.AddRow(tt.want.PaymentType, tt.want.UserID, tt.want.CardNumber, tt.want.ExpirationDate, tt.want.CardHolderName, tt.want.PaymentMethodID)
-			}
+			got, err := paymentMethodService.UpdatePaymentMethod(context.Background(), tt.paymentMethodID, tt.payload, tt.userID)
+			assert.Equal(t, tt.wantErr, err, "UpdatePaymentMethod() unexpected error")
+			assert.Equal(t, tt.want, got, "UpdatePaymentMethod() returned unexpected result")
 
-			mock.ExpectQuery(regexp.QuoteMeta(query)).
-				WithArgs(tt.payload.PaymentType, tt.payload.CardNumber, tt.payload.ExpirationDate, tt.payload.CardHolderName, tt.paymentMethodID).
-				WillReturnRows(rows)
-
-			got, err := paymentMethodService.UpdatePaymentMethod(tt.paymentMethodID, tt.payload)
-			if tt.wantErr {
-				assert.Error(t, err, "UpdatePaymentMethod() should have returned an error")
-				assert.Nil(t, got, "UpdatePaymentMethod() should have returned nil")
-			} else {
-				assert.NoError(t, err, "UpdatePaymentMethod() unexpected error")
-				assert.Equal(t, tt.want, got, "UpdatePaymentMethod() returned unexpected result")
+			if tt.wantErr == nil {
+				_, err := paymentMethodService.vault.Detokenize(context.Background(), previousToken)
+				assert.ErrorIs(t, err, vault.ErrTokenNotFound, "previous card token should be deleted")
 			}
 		})
 	}
 }
 
 func TestDeletePaymentMethod(t *testing.T) {
-	paymentMethodService, mock := setupPaymentMethodService(t)
-	query := "DELETE FROM payment_methods WHERE payment_method_id = $1"
+	paymentMethodService := setupPaymentMethodService(t)
+	seedPaymentMethods(t, paymentMethodService)
+	cardToken := "tok_1"
 
 	tests := []struct {
 		name            string
 		paymentMethodID int
-		wantErr         bool
+		userID          int
+		wantErr         error
 	}{
+		{
+			name:            "payment method of another user",
+			paymentMethodID: 1,
+			userID:          2,
+			wantErr:         ErrPaymentMethodNotFound,
+		},
 		{
 			name:            "existing payment method",
 			paymentMethodID: 1,
-			wantErr:         false,
+			userID:          1,
 		},
 		{
 			name:            "non-existing payment method",
 			paymentMethodID: 999,
-			wantErr:         true,
+			userID:          1,
+			wantErr:         ErrPaymentMethodNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.wantErr {
-				mock.ExpectExec(regexp.QuoteMeta(query)).
-					WithArgs(tt.paymentMethodID).
-					WillReturnResult(sqlmock.NewResult(0, 0))
-			} else {
-				mock.ExpectExec(regexp.QuoteMeta(query)).
-					WithArgs(tt.paymentMethodID).
-					WillReturnResult(sqlmock.NewResult(0, 1))
+			err := paymentMethodService.DeletePaymentMethod(context.Background(), tt.paymentMethodID, tt.userID)
+			assert.Equal(t, tt.wantErr, err, "DeletePaymentMethod() unexpected error")
+
+			_, err = paymentMethodService.vault.Detokenize(context.Background(), cardToken)
+			if tt.wantErr == nil {
+				assert.ErrorIs(t, err, vault.ErrTokenNotFound, "card token should be deleted")
+			} else if tt.paymentMethodID == 1 {
+				assert.NoError(t, err, "the card of another user must stay in the vault")
 			}
+		})
+	}
+}
 
-			err := paymentMethodService.DeletePaymentMethod(tt.paymentMethodID)
-			if tt.wantErr {
-				assert.Error(t, err, "DeletePaymentMethod() should have returned an error")
-				assert.Equal(t, "payment method not found", err.Error(), "Unexpected error message")
-			} else {
-				assert.NoError(t, err, "DeletePaymentMethod() unexpected error")
-			}
+func TestMaskCardNumber(t *testing.T) {
+	tests := []struct {
+		name  string
+		last4 string
+		want  string
+	}{
+		{
+			name:  "last four digits",
+			last4: "4242",
+			want:  "**** 4242",
+		},
+		{
+			name:  "no card number",
+			last4: "",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, maskCardNumber(tt.last4))
 		})
 	}
 }
@@ -0,0 +1,635 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+type PaymentService struct {
+	db      *sqlx.DB
+	tx      *database.TxManager
+	vault   vault.Vault
+	gateway payment.PaymentGateway
+}
+
+var (
+	ErrPaymentNotFound      = errors.New("payment not found")
+	ErrInvalidOrderStatus   = errors.New("order status does not allow this payment operation")
+	ErrRefundExceedsCapture = errors.New("refund exceeds the captured amount")
+	ErrPaymentEventMismatch = errors.New("payment event does not match the payment")
+	ErrPaymentPending       = errors.New("a payment operation on the order is still pending at the gateway")
+)
+
+const paymentColumns = `payment_id, order_id, operation, amount, status, provider, currency, idempotency_key, gateway_reference, failure_code, created_at`
+
+func NewPaymentService(db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway) *PaymentService {
+	return &PaymentService{db: db, tx: database.NewTxManager(db, nil), vault: cardVault, gateway: gateway}
+}
+
+func (s *PaymentService) ListOrderPayments(ctx context.Context, orderID int) ([]entity.Payment, error) {
+	ctx, span := startOperation(ctx, "PaymentService.ListOrderPayments")
+	defer span.End()
+
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 ORDER BY payment_id`
+
+	var payments []entity.Payment
+	rows, err := database.Conn(ctx, s.db).QueryxContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p entity.Payment
+		if err := rows.StructScan(&p); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+
+	return payments, nil
+}
+
+// PayOrder authorizes and captures the order total on the order payment
+// method. An order a failed or timed out capture left authorized is only
+// captured, reusing the idempotency key of a pending capture, so a retry
+// never holds the funds twice.
+func (s *PaymentService) PayOrder(ctx context.Context, orderID, userID int) (*entity.Payment, error) {
+	ctx, span := startOperation(ctx, "PaymentService.PayOrder")
+	defer span.End()
+
+	var authorized bool
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		order, err := s.getOrder(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.UserID != userID {
+			return ErrOrderNotFound
+		}
+
+		authorized = order.OrderStatus == entity.OrderStatusAuthorized
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !authorized {
+		if _, err := s.AuthorizeOrder(ctx, orderID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.CaptureOrder(ctx, orderID)
+}
+
+// AuthorizeOrder holds the order total on the order payment method. A
+// declined card leaves the order in payment_failed, so it can be retried.
+func (s *PaymentService) AuthorizeOrder(ctx context.Context, orderID, userID int) (*entity.Payment, error) {
+	ctx, span := startOperation(ctx, "PaymentService.AuthorizeOrder")
+	defer span.End()
+
+	var (
+		p    *entity.Payment
+		card payment.Card
+	)
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		order, err := s.getOrder(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.UserID != userID {
+			return ErrOrderNotFound
+		}
+		if order.OrderStatus != entity.OrderStatusPendingPayment && order.OrderStatus != entity.OrderStatusPaymentFailed {
+			return ErrInvalidOrderStatus
+		}
+
+		card, err = s.getCard(ctx, order.PaymentMethodID, order.UserID)
+		if err != nil {
+			return err
+		}
+
+		p, err = s.reserve(ctx, order.OrderID, entity.PaymentOperationAuthorize, order.TotalAmount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.attempt(ctx, p, func(ctx context.Context, key string) (string, error) {
+		return s.gateway.Authorize(ctx, key, card, p.Amount)
+	})
+}
+
+// CaptureOrder settles the authorized order total.
+func (s *PaymentService) CaptureOrder(ctx context.Context, orderID int) (*entity.Payment, error) {
+	ctx, span := startOperation(ctx, "PaymentService.CaptureOrder")
+	defer span.End()
+
+	var p, authorization *entity.Payment
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		order, err := s.getOrder(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.OrderStatus != entity.OrderStatusAuthorized {
+			return ErrInvalidOrderStatus
+		}
+
+		authorization, err = s.findPayment(ctx, order.OrderID, entity.PaymentOperationAuthorize, entity.PaymentStatusSucceeded)
+		if err != nil {
+			return err
+		}
+
+		p, err = s.reserve(ctx, order.OrderID, entity.PaymentOperationCapture, order.TotalAmount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.attempt(ctx, p, func(ctx context.Context, key string) (string, error) {
+		return s.gateway.Capture(ctx, key, authorization.GatewayReference, p.Amount)
+	})
+}
+
+// VoidOrder releases the authorization of an order that was not captured.
+func (s *PaymentService) VoidOrder(ctx context.Context, orderID int) (*entity.Payment, error) {
+	ctx, span := startOperation(ctx, "PaymentService.VoidOrder")
+	defer span.End()
+
+	var p, authorization *entity.Payment
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		order, err := s.getOrder(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.OrderStatus != entity.OrderStatusAuthorized {
+			return ErrInvalidOrderStatus
+		}
+
+		authorization, err = s.findPayment(ctx, order.OrderID, entity.PaymentOperationAuthorize, entity.PaymentStatusSucceeded)
+		if err != nil {
+			return err
+		}
+
+		p, err = s.reserve(ctx, order.OrderID, entity.PaymentOperationVoid, authorization.Amount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.attempt(ctx, p, func(ctx context.Context, key string) (string, error) {
+		return "", s.gateway.Void(ctx, key, authorization.GatewayReference)
+	})
+}
+
+// RefundOrder returns amount of the captured order total, the refund status
+// of the order becomes refunded once everything captured was given back.
+func (s *PaymentService) RefundOrder(ctx context.Context, orderID, amount int) (*entity.Payment, error) {
+	ctx, span := startOperation(ctx, "PaymentService.RefundOrder")
+	defer span.End()
+
+	var p, capture *entity.Payment
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		p, capture, err = s.reserveRefund(ctx, orderID, amount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.refund(ctx, p, capture)
+}
+
+// reserveRefund locks the order, checks amount is left to refund of its
+// captured total and reserves the refund, returning it with the capture it
+// refunds. It runs in the transaction of ctx, which must go on until the
+// refund is reserved for the lock to hold.
+func (s *PaymentService) reserveRefund(ctx context.Context, orderID, amount int) (*entity.Payment, *entity.Payment, error) {
+	order, err := s.getOrder(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch order.OrderStatus {
+	case entity.OrderStatusPaid, entity.OrderStatusShipped, entity.OrderStatusDelivered:
+	default:
+		return nil, nil, ErrInvalidOrderStatus
+	}
+	if order.RefundStatus == entity.RefundStatusRefunded {
+		return nil, nil, ErrInvalidOrderStatus
+	}
+
+	capture, err := s.findPayment(ctx, order.OrderID, entity.PaymentOperationCapture, entity.PaymentStatusSucceeded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refunded, err := s.refundedAmount(ctx, order.OrderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if amount <= 0 || refunded+amount > capture.Amount {
+		return nil, nil, ErrRefundExceedsCapture
+	}
+
+	p, err := s.reserve(ctx, order.OrderID, entity.PaymentOperationRefund, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return p, capture, nil
+}
+
+// refund makes the refund p was reserved for with reserveRefund.
+func (s *PaymentService) refund(ctx context.Context, p, capture *entity.Payment) (*entity.Payment, error) {
+	return s.attempt(ctx, p, func(ctx context.Context, key string) (string, error) {
+		return s.gateway.Refund(ctx, key, capture.GatewayReference, p.Amount)
+	})
+}
+
+// RefundableAmount is what is left to refund of the captured order total.
+func (s *PaymentService) RefundableAmount(ctx context.Context, orderID int) (int, error) {
+	ctx, span := startOperation(ctx, "PaymentService.RefundableAmount")
+	defer span.End()
+
+	capture, err := s.findPayment(ctx, orderID, entity.PaymentOperationCapture, entity.PaymentStatusSucceeded)
+	if err == ErrPaymentNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	refunded, err := s.refundedAmount(ctx, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	return capture.Amount - refunded, nil
+}
+
+// refundedAmount counts pending refunds too, they may have gone through.
+func (s *PaymentService) refundedAmount(ctx context.Context, orderID int) (int, error) {
+	query := `SELECT COALESCE(SUM(amount), 0) FROM payments WHERE order_id = $1 AND operation = $2 AND status <> $3`
+
+	var refunded int
+	err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, orderID, entity.PaymentOperationRefund, entity.PaymentStatusFailed).Scan(&refunded)
+	return refunded, err
+}
+
+// SettlePayment applies the asynchronous outcome of a pending gateway call,
+// as reported by a webhook of provider, which must be the provider the
+// payment was made with and report the amount and currency it was made for.
+// Payments already settled are returned unchanged, so the same event can be
+// applied any number of times.
+func (s *PaymentService) SettlePayment(ctx context.Context, provider, idempotencyKey string, amount int, currency, gatewayReference, failureCode string) (*entity.Payment, error) {
+	ctx, span := startOperation(ctx, "PaymentService.SettlePayment")
+	defer span.End()
+
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE idempotency_key = $1 AND provider = $2`
+
+	var p entity.Payment
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, idempotencyKey, provider).StructScan(&p); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+
+	if p.Amount != amount || p.Currency != currency {
+		return nil, ErrPaymentEventMismatch
+	}
+
+	if p.Status != entity.PaymentStatusPending {
+		return &p, nil
+	}
+
+	if err := s.record(ctx, &p, gatewayReference, failureCode); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// reserve records a gateway call in payments before it is made, with the
+// order locked by getOrder in the transaction ctx runs in. A call that timed
+// out stays pending and its idempotency key is reused by the next attempt of
+// the same operation and amount, so the gateway never runs it twice. A
+// concurrent attempt waits for the lock and reuses the key the same way.
+//
+// Refunds are the exception, an order can be refunded several times by the
+// same amount. A pending refund counts as refunded until it settles, so
+// another refund is a new one.
+func (s *PaymentService) reserve(ctx context.Context, orderID int, operation string, amount int) (*entity.Payment, error) {
+	insertQuery := `
+		INSERT INTO payments (order_id, operation, amount, status, provider, currency, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + paymentColumns
+
+	var p *entity.Payment
+	if operation != entity.PaymentOperationRefund {
+		var err error
+		p, err = s.findPayment(ctx, orderID, operation, entity.PaymentStatusPending)
+		if err != nil && err != ErrPaymentNotFound {
+			return nil, err
+		}
+	}
+
+	if p == nil || p.Amount != amount {
+		idempotencyKey, err := newIdempotencyKey()
+		if err != nil {
+			return nil, err
+		}
+
+		p = &entity.Payment{}
+		if err := database.Conn(ctx, s.db).QueryRowxContext(
+			ctx,
+			insertQuery,
+			orderID,
+			operation,
+			amount,
+			entity.PaymentStatusPending,
+			s.gateway.Provider(),
+			s.gateway.Currency(),
+			idempotencyKey,
+		).StructScan(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// attempt makes the gateway call p was reserved for and records its outcome.
+// A call that timed out leaves p pending.
+func (s *PaymentService) attempt(ctx context.Context, p *entity.Payment, call func(ctx context.Context, idempotencyKey string) (string, error)) (*entity.Payment, error) {
+	ref, callErr := call(ctx, p.IdempotencyKey)
+	if errors.Is(callErr, payment.ErrGatewayTimeout) {
+		return p, callErr
+	}
+
+	failureCode := ""
+	if callErr != nil {
+		failureCode = payment.DeclineCode(callErr)
+		if failureCode == "" {
+			failureCode = "gateway_error"
+		}
+	}
+
+	// the gateway already acted, its outcome is recorded even when the
+	// request went away meanwhile
+	if err := s.record(context.WithoutCancel(ctx), p, ref, failureCode); err != nil {
+		return nil, err
+	}
+
+	return p, callErr
+}
+
+// record stores the outcome of a pending payment, failed when failureCode is
+// set, and moves its order to the status that outcome leads to, in one
+// transaction. A payment another attempt with the same idempotency key
+// recorded first is reloaded into p instead.
+func (s *PaymentService) record(ctx context.Context, p *entity.Payment, gatewayReference, failureCode string) error {
+	succeededQuery := `UPDATE payments SET status = $1, gateway_reference = $2, updated_at = CURRENT_TIMESTAMP WHERE payment_id = $3 AND status = $4`
+	failedQuery := `UPDATE payments SET status = $1, failure_code = $2, updated_at = CURRENT_TIMESTAMP WHERE payment_id = $3 AND status = $4`
+	reloadQuery := `SELECT ` + paymentColumns + ` FROM payments WHERE payment_id = $1`
+
+	recorded := false
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tx := database.Conn(ctx, s.db)
+
+		var (
+			result sql.Result
+			err    error
+		)
+		if failureCode == "" {
+			result, err = tx.ExecContext(ctx, succeededQuery, entity.PaymentStatusSucceeded, gatewayReference, p.PaymentID, entity.PaymentStatusPending)
+		} else {
+			result, err = tx.ExecContext(ctx, failedQuery, entity.PaymentStatusFailed, failureCode, p.PaymentID, entity.PaymentStatusPending)
+		}
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			recorded = false
+			return tx.QueryRowxContext(ctx, reloadQuery, p.PaymentID).StructScan(p)
+		}
+
+		if failureCode == "" {
+			p.Status = entity.PaymentStatusSucceeded
+			p.GatewayReference = gatewayReference
+		} else {
+			p.Status = entity.PaymentStatusFailed
+			p.FailureCode = failureCode
+		}
+
+		if err := s.updateOrderStatus(ctx, p); err != nil {
+			return err
+		}
+		if p.Operation == entity.PaymentOperationRefund {
+			if err := s.settleRefund(ctx, p); err != nil {
+				return err
+			}
+		}
+
+		recorded = true
+		return nil
+	})
+	if err != nil || !recorded {
+		return err
+	}
+
+	switch {
+	case p.Operation == entity.PaymentOperationAuthorize && p.Status == entity.PaymentStatusSucceeded:
+		metrics.PaymentAuthorizations.Inc()
+	case payment.IsDeclineCode(failureCode):
+		metrics.PaymentDeclines.WithLabelValues(failureCode).Inc()
+	}
+	return nil
+}
+
+// settleRefund applies the outcome of the refund payment p to the refund
+// RefundService recorded for it, if any, in the transaction of ctx. The
+// items of a refund that went through go back in stock when it was recorded
+// to restock them, a refund that failed is deleted so its items can be
+// refunded again.
+func (s *PaymentService) settleRefund(ctx context.Context, p *entity.Payment) error {
+	deleteQuery := `DELETE FROM refunds WHERE payment_id = $1`
+	itemsQuery := `
+		SELECT oi.product_id, ri.quantity
+		FROM refund_items ri
+		JOIN refunds r ON r.refund_id = ri.refund_id
+		JOIN order_items oi ON oi.order_item_id = ri.order_item_id
+		WHERE r.payment_id = $1 AND r.restock
+		ORDER BY ri.refund_item_id
+	`
+	restockQuery := `UPDATE products SET stock_quantity = stock_quantity + $1 WHERE product_id = $2`
+
+	tx := database.Conn(ctx, s.db)
+
+	if p.Status == entity.PaymentStatusFailed {
+		_, err := tx.ExecContext(ctx, deleteQuery, p.PaymentID)
+		return err
+	}
+
+	var items []struct {
+		ProductID int `db:"product_id"`
+		Quantity  int `db:"quantity"`
+	}
+	if err := tx.SelectContext(ctx, &items, itemsQuery, p.PaymentID); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if _, err := tx.ExecContext(ctx, restockQuery, item.Quantity, item.ProductID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PaymentService) updateOrderStatus(ctx context.Context, p *entity.Payment) error {
+	totalsQuery := `
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE operation = $2), 0),
+			COALESCE(SUM(amount) FILTER (WHERE operation = $3), 0)
+		FROM payments WHERE order_id = $1 AND status = $4
+	`
+
+	succeeded := p.Status == entity.PaymentStatusSucceeded
+
+	var status string
+	switch {
+	case p.Operation == entity.PaymentOperationAuthorize && succeeded:
+		status = entity.OrderStatusAuthorized
+	case p.Operation == entity.PaymentOperationAuthorize:
+		status = entity.OrderStatusPaymentFailed
+	case p.Operation == entity.PaymentOperationCapture && succeeded:
+		status = entity.OrderStatusPaid
+	case p.Operation == entity.PaymentOperationVoid && succeeded:
+		status = entity.OrderStatusVoided
+	case p.Operation == entity.PaymentOperationRefund && succeeded:
+		var captured, refunded int
+		if err := database.Conn(ctx, s.db).QueryRowxContext(
+			ctx,
+			totalsQuery,
+			p.OrderID,
+			entity.PaymentOperationCapture,
+			entity.PaymentOperationRefund,
+			entity.PaymentStatusSucceeded,
+		).Scan(&captured, &refunded); err != nil {
+			return err
+		}
+
+		// a refund leaves the order status alone, a shipped or delivered order
+		// stays so
+		refundStatus := entity.RefundStatusPartiallyRefunded
+		if refunded >= captured {
+			refundStatus = entity.RefundStatusRefunded
+		}
+		return s.setRefundStatus(ctx, p.OrderID, refundStatus)
+	default:
+		// failed captures, voids and refunds leave the order as it was
+		return nil
+	}
+
+	return s.setOrderStatus(ctx, p.OrderID, status)
+}
+
+// getOrder locks the order until the transaction ctx runs in ends, so the
+// payment operations on it take turns.
+func (s *PaymentService) getOrder(ctx context.Context, orderID int) (*entity.Order, error) {
+	query := `SELECT order_id, user_id, total_amount, payment_method_id, order_status, refund_status FROM orders WHERE order_id = $1 FOR UPDATE`
+
+	var order entity.Order
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, orderID).StructScan(&order); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (s *PaymentService) findPayment(ctx context.Context, orderID int, operation, status string) (*entity.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 AND operation = $2 AND status = $3 ORDER BY payment_id DESC LIMIT 1`
+
+	var p entity.Payment
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, orderID, operation, status).StructScan(&p); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (s *PaymentService) getCard(ctx context.Context, paymentMethodID, userID int) (payment.Card, error) {
+	query := `SELECT card_token, expiration_date, card_holder_name FROM payment_methods WHERE payment_method_id = $1 AND user_id = $2`
+
+	var (
+		cardToken      string
+		expirationDate time.Time
+		holderName     string
+	)
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, paymentMethodID, userID).Scan(&cardToken, &expirationDate, &holderName); err != nil {
+		if err == sql.ErrNoRows {
+			return payment.Card{}, ErrPaymentMethodNotFound
+		}
+		return payment.Card{}, err
+	}
+
+	number, err := s.vault.Detokenize(ctx, cardToken)
+	if err != nil {
+		return payment.Card{}, err
+	}
+
+	return payment.Card{Number: number, ExpirationDate: expirationDate, HolderName: holderName}, nil
+}
+
+// setOrderStatus moves the order to status, unless it was cancelled meanwhile,
+// which no payment outcome undoes.
+func (s *PaymentService) setOrderStatus(ctx context.Context, orderID int, status string) error {
+	query := `UPDATE orders SET order_status = $1 WHERE order_id = $2 AND order_status <> $3`
+
+	_, err := database.Conn(ctx, s.db).ExecContext(ctx, query, status, orderID, entity.OrderStatusCancelled)
+	return err
+}
+
+// setRefundStatus records how much of the order was refunded, which a
+// cancellation does not change.
+func (s *PaymentService) setRefundStatus(ctx context.Context, orderID int, status string) error {
+	query := `UPDATE orders SET refund_status = $1 WHERE order_id = $2`
+
+	_, err := database.Conn(ctx, s.db).ExecContext(ctx, query, status, orderID)
+	return err
+}
+
+func newIdempotencyKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return "pay_" + hex.EncodeToString(buf), nil
+}
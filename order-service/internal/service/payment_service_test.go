@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+)
+
+var (
+	orderQuery         = `SELECT order_id, user_id, total_amount, payment_method_id, order_status, refund_status FROM orders WHERE order_id = $1 FOR UPDATE`
+	cardQuery          = `SELECT card_token, expiration_date, card_holder_name FROM payment_methods WHERE payment_method_id = $1 AND user_id = $2`
+	findPaymentQuery   = `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 AND operation = $2 AND status = $3 ORDER BY payment_id DESC LIMIT 1`
+	insertPaymentQuery = `
+		INSERT INTO payments (order_id, operation, amount, status, provider, currency, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + paymentColumns
+	paymentSucceededQuery = `UPDATE payments SET status = $1, gateway_reference = $2, updated_at = CURRENT_TIMESTAMP WHERE payment_id = $3 AND status = $4`
+	paymentFailedQuery    = `UPDATE payments SET status = $1, failure_code = $2, updated_at = CURRENT_TIMESTAMP WHERE payment_id = $3 AND status = $4`
+	orderStatusQuery      = `UPDATE orders SET order_status = $1 WHERE order_id = $2 AND order_status <> $3`
+	refundStatusQuery     = `UPDATE orders SET refund_status = $1 WHERE order_id = $2`
+	paymentColumnNames    = []string{"payment_id", "order_id", "operation", "amount", "status", "provider", "currency", "idempotency_key", "gateway_reference", "failure_code", "created_at"}
+)
+
+func setupPaymentService(t *testing.T) (*PaymentService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	paymentService := NewPaymentService(sqlx.NewDb(db, "postgres"), newFakeVault(), payment.NewFakeGateway())
+	return paymentService, mock
+}
+
+func expectOrder(mock sqlmock.Sqlmock, status string) {
+	expectRefundedOrder(mock, status, entity.RefundStatusNone)
+}
+
+func expectRefundedOrder(mock sqlmock.Sqlmock, status, refundStatus string) {
+	mock.ExpectQuery(regexp.QuoteMeta(orderQuery)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "user_id", "total_amount", "payment_method_id", "order_status", "refund_status"}).
+			AddRow(1, 1, 1000, 1, status, refundStatus))
+}
+
+func TestAuthorizeOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		cardNumber      string
+		wantErr         error
+		wantStatus      string
+		wantOrderStatus string
+	}{
+		{
+			name:            "approved",
+			cardNumber:      "4242424242424242",
+			wantErr:         nil,
+			wantStatus:      entity.PaymentStatusSucceeded,
+			wantOrderStatus: entity.OrderStatusAuthorized,
+		},
+		{
+			name:            "declined",
+			cardNumber:      payment.FakeCardDeclined,
+			wantErr:         payment.ErrCardDeclined,
+			wantStatus:      entity.PaymentStatusFailed,
+			wantOrderStatus: entity.OrderStatusPaymentFailed,
+		},
+		{
+			name:       "timeout",
+			cardNumber: payment.FakeCardTimeout,
+			wantErr:    payment.ErrGatewayTimeout,
+			wantStatus: entity.PaymentStatusPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paymentService, mock := setupPaymentService(t)
+			cardToken, _ := paymentService.vault.Tokenize(context.Background(), tt.cardNumber)
+
+			mock.ExpectBegin()
+			expectOrder(mock, entity.OrderStatusPendingPayment)
+			mock.ExpectQuery(regexp.QuoteMeta(cardQuery)).
+				WithArgs(1, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"card_token", "expiration_date", "card_holder_name"}).
+					AddRow(cardToken, time.Date(2040, time.December, 31, 0, 0, 0, 0, time.UTC), "John Doe"))
+			mock.ExpectQuery(regexp.QuoteMeta(findPaymentQuery)).
+				WithArgs(1, entity.PaymentOperationAuthorize, entity.PaymentStatusPending).
+				WillReturnRows(sqlmock.NewRows(paymentColumnNames))
+			mock.ExpectQuery(regexp.QuoteMeta(insertPaymentQuery)).
+				WithArgs(1, entity.PaymentOperationAuthorize, 1000, entity.PaymentStatusPending, "fake", "USD", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows(paymentColumnNames).
+					AddRow(1, 1, entity.PaymentOperationAuthorize, 1000, entity.PaymentStatusPending, "fake", "USD", "pay_1", "", "", "2024-01-01T00:00:00Z"))
+			mock.ExpectCommit()
+
+			if tt.wantStatus != entity.PaymentStatusPending {
+				mock.ExpectBegin()
+			}
+			switch tt.wantStatus {
+			case entity.PaymentStatusSucceeded:
+				mock.ExpectExec(regexp.QuoteMeta(paymentSucceededQuery)).
+					WithArgs(entity.PaymentStatusSucceeded, sqlmock.AnyArg(), 1, entity.PaymentStatusPending).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			case entity.PaymentStatusFailed:
+				mock.ExpectExec(regexp.QuoteMeta(paymentFailedQuery)).
+					WithArgs(entity.PaymentStatusFailed, "card_declined", 1, entity.PaymentStatusPending).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			if tt.wantOrderStatus != "" {
+				mock.ExpectExec(regexp.QuoteMeta(orderStatusQuery)).
+					WithArgs(tt.wantOrderStatus, 1, entity.OrderStatusCancelled).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			authorized := testutil.ToFloat64(metrics.PaymentAuthorizations)
+			declined := testutil.ToFloat64(metrics.PaymentDeclines.WithLabelValues("card_declined"))
+
+			got, err := paymentService.AuthorizeOrder(context.Background(), 1, 1)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.NoError(t, mock.ExpectationsWereMet())
+
+			wantAuthorized, wantDeclined := authorized, declined
+			switch tt.wantStatus {
+			case entity.PaymentStatusSucceeded:
+				wantAuthorized++
+			case entity.PaymentStatusFailed:
+				wantDeclined++
+			}
+			assert.Equal(t, wantAuthorized, testutil.ToFloat64(metrics.PaymentAuthorizations))
+			assert.Equal(t, wantDeclined, testutil.ToFloat64(metrics.PaymentDeclines.WithLabelValues("card_declined")))
+		})
+	}
+}
+
+func TestAuthorizeOrderReusesPendingAttempt(t *testing.T) {
+	paymentService, mock := setupPaymentService(t)
+	cardToken, _ := paymentService.vault.Tokenize(context.Background(), "4242424242424242")
+
+	mock.ExpectBegin()
+	expectOrder(mock, entity.OrderStatusPendingPayment)
+	mock.ExpectQuery(regexp.QuoteMeta(cardQuery)).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"card_token", "expiration_date", "card_holder_name"}).
+			AddRow(cardToken, time.Date(2040, time.December, 31, 0, 0, 0, 0, time.UTC), "John Doe"))
+	mock.ExpectQuery(regexp.QuoteMeta(findPaymentQuery)).
+		WithArgs(1, entity.PaymentOperationAuthorize, entity.PaymentStatusPending).
+		WillReturnRows(sqlmock.NewRows(paymentColumnNames).
+			AddRow(7, 1, entity.PaymentOperationAuthorize, 1000, entity.PaymentStatusPending, "fake", "USD", "pay_timed_out", "", "", "2024-01-01T00:00:00Z"))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(paymentSucceededQuery)).
+		WithArgs(entity.PaymentStatusSucceeded, sqlmock.AnyArg(), 7, entity.PaymentStatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(orderStatusQuery)).
+		WithArgs(entity.OrderStatusAuthorized, 1, entity.OrderStatusCancelled).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	got, err := paymentService.AuthorizeOrder(context.Background(), 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, got.PaymentID)
+	assert.Equal(t, "pay_timed_out", got.IdempotencyKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthorizeOrderInvalidStatus(t *testing.T) {
+	paymentService, mock := setupPaymentService(t)
+
+	mock.ExpectBegin()
+	expectOrder(mock, entity.OrderStatusPaid)
+	mock.ExpectRollback()
+
+	_, err := paymentService.AuthorizeOrder(context.Background(), 1, 1)
+	assert.ErrorIs(t, err, ErrInvalidOrderStatus)
+
+	mock.ExpectBegin()
+	expectOrder(mock, entity.OrderStatusPendingPayment)
+	mock.ExpectRollback()
+
+	_, err = paymentService.AuthorizeOrder(context.Background(), 1, 2)
+	assert.ErrorIs(t, err, ErrOrderNotFound, "other users' orders should not be found")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPayOrderRetriesCaptureOfAuthorizedOrder(t *testing.T) {
+	paymentService, mock := setupPaymentService(t)
+	authorizationRef, err := paymentService.gateway.Authorize(context.Background(), "pay_auth", payment.Card{
+		Number:         "4242424242424242",
+		ExpirationDate: time.Date(2040, time.December, 31, 0, 0, 0, 0, time.UTC),
+	}, 1000)
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	expectOrder(mock, entity.OrderStatusAuthorized)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectOrder(mock, entity.OrderStatusAuthorized)
+	mock.ExpectQuery(regexp.QuoteMeta(findPaymentQuery)).
+		WithArgs(1, entity.PaymentOperationAuthorize, entity.PaymentStatusSucceeded).
+		WillReturnRows(sqlmock.NewRows(paymentColumnNames).
+			AddRow(1, 1, entity.PaymentOperationAuthorize, 1000, entity.PaymentStatusSucceeded, "fake", "USD", "pay_auth", authorizationRef, "", "2024-01-01T00:00:00Z"))
+	mock.ExpectQuery(regexp.QuoteMeta(findPaymentQuery)).
+		WithArgs(1, entity.PaymentOperationCapture, entity.PaymentStatusPending).
+		WillReturnRows(sqlmock.NewRows(paymentColumnNames).
+			AddRow(2, 1, entity.PaymentOperationCapture, 1000, entity.PaymentStatusPending, "fake", "USD", "pay_timed_out", "", "", "2024-01-01T00:00:00Z"))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(paymentSucceededQuery)).
+		WithArgs(entity.PaymentStatusSucceeded, sqlmock.AnyArg(), 2, entity.PaymentStatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(orderStatusQuery)).
+		WithArgs(entity.OrderStatusPaid, 1, entity.OrderStatusCancelled).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	got, err := paymentService.PayOrder(context.Background(), 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.PaymentOperationCapture, got.Operation)
+	assert.Equal(t, "pay_timed_out", got.IdempotencyKey, "the pending capture should be retried with its key")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefundOrderExceedsCapture(t *testing.T) {
+	paymentService, mock := setupPaymentService(t)
+	refundedQuery := `SELECT COALESCE(SUM(amount), 0) FROM payments WHERE order_id = $1 AND operation = $2 AND status <> $3`
+
+	mock.ExpectBegin()
+	expectRefundedOrder(mock, entity.OrderStatusDelivered, entity.RefundStatusPartiallyRefunded)
+	mock.ExpectQuery(regexp.QuoteMeta(findPaymentQuery)).
+		WithArgs(1, entity.PaymentOperationCapture, entity.PaymentStatusSucceeded).
+		WillReturnRows(sqlmock.NewRows(paymentColumnNames).
+			AddRow(2, 1, entity.PaymentOperationCapture, 1000, entity.PaymentStatusSucceeded, "fake", "USD", "pay_2", "cap_1", "", "2024-01-01T00:00:00Z"))
+	mock.ExpectQuery(regexp.QuoteMeta(refundedQuery)).
+		WithArgs(1, entity.PaymentOperationRefund, entity.PaymentStatusFailed).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(800))
+	mock.ExpectRollback()
+
+	_, err := paymentService.RefundOrder(context.Background(), 1, 300)
+	assert.ErrorIs(t, err, ErrRefundExceedsCapture)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
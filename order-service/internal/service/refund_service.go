@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+type RefundService struct {
+	db       *sqlx.DB
+	tx       *database.TxManager
+	payments *PaymentService
+}
+
+var (
+	ErrOrderItemNotFound      = errors.New("order item not found")
+	ErrRefundQuantityExceeded = errors.New("refund quantity exceeds what is left to refund")
+	ErrNothingToRefund        = errors.New("nothing left to refund")
+)
+
+// refundableItem is an order item with the quantity already refunded.
+type refundableItem struct {
+	OrderItemID  int `db:"order_item_id"`
+	ProductID    int `db:"product_id"`
+	Quantity     int `db:"quantity"`
+	PricePerUnit int `db:"price_per_unit"`
+	Refunded     int `db:"refunded"`
+}
+
+func NewRefundService(db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway) *RefundService {
+	return &RefundService{
+		db:       db,
+		tx:       database.NewTxManager(db, nil),
+		payments: NewPaymentService(db, cardVault, gateway),
+	}
+}
+
+// RefundOrder gives back the order items in payload, or everything not
+// refunded yet when it lists none, and puts the refunded quantities back in
+// stock. Nothing is recorded if the gateway declines the refund.
+func (s *RefundService) RefundOrder(ctx context.Context, orderID, adminID int, payload dto.RefundPayload) (*entity.Refund, error) {
+	ctx, span := startOperation(ctx, "RefundService.RefundOrder")
+	defer span.End()
+
+	return s.refund(ctx, orderID, adminID, payload, refundOptions{restock: true})
+}
+
+// RefundReturnedItems is RefundOrder for the items that came back through
+// the return returnID, whose inspection already decided what goes back in
+// stock. Only what is left to refund of each item is refunded, items refunded
+// otherwise since the return was requested are skipped, and
+// ErrNothingToRefund is returned when none is left. The refund is recorded
+// as the refund of the return, a retried return gets the refund made the
+// first time, resumed at the gateway if it is still pending.
+func (s *RefundService) RefundReturnedItems(ctx context.Context, orderID, returnID, adminID int, payload dto.RefundPayload) (*entity.Refund, error) {
+	ctx, span := startOperation(ctx, "RefundService.RefundReturnedItems")
+	defer span.End()
+
+	return s.refund(ctx, orderID, adminID, payload, refundOptions{returnID: returnID})
+}
+
+// cancellationRefundReason is the reason shown for the refund a cancellation
+// makes.
+const cancellationRefundReason = "order cancelled"
+
+// RefundCancelledOrder refunds everything not refunded yet of an order userID
+// is cancelling, without restocking, the cancellation releases the stock of
+// the whole order. The refund is recorded as the cancellation of the order, a
+// retried cancellation gets the refund made the first time, resumed at the
+// gateway if it is still pending.
+func (s *RefundService) RefundCancelledOrder(ctx context.Context, orderID, userID int) (*entity.Refund, error) {
+	ctx, span := startOperation(ctx, "RefundService.RefundCancelledOrder")
+	defer span.End()
+
+	return s.refund(ctx, orderID, userID, dto.RefundPayload{Reason: cancellationRefundReason}, refundOptions{cancellation: true})
+}
+
+// refundOptions tell how refund makes a refund.
+type refundOptions struct {
+	// restock puts the refunded items back in stock once the refund goes
+	// through.
+	restock bool
+	// cancellation records the refund as the one cancelling the order, and
+	// returns the refund already recorded so instead of making another.
+	cancellation bool
+	// returnID records the refund as the refund of that return, returns the
+	// refund already recorded so instead of making another, and refunds only
+	// what is left of each item in the payload.
+	returnID int
+}
+
+// refund reserves the refund with the order locked, so concurrent refunds
+// never give back the same items or more than was captured, then makes it.
+// Recording the outcome of the refund payment restocks its items when
+// opts.restock is set, or deletes the refund when it failed, see
+// PaymentService.settleRefund. A refund the gateway timed out on stays
+// reserved until the provider webhook settles it the same way.
+//
+// A refund opts tells to return instead of making another is tried again at
+// the gateway with the same idempotency key while it is pending.
+func (s *RefundService) refund(ctx context.Context, orderID, adminID int, payload dto.RefundPayload, opts refundOptions) (*entity.Refund, error) {
+	var (
+		p, capture *entity.Payment
+		refund     *entity.Refund
+	)
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.payments.getOrder(ctx, orderID); err != nil {
+			return err
+		}
+
+		var err error
+		switch {
+		case opts.cancellation:
+			refund, p, err = s.findCancellationRefund(ctx, orderID)
+		case opts.returnID != 0:
+			refund, p, err = s.findRefund(ctx, `r.refund_id = (SELECT refund_id FROM returns WHERE return_id = $1)`, opts.returnID)
+		}
+		if err != nil {
+			return err
+		}
+		if refund != nil {
+			if p.Status == entity.PaymentStatusPending {
+				capture, err = s.payments.findPayment(ctx, orderID, entity.PaymentOperationCapture, entity.PaymentStatusSucceeded)
+			}
+			return err
+		}
+
+		lines, amount, err := s.refundLines(ctx, orderID, payload, opts.returnID != 0)
+		if err != nil {
+			return err
+		}
+
+		p, capture, err = s.payments.reserveRefund(ctx, orderID, amount)
+		if err != nil {
+			return err
+		}
+
+		refund, err = s.recordRefund(ctx, orderID, adminID, p, payload.Reason, opts, lines)
+		if err != nil || opts.returnID == 0 {
+			return err
+		}
+
+		// a refund whose payment fails is deleted, which unsets refund_id
+		_, err = database.Conn(ctx, s.db).ExecContext(ctx, `UPDATE returns SET refund_id = $1 WHERE return_id = $2`, refund.RefundID, opts.returnID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Status == entity.PaymentStatusPending {
+		if _, err := s.payments.refund(ctx, p, capture); err != nil {
+			return nil, err
+		}
+	}
+
+	return refund, nil
+}
+
+// findCancellationRefund finds the refund recorded as the cancellation of
+// the order, see findRefund.
+func (s *RefundService) findCancellationRefund(ctx context.Context, orderID int) (*entity.Refund, *entity.Payment, error) {
+	return s.findRefund(ctx, `r.order_id = $1 AND r.cancellation`, orderID)
+}
+
+// findRefund finds the latest refund matching the condition where on the
+// refunds r, whose payment did not fail, with that payment, or nil when there
+// is none. The arguments of where are numbered from $1.
+func (s *RefundService) findRefund(ctx context.Context, where string, args ...any) (*entity.Refund, *entity.Payment, error) {
+	refundQuery := fmt.Sprintf(`
+		SELECT r.refund_id, r.order_id, r.payment_id, r.amount, r.reason, COALESCE(r.created_by, 0) AS created_by, r.created_at
+		FROM refunds r
+		JOIN payments p ON p.payment_id = r.payment_id
+		WHERE %s AND p.status <> $%d
+		ORDER BY r.refund_id DESC
+		LIMIT 1
+	`, where, len(args)+1)
+	paymentQuery := `SELECT ` + paymentColumns + ` FROM payments WHERE payment_id = $1`
+	itemsQuery := `
+		SELECT refund_item_id, refund_id, order_item_id, quantity, amount
+		FROM refund_items WHERE refund_id = $1 ORDER BY refund_item_id
+	`
+
+	tx := database.Conn(ctx, s.db)
+
+	var refund entity.Refund
+	if err := tx.QueryRowxContext(ctx, refundQuery, append(args, entity.PaymentStatusFailed)...).StructScan(&refund); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var p entity.Payment
+	if err := tx.QueryRowxContext(ctx, paymentQuery, refund.PaymentID).StructScan(&p); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.SelectContext(ctx, &refund.Items, itemsQuery, refund.RefundID); err != nil {
+		return nil, nil, err
+	}
+
+	return &refund, &p, nil
+}
+
+// refundLines works out the refund lines of payload and their amount, from
+// the order items with the quantities refunded so far, with the order locked
+// in the transaction of ctx. An item listed for more than is left to refund
+// fails with ErrRefundQuantityExceeded, unless upToLeft is set, which refunds
+// what is left instead.
+func (s *RefundService) refundLines(ctx context.Context, orderID int, payload dto.RefundPayload, upToLeft bool) ([]entity.RefundItem, int, error) {
+	// a refund whose payment failed gave nothing back
+	itemsQuery := `
+		SELECT oi.order_item_id, oi.product_id, oi.quantity, oi.price_per_unit, COALESCE(SUM(ri.quantity), 0) AS refunded
+		FROM order_items oi
+		LEFT JOIN refund_items ri ON ri.order_item_id = oi.order_item_id AND ri.refund_id IN (
+			SELECT r.refund_id FROM refunds r
+			JOIN payments p ON p.payment_id = r.payment_id
+			WHERE p.status <> $2
+		)
+		WHERE oi.order_id = $1
+		GROUP BY oi.order_item_id
+		ORDER BY oi.order_item_id
+	`
+
+	var items []refundableItem
+	if err := database.Conn(ctx, s.db).SelectContext(ctx, &items, itemsQuery, orderID, entity.PaymentStatusFailed); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		lines  []entity.RefundItem
+		amount int
+	)
+	if len(payload.Items) == 0 {
+		for _, item := range items {
+			if remaining := item.Quantity - item.Refunded; remaining > 0 {
+				lines = append(lines, entity.RefundItem{
+					OrderItemID: item.OrderItemID,
+					Quantity:    remaining,
+					Amount:      remaining * item.PricePerUnit,
+				})
+			}
+		}
+
+		// a full refund also gives back what was charged outside the items
+		refundable, err := s.payments.RefundableAmount(ctx, orderID)
+		if err != nil {
+			return nil, 0, err
+		}
+		amount = refundable
+	} else {
+		requested := map[int]int{}
+		for _, line := range payload.Items {
+			requested[line.OrderItemID] += line.Quantity
+		}
+
+		for _, line := range payload.Items {
+			quantity, ok := requested[line.OrderItemID]
+			if !ok {
+				// listed twice, already merged into the first line
+				continue
+			}
+			delete(requested, line.OrderItemID)
+
+			item, ok := findRefundableItem(items, line.OrderItemID)
+			if !ok {
+				return nil, 0, ErrOrderItemNotFound
+			}
+			if left := item.Quantity - item.Refunded; quantity > left {
+				if !upToLeft {
+					return nil, 0, ErrRefundQuantityExceeded
+				}
+				quantity = left
+			}
+			if quantity <= 0 {
+				continue
+			}
+
+			lines = append(lines, entity.RefundItem{
+				OrderItemID: item.OrderItemID,
+				Quantity:    quantity,
+				Amount:      quantity * item.PricePerUnit,
+			})
+			amount += quantity * item.PricePerUnit
+		}
+	}
+
+	if amount <= 0 {
+		return nil, 0, ErrNothingToRefund
+	}
+
+	return lines, amount, nil
+}
+
+// recordRefund records the refund p was reserved for and its lines, in the
+// transaction of ctx.
+func (s *RefundService) recordRefund(ctx context.Context, orderID, adminID int, p *entity.Payment, reason string, opts refundOptions, lines []entity.RefundItem) (*entity.Refund, error) {
+	refundQuery := `
+		INSERT INTO refunds (order_id, payment_id, amount, reason, created_by, restock, cancellation)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING refund_id, order_id, payment_id, amount, reason, COALESCE(created_by, 0) AS created_by, created_at
+	`
+	itemQuery := `
+		INSERT INTO refund_items (refund_id, order_item_id, quantity, amount)
+		VALUES ($1, $2, $3, $4)
+		RETURNING refund_item_id
+	`
+
+	tx := database.Conn(ctx, s.db)
+
+	var refund entity.Refund
+	if err := tx.QueryRowxContext(ctx, refundQuery, orderID, p.PaymentID, p.Amount, reason, adminID, opts.restock, opts.cancellation).StructScan(&refund); err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		line.RefundID = refund.RefundID
+		if err := tx.QueryRowxContext(ctx, itemQuery, line.RefundID, line.OrderItemID, line.Quantity, line.Amount).Scan(&line.RefundItemID); err != nil {
+			return nil, err
+		}
+		refund.Items = append(refund.Items, line)
+	}
+
+	return &refund, nil
+}
+
+func (s *RefundService) ListOrderRefunds(ctx context.Context, orderID int) ([]entity.Refund, error) {
+	ctx, span := startOperation(ctx, "RefundService.ListOrderRefunds")
+	defer span.End()
+
+	refundsQuery := `
+		SELECT refund_id, order_id, payment_id, amount, reason, COALESCE(created_by, 0) AS created_by, created_at
+		FROM refunds WHERE order_id = $1 ORDER BY refund_id
+	`
+	itemsQuery := `
+		SELECT ri.refund_item_id, ri.refund_id, ri.order_item_id, ri.quantity, ri.amount
+		FROM refund_items ri
+		JOIN refunds r ON r.refund_id = ri.refund_id
+		WHERE r.order_id = $1
+		ORDER BY ri.refund_item_id
+	`
+
+	var refunds []entity.Refund
+	if err := database.Conn(ctx, s.db).SelectContext(ctx, &refunds, refundsQuery, orderID); err != nil {
+		return nil, err
+	}
+
+	var items []entity.RefundItem
+	if err := database.Conn(ctx, s.db).SelectContext(ctx, &items, itemsQuery, orderID); err != nil {
+		return nil, err
+	}
+
+	for i := range refunds {
+		for _, item := range items {
+			if item.RefundID == refunds[i].RefundID {
+				refunds[i].Items = append(refunds[i].Items, item)
+			}
+		}
+	}
+
+	return refunds, nil
+}
+
+func findRefundableItem(items []refundableItem, orderItemID int) (refundableItem, bool) {
+	for _, item := range items {
+		if item.OrderItemID == orderItemID {
+			return item, true
+		}
+	}
+	return refundableItem{}, false
+}
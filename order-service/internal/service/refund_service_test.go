@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+)
+
+var (
+	refundableItemsQuery = `
+		SELECT oi.order_item_id, oi.product_id, oi.quantity, oi.price_per_unit, COALESCE(SUM(ri.quantity), 0) AS refunded
+		FROM order_items oi
+		LEFT JOIN refund_items ri ON ri.order_item_id = oi.order_item_id AND ri.refund_id IN (
+			SELECT r.refund_id FROM refunds r
+			JOIN payments p ON p.payment_id = r.payment_id
+			WHERE p.status <> $2
+		)
+		WHERE oi.order_id = $1
+		GROUP BY oi.order_item_id
+		ORDER BY oi.order_item_id
+	`
+	refundableItemColumns = []string{"order_item_id", "product_id", "quantity", "price_per_unit", "refunded"}
+)
+
+func setupRefundService(t *testing.T) (*RefundService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	refundService := NewRefundService(sqlx.NewDb(db, "postgres"), newFakeVault(), payment.NewFakeGateway())
+	return refundService, mock
+}
+
+func TestRefundOrderItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   []dto.RefundItemPayload
+		wantErr error
+	}{
+		{
+			name:    "unknown order item",
+			items:   []dto.RefundItemPayload{{OrderItemID: 9, Quantity: 1}},
+			wantErr: ErrOrderItemNotFound,
+		},
+		{
+			name:    "more than what is left",
+			items:   []dto.RefundItemPayload{{OrderItemID: 1, Quantity: 2}},
+			wantErr: ErrRefundQuantityExceeded,
+		},
+		{
+			name: "duplicate lines add up",
+			items: []dto.RefundItemPayload{
+				{OrderItemID: 2, Quantity: 1},
+				{OrderItemID: 2, Quantity: 1},
+			},
+			wantErr: ErrRefundQuantityExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refundService, mock := setupRefundService(t)
+
+			mock.ExpectBegin()
+			expectOrder(mock, entity.OrderStatusPaid)
+			mock.ExpectQuery(regexp.QuoteMeta(refundableItemsQuery)).
+				WithArgs(1, entity.PaymentStatusFailed).
+				WillReturnRows(sqlmock.NewRows(refundableItemColumns).
+					AddRow(1, 1, 2, 300, 1).
+					AddRow(2, 2, 1, 400, 0))
+			mock.ExpectRollback()
+
+			_, err := refundService.RefundOrder(context.Background(), 1, 1, dto.RefundPayload{Items: tt.items})
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRefundOrderNothingLeft(t *testing.T) {
+	refundService, mock := setupRefundService(t)
+
+	capturedQuery := `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 AND operation = $2 AND status = $3 ORDER BY payment_id DESC LIMIT 1`
+	refundedQuery := `SELECT COALESCE(SUM(amount), 0) FROM payments WHERE order_id = $1 AND operation = $2 AND status <> $3`
+
+	mock.ExpectBegin()
+	expectRefundedOrder(mock, entity.OrderStatusPaid, entity.RefundStatusRefunded)
+	mock.ExpectQuery(regexp.QuoteMeta(refundableItemsQuery)).
+		WithArgs(1, entity.PaymentStatusFailed).
+		WillReturnRows(sqlmock.NewRows(refundableItemColumns).AddRow(1, 1, 2, 500, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(capturedQuery)).
+		WithArgs(1, entity.PaymentOperationCapture, entity.PaymentStatusSucceeded).
+		WillReturnRows(sqlmock.NewRows(paymentColumnNames).
+			AddRow(1, 1, entity.PaymentOperationCapture, 1000, entity.PaymentStatusSucceeded, "fake", "USD", "pay_1", "cap_1", "", "2024-01-01T00:00:00Z"))
+	mock.ExpectQuery(regexp.QuoteMeta(refundedQuery)).
+		WithArgs(1, entity.PaymentOperationRefund, entity.PaymentStatusFailed).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1000))
+	mock.ExpectRollback()
+
+	_, err := refundService.RefundOrder(context.Background(), 1, 1, dto.RefundPayload{})
+	assert.ErrorIs(t, err, ErrNothingToRefund)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+	"github.com/mathesukkj/goecommerce/order-service/internal/vault"
+)
+
+const returnColumns = `return_id, order_id, status, label_code, rejection_reason, COALESCE(refund_id, 0) AS refund_id, created_at, updated_at`
+
+type ReturnService struct {
+	db      *sqlx.DB
+	tx      *database.TxManager
+	refunds *RefundService
+	window  time.Duration
+}
+
+var (
+	ErrReturnNotFound          = errors.New("return not found")
+	ErrOrderNotDelivered       = errors.New("order was not delivered")
+	ErrReturnWindowClosed      = errors.New("order can no longer be returned")
+	ErrReturnQuantityExceeded  = errors.New("return quantity exceeds what is left to return")
+	ErrInvalidReturnStatus     = errors.New("invalid return status for this operation")
+	ErrReturnInspectionMissing = errors.New("every returned item must be inspected")
+)
+
+// returnableItem is an order item with the quantity already refunded and the
+// quantity in returns still open.
+type returnableItem struct {
+	OrderItemID int `db:"order_item_id"`
+	Quantity    int `db:"quantity"`
+	Refunded    int `db:"refunded"`
+	InReturn    int `db:"in_return"`
+}
+
+func NewReturnService(db *sqlx.DB, cardVault vault.Vault, gateway payment.PaymentGateway, window time.Duration) *ReturnService {
+	return &ReturnService{
+		db:      db,
+		tx:      database.NewTxManager(db, nil),
+		refunds: NewRefundService(db, cardVault, gateway),
+		window:  window,
+	}
+}
+
+// RequestReturn opens a return for items of a delivered order of userID,
+// which an admin then approves or rejects.
+func (s *ReturnService) RequestReturn(ctx context.Context, orderID, userID int, payload dto.ReturnPayload) (*entity.Return, error) {
+	ctx, span := startOperation(ctx, "ReturnService.RequestReturn")
+	defer span.End()
+
+	orderQuery := `
+		SELECT
+			order_status,
+			delivered_at IS NOT NULL AS delivered,
+			COALESCE(delivered_at >= CURRENT_TIMESTAMP - $3 * INTERVAL '1 second', FALSE) AS within_window
+		FROM orders WHERE order_id = $1 AND user_id = $2
+		FOR UPDATE
+	`
+	itemsQuery := `
+		SELECT
+			oi.order_item_id,
+			oi.quantity,
+			COALESCE((SELECT SUM(ri.quantity) FROM refund_items ri WHERE ri.order_item_id = oi.order_item_id), 0) AS refunded,
+			COALESCE((
+				SELECT SUM(rti.quantity) FROM return_items rti
+				JOIN returns r ON r.return_id = rti.return_id
+				WHERE rti.order_item_id = oi.order_item_id AND r.status IN ($2, $3, $4)
+			), 0) AS in_return
+		FROM order_items oi
+		WHERE oi.order_id = $1
+		ORDER BY oi.order_item_id
+	`
+	returnQuery := `
+		INSERT INTO returns (order_id, status)
+		VALUES ($1, $2)
+		RETURNING ` + returnColumns
+	itemQuery := `
+		INSERT INTO return_items (return_id, order_item_id, quantity, reason_code)
+		VALUES ($1, $2, $3, $4)
+		RETURNING return_item_id
+	`
+
+	var ret entity.Return
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tx := database.Conn(ctx, s.db)
+
+		// the order row lock keeps concurrent requests from returning the
+		// same items twice
+		var order struct {
+			OrderStatus  string `db:"order_status"`
+			Delivered    bool   `db:"delivered"`
+			WithinWindow bool   `db:"within_window"`
+		}
+		if err := tx.QueryRowxContext(ctx, orderQuery, orderID, userID, int(s.window.Seconds())).StructScan(&order); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+
+		if order.OrderStatus != entity.OrderStatusDelivered || !order.Delivered {
+			return ErrOrderNotDelivered
+		}
+		if !order.WithinWindow {
+			return ErrReturnWindowClosed
+		}
+
+		var items []returnableItem
+		if err := tx.SelectContext(
+			ctx,
+			&items,
+			itemsQuery,
+			orderID,
+			entity.ReturnStatusRequested,
+			entity.ReturnStatusApproved,
+			entity.ReturnStatusReceived,
+		); err != nil {
+			return err
+		}
+
+		requested := map[int]int{}
+		for _, line := range payload.Items {
+			requested[line.OrderItemID] += line.Quantity
+		}
+		for orderItemID, quantity := range requested {
+			item, ok := findReturnableItem(items, orderItemID)
+			if !ok {
+				return ErrOrderItemNotFound
+			}
+			if quantity > item.Quantity-item.Refunded-item.InReturn {
+				return ErrReturnQuantityExceeded
+			}
+		}
+
+		// a retried transaction starts over
+		ret = entity.Return{}
+		if err := tx.QueryRowxContext(ctx, returnQuery, orderID, entity.ReturnStatusRequested).StructScan(&ret); err != nil {
+			return err
+		}
+
+		for _, line := range payload.Items {
+			item := entity.ReturnItem{
+				ReturnID:    ret.ReturnID,
+				OrderItemID: line.OrderItemID,
+				Quantity:    line.Quantity,
+				ReasonCode:  line.ReasonCode,
+			}
+			if err := tx.QueryRowxContext(ctx, itemQuery, item.ReturnID, item.OrderItemID, item.Quantity, item.ReasonCode).Scan(&item.ReturnItemID); err != nil {
+				return err
+			}
+			ret.Items = append(ret.Items, item)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (s *ReturnService) ListOrderReturns(ctx context.Context, orderID, userID int) ([]entity.Return, error) {
+	ctx, span := startOperation(ctx, "ReturnService.ListOrderReturns")
+	defer span.End()
+
+	returnsQuery := `
+		SELECT ` + returnColumns + ` FROM returns
+		WHERE order_id = $1 AND order_id IN (SELECT order_id FROM orders WHERE user_id = $2)
+		ORDER BY return_id
+	`
+
+	var returns []entity.Return
+	if err := database.Conn(ctx, s.db).SelectContext(ctx, &returns, returnsQuery, orderID, userID); err != nil {
+		return nil, err
+	}
+
+	for i := range returns {
+		items, err := s.getItems(ctx, returns[i].ReturnID)
+		if err != nil {
+			return nil, err
+		}
+		returns[i].Items = items
+	}
+
+	return returns, nil
+}
+
+// GetReturn finds a return for an order of userID, the returns of other
+// users are not found.
+func (s *ReturnService) GetReturn(ctx context.Context, returnID, userID int) (*entity.Return, error) {
+	ctx, span := startOperation(ctx, "ReturnService.GetReturn")
+	defer span.End()
+
+	return s.getReturn(ctx, returnID, userID)
+}
+
+// GetAnyReturn is GetReturn for admins, whoever the order is of.
+func (s *ReturnService) GetAnyReturn(ctx context.Context, returnID int) (*entity.Return, error) {
+	ctx, span := startOperation(ctx, "ReturnService.GetAnyReturn")
+	defer span.End()
+
+	return s.getReturn(ctx, returnID, 0)
+}
+
+// getReturn finds a return for an order of userID, of any user when userID
+// is 0.
+func (s *ReturnService) getReturn(ctx context.Context, returnID, userID int) (*entity.Return, error) {
+	query := `
+		SELECT ` + returnColumns + ` FROM returns
+		WHERE return_id = $1 AND ($2 = 0 OR order_id IN (SELECT order_id FROM orders WHERE user_id = $2))
+	`
+
+	var ret entity.Return
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, returnID, userID).StructScan(&ret); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReturnNotFound
+		}
+		return nil, err
+	}
+
+	items, err := s.getItems(ctx, returnID)
+	if err != nil {
+		return nil, err
+	}
+	ret.Items = items
+
+	return &ret, nil
+}
+
+// ApproveReturn accepts a requested return and issues the label the
+// customer ships the items back with.
+func (s *ReturnService) ApproveReturn(ctx context.Context, returnID int) (*entity.Return, error) {
+	ctx, span := startOperation(ctx, "ReturnService.ApproveReturn")
+	defer span.End()
+
+	label, err := newReturnLabel(returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.transition(ctx, returnID, entity.ReturnStatusRequested, entity.ReturnStatusApproved, "label_code = $4", label)
+}
+
+func (s *ReturnService) RejectReturn(ctx context.Context, returnID int, reason string) (*entity.Return, error) {
+	ctx, span := startOperation(ctx, "ReturnService.RejectReturn")
+	defer span.End()
+
+	return s.transition(ctx, returnID, entity.ReturnStatusRequested, entity.ReturnStatusRejected, "rejection_reason = $4", reason)
+}
+
+// ReceiveReturn records the inspection of the items of an approved return,
+// putting back in stock the ones marked restock, then refunds every returned
+// item and completes the return. Items an admin refunded since the return was
+// requested are not refunded twice, a return with none left to refund
+// completes without a refund. When the refund fails the return stays
+// received and calling ReceiveReturn again only retries the refund, resuming
+// the one the gateway timed out on instead of making another.
+func (s *ReturnService) ReceiveReturn(ctx context.Context, returnID, adminID int, payload dto.InspectionPayload) (*entity.Return, error) {
+	ctx, span := startOperation(ctx, "ReturnService.ReceiveReturn")
+	defer span.End()
+
+	ret, err := s.getReturn(ctx, returnID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ret.Status {
+	case entity.ReturnStatusApproved:
+		if err := s.inspect(ctx, ret, payload); err != nil {
+			return nil, err
+		}
+	case entity.ReturnStatusReceived:
+	default:
+		return nil, ErrInvalidReturnStatus
+	}
+
+	refund := dto.RefundPayload{Reason: "return " + ret.LabelCode}
+	for _, item := range ret.Items {
+		refund.Items = append(refund.Items, dto.RefundItemPayload{OrderItemID: item.OrderItemID, Quantity: item.Quantity})
+	}
+
+	var refundID any
+	r, err := s.refunds.RefundReturnedItems(ctx, ret.OrderID, ret.ReturnID, adminID, refund)
+	if err == nil {
+		refundID = r.RefundID
+	} else if err != ErrNothingToRefund {
+		return nil, err
+	}
+
+	// the refund went through, the return completes even when the request
+	// went away meanwhile
+	return s.transition(context.WithoutCancel(ctx), returnID, entity.ReturnStatusReceived, entity.ReturnStatusCompleted, "refund_id = $4", refundID)
+}
+
+func (s *ReturnService) inspect(ctx context.Context, ret *entity.Return, payload dto.InspectionPayload) error {
+	outcomeQuery := `UPDATE return_items SET outcome = $1 WHERE return_item_id = $2`
+	restockQuery := `
+		UPDATE products SET stock_quantity = stock_quantity + $1
+		WHERE product_id = (SELECT product_id FROM order_items WHERE order_item_id = $2)
+	`
+	statusQuery := `UPDATE returns SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE return_id = $2 AND status = $3`
+
+	outcomes := map[int]string{}
+	for _, item := range payload.Items {
+		outcomes[item.ReturnItemID] = item.Outcome
+	}
+	if len(outcomes) != len(ret.Items) {
+		return ErrReturnInspectionMissing
+	}
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tx := database.Conn(ctx, s.db)
+
+		result, err := tx.ExecContext(ctx, statusQuery, entity.ReturnStatusReceived, ret.ReturnID, entity.ReturnStatusApproved)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			return ErrInvalidReturnStatus
+		}
+
+		for _, item := range ret.Items {
+			outcome, ok := outcomes[item.ReturnItemID]
+			if !ok {
+				return ErrReturnInspectionMissing
+			}
+
+			if _, err := tx.ExecContext(ctx, outcomeQuery, outcome, item.ReturnItemID); err != nil {
+				return err
+			}
+			if outcome == entity.ReturnOutcomeRestock {
+				if _, err := tx.ExecContext(ctx, restockQuery, item.Quantity, item.OrderItemID); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, item := range ret.Items {
+		ret.Items[i].Outcome = outcomes[item.ReturnItemID]
+	}
+	ret.Status = entity.ReturnStatusReceived
+	return nil
+}
+
+// transition moves a return from one status to the next, setting the extra
+// column assignment in set to value.
+func (s *ReturnService) transition(ctx context.Context, returnID int, from, to, set string, value any) (*entity.Return, error) {
+	query := `
+		UPDATE returns SET status = $1, ` + set + `, updated_at = CURRENT_TIMESTAMP
+		WHERE return_id = $2 AND status = $3
+		RETURNING ` + returnColumns
+
+	var ret entity.Return
+	if err := database.Conn(ctx, s.db).QueryRowxContext(ctx, query, to, returnID, from, value).StructScan(&ret); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		// tell a missing return apart from one in another status
+		if _, err := s.getReturn(ctx, returnID, 0); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidReturnStatus
+	}
+
+	items, err := s.getItems(ctx, returnID)
+	if err != nil {
+		return nil, err
+	}
+	ret.Items = items
+
+	return &ret, nil
+}
+
+func (s *ReturnService) getItems(ctx context.Context, returnID int) ([]entity.ReturnItem, error) {
+	query := `
+		SELECT return_item_id, return_id, order_item_id, quantity, reason_code, outcome
+		FROM return_items WHERE return_id = $1 ORDER BY return_item_id
+	`
+
+	var items []entity.ReturnItem
+	if err := database.Conn(ctx, s.db).SelectContext(ctx, &items, query, returnID); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// newReturnLabel stands in for the carrier label until one is integrated,
+// the code is what the warehouse matches incoming parcels against.
+func newReturnLabel(returnID int) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("RMA-%06d-%s", returnID, strings.ToUpper(hex.EncodeToString(suffix))), nil
+}
+
+func findReturnableItem(items []returnableItem, orderItemID int) (returnableItem, bool) {
+	for _, item := range items {
+		if item.OrderItemID == orderItemID {
+			return item, true
+		}
+	}
+	return returnableItem{}, false
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
+	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/payment"
+)
+
+var (
+	returnableOrderQuery = `
+		SELECT
+			order_status,
+			delivered_at IS NOT NULL AS delivered,
+			COALESCE(delivered_at >= CURRENT_TIMESTAMP - $3 * INTERVAL '1 second', FALSE) AS within_window
+		FROM orders WHERE order_id = $1 AND user_id = $2
+		FOR UPDATE
+	`
+	returnableItemsQuery = `
+		SELECT
+			oi.order_item_id,
+			oi.quantity,
+			COALESCE((SELECT SUM(ri.quantity) FROM refund_items ri WHERE ri.order_item_id = oi.order_item_id), 0) AS refunded,
+			COALESCE((
+				SELECT SUM(rti.quantity) FROM return_items rti
+				JOIN returns r ON r.return_id = rti.return_id
+				WHERE rti.order_item_id = oi.order_item_id AND r.status IN ($2, $3, $4)
+			), 0) AS in_return
+		FROM order_items oi
+		WHERE oi.order_id = $1
+		ORDER BY oi.order_item_id
+	`
+	returnTransitionQuery = `
+		UPDATE returns SET status = $1, label_code = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE return_id = $2 AND status = $3
+		RETURNING ` + returnColumns
+	getReturnQuery = `
+		SELECT ` + returnColumns + ` FROM returns
+		WHERE return_id = $1 AND ($2 = 0 OR order_id IN (SELECT order_id FROM orders WHERE user_id = $2))
+	`
+	returnItemsQuery = `
+		SELECT return_item_id, return_id, order_item_id, quantity, reason_code, outcome
+		FROM return_items WHERE return_id = $1 ORDER BY return_item_id
+	`
+	returnColumnNames = []string{"return_id", "order_id", "status", "label_code", "rejection_reason", "refund_id", "created_at", "updated_at"}
+)
+
+func setupReturnService(t *testing.T) (*ReturnService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	returnService := NewReturnService(sqlx.NewDb(db, "postgres"), newFakeVault(), payment.NewFakeGateway(), config.Default().Orders.ReturnWindow)
+	return returnService, mock
+}
+
+func TestRequestReturn(t *testing.T) {
+	payload := dto.ReturnPayload{
+		Items: []dto.ReturnItemPayload{
+			{OrderItemID: 1, Quantity: 1, ReasonCode: entity.ReturnReasonDamaged},
+			{OrderItemID: 1, Quantity: 1, ReasonCode: entity.ReturnReasonDefective},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		status       string
+		delivered    bool
+		withinWindow bool
+		refunded     int
+		inReturn     int
+		wantErr      error
+	}{
+		{
+			name:         "not delivered",
+			status:       entity.OrderStatusPaid,
+			withinWindow: false,
+			wantErr:      ErrOrderNotDelivered,
+		},
+		{
+			name:         "delivered before deliveries were recorded",
+			status:       entity.OrderStatusDelivered,
+			withinWindow: false,
+			wantErr:      ErrOrderNotDelivered,
+		},
+		{
+			name:         "window closed",
+			status:       entity.OrderStatusDelivered,
+			delivered:    true,
+			withinWindow: false,
+			wantErr:      ErrReturnWindowClosed,
+		},
+		{
+			name:         "already refunded",
+			status:       entity.OrderStatusDelivered,
+			delivered:    true,
+			withinWindow: true,
+			refunded:     1,
+			wantErr:      ErrReturnQuantityExceeded,
+		},
+		{
+			name:         "already in an open return",
+			status:       entity.OrderStatusDelivered,
+			delivered:    true,
+			withinWindow: true,
+			inReturn:     1,
+			wantErr:      ErrReturnQuantityExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returnService, mock := setupReturnService(t)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(returnableOrderQuery)).
+				WithArgs(1, 1, int(config.Default().Orders.ReturnWindow.Seconds())).
+				WillReturnRows(sqlmock.NewRows([]string{"order_status", "delivered", "within_window"}).AddRow(tt.status, tt.delivered, tt.withinWindow))
+			if tt.delivered && tt.withinWindow {
+				mock.ExpectQuery(regexp.QuoteMeta(returnableItemsQuery)).
+					WithArgs(1, entity.ReturnStatusRequested, entity.ReturnStatusApproved, entity.ReturnStatusReceived).
+					WillReturnRows(sqlmock.NewRows([]string{"order_item_id", "quantity", "refunded", "in_return"}).
+						AddRow(1, 2, tt.refunded, tt.inReturn))
+			}
+			mock.ExpectRollback()
+
+			_, err := returnService.RequestReturn(context.Background(), 1, 1, payload)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestApproveReturn(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		wantErr error
+	}{
+		{
+			name:    "requested",
+			status:  entity.ReturnStatusRequested,
+			wantErr: nil,
+		},
+		{
+			name:    "already rejected",
+			status:  entity.ReturnStatusRejected,
+			wantErr: ErrInvalidReturnStatus,
+		},
+		{
+			name:    "missing",
+			wantErr: ErrReturnNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returnService, mock := setupReturnService(t)
+
+			transition := mock.ExpectQuery(regexp.QuoteMeta(returnTransitionQuery)).
+				WithArgs(entity.ReturnStatusApproved, 1, entity.ReturnStatusRequested, sqlmock.AnyArg())
+			switch tt.status {
+			case entity.ReturnStatusRequested:
+				transition.WillReturnRows(sqlmock.NewRows(returnColumnNames).
+					AddRow(1, 1, entity.ReturnStatusApproved, "RMA-000001-0A1B2C3D", "", 0, "2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z"))
+				mock.ExpectQuery(regexp.QuoteMeta(returnItemsQuery)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"return_item_id", "return_id", "order_item_id", "quantity", "reason_code", "outcome"}).
+						AddRow(1, 1, 1, 1, entity.ReturnReasonDamaged, ""))
+			case entity.ReturnStatusRejected:
+				transition.WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(getReturnQuery)).
+					WithArgs(1, 0).
+					WillReturnRows(sqlmock.NewRows(returnColumnNames).
+						AddRow(1, 1, entity.ReturnStatusRejected, "", "no receipt", 0, "2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z"))
+				mock.ExpectQuery(regexp.QuoteMeta(returnItemsQuery)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"return_item_id", "return_id", "order_item_id", "quantity", "reason_code", "outcome"}))
+			default:
+				transition.WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(getReturnQuery)).
+					WithArgs(1, 0).
+					WillReturnError(sql.ErrNoRows)
+			}
+
+			got, err := returnService.ApproveReturn(context.Background(), 1)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Regexp(t, `^RMA-000001-[0-9A-F]{8}$`, got.LabelCode)
+				assert.Len(t, got.Items, 1)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetReturn(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  int
+		wantErr error
+	}{
+		{
+			name:    "return of the user",
+			userID:  1,
+			wantErr: nil,
+		},
+		{
+			name:    "return of another user",
+			userID:  2,
+			wantErr: ErrReturnNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returnService, mock := setupReturnService(t)
+
+			rows := sqlmock.NewRows(returnColumnNames)
+			if tt.wantErr == nil {
+				rows.AddRow(1, 1, entity.ReturnStatusRequested, "", "", 0, "2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z")
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(getReturnQuery)).
+				WithArgs(1, tt.userID).
+				WillReturnRows(rows)
+			if tt.wantErr == nil {
+				mock.ExpectQuery(regexp.QuoteMeta(returnItemsQuery)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"return_item_id", "return_id", "order_item_id", "quantity", "reason_code", "outcome"}).
+						AddRow(1, 1, 1, 1, entity.ReturnReasonDamaged, ""))
+			}
+
+			got, err := returnService.GetReturn(context.Background(), 1, tt.userID)
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr == nil {
+				assert.Len(t, got.Items, 1)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -1,16 +1,23 @@
 package service
 
 import (
-	"database/sql"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"os"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/jmoiron/sqlx"
-	"github.com/lib/pq"
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/email"
 	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
+	"github.com/mathesukkj/goecommerce/order-service/internal/fieldcrypt"
+	"github.com/mathesukkj/goecommerce/order-service/internal/jwtauth"
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,23 +26,44 @@ var (
 	ErrUserAlreadyExists = errors.New("user with this username or email already exists")
 	ErrUserNotFound      = errors.New("user not found")
 	ErrInvalidPassword   = errors.New("invalid user or password")
+	ErrUserDisabled      = errors.New("user account is disabled")
+
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrInvalidResetToken     = errors.New("invalid or expired password reset token")
+
+	ErrCannotImpersonateAdmin = errors.New("admin users cannot be impersonated")
 )
 
+// TokenTTLs is how long the tokens handed out by UserService stay valid.
+type TokenTTLs struct {
+	Session       time.Duration
+	Impersonation time.Duration
+	PasswordReset time.Duration
+}
+
 type UserService struct {
-	db *sqlx.DB
+	users repository.UserRepository
+	ttls  TokenTTLs
+	mail  email.Sender
 }
 
-func NewUserService(db *sqlx.DB) *UserService {
-	return &UserService{db: db}
+// NewUserService returns the user service, mail delivers the password reset
+// tokens.
+func NewUserService(users repository.UserRepository, ttls TokenTTLs, mail email.Sender) *UserService {
+	return &UserService{users: users, ttls: ttls, mail: mail}
 }
 
-func (s *UserService) Signup(user dto.SignupPayload) (string, error) {
-	userId, err := s.CreateUser(user)
+func (s *UserService) Signup(ctx context.Context, user dto.SignupPayload) (string, error) {
+	ctx, span := startOperation(ctx, "UserService.Signup")
+	defer span.End()
+
+	userId, err := s.CreateUser(ctx, user)
 	if err != nil {
 		return "", err
 	}
+	metrics.Signups.Inc()
 
-	token, err := generateToken(userId)
+	token, err := generateToken(userId, entity.RoleCustomer, 0, s.ttls.Session)
 	if err != nil {
 		return "", err
 	}
@@ -43,12 +71,9 @@ func (s *UserService) Signup(user dto.SignupPayload) (string, error) {
 	return token, nil
 }
 
-func (s *UserService) CreateUser(user dto.SignupPayload) (int, error) {
-	query := `
-		INSERT INTO users (username, password, email, first_name, last_name, phone_number)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING user_id
-	`
+func (s *UserService) CreateUser(ctx context.Context, user dto.SignupPayload) (int, error) {
+	ctx, span := startOperation(ctx, "UserService.CreateUser")
+	defer span.End()
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err == bcrypt.ErrPasswordTooLong {
@@ -57,36 +82,44 @@ func (s *UserService) CreateUser(user dto.SignupPayload) (int, error) {
 		return 0, err
 	}
 
-	var userId int
-	err = s.db.QueryRowx(
-		query,
-		user.Username,
-		string(hashedPassword),
-		user.Email,
-		user.FirstName,
-		user.LastName,
-		user.PhoneNumber,
-	).Scan(
-		&userId,
-	)
-	if err != nil {
-		if pgErr, ok := err.(*pq.Error); ok {
-			if pgErr.Code.Name() == "unique_violation" {
-				return 0, ErrUserAlreadyExists
-			}
-		}
+	userId, err := s.users.Create(ctx, entity.User{
+		Username:    user.Username,
+		Password:    string(hashedPassword),
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		PhoneNumber: fieldcrypt.EncryptedString(user.PhoneNumber),
+	})
+	if err == repository.ErrDuplicate {
+		return 0, ErrUserAlreadyExists
+	} else if err != nil {
 		return 0, err
 	}
 
 	return userId, nil
 }
 
-func (s *UserService) Login(login dto.LoginPayload) (string, error) {
-	query := `SELECT user_id, password FROM users WHERE email = $1`
+func (s *UserService) Login(ctx context.Context, login dto.LoginPayload) (string, error) {
+	ctx, span := startOperation(ctx, "UserService.Login")
+	defer span.End()
+
+	token, err := s.login(ctx, login)
 
-	var user entity.User
-	err := s.db.QueryRowx(query, login.Email).StructScan(&user)
-	if err == sql.ErrNoRows {
+	// errors other than the answers to the credentials say nothing of them
+	switch {
+	case err == nil:
+		metrics.Logins.WithLabelValues(metrics.LoginSucceeded).Inc()
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrInvalidPassword),
+		errors.Is(err, ErrUserDisabled), errors.Is(err, ErrPasswordResetRequired):
+		metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+	}
+
+	return token, err
+}
+
+func (s *UserService) login(ctx context.Context, login dto.LoginPayload) (string, error) {
+	user, err := s.users.FindByEmail(ctx, login.Email)
+	if err == repository.ErrNotFound {
 		return "", ErrUserNotFound
 	} else if err != nil {
 		return "", err
@@ -96,7 +129,15 @@ func (s *UserService) Login(login dto.LoginPayload) (string, error) {
 		return "", ErrInvalidPassword
 	}
 
-	token, err := generateToken(user.UserID)
+	if user.Disabled {
+		return "", ErrUserDisabled
+	}
+
+	if user.PasswordResetRequired {
+		return "", ErrPasswordResetRequired
+	}
+
+	token, err := generateToken(user.UserID, user.Role, user.TokenVersion, s.ttls.Session)
 	if err != nil {
 		return "", err
 	}
@@ -104,78 +145,225 @@ func (s *UserService) Login(login dto.LoginPayload) (string, error) {
 	return token, nil
 }
 
-func (s *UserService) GetUserByID(userID int) (*entity.User, error) {
-	query := `SELECT user_id, username, email, first_name, last_name, phone_number FROM users WHERE user_id = $1`
+func (s *UserService) GetUserByID(ctx context.Context, userID int) (*entity.User, error) {
+	ctx, span := startOperation(ctx, "UserService.GetUserByID")
+	defer span.End()
 
-	var user entity.User
-	err := s.db.QueryRowx(query, userID).StructScan(&user)
-	if err == sql.ErrNoRows {
+	user, err := s.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
 		return nil, ErrUserNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return &user, nil
-}
-
-func (s *UserService) UpdateUser(userID int, user dto.UpdateUserPayload) (*entity.User, error) {
-	query := `
-		UPDATE users
-		SET username = $1, email = $2, first_name = $3, last_name = $4, phone_number = $5
-		WHERE user_id = $6
-		RETURNING user_id, username, email, first_name, last_name, phone_number
-	`
-
-	var updatedUser entity.User
-	err := s.db.QueryRowx(
-		query,
-		user.Username,
-		user.Email,
-		user.FirstName,
-		user.LastName,
-		user.PhoneNumber,
-		userID,
-	).StructScan(&updatedUser)
-	if err == sql.ErrNoRows {
+	return profile(user), nil
+}
+
+func (s *UserService) UpdateUser(ctx context.Context, userID int, user dto.UpdateUserPayload) (*entity.User, error) {
+	ctx, span := startOperation(ctx, "UserService.UpdateUser")
+	defer span.End()
+
+	updatedUser, err := s.users.Update(ctx, entity.User{
+		UserID:      userID,
+		Username:    user.Username,
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		PhoneNumber: fieldcrypt.EncryptedString(user.PhoneNumber),
+	})
+	if err == repository.ErrNotFound {
 		return nil, ErrUserNotFound
+	} else if err == repository.ErrDuplicate {
+		return nil, ErrUserAlreadyExists
 	} else if err != nil {
 		return nil, err
 	}
 
-	return &updatedUser, nil
+	return profile(updatedUser), nil
 }
 
-func (s *UserService) DeleteUser(userID int) error {
-	query := `DELETE FROM users WHERE user_id = $1`
+func (s *UserService) DeleteUser(ctx context.Context, userID int) error {
+	ctx, span := startOperation(ctx, "UserService.DeleteUser")
+	defer span.End()
 
-	result, err := s.db.Exec(query, userID)
-	if err != nil {
+	if err := s.users.Delete(ctx, userID); err == repository.ErrNotFound {
+		return ErrUserNotFound
+	} else if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+	return nil
+}
+
+// Account returns the user a token of userID authenticates as, with its
+// current role, whether it is disabled and its token version, or nil when
+// the user no longer exists.
+func (s *UserService) Account(ctx context.Context, userID int) (*entity.User, error) {
+	ctx, span := startOperation(ctx, "UserService.Account")
+	defer span.End()
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
+	return user, nil
+}
+
+// SearchUsers returns a page of users matching every filter set in search,
+// along with the total number of matching users.
+func (s *UserService) SearchUsers(ctx context.Context, search dto.UserSearchQuery) ([]entity.User, int, error) {
+	ctx, span := startOperation(ctx, "UserService.SearchUsers")
+	defer span.End()
+
+	filter := repository.UserFilter{Email: search.Email, Username: search.Username, Name: search.Name}
+	return s.users.Search(ctx, filter, search.PageSize, (search.Page-1)*search.PageSize)
+}
+
+func (s *UserService) GetUserDetailsByID(ctx context.Context, userID int) (*entity.User, error) {
+	ctx, span := startOperation(ctx, "UserService.GetUserDetailsByID")
+	defer span.End()
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *UserService) SetUserDisabled(ctx context.Context, userID int, disabled bool) error {
+	ctx, span := startOperation(ctx, "UserService.SetUserDisabled")
+	defer span.End()
+
+	if err := s.users.SetDisabled(ctx, userID, disabled); err == repository.ErrNotFound {
 		return ErrUserNotFound
+	} else if err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func generateToken(userId int) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userId,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+// ForcePasswordReset blocks logins for the user until the password is
+// changed through ResetPassword with a one-time token, and revokes the
+// tokens issued to the user so far. The token is emailed
+// to the user only, whoever forces the reset never sees it.
+func (s *UserService) ForcePasswordReset(ctx context.Context, userID int) error {
+	ctx, span := startOperation(ctx, "UserService.ForcePasswordReset")
+	defer span.End()
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err == repository.ErrNotFound {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	resetToken := hex.EncodeToString(buf)
+
+	expiresAt := time.Now().Add(s.ttls.PasswordReset)
+	err = s.users.RequirePasswordReset(ctx, userID, hashResetToken(resetToken), expiresAt)
+	if err == repository.ErrNotFound {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// a failed delivery leaves the reset required, forcing it again issues
+	// a new token
+	return s.mail.Send(ctx, email.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("You must choose a new password before logging in again.\n\n"+
+			"Reset it with the token below before %s:\n\n%s\n",
+			expiresAt.UTC().Format(time.RFC1123), resetToken),
 	})
+}
+
+func (s *UserService) ResetPassword(ctx context.Context, reset dto.ResetPasswordPayload) error {
+	ctx, span := startOperation(ctx, "UserService.ResetPassword")
+	defer span.End()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(reset.NewPassword), bcrypt.DefaultCost)
+	if err == bcrypt.ErrPasswordTooLong {
+		return ErrPasswordTooLong
+	} else if err != nil {
+		return err
+	}
+
+	err = s.users.ResetPassword(ctx, hashResetToken(reset.Token), string(hashedPassword), time.Now())
+	if err == repository.ErrNotFound {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Impersonate issues a short lived token for userID carrying the admin as
+// the act (actor) claim, so every request made with it can be traced back.
+func (s *UserService) Impersonate(ctx context.Context, actorUserID, userID int) (string, error) {
+	ctx, span := startOperation(ctx, "UserService.Impersonate")
+	defer span.End()
 
-	secret := os.Getenv("JWT_SECRET")
-	tokenStr, err := token.SignedString([]byte(secret))
+	user, err := s.GetUserDetailsByID(ctx, userID)
 	if err != nil {
 		return "", err
 	}
 
-	return tokenStr, nil
+	if user.Role == entity.RoleAdmin {
+		return "", ErrCannotImpersonateAdmin
+	}
+
+	return jwtauth.Sign(jwt.MapClaims{
+		"user_id": user.UserID,
+		"role":    user.Role,
+		"act":     map[string]interface{}{"user_id": actorUserID},
+		"ver":     user.TokenVersion,
+		"exp":     time.Now().Add(s.ttls.Impersonation).Unix(),
+	})
+}
+
+// profile is the part of user shown to the user themselves.
+func profile(user *entity.User) *entity.User {
+	return &entity.User{
+		UserID:      user.UserID,
+		Username:    user.Username,
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		PhoneNumber: user.PhoneNumber,
+	}
+}
+
+// only the hash of a reset token is stored, so a leaked users table can't be
+// used to take over accounts
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// generateToken issues a session token for userId, version is the token
+// version of the user.
+func generateToken(userId int, role string, version int, ttl time.Duration) (string, error) {
+	return jwtauth.Sign(jwt.MapClaims{
+		"user_id": userId,
+		"role":    role,
+		"ver":     version,
+		"exp":     time.Now().Add(ttl).Unix(),
+	})
 }
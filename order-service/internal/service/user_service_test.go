@@ -1,68 +1,77 @@
 package service
 
 import (
-	"database/sql"
-	"errors"
+	"context"
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/jmoiron/sqlx"
+	"github.com/mathesukkj/goecommerce/order-service/internal/config"
 	"github.com/mathesukkj/goecommerce/order-service/internal/dto"
+	"github.com/mathesukkj/goecommerce/order-service/internal/email"
 	"github.com/mathesukkj/goecommerce/order-service/internal/entity"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mathesukkj/goecommerce/order-service/internal/metrics"
+	"github.com/mathesukkj/goecommerce/order-service/internal/repository/memory"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupUserService(t *testing.T) (*UserService, sqlmock.Sqlmock) {
+func setupUserService(t *testing.T) (*UserService, *memory.UserRepository) {
 	t.Helper()
 
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("failed to open mock db: %v", err)
+	users := memory.NewUserRepository()
+	return NewUserService(users, defaultTokenTTLs(), email.NewFakeSender()), users
+}
+
+// defaultTokenTTLs are the token lifetimes of the default configuration.
+func defaultTokenTTLs() TokenTTLs {
+	auth := config.Default().Auth
+	return TokenTTLs{
+		Session:       auth.TokenTTL,
+		Impersonation: auth.ImpersonationTokenTTL,
+		PasswordReset: auth.PasswordResetTokenTTL,
 	}
+}
 
-	userService := NewUserService(sqlx.NewDb(db, "postgres"))
-	return userService, mock
+// sentResetToken returns the reset token of the last mail sent by service.
+func sentResetToken(t *testing.T, service *UserService) string {
+	t.Helper()
+
+	sent := service.mail.(*email.FakeSender).Sent()
+	if len(sent) == 0 {
+		t.Fatal("no mail sent")
+	}
+	return regexp.MustCompile(`[0-9a-f]{64}`).FindString(sent[len(sent)-1].Body)
 }
 
+// seedUsers creates user 1, "user", whose password is "password".
 func seedUsers(t *testing.T, service *UserService) {
 	t.Helper()
 
-	params := map[string]interface{}{
-		"username":     "user",
-		"password":     "password",
-		"email":        "user@example.com",
-		"first_name":   "user",
-		"last_name":    "User",
-		"phone_number": "1234567890",
+	_, err := service.CreateUser(context.Background(), dto.SignupPayload{
+		Username:    "user",
+		Password:    "password",
+		Email:       "user@example.com",
+		FirstName:   "user",
+		LastName:    "User",
+		PhoneNumber: "1234567890",
+	})
+	if err != nil {
+		t.Fatalf("failed to seed user: %v", err)
 	}
-
-	service.db.NamedExec(`
-		INSERT INTO users (username, password, email, first_name, last_name, phone_number) 
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, params)
 }
 
 func TestSignup(t *testing.T) {
-	userService, mock := setupUserService(t)
+	userService, _ := setupUserService(t)
 	seedUsers(t, userService)
-	query := `
-		INSERT INTO users (username, password, email, first_name, last_name, phone_number)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING user_id
-	`
 
 	tests := []struct {
 		name    string
 		user    dto.SignupPayload
-		err     error
-		wantErr bool
+		wantErr error
 	}{
 		{
 			name: "valid user payload",
@@ -74,53 +83,38 @@ func TestSignup(t *testing.T) {
 				LastName:    "User",
 				PhoneNumber: "1234567890",
 			},
-			err:     nil,
-			wantErr: false,
 		},
 		{
 			name: "non-unique username",
 			user: dto.SignupPayload{
 				Username:    "user",
 				Password:    "password",
-				Email:       "testuser@example.com",
+				Email:       "other@example.com",
 				FirstName:   "Test",
 				LastName:    "User",
 				PhoneNumber: "1234567890",
 			},
-			err:     nil,
-			wantErr: true,
+			wantErr: ErrUserAlreadyExists,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if !tt.wantErr {
-				mock.
-					ExpectQuery(regexp.QuoteMeta(query)).
-					WithArgs(tt.user.Username, sqlmock.AnyArg(), tt.user.Email, tt.user.FirstName, tt.user.LastName, tt.user.PhoneNumber).
-					WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
-			}
-
-			got, err := userService.Signup(tt.user)
-			if tt.wantErr {
-				assert.Error(t, err, "signup() should have returned an error")
+			got, err := userService.Signup(context.Background(), tt.user)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err, "signup() should have returned an error")
 				return
 			}
 
 			assert.NoError(t, err, "signup() unexpected error")
-			assert.NotNil(t, got, "signup() returned unexpected user_id")
+			assert.NotEmpty(t, got, "signup() returned no token")
 		})
 	}
 }
 
 func TestCreateUser(t *testing.T) {
-	userService, mock := setupUserService(t)
+	userService, users := setupUserService(t)
 	seedUsers(t, userService)
-	query := `
-		INSERT INTO users (username, password, email, first_name, last_name, phone_number)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING user_id
-	`
 
 	tests := []struct {
 		name     string
@@ -138,15 +132,14 @@ func TestCreateUser(t *testing.T) {
 				LastName:    "User",
 				PhoneNumber: "1234567890",
 			},
-			expected: 1,
-			err:      nil,
+			expected: 2,
 		},
 		{
 			name: "create user with password too long",
 			user: dto.SignupPayload{
-				Username:    "testuser",
+				Username:    "longpassword",
 				Password:    strings.Repeat("a", 73),
-				Email:       "testuser@example.com",
+				Email:       "longpassword@example.com",
 				FirstName:   "Test",
 				LastName:    "User",
 				PhoneNumber: "1234567890",
@@ -154,112 +147,102 @@ func TestCreateUser(t *testing.T) {
 			err: ErrPasswordTooLong,
 		},
 		{
-			name: "create user with non-unique username",
+			name: "create user with non-unique email",
 			user: dto.SignupPayload{
-				Username:    "user",
+				Username:    "user1",
 				Password:    "password",
-				Email:       "user1@example",
+				Email:       "user@example.com",
 				FirstName:   "user",
 				LastName:    "User",
 				PhoneNumber: "1234567890",
 			},
-			err: errors.New("pq: duplicate key value violates unique constraint \"users_pkey\""),
+			err: ErrUserAlreadyExists,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.err != ErrPasswordTooLong {
-				expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(tt.user.Username, sqlmock.AnyArg(), tt.user.Email, tt.user.FirstName, tt.user.LastName, tt.user.PhoneNumber)
-				if tt.expected != 0 {
-					expectedQuery.WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(tt.expected))
-				}
-			}
-			_, err := userService.CreateUser(tt.user)
-			if tt.err == ErrPasswordTooLong {
-				assert.Equal(t, tt.err, err)
+			got, err := userService.CreateUser(context.Background(), tt.user)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.expected, got)
+			if tt.err != nil {
+				return
 			}
-			assert.NoError(t, mock.ExpectationsWereMet())
+
+			stored, err := users.FindByEmail(context.Background(), tt.user.Email)
+			assert.NoError(t, err)
+			assert.NotEqual(t, tt.user.Password, stored.Password, "password must be stored hashed")
+			assert.Equal(t, entity.RoleCustomer, stored.Role)
 		})
 	}
 }
 
 func TestLogin(t *testing.T) {
-	userService, mock := setupUserService(t)
-	seedUsers(t, userService)
-	query := `SELECT user_id, password FROM users WHERE email = $1`
-
 	tests := []struct {
-		name     string
-		login    dto.LoginPayload
-		mockUser *entity.User
-		wantErr  bool
+		name    string
+		login   dto.LoginPayload
+		prepare func(users *memory.UserRepository)
+		wantErr error
 	}{
 		{
-			name: "successful login",
-			login: dto.LoginPayload{
-				Email:    "test@example.com",
-				Password: "password123",
-			},
-			mockUser: &entity.User{
-				UserID:   1,
-				Password: "$2y$10$zuljQprm6i1NQTGfQgB/xeC7wu44vtsb3./R8LuydUc6m1CdS8ziK",
-			},
-			wantErr: false,
+			name:  "successful login",
+			login: dto.LoginPayload{Email: "user@example.com", Password: "password"},
 		},
 		{
-			name: "user not found",
-			login: dto.LoginPayload{
-				Email:    "nonexistent@example.com",
-				Password: "password123",
-			},
-			mockUser: nil,
-			wantErr:  true,
+			name:    "user not found",
+			login:   dto.LoginPayload{Email: "nonexistent@example.com", Password: "password"},
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:    "incorrect password",
+			login:   dto.LoginPayload{Email: "user@example.com", Password: "wrongpassword"},
+			wantErr: ErrInvalidPassword,
 		},
 		{
-			name: "incorrect password",
-			login: dto.LoginPayload{
-				Email:    "test@example.com",
-				Password: "wrongpassword",
+			name:  "disabled user",
+			login: dto.LoginPayload{Email: "user@example.com", Password: "password"},
+			prepare: func(users *memory.UserRepository) {
+				users.SetDisabled(context.Background(), 1, true)
 			},
-			mockUser: &entity.User{
-				UserID:   1,
-				Password: "$2a$10$1234567890123456789012",
+			wantErr: ErrUserDisabled,
+		},
+		{
+			name:  "password reset required",
+			login: dto.LoginPayload{Email: "user@example.com", Password: "password"},
+			prepare: func(users *memory.UserRepository) {
+				users.RequirePasswordReset(context.Background(), 1, "token", time.Now().Add(time.Hour))
 			},
-			wantErr: true,
+			wantErr: ErrPasswordResetRequired,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockQuery := mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(tt.login.Email)
-
-			if tt.mockUser == nil {
-				mockQuery.WillReturnError(ErrUserNotFound)
-			} else {
-				mockQuery.WillReturnRows(sqlmock.NewRows([]string{"user_id", "password"}).
-					AddRow(tt.mockUser.UserID, tt.mockUser.Password))
+			userService, users := setupUserService(t)
+			seedUsers(t, userService)
+			if tt.prepare != nil {
+				tt.prepare(users)
 			}
 
-			token, err := userService.Login(tt.login)
+			succeeded := testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginSucceeded))
+			failed := testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginFailed))
 
-			if tt.wantErr {
-				assert.Error(t, err)
+			token, err := userService.Login(context.Background(), tt.login)
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr != nil {
 				assert.Empty(t, token)
+				assert.Equal(t, failed+1, testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginFailed)))
 			} else {
-				assert.NoError(t, err)
 				assert.NotEmpty(t, token)
+				assert.Equal(t, succeeded+1, testutil.ToFloat64(metrics.Logins.WithLabelValues(metrics.LoginSucceeded)))
 			}
-
-			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
 
 func TestGetUserById(t *testing.T) {
-	userService, mock := setupUserService(t)
+	userService, _ := setupUserService(t)
 	seedUsers(t, userService)
-	query := `SELECT user_id, username, email, first_name, last_name, phone_number FROM users WHERE user_id = $1`
 
 	tests := []struct {
 		name     string
@@ -290,38 +273,24 @@ func TestGetUserById(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockQuery := mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(tt.userID)
-
-			if tt.wantUser != nil {
-				mockQuery.WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "email", "first_name", "last_name", "phone_number"}).
-					AddRow(tt.wantUser.UserID, tt.wantUser.Username, tt.wantUser.Email, tt.wantUser.FirstName, tt.wantUser.LastName, tt.wantUser.PhoneNumber))
-			} else {
-				mockQuery.WillReturnError(sql.ErrNoRows)
-			}
-
-			gotUser, err := userService.GetUserByID(tt.userID)
-			if tt.wantErr != nil {
-				assert.Error(t, err)
-				assert.Nil(t, gotUser)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.wantUser, gotUser)
-			}
-
-			assert.NoError(t, mock.ExpectationsWereMet())
+			gotUser, err := userService.GetUserByID(context.Background(), tt.userID)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantUser, gotUser)
 		})
 	}
 }
 
 func TestUpdateUser(t *testing.T) {
-	userService, mock := setupUserService(t)
+	userService, _ := setupUserService(t)
 	seedUsers(t, userService)
-	query := `
-		UPDATE users
-		SET username = $1, email = $2, first_name = $3, last_name = $4, phone_number = $5
-		WHERE user_id = $6
-		RETURNING user_id, username, email, first_name, last_name, phone_number
-	`
+	_, err := userService.CreateUser(context.Background(), dto.SignupPayload{
+		Username: "other",
+		Password: "password",
+		Email:    "other@example.com",
+	})
+	if err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
 
 	tests := []struct {
 		name     string
@@ -350,6 +319,19 @@ func TestUpdateUser(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name:   "email of another user",
+			userID: 1,
+			input: dto.UpdateUserPayload{
+				Username:    "updateduser",
+				Email:       "other@example.com",
+				FirstName:   "Updated",
+				LastName:    "User",
+				PhoneNumber: "9876543210",
+			},
+			wantUser: nil,
+			wantErr:  ErrUserAlreadyExists,
+		},
 		{
 			name:   "user not found",
 			userID: 999,
@@ -367,38 +349,16 @@ func TestUpdateUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.wantUser != nil {
-				rows := sqlmock.NewRows([]string{"user_id", "username", "email", "first_name", "last_name", "phone_number"}).
-					AddRow(tt.wantUser.UserID, tt.wantUser.Username, tt.wantUser.Email, tt.wantUser.FirstName, tt.wantUser.LastName, tt.wantUser.PhoneNumber)
-				mock.ExpectQuery(regexp.QuoteMeta(query)).
-					WithArgs(tt.input.Username, tt.input.Email, tt.input.FirstName, tt.input.LastName, tt.input.PhoneNumber, tt.userID).
-					WillReturnRows(rows)
-			} else {
-				mock.ExpectQuery(regexp.QuoteMeta(query)).
-					WithArgs(tt.input.Username, tt.input.Email, tt.input.FirstName, tt.input.LastName, tt.input.PhoneNumber, tt.userID).
-					WillReturnError(sql.ErrNoRows)
-			}
-
-			gotUser, err := userService.UpdateUser(tt.userID, tt.input)
-
-			if tt.wantErr != nil {
-				assert.Error(t, err)
-				assert.Equal(t, tt.wantErr, err)
-				assert.Nil(t, gotUser)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.wantUser, gotUser)
-			}
-
-			assert.NoError(t, mock.ExpectationsWereMet())
+			gotUser, err := userService.UpdateUser(context.Background(), tt.userID, tt.input)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantUser, gotUser)
 		})
 	}
 }
 
 func TestDeleteUser(t *testing.T) {
-	userService, mock := setupUserService(t)
+	userService, _ := setupUserService(t)
 	seedUsers(t, userService)
-	query := `DELETE FROM users WHERE user_id = $1`
 
 	tests := []struct {
 		name    string
@@ -419,25 +379,8 @@ func TestDeleteUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.wantErr == nil {
-				mock.ExpectExec(regexp.QuoteMeta(query)).
-					WithArgs(tt.userID).
-					WillReturnResult(sqlmock.NewResult(1, 1))
-			} else {
-				mock.ExpectExec(regexp.QuoteMeta(query)).
-					WithArgs(tt.userID).
-					WillReturnResult(sqlmock.NewResult(0, 0))
-			}
-
-			err := userService.DeleteUser(tt.userID)
-			if tt.wantErr != nil {
-				assert.Error(t, err)
-				assert.Equal(t, tt.wantErr, err)
-			} else {
-				assert.NoError(t, err)
-			}
-
-			assert.NoError(t, mock.ExpectationsWereMet())
+			err := userService.DeleteUser(context.Background(), tt.userID)
+			assert.Equal(t, tt.wantErr, err)
 		})
 	}
 }
@@ -468,10 +411,7 @@ func TestGenerateToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			os.Setenv("JWT_SECRET", "test_secret")
-			defer os.Unsetenv("JWT_SECRET")
-
-			got, err := generateToken(tt.userId)
+			got, err := generateToken(tt.userId, entity.RoleCustomer, 0, defaultTokenTTLs().Session)
 			if tt.wantErr {
 				assert.Error(t, err, "generateToken() should have returned an error")
 				return
@@ -490,6 +430,7 @@ func TestGenerateToken(t *testing.T) {
 			claims, ok := token.Claims.(jwt.MapClaims)
 			assert.True(t, ok, "failed to parse claims")
 			assert.Equal(t, float64(tt.userId), claims["user_id"], "unexpected user_id in token")
+			assert.Equal(t, entity.RoleCustomer, claims["role"], "unexpected role in token")
 			assert.Contains(t, claims, "exp", "token missing expiration claim")
 
 			exp, ok := claims["exp"].(float64)
@@ -499,3 +440,255 @@ func TestGenerateToken(t *testing.T) {
 		})
 	}
 }
+
+func TestAccount(t *testing.T) {
+	userService, users := setupUserService(t)
+	seedUsers(t, userService)
+	seedUser(t, userService, "disabled")
+	users.SetDisabled(context.Background(), 2, true)
+
+	tests := []struct {
+		name         string
+		userID       int
+		wantFound    bool
+		wantDisabled bool
+	}{
+		{
+			name:      "active user",
+			userID:    1,
+			wantFound: true,
+		},
+		{
+			name:         "disabled user",
+			userID:       2,
+			wantFound:    true,
+			wantDisabled: true,
+		},
+		{
+			name:   "user not found",
+			userID: 999,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := userService.Account(context.Background(), tt.userID)
+			assert.NoError(t, err)
+			if !tt.wantFound {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, tt.userID, got.UserID)
+			assert.Equal(t, tt.wantDisabled, got.Disabled)
+		})
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	userService, _ := setupUserService(t)
+	for _, username := range []string{"john", "jane", "100%off"} {
+		seedUser(t, userService, username)
+	}
+
+	tests := []struct {
+		name        string
+		search      dto.UserSearchQuery
+		expectedIDs []int
+		total       int
+	}{
+		{
+			name:        "no filters",
+			search:      dto.UserSearchQuery{Page: 1, PageSize: 20},
+			expectedIDs: []int{1, 2, 3},
+			total:       3,
+		},
+		{
+			name:        "second page",
+			search:      dto.UserSearchQuery{Page: 2, PageSize: 2},
+			expectedIDs: []int{3},
+			total:       3,
+		},
+		{
+			name:        "email and name filters",
+			search:      dto.UserSearchQuery{Email: "100%", Name: "john 100", Page: 1, PageSize: 10},
+			expectedIDs: []int{3},
+			total:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, total, err := userService.SearchUsers(context.Background(), tt.search)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.total, total)
+
+			var ids []int
+			for _, user := range users {
+				ids = append(ids, user.UserID)
+			}
+			assert.Equal(t, tt.expectedIDs, ids)
+		})
+	}
+}
+
+func TestSetUserDisabled(t *testing.T) {
+	userService, _ := setupUserService(t)
+	seedUsers(t, userService)
+
+	tests := []struct {
+		name    string
+		userID  int
+		wantErr error
+	}{
+		{
+			name:    "user disabled",
+			userID:  1,
+			wantErr: nil,
+		},
+		{
+			name:    "user not found",
+			userID:  999,
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := userService.SetUserDisabled(context.Background(), tt.userID, true)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+
+	account, err := userService.Account(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, account.Disabled)
+}
+
+func TestForcePasswordReset(t *testing.T) {
+	userService, _ := setupUserService(t)
+	seedUsers(t, userService)
+
+	err := userService.ForcePasswordReset(context.Background(), 1)
+	assert.NoError(t, err)
+
+	sent := userService.mail.(*email.FakeSender).Sent()
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, "user@example.com", sent[0].To)
+		assert.Len(t, sentResetToken(t, userService), 64)
+	}
+
+	_, err = userService.Login(context.Background(), dto.LoginPayload{Email: "user@example.com", Password: "password"})
+	assert.Equal(t, ErrPasswordResetRequired, err)
+
+	err = userService.ForcePasswordReset(context.Background(), 999)
+	assert.Equal(t, ErrUserNotFound, err)
+	assert.Len(t, userService.mail.(*email.FakeSender).Sent(), 1, "no mail for an unknown user")
+}
+
+func TestResetPassword(t *testing.T) {
+	userService, _ := setupUserService(t)
+	seedUsers(t, userService)
+	if err := userService.ForcePasswordReset(context.Background(), 1); err != nil {
+		t.Fatalf("failed to force password reset: %v", err)
+	}
+	resetToken := sentResetToken(t, userService)
+
+	tests := []struct {
+		name    string
+		payload dto.ResetPasswordPayload
+		wantErr error
+	}{
+		{
+			name:    "invalid token",
+			payload: dto.ResetPasswordPayload{Token: "invalid", NewPassword: "newpassword"},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name:    "valid token",
+			payload: dto.ResetPasswordPayload{Token: resetToken, NewPassword: "newpassword"},
+			wantErr: nil,
+		},
+		{
+			name:    "token already used",
+			payload: dto.ResetPasswordPayload{Token: resetToken, NewPassword: "newerpassword"},
+			wantErr: ErrInvalidResetToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := userService.ResetPassword(context.Background(), tt.payload)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+
+	token, err := userService.Login(context.Background(), dto.LoginPayload{Email: "user@example.com", Password: "newpassword"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+}
+
+func TestImpersonate(t *testing.T) {
+	userService, users := setupUserService(t)
+	seedUsers(t, userService)
+	seedUser(t, userService, "admin")
+	users.SetRole(2, entity.RoleAdmin)
+
+	tests := []struct {
+		name    string
+		userID  int
+		wantErr error
+	}{
+		{
+			name:    "customer user",
+			userID:  1,
+			wantErr: nil,
+		},
+		{
+			name:    "admin user",
+			userID:  2,
+			wantErr: ErrCannotImpersonateAdmin,
+		},
+		{
+			name:    "user not found",
+			userID:  999,
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := userService.Impersonate(context.Background(), 42, tt.userID)
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr != nil {
+				return
+			}
+			claims := jwt.MapClaims{}
+			_, err = jwt.ParseWithClaims(got, claims, func(token *jwt.Token) (interface{}, error) {
+				return []byte("test_secret"), nil
+			})
+			assert.NoError(t, err, "failed to parse token")
+			assert.Equal(t, float64(tt.userID), claims["user_id"])
+			assert.Equal(t, map[string]interface{}{"user_id": float64(42)}, claims["act"])
+
+			exp, err := claims.GetExpirationTime()
+			assert.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(defaultTokenTTLs().Impersonation), exp.Time, time.Minute)
+		})
+	}
+}
+
+// seedUser creates another user named username, after the ones already there.
+func seedUser(t *testing.T, service *UserService, username string) {
+	t.Helper()
+
+	_, err := service.CreateUser(context.Background(), dto.SignupPayload{
+		Username:  username,
+		Password:  "password",
+		Email:     username + "@example.com",
+		FirstName: "John",
+		LastName:  username,
+	})
+	if err != nil {
+		t.Fatalf("failed to seed user %s: %v", username, err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package tracing sends the OpenTelemetry spans of the service to the
+// exporter picked in the configuration, and carries the W3C trace context of
+// the requests served over to the calls made to other services.
+//
+// The spans themselves are started where the work happens: by
+// middleware.Trace for each request, by the services for each of their
+// methods and by database.Conn for each statement.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+)
+
+const (
+	serviceName     = "order-service"
+	requestIDHeader = "X-Request-ID"
+)
+
+// Exporters.
+const (
+	// ExporterNone records no span, the trace context is still propagated.
+	ExporterNone = "none"
+	// ExporterStdout writes the spans as JSON to the standard output.
+	ExporterStdout = "stdout"
+	// ExporterFile appends the spans as JSON to Options.File.
+	ExporterFile = "file"
+	// ExporterOTLP sends the spans to the collector at Options.OTLPEndpoint
+	// over http.
+	ExporterOTLP = "otlp"
+)
+
+var Exporters = []string{ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP}
+
+type Options struct {
+	Exporter     string
+	File         string
+	OTLPEndpoint string
+}
+
+// Setup installs the global propagator and the tracer provider exporting to
+// opts.Exporter. shutdown flushes the spans not exported yet, it must be
+// called before the service exits.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file io.Closer
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		var f *os.File
+		f, err = os.OpenFile(opts.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening trace file: %w", err)
+		}
+		file = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Transport sends the trace context and the X-Request-ID of the request
+// context along with the requests made through base, http.DefaultTransport
+// when nil, and traces them. Clients of other services are built on it:
+//
+//	client := &http.Client{Transport: tracing.Transport(nil), Timeout: 5 * time.Second}
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(requestIDTransport{base})
+}
+
+// requestIDTransport sets the X-Request-ID header of the requests it sends,
+// unless already set, to the id of the request they are made for.
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestID := logging.RequestID(req.Context())
+	if requestID == "" || req.Header.Get(requestIDHeader) != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	req.Header.Set(requestIDHeader, requestID)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/logging"
+)
+
+func TestSetupFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(context.Background(), Options{Exporter: ExporterFile, File: path})
+	if err != nil {
+		t.Fatalf("failed to set up tracing: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "UserService.Login")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	spans, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(spans), `"Name":"UserService.Login"`)
+	assert.Contains(t, string(spans), `"Value":"order-service"`, "the spans should name the service")
+}
+
+func TestSetupErrors(t *testing.T) {
+	_, err := Setup(context.Background(), Options{Exporter: "jaeger"})
+	assert.EqualError(t, err, `unknown trace exporter "jaeger"`)
+
+	_, err = Setup(context.Background(), Options{Exporter: ExporterFile, File: filepath.Join(t.TempDir(), "missing", "spans.json")})
+	assert.ErrorContains(t, err, "opening trace file")
+}
+
+func TestTransport(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: ExporterNone}); err != nil {
+		t.Fatalf("failed to set up tracing: %v", err)
+	}
+
+	var traceparent, requestID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		requestID = r.Header.Get("X-Request-ID")
+	}))
+	defer srv.Close()
+
+	// the context of a request served as part of a trace
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	ctx = logging.WithRequestID(ctx, "request-1")
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	assert.Regexp(t, `^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-01$`, traceparent, "the trace should continue in the called service")
+	assert.Equal(t, "request-1", requestID)
+}
@@ -0,0 +1,126 @@
+// Package vault exchanges card numbers (PANs) for opaque tokens, so the rest
+// of the service never stores a card number.
+package vault
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+)
+
+var (
+	ErrTokenNotFound = errors.New("card token not found")
+	ErrInvalidKey    = errors.New("card vault key must be 32 bytes, base64 encoded")
+)
+
+type Vault interface {
+	// Tokenize stores pan and returns the token that now stands for it.
+	Tokenize(ctx context.Context, pan string) (string, error)
+	// Detokenize returns the pan behind token, only payment processing
+	// should ever need it.
+	Detokenize(ctx context.Context, token string) (string, error)
+	// Delete forgets token, deleting an unknown token is not an error.
+	Delete(ctx context.Context, token string) error
+}
+
+// LocalVault keeps the card numbers AES-GCM encrypted in the card_vault
+// table, a stand in until a hosted vault provider is plugged in. Its queries
+// join the transaction of the context, like those of the repositories.
+type LocalVault struct {
+	db   *sqlx.DB
+	aead cipher.AEAD
+}
+
+// ParseKey decodes a base64 encoded 256 bit key, such as the CARD_VAULT_KEY
+// environment variable.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+func NewLocalVault(db *sqlx.DB, key []byte) (*LocalVault, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalVault{db: db, aead: aead}, nil
+}
+
+func (v *LocalVault) Tokenize(ctx context.Context, pan string) (string, error) {
+	query := `INSERT INTO card_vault (token, ciphertext) VALUES ($1, $2)`
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := "tok_" + hex.EncodeToString(buf)
+
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	// the token is bound as additional data, so a ciphertext copied under
+	// another token fails to decrypt
+	ciphertext := v.aead.Seal(nonce, nonce, []byte(pan), []byte(token))
+
+	if _, err := database.Conn(ctx, v.db).ExecContext(ctx, query, token, ciphertext); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (v *LocalVault) Detokenize(ctx context.Context, token string) (string, error) {
+	query := `SELECT ciphertext FROM card_vault WHERE token = $1`
+
+	var ciphertext []byte
+	err := database.Conn(ctx, v.db).QueryRowxContext(ctx, query, token).Scan(&ciphertext)
+	if err == sql.ErrNoRows {
+		return "", ErrTokenNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	nonceSize := v.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return "", fmt.Errorf("card vault: ciphertext for %s is truncated", token)
+	}
+
+	pan, err := v.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(token))
+	if err != nil {
+		return "", fmt.Errorf("card vault: decrypting %s: %w", token, err)
+	}
+
+	return string(pan), nil
+}
+
+func (v *LocalVault) Delete(ctx context.Context, token string) error {
+	query := `DELETE FROM card_vault WHERE token = $1`
+
+	_, err := database.Conn(ctx, v.db).ExecContext(ctx, query, token)
+	return err
+}
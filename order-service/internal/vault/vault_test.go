@@ -0,0 +1,128 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, 32)
+
+func setupLocalVault(t *testing.T) (*LocalVault, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %v", err)
+	}
+
+	localVault, err := NewLocalVault(sqlx.NewDb(db, "postgres"), testKey)
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+	return localVault, mock
+}
+
+// capture records the value bound to a query argument.
+type capture struct {
+	value driver.Value
+}
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{
+			name:    "valid key",
+			encoded: base64.StdEncoding.EncodeToString(testKey),
+			wantErr: false,
+		},
+		{
+			name:    "short key",
+			encoded: base64.StdEncoding.EncodeToString(testKey[:16]),
+			wantErr: true,
+		},
+		{
+			name:    "not base64",
+			encoded: "not a key!",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.encoded)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidKey)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testKey, key)
+			}
+		})
+	}
+}
+
+func TestNewLocalVaultKeyLength(t *testing.T) {
+	_, err := NewLocalVault(nil, testKey[:16])
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestTokenizeDetokenize(t *testing.T) {
+	localVault, mock := setupLocalVault(t)
+	insertQuery := `INSERT INTO card_vault (token, ciphertext) VALUES ($1, $2)`
+	selectQuery := `SELECT ciphertext FROM card_vault WHERE token = $1`
+
+	ciphertext := &capture{}
+	mock.ExpectExec(regexp.QuoteMeta(insertQuery)).
+		WithArgs(sqlmock.AnyArg(), ciphertext).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	token, err := localVault.Tokenize(context.Background(), "4242424242424242")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "tok_"), "token should be prefixed, got %s", token)
+	assert.NotContains(t, string(ciphertext.value.([]byte)), "4242424242424242", "card number should be encrypted")
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+		WithArgs(token).
+		WillReturnRows(sqlmock.NewRows([]string{"ciphertext"}).AddRow(ciphertext.value))
+
+	pan, err := localVault.Detokenize(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "4242424242424242", pan)
+
+	// a ciphertext moved under another token must not decrypt
+	mock.ExpectQuery(regexp.QuoteMeta(selectQuery)).
+		WithArgs("tok_other").
+		WillReturnRows(sqlmock.NewRows([]string{"ciphertext"}).AddRow(ciphertext.value))
+
+	_, err = localVault.Detokenize(context.Background(), "tok_other")
+	assert.Error(t, err)
+}
+
+func TestDetokenizeNotFound(t *testing.T) {
+	localVault, mock := setupLocalVault(t)
+	query := `SELECT ciphertext FROM card_vault WHERE token = $1`
+
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs("tok_missing").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err := localVault.Detokenize(context.Background(), "tok_missing")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
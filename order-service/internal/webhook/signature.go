@@ -0,0 +1,91 @@
+// Package webhook verifies the signatures payment providers put on the events
+// they post to us.
+//
+// A signature header looks like
+//
+//	t=1700000000,v1=5257a869e7ecebeda32affa62cdca3fa51cad7e77a0e56ff536d0ce8e108d8bd
+//
+// where v1 is the hex HMAC-SHA256 of "<t>.<body>" under the provider secret.
+// Several v1 entries may be sent while a secret is being rolled.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	// DefaultTolerance is how old a signed event may be, bounding replays of
+	// a captured request.
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrMalformedSignature = errors.New("malformed webhook signature header")
+	ErrInvalidSignature   = errors.New("webhook signature does not match")
+	ErrStaleSignature     = errors.New("webhook timestamp outside the tolerance")
+)
+
+// Sign returns the signature header for body sent at timestamp.
+func Sign(secret, body []byte, timestamp time.Time) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks header signs body under secret, with a timestamp no further
+// than tolerance from now.
+func Verify(secret []byte, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var (
+		t          string
+		signatures [][]byte
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformedSignature
+		}
+
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			signature, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrMalformedSignature
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrMalformedSignature
+	}
+
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrStaleSignature
+	}
+
+	expected := mac(secret, t, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func mac(secret []byte, t string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(t))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
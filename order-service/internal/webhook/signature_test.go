@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := []byte(`{"id":"evt_1","type":"payment.succeeded"}`)
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		wantErr error
+	}{
+		{
+			name:    "valid signature",
+			header:  Sign(secret, body, now),
+			body:    body,
+			wantErr: nil,
+		},
+		{
+			name:    "one of several signatures",
+			header:  Sign([]byte("whsec_old"), body, now) + ",v1=" + strings.Split(Sign(secret, body, now), "v1=")[1],
+			body:    body,
+			wantErr: nil,
+		},
+		{
+			name:    "tampered body",
+			header:  Sign(secret, body, now),
+			body:    []byte(`{"id":"evt_1","type":"payment.failed"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "other secret",
+			header:  Sign([]byte("whsec_other"), body, now),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "too old",
+			header:  Sign(secret, body, now.Add(-DefaultTolerance-time.Second)),
+			body:    body,
+			wantErr: ErrStaleSignature,
+		},
+		{
+			name:    "too far in the future",
+			header:  Sign(secret, body, now.Add(DefaultTolerance+time.Second)),
+			body:    body,
+			wantErr: ErrStaleSignature,
+		},
+		{
+			name:    "missing signature",
+			header:  "t=1700000000",
+			body:    body,
+			wantErr: ErrMalformedSignature,
+		},
+		{
+			name:    "empty header",
+			header:  "",
+			body:    body,
+			wantErr: ErrMalformedSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(secret, tt.header, tt.body, now, DefaultTolerance)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
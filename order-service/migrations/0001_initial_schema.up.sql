@@ -1,3 +1,6 @@
+-- The schema of init.sql, databases created from it are adopted at this
+-- version with migrate baseline, see cmd/migrate.
+
 -- Create Users table
 CREATE TABLE users (
     user_id SERIAL PRIMARY KEY,
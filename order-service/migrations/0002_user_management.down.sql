@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_user_password_reset_token;
+
+ALTER TABLE users DROP COLUMN token_version;
+ALTER TABLE users DROP COLUMN password_reset_expires_at;
+ALTER TABLE users DROP COLUMN password_reset_token;
+ALTER TABLE users DROP COLUMN password_reset_required;
+ALTER TABLE users DROP COLUMN disabled;
+ALTER TABLE users DROP COLUMN role;
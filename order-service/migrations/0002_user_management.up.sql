@@ -0,0 +1,11 @@
+-- Roles, disabled accounts and forced password resets for admin user management
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'customer';
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN password_reset_token VARCHAR(64);
+ALTER TABLE users ADD COLUMN password_reset_expires_at TIMESTAMP;
+-- tokens carry the version of their user, bumped to revoke every token
+-- issued before, as when a password reset is forced
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_user_password_reset_token ON users (password_reset_token);
@@ -0,0 +1,4 @@
+ALTER TABLE payment_methods DROP COLUMN card_last4;
+ALTER TABLE payment_methods DROP COLUMN card_token;
+
+DROP TABLE IF EXISTS card_vault;
@@ -0,0 +1,13 @@
+-- Create Card Vault table, card numbers only ever live here, encrypted
+CREATE TABLE card_vault (
+    token VARCHAR(64) PRIMARY KEY,
+    ciphertext BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Payment methods refer to their card by token. The numbers stored so far
+-- are moved into the vault by the tokenize-cards command, card_number goes
+-- once they all are, see 0013_drop_card_number.
+ALTER TABLE payment_methods ADD COLUMN card_token VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE payment_methods ADD COLUMN card_last4 CHAR(4) NOT NULL DEFAULT '';
+ALTER TABLE payment_methods ALTER COLUMN card_number TYPE VARCHAR(19);
@@ -0,0 +1,15 @@
+-- Phone numbers and addresses are stored encrypted, pii_key_version is the
+-- master key they are encrypted with, 0 until the reencrypt command
+-- encrypted the rows stored before
+ALTER TABLE users ALTER COLUMN phone_number TYPE TEXT;
+ALTER TABLE users ADD COLUMN pii_key_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_user_pii_key_version ON users (pii_key_version);
+
+ALTER TABLE addresses ALTER COLUMN street_address TYPE TEXT;
+ALTER TABLE addresses ALTER COLUMN city TYPE TEXT;
+ALTER TABLE addresses ALTER COLUMN state TYPE TEXT;
+ALTER TABLE addresses ALTER COLUMN postal_code TYPE TEXT;
+ALTER TABLE addresses ADD COLUMN pii_key_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_address_pii_key_version ON addresses (pii_key_version);
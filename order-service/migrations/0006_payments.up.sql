@@ -0,0 +1,18 @@
+-- Create Payments table, one row per gateway call made for an order
+CREATE TABLE payments (
+    payment_id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(order_id),
+    operation VARCHAR(20) NOT NULL,
+    amount INT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    -- a webhook only settles the payments of the provider that signed it
+    provider VARCHAR(50) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    idempotency_key VARCHAR(64) UNIQUE NOT NULL,
+    gateway_reference VARCHAR(64) NOT NULL DEFAULT '',
+    failure_code VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payment_order_id ON payments (order_id);
@@ -0,0 +1,31 @@
+-- Create Refunds table
+CREATE TABLE refunds (
+    refund_id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(order_id),
+    payment_id INTEGER NOT NULL REFERENCES payments(payment_id),
+    amount INT NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users(user_id) ON DELETE SET NULL,
+    -- whether the items go back in stock once the refund goes through, which
+    -- for a refund the gateway timed out on is when the webhook settles it
+    restock BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_refund_order_id ON refunds (order_id);
+
+-- Create Refund Items table, the order item quantities given back by a refund
+CREATE TABLE refund_items (
+    refund_item_id SERIAL PRIMARY KEY,
+    refund_id INTEGER NOT NULL REFERENCES refunds(refund_id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(order_item_id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    amount INT NOT NULL
+);
+
+CREATE INDEX idx_refund_item_refund_id ON refund_items (refund_id);
+CREATE INDEX idx_refund_item_order_item_id ON refund_items (order_item_id);
+
+-- How much of an order was refunded, partially_refunded or refunded, kept
+-- apart from its order status so a refund does not undo its fulfilment
+ALTER TABLE orders ADD COLUMN refund_status VARCHAR(50) NOT NULL DEFAULT '';
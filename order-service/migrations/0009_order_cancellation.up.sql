@@ -0,0 +1,6 @@
+-- Why and when a customer cancelled their order
+ALTER TABLE orders ADD COLUMN cancellation_reason VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN cancelled_at TIMESTAMP;
+
+-- The refund a cancellation made, a retried cancellation resumes it
+ALTER TABLE refunds ADD COLUMN cancellation BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS orders_delivered_at ON orders;
+DROP FUNCTION IF EXISTS orders_set_delivered_at();
+ALTER TABLE orders DROP COLUMN delivered_at;
+
+DROP TABLE IF EXISTS return_items;
+DROP TABLE IF EXISTS returns;
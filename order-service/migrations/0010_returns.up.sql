@@ -0,0 +1,45 @@
+-- Create Returns table, a customer request to send back delivered order items
+CREATE TABLE returns (
+    return_id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(order_id),
+    status VARCHAR(20) NOT NULL,
+    label_code VARCHAR(32) NOT NULL DEFAULT '',
+    rejection_reason VARCHAR(255) NOT NULL DEFAULT '',
+    -- set along with the refund, unset when its payment fails and it is deleted
+    refund_id INTEGER REFERENCES refunds(refund_id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_return_order_id ON returns (order_id);
+
+-- Create Return Items table, outcome is set once the item is inspected
+CREATE TABLE return_items (
+    return_item_id SERIAL PRIMARY KEY,
+    return_id INTEGER NOT NULL REFERENCES returns(return_id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(order_item_id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    reason_code VARCHAR(32) NOT NULL,
+    outcome VARCHAR(20) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_return_item_return_id ON return_items (return_id);
+CREATE INDEX idx_return_item_order_item_id ON return_items (order_item_id);
+
+-- When an order was delivered, which its return window counts from. Orders
+-- are marked delivered outside this service, so the column is stamped when
+-- their status changes to delivered. Orders delivered before have none and
+-- cannot be returned.
+ALTER TABLE orders ADD COLUMN delivered_at TIMESTAMP;
+
+CREATE FUNCTION orders_set_delivered_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.delivered_at := CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_delivered_at
+BEFORE UPDATE OF order_status ON orders
+FOR EACH ROW WHEN (NEW.order_status = 'delivered' AND OLD.order_status <> 'delivered')
+EXECUTE FUNCTION orders_set_delivered_at();
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_order_item_product_id;
+
+DROP INDEX IF EXISTS idx_order_user_status;
+DROP INDEX IF EXISTS idx_order_user_amount;
+DROP INDEX IF EXISTS idx_order_user_date;
+CREATE INDEX idx_order_user_id ON orders (user_id);
+
+DROP INDEX IF EXISTS idx_product_name_trgm;
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,12 @@
+-- Trigram indexes back the substring searches on names
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_product_name_trgm ON products USING GIN (product_name gin_trgm_ops);
+
+-- order history is listed per user by date or amount, optionally by status
+DROP INDEX idx_order_user_id;
+CREATE INDEX idx_order_user_date ON orders (user_id, order_date DESC, order_id DESC);
+CREATE INDEX idx_order_user_amount ON orders (user_id, total_amount, order_id);
+CREATE INDEX idx_order_user_status ON orders (user_id, order_status);
+
+CREATE INDEX idx_order_item_product_id ON order_items (product_id);
@@ -0,0 +1,4 @@
+-- the card numbers stay in the vault, they are not copied back
+ALTER TABLE payment_methods ALTER COLUMN card_last4 SET DEFAULT '';
+ALTER TABLE payment_methods ALTER COLUMN card_token SET DEFAULT '';
+ALTER TABLE payment_methods ADD COLUMN card_number VARCHAR(19);
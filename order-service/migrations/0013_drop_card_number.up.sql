@@ -0,0 +1,13 @@
+-- Card numbers now only live in the card vault. Refuse to drop them while a
+-- payment method still has its number here and not in the vault.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM payment_methods WHERE card_number IS NOT NULL AND card_token = '') THEN
+        RAISE EXCEPTION 'payment_methods still holds card numbers, move them to the vault with tokenize-cards first';
+    END IF;
+END
+$$;
+
+ALTER TABLE payment_methods DROP COLUMN card_number;
+ALTER TABLE payment_methods ALTER COLUMN card_token DROP DEFAULT;
+ALTER TABLE payment_methods ALTER COLUMN card_last4 DROP DEFAULT;
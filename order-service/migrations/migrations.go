@@ -0,0 +1,43 @@
+// Package migrations embeds the versioned schema migrations, applied with
+// the migrate command.
+//
+// Each version is a pair of files, NNNN_name.up.sql and NNNN_name.down.sql,
+// numbered in the order they apply. An applied migration must never be
+// edited: its checksum is recorded and the runner refuses to go on when it
+// changes, add a new version instead.
+//
+// The sqlite directory holds the same versions translated for SQLite, every
+// new version is added to both.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// SQLite is FS translated for SQLite.
+var SQLite = mustSub(sqliteFS, "sqlite")
+
+// For returns the migrations written for dialect.
+func For(dialect database.Dialect) fs.FS {
+	if dialect == database.SQLite {
+		return SQLite
+	}
+	return FS
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,134 @@
+-- 0001_initial_schema translated for SQLite, see migrations.SQLite.
+--
+-- Times are stored as text in the format strftime('%Y-%m-%dT%H:%M:%SZ')
+-- returns, the one database.Conn binds times in, so they compare in order
+-- with each other and with the cursors of the listings.
+
+-- Create Users table
+CREATE TABLE users (
+    user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(50) UNIQUE NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    email VARCHAR(100) UNIQUE NOT NULL,
+    first_name VARCHAR(50),
+    last_name VARCHAR(50),
+    phone_number VARCHAR(20),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX idx_user_email ON users (email);
+
+-- Create Addresses table
+CREATE TABLE addresses (
+    address_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE,
+    street_address VARCHAR(255) NOT NULL,
+    city VARCHAR(100) NOT NULL,
+    state VARCHAR(50),
+    postal_code VARCHAR(20) NOT NULL,
+    country VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX idx_address_user_id ON addresses (user_id);
+
+-- Create Payment Methods table
+CREATE TABLE payment_methods (
+    payment_method_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE,
+    payment_type VARCHAR(50) NOT NULL,
+    card_number VARCHAR(16),
+    expiration_date DATE,
+    card_holder_name VARCHAR(100),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX idx_payment_method_user_id ON payment_methods (user_id);
+
+-- expiration dates are stored as the midnight they start at, like postgres
+-- returns them, for the listings sorted by them to page through ties
+CREATE TRIGGER payment_methods_expiration_date_insert
+AFTER INSERT ON payment_methods WHEN length(NEW.expiration_date) = 10
+BEGIN
+    UPDATE payment_methods SET expiration_date = NEW.expiration_date || 'T00:00:00Z'
+    WHERE payment_method_id = NEW.payment_method_id;
+END;
+
+CREATE TRIGGER payment_methods_expiration_date_update
+AFTER UPDATE OF expiration_date ON payment_methods WHEN length(NEW.expiration_date) = 10
+BEGIN
+    UPDATE payment_methods SET expiration_date = NEW.expiration_date || 'T00:00:00Z'
+    WHERE payment_method_id = NEW.payment_method_id;
+END;
+
+-- Create Categories table
+CREATE TABLE categories (
+    category_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category_name VARCHAR(100) UNIQUE NOT NULL
+);
+
+-- Create Products table
+CREATE TABLE products (
+    product_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category_id INTEGER REFERENCES categories(category_id) ON DELETE CASCADE,
+    product_name VARCHAR(255) NOT NULL,
+    description TEXT,
+    price INT NOT NULL,
+    stock_quantity INTEGER NOT NULL
+);
+
+-- Create Reviews table
+CREATE TABLE reviews (
+    review_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER REFERENCES products(product_id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE,
+    rating INTEGER CHECK (rating >= 1 AND rating <= 5),
+    review_text TEXT,
+    review_date TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX idx_review_product_id ON reviews (product_id);
+CREATE INDEX idx_review_user_id ON reviews (user_id);
+
+-- Create Shopping Carts table
+CREATE TABLE shopping_carts (
+    cart_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_cart_user_id ON shopping_carts (user_id);
+
+-- Create Cart Items table
+CREATE TABLE cart_items (
+    cart_item_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    cart_id INTEGER REFERENCES shopping_carts(cart_id),
+    product_id INTEGER REFERENCES products(product_id),
+    quantity INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX idx_cart_item_cart_id ON cart_items (cart_id);
+
+-- Create Orders table
+CREATE TABLE orders (
+    order_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(user_id),
+    order_date TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+    total_amount INT NOT NULL,
+    payment_method_id INTEGER REFERENCES payment_methods(payment_method_id),
+    shipping_address_id INTEGER REFERENCES addresses(address_id),
+    order_status VARCHAR(50) NOT NULL
+);
+
+CREATE INDEX idx_order_user_id ON orders (user_id);
+
+-- Create Order Items table
+CREATE TABLE order_items (
+    order_item_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER REFERENCES orders(order_id),
+    product_id INTEGER REFERENCES products(product_id),
+    quantity INTEGER NOT NULL,
+    price_per_unit INT NOT NULL
+);
+
+CREATE INDEX idx_order_item_order_id ON order_items (order_id);
@@ -0,0 +1,13 @@
+-- Create Impersonation Audit Log table
+CREATE TABLE impersonation_audit_log (
+    audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor_user_id INTEGER REFERENCES users(user_id) ON DELETE SET NULL,
+    user_id INTEGER REFERENCES users(user_id) ON DELETE SET NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    status_code INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+CREATE INDEX idx_impersonation_audit_log_user_id ON impersonation_audit_log (user_id);
+CREATE INDEX idx_impersonation_audit_log_actor_user_id ON impersonation_audit_log (actor_user_id);
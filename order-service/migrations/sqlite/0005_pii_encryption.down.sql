@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_address_pii_key_version;
+ALTER TABLE addresses DROP COLUMN pii_key_version;
+
+DROP INDEX IF EXISTS idx_user_pii_key_version;
+ALTER TABLE users DROP COLUMN pii_key_version;
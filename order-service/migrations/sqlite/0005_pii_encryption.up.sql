@@ -0,0 +1,10 @@
+-- Phone numbers and addresses are stored encrypted, pii_key_version is the
+-- master key they are encrypted with, 0 until the reencrypt command
+-- encrypted the rows stored before
+ALTER TABLE users ADD COLUMN pii_key_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_user_pii_key_version ON users (pii_key_version);
+
+ALTER TABLE addresses ADD COLUMN pii_key_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_address_pii_key_version ON addresses (pii_key_version);
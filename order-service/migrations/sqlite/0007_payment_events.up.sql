@@ -0,0 +1,14 @@
+-- Create Payment Events table, raw provider webhooks kept for deduplication and replay
+CREATE TABLE payment_events (
+    event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    provider VARCHAR(50) NOT NULL,
+    provider_event_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload TEXT NOT NULL,
+    received_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+    processed_at TIMESTAMP,
+    processing_error TEXT NOT NULL DEFAULT '',
+    UNIQUE (provider, provider_event_id)
+);
+
+CREATE INDEX idx_payment_event_received_at ON payment_events (received_at);
@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN refund_status;
+DROP TABLE IF EXISTS refund_items;
+DROP TABLE IF EXISTS refunds;
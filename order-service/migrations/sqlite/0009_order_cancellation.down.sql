@@ -0,0 +1,3 @@
+ALTER TABLE refunds DROP COLUMN cancellation;
+ALTER TABLE orders DROP COLUMN cancelled_at;
+ALTER TABLE orders DROP COLUMN cancellation_reason;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS orders_delivered_at;
+ALTER TABLE orders DROP COLUMN delivered_at;
+
+DROP TABLE IF EXISTS return_items;
+DROP TABLE IF EXISTS returns;
@@ -0,0 +1,22 @@
+-- Create Idempotency Keys table, the response stored for a retried request.
+-- status_code stays 0 while the first request is still running, which holds
+-- the key until locked_until, a retry takes over the key of a request that
+-- never finished once its lease ran out. lease_token tells the request holding
+-- the key apart from one it was taken from, which can no longer store its
+-- response. The headers the handler set are replayed with the response, stored
+-- as JSON.
+CREATE TABLE idempotency_keys (
+    user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    lease_token CHAR(32),
+    response_headers TEXT NOT NULL DEFAULT '{}',
+    response_body BLOB,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_order_item_product_id;
+
+DROP INDEX IF EXISTS idx_order_user_status;
+DROP INDEX IF EXISTS idx_order_user_amount;
+DROP INDEX IF EXISTS idx_order_user_date;
+CREATE INDEX idx_order_user_id ON orders (user_id);
@@ -0,0 +1,7 @@
+-- order history is listed per user by date or amount, optionally by status
+DROP INDEX idx_order_user_id;
+CREATE INDEX idx_order_user_date ON orders (user_id, order_date DESC, order_id DESC);
+CREATE INDEX idx_order_user_amount ON orders (user_id, total_amount, order_id);
+CREATE INDEX idx_order_user_status ON orders (user_id, order_status);
+
+CREATE INDEX idx_order_item_product_id ON order_items (product_id);
@@ -0,0 +1,2 @@
+-- the card numbers stay in the vault, they are not copied back
+ALTER TABLE payment_methods ADD COLUMN card_number VARCHAR(19);
@@ -0,0 +1,11 @@
+-- Card numbers now only live in the card vault. Refuse to drop them while a
+-- payment method still has its number here and not in the vault, SQLite only
+-- raises errors in triggers so the count fails a check constraint instead.
+CREATE TEMP TABLE card_numbers_left (
+    count INTEGER CONSTRAINT move_them_to_the_vault_with_tokenize_cards_first CHECK (count = 0)
+);
+INSERT INTO card_numbers_left
+SELECT COUNT(*) FROM payment_methods WHERE card_number IS NOT NULL AND card_token = '';
+DROP TABLE card_numbers_left;
+
+ALTER TABLE payment_methods DROP COLUMN card_number;
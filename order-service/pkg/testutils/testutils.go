@@ -10,6 +10,10 @@ import (
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/mathesukkj/goecommerce/order-service/internal/database"
+	"github.com/mathesukkj/goecommerce/order-service/internal/migrate"
+	"github.com/mathesukkj/goecommerce/order-service/migrations"
 )
 
 func NewPostgresContainerDB() (*postgres.PostgresContainer, *sqlx.DB) {
@@ -20,7 +24,6 @@ func NewPostgresContainerDB() (*postgres.PostgresContainer, *sqlx.DB) {
 	ctx := context.Background()
 	pgContainer, err := postgres.Run(ctx,
 		"docker.io/postgres:16-alpine",
-		postgres.WithInitScripts("../../../init.sql"),
 		postgres.WithDatabase(dbName),
 		postgres.WithUsername(dbUser),
 		postgres.WithPassword(dbPassword),
@@ -39,5 +42,33 @@ func NewPostgresContainerDB() (*postgres.PostgresContainer, *sqlx.DB) {
 	}
 
 	db := sqlx.MustOpen("postgres", connStr)
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		log.Fatalf("failed to load migrations: %s", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		log.Fatalf("failed to apply migrations: %s", err)
+	}
+
 	return pgContainer, db
 }
+
+// NewSQLiteDB creates a SQLite database at path with the schema migrated, for
+// the tests that need a real database but no Docker.
+func NewSQLiteDB(path string) *sqlx.DB {
+	db, err := database.Open("sqlite:" + path)
+	if err != nil {
+		log.Fatalf("failed to open database: %s", err)
+	}
+
+	migrator, err := migrate.New(db, migrations.SQLite)
+	if err != nil {
+		log.Fatalf("failed to load migrations: %s", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		log.Fatalf("failed to apply migrations: %s", err)
+	}
+
+	return db
+}